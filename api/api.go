@@ -0,0 +1,11 @@
+// Package api встраивает OpenAPI-спецификацию в бинарники: по ней сервисы
+// проверяют запросы, а тесты — соответствие обработчиков документации.
+package api
+
+import _ "embed"
+
+//go:embed swagger.yaml
+var swagger []byte
+
+// Swagger — содержимое api/swagger.yaml.
+func Swagger() []byte { return swagger }
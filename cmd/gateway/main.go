@@ -1,20 +1,262 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	_ "github.com/lib/pq"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/httpx"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/common/migrate"
+	"HW4/internal/gateway/apikey"
+	"HW4/internal/gateway/auth"
 	"HW4/internal/gateway/config"
 	"HW4/internal/gateway/handler"
+	"HW4/internal/gateway/ratelimit"
+	"HW4/internal/gateway/repository"
+	"HW4/internal/gateway/repository/memstore"
+	"HW4/internal/gateway/upstream"
+	"HW4/migrations"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cfg := config.MustLoad()
+
+	upstreams := upstream.NewRegistry(cfg.Health)
+	specs, err := cfg.Upstreams()
+	if err == nil {
+		err = upstreams.Apply(specs)
+	}
+	if err != nil {
+		log.Fatalf("[gateway] upstreams: %v", err)
+	}
+	logUpstreams(upstreams)
+
+	store, db := mustKeyStore(ctx, cfg)
+	keyAuth := apikey.NewAuthenticator(store, apikey.Options{
+		CacheTTL:      cfg.APIKeyCacheTTL,
+		FlushInterval: cfg.APIKeyFlushInterval,
+	})
+
+	routeSpecs, err := cfg.Routes()
+	if err != nil {
+		log.Fatalf("[gateway] routes: %v", err)
+	}
+	rt, err := handler.NewRouter(upstreams, handler.Options{
+		Auth:       auth.NewAuthenticator(mustVerifier(cfg), keyAuth, cfg.AdminToken),
+		Keys:       apikey.NewManager(store, keyAuth),
+		Limiter:    newLimiter(cfg),
+		Routes:     routeSpecs,
+		Proxies:    cfg.Proxies(),
+		Proxy:      cfg.DefaultProxy,
+		Versioning: apiversion.Options{Sunset: cfg.LegacySunset},
+	})
+	if err != nil {
+		log.Fatalf("[gateway] routes: %v", err)
+	}
+	logRoutes(rt)
 	mux := http.NewServeMux()
-	rt := handler.NewRouter(cfg.OrdersBaseURL, cfg.PaymentsBaseURL)
 	rt.Register(mux)
-	srv := &http.Server{Addr: ":8080", Handler: mux, ReadHeaderTimeout: 5 * time.Second}
-	log.Println("[gateway] up on :8080")
-	log.Fatal(srv.ListenAndServe())
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	sup := lifecycle.NewSupervisor("gateway", cfg.WorkerRestartDelay)
+	sup.Go(workersCtx, "api-key-usage", keyAuth)
+	sup.Go(workersCtx, "upstream-health", upstreams)
+	sup.Go(workersCtx, "sighup-reload", lifecycle.WorkerFunc(func(ctx context.Context) {
+		reloadOnSIGHUP(ctx, cfg, upstreams, rt)
+	}))
+
+	srv := &http.Server{Addr: ":8080", Handler: httpx.RequestID(mux), ReadHeaderTimeout: 5 * time.Second}
+
+	srvErr := make(chan error, 1)
+	go func() {
+		log.Println("[gateway] up on :8080")
+		srvErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("[gateway] shutdown signal received")
+	case err := <-srvErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[gateway] http server error: %v", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[gateway] http shutdown: %v", err)
+	}
+	// последний сброс last_used_at происходит при остановке воркера
+	stopWorkers()
+	if err := sup.Wait(shutdownCtx); err != nil {
+		// сброс last_used_at отменён, но воркер ещё может держать БД
+		log.Printf("[gateway] workers did not stop in %s: %v; exiting without closing connections", cfg.ShutdownTimeout, err)
+		return
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			log.Printf("[gateway] db close: %v", err)
+		}
+	}
+	log.Println("[gateway] stopped")
+}
+
+// reloadOnSIGHUP перечитывает пулы upstream и таблицу маршрутов по SIGHUP.
+// Ошибка в конфигурации не применяется частично: остаётся прежняя. Пулы
+// применяются первыми, чтобы новые маршруты могли ссылаться на новые upstream'ы.
+func reloadOnSIGHUP(ctx context.Context, cfg *config.Config, upstreams *upstream.Registry, rt *handler.Router) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		specs, err := cfg.Upstreams()
+		if err == nil {
+			err = upstreams.Apply(specs)
+		}
+		if err != nil {
+			log.Printf("[gateway] reload upstreams: %v", err)
+			continue
+		}
+		log.Println("[gateway] upstreams reloaded")
+		logUpstreams(upstreams)
+
+		routeSpecs, err := cfg.Routes()
+		if err == nil {
+			err = rt.SetRoutes(routeSpecs)
+		}
+		if err != nil {
+			log.Printf("[gateway] reload routes: %v", err)
+			continue
+		}
+		log.Println("[gateway] routes reloaded")
+		logRoutes(rt)
+	}
+}
+
+func logUpstreams(upstreams *upstream.Registry) {
+	for _, name := range upstreams.Names() {
+		pool := upstreams.Get(name)
+		var urls []string
+		for _, in := range pool.Instances() {
+			urls = append(urls, in.URL.String())
+		}
+		log.Printf("[gateway] upstream %s (%s): %s", name, pool.Policy(), strings.Join(urls, ", "))
+	}
+}
+
+func logRoutes(rt *handler.Router) {
+	for _, r := range rt.Routes().Routes() {
+		path := r.Prefix
+		if path == "" {
+			path = r.Pattern
+		}
+		methods := "*"
+		if len(r.Methods) > 0 {
+			methods = strings.Join(r.Methods, ",")
+		}
+		log.Printf("[gateway] route %s: %s %s -> %s", r.Name, methods, path, r.Upstream)
+	}
+}
+
+func mustVerifier(cfg *config.Config) *auth.Verifier {
+	if cfg.JWKSFile == "" {
+		log.Println("[gateway] GATEWAY_JWKS_FILE is not set: authentication is DISABLED")
+		return nil
+	}
+	keys, err := auth.LoadJWKS(cfg.JWKSFile)
+	if err != nil {
+		log.Fatalf("[gateway] load jwks: %v", err)
+	}
+	log.Printf("[gateway] loaded %d jwt key(s) from %s", len(keys), cfg.JWKSFile)
+	return auth.NewVerifier(keys, auth.Options{
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Leeway:   30 * time.Second,
+	})
+}
+
+func newLimiter(cfg *config.Config) *ratelimit.Limiter {
+	if len(cfg.RateLimits) == 0 {
+		log.Println("[gateway] rate limiting is DISABLED")
+		return nil
+	}
+	log.Printf("[gateway] rate limits: %s", ratelimit.FormatLimits(cfg.RateLimits))
+	return ratelimit.New(ratelimit.NewMemory(), cfg.RateLimits, auth.ClientKey)
+}
+
+// mustKeyStore открывает хранилище API-ключей. Без GATEWAY_DB_DSN ключи
+// живут в памяти и пропадают при рестарте.
+func mustKeyStore(ctx context.Context, cfg *config.Config) (apikey.Store, *sql.DB) {
+	if cfg.DBDSN == "" {
+		log.Println("[gateway] GATEWAY_DB_DSN is not set: api keys are kept in memory")
+		return memstore.New(), nil
+	}
+	db, err := sql.Open("postgres", cfg.DBDSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.DBAutoMigrate {
+		runner, err := migrate.New(db, migrations.Gateway(), "gateway")
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatalf("[gateway] auto-migrate: %v", err)
+		}
+		log.Printf("[gateway] auto-migrate: applied %d migration(s)", n)
+	}
+	return repository.NewAPIKeysRepo(db), db
+}
+
+func runMigrate(args []string) int {
+	dsn := strings.TrimSpace(os.Getenv("GATEWAY_DB_DSN"))
+	if dsn == "" {
+		log.Print("[gateway] GATEWAY_DB_DSN is required for migrate")
+		return 2
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.Close()
+
+	runner, err := migrate.New(db, migrations.Gateway(), "gateway")
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := migrate.RunCommand(context.Background(), runner, args, os.Stdout); err != nil {
+		log.Printf("[gateway] migrate: %v", err)
+		return 1
+	}
+	return 0
 }
@@ -3,91 +3,181 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
-	"time"
 
 	_ "github.com/lib/pq"
 
+	apidoc "HW4/api"
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
 	"HW4/internal/common/kafka"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/common/migrate"
+	"HW4/internal/common/openapi"
+	"HW4/internal/orders/config"
 	"HW4/internal/orders/handler"
 	"HW4/internal/orders/repository"
 	"HW4/internal/orders/service"
 	"HW4/internal/orders/worker"
+	"HW4/migrations"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	db, err := sql.Open("postgres", mustEnv("ORDERS_DB_DSN"))
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("[orders] invalid config:\n%v", err)
+	}
+
+	db, err := openDB(cfg.DB)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
 
-	brokers := kafka.SplitBrokers(mustEnv("KAFKA_BROKERS"))
+	if cfg.DB.AutoMigrate {
+		runner, err := migrate.New(db, migrations.Orders(), "orders")
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatalf("[orders] auto-migrate: %v", err)
+		}
+		log.Printf("[orders] auto-migrate: applied %d migration(s)", n)
+	}
 
-	producer := kafka.NewProducer(brokers)
-	defer producer.Close()
-	go worker.NewOutboxPublisher(db, producer).Run(ctx)
+	producer := kafka.NewProducer(cfg.Kafka.Producer())
 
-	resTopic := mustEnv("KAFKA_TOPIC_PAYMENT_RESULT")
-	group := mustEnv("ORDERS_CONSUMER_GROUP")
-	reqTopic := mustEnv("KAFKA_TOPIC_PAYMENT_REQUESTED")
+	log.Printf("[orders] starting consumer topic=%s group=%s brokers=%v",
+		cfg.Kafka.TopicPaymentResult, cfg.Kafka.ConsumerGroup, cfg.Kafka.Brokers)
+	resConsumer := kafka.NewConsumer(cfg.Kafka.Consumer(cfg.Kafka.TopicPaymentResult))
 
-	log.Printf("[orders] starting consumer topic=%s group=%s brokers=%v", resTopic, group, brokers)
+	// Воркеры живут в своём контексте: его отменяем только после остановки HTTP.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-	resConsumer := kafka.NewConsumer(brokers, resTopic, group)
-	defer resConsumer.Close()
+	sup := lifecycle.NewSupervisor("orders", cfg.WorkerRestartDelay)
+	sup.Go(workersCtx, "outbox-publisher", worker.NewOutboxPublisher(repository.NewOutboxRepo(db), producer, cfg.Outbox))
 
 	statusRepo := repository.NewOrdersStatusRepo(db)
-	go worker.NewPaymentResultConsumer(resConsumer, statusRepo).Run(ctx)
+	sup.Go(workersCtx, "payment-result-consumer", worker.NewPaymentResultConsumer(resConsumer, statusRepo))
 
-	ordersRepo := repository.NewOrdersRepo(db, reqTopic)
+	ordersRepo := repository.NewOrdersRepo(db, cfg.Kafka.TopicPaymentRequested)
 	ordersSvc := service.New(ordersRepo)
 	h := handler.New(ordersSvc)
 
+	api := http.NewServeMux()
+	h.Register(api)
+
+	spec, err := openapi.Parse(apidoc.Swagger())
+	if err != nil {
+		log.Fatalf("[orders] api spec: %v", err)
+	}
+	validation := openapi.Options{Responses: cfg.HTTP.ValidateResponses}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
-	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			h.CreateOrder(w, r)
-			return
-		}
-		if r.Method == http.MethodGet {
-			h.ListOrders(w, r)
-			return
-		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})
-	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.GetOrder(w, r)
-			return
+	mux.Handle("/", authn.Middleware(cfg.Auth.Required, apiversion.Middleware(cfg.HTTP.Versioning(), openapi.Middleware(spec, validation, api))))
+
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           httpx.RequestID(mux),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	srvErr := make(chan error, 1)
+	go func() {
+		log.Printf("[orders] up on %s", cfg.HTTP.Addr)
+		srvErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("[orders] shutdown signal received")
+	case err := <-srvErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[orders] http server error: %v", err)
 		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})
+	}
 
-	srv := &http.Server{Addr: ":8080", Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-	go func() { <-ctx.Done(); _ = srv.Shutdown(context.Background()) }()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[orders] http shutdown: %v", err)
+	}
 
-	log.Println("[orders] up on :8080")
-	log.Fatal(srv.ListenAndServe())
+	stopWorkers()
+	if err := sup.Wait(shutdownCtx); err != nil {
+		// начатая работа отменена, но воркеры ещё могут держать consumer'ы,
+		// producer и БД: закрыть их сейчас — значит выдернуть из-под них
+		log.Printf("[orders] workers did not stop in %s: %v; exiting without closing connections", cfg.ShutdownTimeout, err)
+		return
+	}
+
+	if err := resConsumer.Close(); err != nil {
+		log.Printf("[orders] consumer close: %v", err)
+	}
+	if err := producer.Close(); err != nil {
+		log.Printf("[orders] producer close: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("[orders] db close: %v", err)
+	}
+	log.Println("[orders] stopped")
 }
 
-func mustEnv(k string) string {
-	v := strings.TrimSpace(os.Getenv(k))
-	if v == "" {
-		log.Fatalf("missing env %s", k)
+func runMigrate(args []string) int {
+	dbCfg, err := config.LoadDB()
+	if err != nil {
+		log.Printf("[orders] invalid config:\n%v", err)
+		return 2
+	}
+	db, err := openDB(dbCfg)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.Close()
+
+	runner, err := migrate.New(db, migrations.Orders(), "orders")
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := migrate.RunCommand(context.Background(), runner, args, os.Stdout); err != nil {
+		log.Printf("[orders] migrate: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func openDB(cfg config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
 	}
-	return v
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
 }
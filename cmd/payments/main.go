@@ -3,91 +3,202 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	_ "github.com/lib/pq"
 
+	apidoc "HW4/api"
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
 	"HW4/internal/common/kafka"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/common/migrate"
+	"HW4/internal/common/openapi"
+	"HW4/internal/payments/config"
 	"HW4/internal/payments/handler"
+	"HW4/internal/payments/payout"
 	"HW4/internal/payments/repository"
 	"HW4/internal/payments/service"
 	"HW4/internal/payments/worker"
+	"HW4/migrations"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	db, err := sql.Open("postgres", mustEnv("PAYMENTS_DB_DSN"))
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("[payments] invalid config:\n%v", err)
+	}
+
+	db, err := openDB(cfg.DB)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
 
-	accRepo := repository.NewAccountsRepo(db)
+	if cfg.DB.AutoMigrate {
+		runner, err := migrate.New(db, migrations.Payments(), "payments")
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatalf("[payments] auto-migrate: %v", err)
+		}
+		log.Printf("[payments] auto-migrate: applied %d migration(s)", n)
+	}
+
+	accRepo := repository.NewAccountsRepo(db, cfg.Kafka.TopicPayoutRequested)
+	accRepo.SetPayoutRetry(repository.PayoutRetry{
+		Backoff:     cfg.Payout.RetryAfter,
+		MaxBackoff:  cfg.Payout.RetryMaxBackoff,
+		MaxAttempts: cfg.Payout.RetryMaxAttempts,
+	})
 	paySvc := service.New(accRepo)
 	h := handler.New(paySvc)
 
+	api := http.NewServeMux()
+	h.Register(api)
+
+	spec, err := openapi.Parse(apidoc.Swagger())
+	if err != nil {
+		log.Fatalf("[payments] api spec: %v", err)
+	}
+	validation := openapi.Options{Responses: cfg.HTTP.ValidateResponses}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
-	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			h.CreateAccount(w, r)
-			return
-		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})
-	mux.HandleFunc("/accounts/topup", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			h.TopUp(w, r)
-			return
-		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})
-	mux.HandleFunc("/accounts/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.GetBalance(w, r)
-			return
-		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})
+	mux.Handle("/", authn.Middleware(cfg.Auth.Required, apiversion.Middleware(cfg.HTTP.Versioning(), openapi.Middleware(spec, validation, api))))
+
+	producer := kafka.NewProducer(cfg.Kafka.Producer())
+	consumer := kafka.NewConsumer(cfg.Kafka.Consumer(cfg.Kafka.TopicPaymentRequested))
+	retryConsumer := kafka.NewConsumer(cfg.Kafka.Consumer(cfg.Retry.Topic))
+	payoutConsumer := kafka.NewConsumer(cfg.Kafka.Consumer(cfg.Kafka.TopicPayoutRequested))
+	processor := repository.NewPaymentProcessor(db, cfg.Kafka.TopicPaymentResult, cfg.Holds.TTL)
+	// таблица курсов уже проверена в config.Validate
+	if rates, _ := cfg.FX.Table(); rates != nil {
+		processor.SetFX(rates, cfg.FX.Rounding)
+		log.Printf("[payments] fx: %d rate(s), rounding %s", rates.Len(), cfg.FX.Rounding)
+	}
 
-	brokers := kafka.SplitBrokers(mustEnv("KAFKA_BROKERS"))
-	producer := kafka.NewProducer(brokers)
-	defer producer.Close()
+	// Воркеры живут в своём контексте: его отменяем только после остановки HTTP.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	sup := lifecycle.NewSupervisor("payments", cfg.WorkerRestartDelay)
+	sup.Go(workersCtx, "outbox-publisher", worker.NewOutboxPublisher(repository.NewOutboxRepo(db), producer, cfg.Outbox))
+	sup.Go(workersCtx, "payment-requested-consumer", worker.NewPaymentRequestedConsumer(consumer, processor, producer, cfg.Retry))
+	// повторные попытки читаются из retry-топика тем же обработчиком после паузы retry.backoff
+	sup.Go(workersCtx, "payment-retry-consumer", worker.NewPaymentRequestedConsumer(retryConsumer, processor, producer, cfg.Retry))
+	sup.Go(workersCtx, "hold-expirer", worker.NewHoldExpirer(processor, cfg.Holds))
+	payoutProvider := payout.NewFake(cfg.Payout.FakeMode, cfg.Payout.FakeDelay)
+	sup.Go(workersCtx, "payout-consumer", worker.NewPayoutConsumer(payoutConsumer, payoutProvider, accRepo, cfg.Payout))
+	sup.Go(workersCtx, "payout-retrier", worker.NewPayoutRetrier(accRepo, cfg.Payout))
+
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           httpx.RequestID(mux),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
 
-	go worker.NewOutboxPublisher(db, producer).Run(ctx)
+	srvErr := make(chan error, 1)
+	go func() {
+		log.Printf("[payments] up on %s", cfg.HTTP.Addr)
+		srvErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("[payments] shutdown signal received")
+	case err := <-srvErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[payments] http server error: %v", err)
+		}
+	}
 
-	reqTopic := mustEnv("KAFKA_TOPIC_PAYMENT_REQUESTED")
-	group := mustEnv("PAYMENTS_CONSUMER_GROUP")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-	consumer := kafka.NewConsumer(brokers, reqTopic, group)
-	defer consumer.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[payments] http shutdown: %v", err)
+	}
 
-	resultTopic := mustEnv("KAFKA_TOPIC_PAYMENT_RESULT")
-	processor := repository.NewPaymentProcessor(db, resultTopic)
-	go worker.NewPaymentRequestedConsumer(consumer, processor, producer).Run(ctx)
+	stopWorkers()
+	if err := sup.Wait(shutdownCtx); err != nil {
+		// начатая работа отменена, но воркеры ещё могут держать consumer'ы,
+		// producer и БД: закрыть их сейчас — значит выдернуть из-под них
+		log.Printf("[payments] workers did not stop in %s: %v; exiting without closing connections", cfg.ShutdownTimeout, err)
+		return
+	}
 
-	srv := &http.Server{Addr: ":8080", Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	if err := consumer.Close(); err != nil {
+		log.Printf("[payments] consumer close: %v", err)
+	}
+	if err := retryConsumer.Close(); err != nil {
+		log.Printf("[payments] retry consumer close: %v", err)
+	}
+	if err := payoutConsumer.Close(); err != nil {
+		log.Printf("[payments] payout consumer close: %v", err)
+	}
+	if err := producer.Close(); err != nil {
+		log.Printf("[payments] producer close: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("[payments] db close: %v", err)
+	}
+	log.Println("[payments] stopped")
+}
 
-	go func() { <-ctx.Done(); _ = srv.Shutdown(context.Background()) }()
+func runMigrate(args []string) int {
+	dbCfg, err := config.LoadDB()
+	if err != nil {
+		log.Printf("[payments] invalid config:\n%v", err)
+		return 2
+	}
+	db, err := openDB(dbCfg)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.Close()
 
-	log.Println("[payments] up on :8080")
-	log.Fatal(srv.ListenAndServe())
+	runner, err := migrate.New(db, migrations.Payments(), "payments")
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := migrate.RunCommand(context.Background(), runner, args, os.Stdout); err != nil {
+		log.Printf("[payments] migrate: %v", err)
+		return 1
+	}
+	return 0
 }
 
-func mustEnv(k string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		log.Fatalf("missing env %s", k)
+func openDB(cfg config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
 	}
-	return v
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
 }
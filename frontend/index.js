@@ -41,8 +41,9 @@ function proxy(basePath) {
     };
 }
 
-app.all('/api/orders*', proxy('/orders'));
-app.all('/api/accounts*', proxy('/accounts'));
+app.all('/api/orders*', proxy('/v1/orders'));
+app.all('/api/accounts*', proxy('/v1/accounts'));
+app.get('/api/users*', proxy('/v1/users'));
 
 app.all('/api/health', proxy('/health'));
 app.get('/health', (req, res) => res.status(200).send('ok'));
@@ -7,6 +7,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/segmentio/kafka-go v0.4.49
 	github.com/swaggo/swag v1.16.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,125 @@
+// Package apiversion — единственное место, где определяется версия API
+// запроса. Версия берётся из префикса пути (/v1/orders), затем из заголовка
+// API-Version. Запрос без версии — устаревший алиас текущей версии: он
+// обслуживается как раньше, но ответ несёт Deprecation и Sunset.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"HW4/internal/common/httpx"
+)
+
+const (
+	// Header — версия в запросе (согласование без префикса) и в ответе.
+	Header = "API-Version"
+
+	V1 = "v1"
+	// Latest — версия, которой обслуживаются маршруты без префикса.
+	Latest = V1
+)
+
+var supported = map[string]bool{V1: true}
+
+// Маршруты без версии объявлены устаревшими с DeprecatedSince и по
+// умолчанию будут отключены после DefaultSunset.
+var (
+	DeprecatedSince = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	DefaultSunset   = time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// Supported сообщает, обслуживается ли версия v.
+func Supported(v string) bool { return supported[v] }
+
+type ctxKey struct{}
+
+// FromContext — версия, выбранная Middleware; без неё — Latest.
+func FromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKey{}).(string); ok {
+		return v
+	}
+	return Latest
+}
+
+// Options настраивают объявление об устаревании маршрутов без версии.
+type Options struct {
+	// Sunset — дата отключения маршрутов без версии. Нулевая — DefaultSunset.
+	Sunset time.Time
+}
+
+// ParseSunset разбирает дату в виде 2027-06-30 или RFC 3339. Пустая строка — нулевое время.
+func ParseSunset(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad sunset date %q: expected like 2027-06-30", raw)
+	}
+	return t, nil
+}
+
+// Middleware определяет версию запроса, срезает префикс версии с пути и
+// кладёт версию в контекст и в заголовок API-Version запроса: так её видят
+// обработчики и сервисы за прокси. Неизвестная версия отклоняется.
+func Middleware(opts Options, next http.Handler) http.Handler {
+	sunset := opts.Sunset
+	if sunset.IsZero() {
+		sunset = DefaultSunset
+	}
+	deprecation := "@" + strconv.FormatInt(DeprecatedSince.Unix(), 10)
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, rest, ok := splitVersion(r.URL.Path)
+		switch {
+		case ok:
+			if !supported[version] {
+				httpx.Error(w, http.StatusNotFound, httpx.CodeUnsupportedAPIVersion, "api version "+version+" is not supported")
+				return
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = rest
+			r.URL.RawPath = ""
+			w.Header().Set(Header, version)
+		case r.Header.Get(Header) != "":
+			// версию согласовал клиент или gateway, ответ о ней уже знает
+			version = strings.ToLower(strings.TrimSpace(r.Header.Get(Header)))
+			if !supported[version] {
+				httpx.Error(w, http.StatusBadRequest, httpx.CodeUnsupportedAPIVersion, "api version "+version+" is not supported")
+				return
+			}
+		default:
+			version = Latest
+			h := w.Header()
+			h.Set(Header, version)
+			h.Set("Deprecation", deprecation)
+			h.Set("Sunset", sunsetHeader)
+			h.Set("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, version, r.URL.Path))
+		}
+
+		r.Header.Set(Header, version)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, version)))
+	})
+}
+
+// splitVersion отделяет от пути первый сегмент вида vN.
+func splitVersion(path string) (version, rest string, ok bool) {
+	seg, tail, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if len(seg) < 2 || seg[0] != 'v' {
+		return "", path, false
+	}
+	if _, err := strconv.Atoi(seg[1:]); err != nil {
+		return "", path, false
+	}
+	return seg, "/" + tail, true
+}
@@ -0,0 +1,126 @@
+// Package authn переносит личность пользователя от gateway к сервисам.
+// Gateway проверяет токен и выставляет доверенные заголовки; сервисы читают
+// их в контекст запроса и ограничивают доступ к чужим user_id.
+package authn
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"HW4/internal/common/httpx"
+)
+
+const (
+	HeaderSubject = "X-Auth-Subject"
+	HeaderRoles   = "X-Auth-Roles"
+
+	RoleAdmin = "admin"
+)
+
+type Identity struct {
+	Subject string
+	Roles   []string
+}
+
+func (id Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (id Identity) IsAdmin() bool { return id.HasRole(RoleAdmin) }
+
+type ctxKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// CanAccess сообщает, может ли текущий пользователь работать с данными userID.
+// Запрос без личности (авторизация на сервисе не обязательна) пропускается.
+func CanAccess(ctx context.Context, userID string) bool {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return true
+	}
+	return id.IsAdmin() || strings.EqualFold(id.Subject, userID)
+}
+
+// CanAdminister сообщает, может ли текущий пользователь выполнять админские
+// операции. В отличие от CanAccess, запрос без личности не пропускается даже
+// при необязательной авторизации: админские операции требуют роли admin.
+func CanAdminister(ctx context.Context) bool {
+	id, ok := FromContext(ctx)
+	return ok && id.IsAdmin()
+}
+
+// ErrAuthRequired — ответ на админскую операцию без личности.
+var ErrAuthRequired = httpx.NewError(http.StatusUnauthorized, httpx.CodeUnauthorized, "authentication required")
+
+// RequireAdmin проверяет доступ к админской операции: nil для админа,
+// ErrAuthRequired для запроса без личности, forbidden — для остальных.
+func RequireAdmin(ctx context.Context, forbidden error) error {
+	if _, ok := FromContext(ctx); !ok {
+		return ErrAuthRequired
+	}
+	if !CanAdminister(ctx) {
+		return forbidden
+	}
+	return nil
+}
+
+// SetHeaders записывает личность в доверенные заголовки исходящего запроса.
+func SetHeaders(h http.Header, id Identity) {
+	h.Set(HeaderSubject, id.Subject)
+	if len(id.Roles) > 0 {
+		h.Set(HeaderRoles, strings.Join(id.Roles, ","))
+	} else {
+		h.Del(HeaderRoles)
+	}
+}
+
+// StripHeaders удаляет доверенные заголовки, пришедшие от клиента.
+func StripHeaders(h http.Header) {
+	h.Del(HeaderSubject)
+	h.Del(HeaderRoles)
+}
+
+func fromHeaders(h http.Header) (Identity, bool) {
+	sub := strings.TrimSpace(h.Get(HeaderSubject))
+	if sub == "" {
+		return Identity{}, false
+	}
+	id := Identity{Subject: sub}
+	for _, r := range strings.Split(h.Get(HeaderRoles), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			id.Roles = append(id.Roles, r)
+		}
+	}
+	return id, true
+}
+
+// Middleware кладёт личность из заголовков gateway в контекст запроса.
+// При required=true запрос без личности отклоняется с 401.
+func Middleware(required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := fromHeaders(r.Header)
+		if !ok {
+			if required {
+				httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
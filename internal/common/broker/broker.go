@@ -0,0 +1,38 @@
+// Package broker описывает транспорт сообщений, от которого зависят воркеры.
+// Реализации: kafka (продакшн) и broker/membroker (in-memory для тестов).
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Time      time.Time
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, topic string, key, value []byte) error
+	PublishWithHeaders(ctx context.Context, topic string, key, value []byte, headers []Header) error
+	Close() error
+}
+
+// Subscriber читает один топик в рамках consumer group.
+// Сообщение считается обработанным только после Commit; незакоммиченные
+// сообщения доставляются повторно после перезапуска или ребалансировки.
+type Subscriber interface {
+	Fetch(ctx context.Context) (Message, error)
+	Commit(ctx context.Context, msg Message) error
+	Close() error
+}
@@ -0,0 +1,303 @@
+// Package membroker — in-memory реализация broker.Publisher/Subscriber для тестов.
+// Повторяет семантику Kafka, на которую опираются воркеры: партиции по ключу,
+// consumer groups с распределением партиций, коммит оффсетов и повторную
+// доставку незакоммиченных сообщений после ребалансировки.
+package membroker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"HW4/internal/common/broker"
+)
+
+var (
+	ErrClosed      = errors.New("membroker: subscriber closed")
+	ErrNotAssigned = errors.New("membroker: partition is not assigned to subscriber")
+)
+
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string]*topic
+	groups     map[groupKey]*group
+	notify     chan struct{}
+	rr         int
+}
+
+type topic struct {
+	parts [][]broker.Message
+}
+
+type groupKey struct {
+	group string
+	topic string
+}
+
+type group struct {
+	committed []int64
+	members   []*Subscriber
+}
+
+var _ broker.Publisher = (*Broker)(nil)
+
+// New создаёт брокер, у которого каждый топик состоит из partitions партиций.
+func New(partitions int) *Broker {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &Broker{
+		partitions: partitions,
+		topics:     map[string]*topic{},
+		groups:     map[groupKey]*group{},
+		notify:     make(chan struct{}),
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, topic string, key, value []byte) error {
+	return b.PublishWithHeaders(ctx, topic, key, value, nil)
+}
+
+func (b *Broker) PublishWithHeaders(ctx context.Context, topicName string, key, value []byte, headers []broker.Header) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topicName)
+	p := b.partitionFor(key)
+	msg := broker.Message{
+		Topic:     topicName,
+		Partition: p,
+		Offset:    int64(len(t.parts[p])),
+		Key:       clone(key),
+		Value:     clone(value),
+		Headers:   cloneHeaders(headers),
+		Time:      time.Now(),
+	}
+	t.parts[p] = append(t.parts[p], msg)
+	b.wakeLocked()
+	return nil
+}
+
+// Close ничего не делает: брокер разделяется между всеми издателями теста.
+func (b *Broker) Close() error { return nil }
+
+// Subscribe подключает нового участника группы groupID к топику.
+// Партиции перераспределяются между всеми участниками группы.
+func (b *Broker) Subscribe(topicName, groupID string) *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topic(topicName)
+	g := b.group(topicName, groupID)
+	s := &Subscriber{b: b, g: g, topic: topicName}
+	g.members = append(g.members, s)
+	b.rebalanceLocked(g)
+	return s
+}
+
+// Messages возвращает все сообщения топика по порядку партиций и оффсетов.
+func (b *Broker) Messages(topicName string) []broker.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topicName]
+	if !ok {
+		return nil
+	}
+	var out []broker.Message
+	for _, part := range t.parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// Lag — число сообщений топика, ещё не закоммиченных группой.
+func (b *Broker) Lag(topicName, groupID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topicName)
+	g := b.group(topicName, groupID)
+	lag := 0
+	for p, part := range t.parts {
+		lag += len(part) - int(g.committed[p])
+	}
+	return lag
+}
+
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{parts: make([][]broker.Message, b.partitions)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *Broker) group(topicName, groupID string) *group {
+	k := groupKey{group: groupID, topic: topicName}
+	g, ok := b.groups[k]
+	if !ok {
+		g = &group{committed: make([]int64, b.partitions)}
+		b.groups[k] = g
+	}
+	return g
+}
+
+func (b *Broker) partitionFor(key []byte) int {
+	if len(key) == 0 {
+		b.rr++
+		return b.rr % b.partitions
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(b.partitions))
+}
+
+// rebalanceLocked раздаёт партиции участникам по кругу. Как и в Kafka, после
+// ребалансировки чтение продолжается с закоммиченных оффсетов, поэтому
+// полученные, но не закоммиченные сообщения будут доставлены ещё раз.
+func (b *Broker) rebalanceLocked(g *group) {
+	for _, m := range g.members {
+		m.positions = map[int]int64{}
+	}
+	if len(g.members) > 0 {
+		for p := 0; p < b.partitions; p++ {
+			m := g.members[p%len(g.members)]
+			m.positions[p] = g.committed[p]
+		}
+	}
+	b.wakeLocked()
+}
+
+func (b *Broker) wakeLocked() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+type Subscriber struct {
+	b         *Broker
+	g         *group
+	topic     string
+	positions map[int]int64
+	next      int
+	closed    bool
+}
+
+var _ broker.Subscriber = (*Subscriber)(nil)
+
+// Fetch блокируется, пока в назначенных партициях не появится сообщение
+// или не будет отменён ctx.
+func (s *Subscriber) Fetch(ctx context.Context) (broker.Message, error) {
+	for {
+		s.b.mu.Lock()
+		if s.closed {
+			s.b.mu.Unlock()
+			return broker.Message{}, ErrClosed
+		}
+		if msg, ok := s.pollLocked(); ok {
+			s.b.mu.Unlock()
+			return msg, nil
+		}
+		wait := s.b.notify
+		s.b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return broker.Message{}, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+func (s *Subscriber) pollLocked() (broker.Message, bool) {
+	owned := make([]int, 0, len(s.positions))
+	for p := range s.positions {
+		owned = append(owned, p)
+	}
+	if len(owned) == 0 {
+		return broker.Message{}, false
+	}
+	sort.Ints(owned)
+
+	t := s.b.topics[s.topic]
+	// обходим партиции по кругу, чтобы одна не забивала остальные
+	for i := 0; i < len(owned); i++ {
+		p := owned[(s.next+i)%len(owned)]
+		pos := s.positions[p]
+		if pos < int64(len(t.parts[p])) {
+			s.positions[p] = pos + 1
+			s.next = (s.next + i + 1) % len(owned)
+			msg := t.parts[p][pos]
+			msg.Headers = cloneHeaders(msg.Headers)
+			return msg, true
+		}
+	}
+	return broker.Message{}, false
+}
+
+func (s *Subscriber) Commit(ctx context.Context, msg broker.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.positions[msg.Partition]; !ok || msg.Topic != s.topic {
+		return ErrNotAssigned
+	}
+	if next := msg.Offset + 1; next > s.g.committed[msg.Partition] {
+		s.g.committed[msg.Partition] = next
+	}
+	return nil
+}
+
+// Close выводит участника из группы; его партиции переходят к остальным.
+func (s *Subscriber) Close() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	members := s.g.members[:0]
+	for _, m := range s.g.members {
+		if m != s {
+			members = append(members, m)
+		}
+	}
+	s.g.members = members
+	s.b.rebalanceLocked(s.g)
+	return nil
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func cloneHeaders(hs []broker.Header) []broker.Header {
+	if hs == nil {
+		return nil
+	}
+	out := make([]broker.Header, len(hs))
+	for i, h := range hs {
+		out[i] = broker.Header{Key: h.Key, Value: clone(h.Value)}
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+package membroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"HW4/internal/common/broker"
+)
+
+func fetch(t *testing.T, s *Subscriber) broker.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := s.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	return msg
+}
+
+func drain(s *Subscriber) []broker.Message {
+	var out []broker.Message
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		msg, err := s.Fetch(ctx)
+		cancel()
+		if err != nil {
+			return out
+		}
+		out = append(out, msg)
+	}
+}
+
+func expectEmpty(t *testing.T, s *Subscriber) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if msg, err := s.Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected no messages, got %q err=%v", msg.Value, err)
+	}
+}
+
+func TestSameKeyKeepsPartitionAndOrder(t *testing.T) {
+	b := New(4)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_ = b.Publish(ctx, "t", []byte("order-1"), []byte(fmt.Sprint(i)))
+	}
+
+	msgs := b.Messages("t")
+	if len(msgs) != 5 {
+		t.Fatalf("got %d messages, want 5", len(msgs))
+	}
+	for i, m := range msgs {
+		if m.Partition != msgs[0].Partition {
+			t.Fatalf("message %d in partition %d, want %d", i, m.Partition, msgs[0].Partition)
+		}
+		if m.Offset != int64(i) || string(m.Value) != fmt.Sprint(i) {
+			t.Fatalf("message %d: offset=%d value=%s", i, m.Offset, m.Value)
+		}
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	b := New(4)
+	ctx := context.Background()
+	for i := 0; i < 40; i++ {
+		_ = b.Publish(ctx, "t", []byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprint(i)))
+	}
+
+	a1 := b.Subscribe("t", "a")
+	a2 := b.Subscribe("t", "a")
+	other := b.Subscribe("t", "b")
+
+	seen := map[string]int{}
+	for _, s := range []*Subscriber{a1, a2} {
+		got := drain(s)
+		if len(got) == 0 || len(got) == 40 {
+			t.Fatalf("partitions are not split between members: one got %d messages", len(got))
+		}
+		for _, msg := range got {
+			seen[string(msg.Value)]++
+			_ = s.Commit(ctx, msg)
+		}
+	}
+	if len(seen) != 40 {
+		t.Fatalf("group a saw %d distinct messages, want 40", len(seen))
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Fatalf("message %s delivered %d times inside one group", v, n)
+		}
+	}
+	expectEmpty(t, a1)
+	expectEmpty(t, a2)
+
+	if got := drain(other); len(got) != 40 {
+		t.Fatalf("group b got %d messages, want all 40", len(got))
+	}
+	if lag := b.Lag("t", "a"); lag != 0 {
+		t.Fatalf("group a lag = %d, want 0", lag)
+	}
+	if lag := b.Lag("t", "b"); lag != 40 {
+		t.Fatalf("group b lag = %d, want 40 (nothing committed)", lag)
+	}
+}
+
+func TestUncommittedRedeliveredAfterRestart(t *testing.T) {
+	b := New(1)
+	ctx := context.Background()
+	for _, v := range []string{"m1", "m2", "m3"} {
+		_ = b.Publish(ctx, "t", nil, []byte(v))
+	}
+
+	s := b.Subscribe("t", "g")
+	m1 := fetch(t, s)
+	_ = fetch(t, s)
+	if err := s.Commit(ctx, m1); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	_ = s.Close()
+
+	if _, err := s.Fetch(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("fetch after close: %v, want ErrClosed", err)
+	}
+	if err := s.Commit(ctx, m1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("commit after close: %v, want ErrClosed", err)
+	}
+
+	restarted := b.Subscribe("t", "g")
+	if got := fetch(t, restarted); string(got.Value) != "m2" {
+		t.Fatalf("after restart got %s, want redelivered m2", got.Value)
+	}
+	if got := fetch(t, restarted); string(got.Value) != "m3" {
+		t.Fatalf("after restart got %s, want m3", got.Value)
+	}
+}
+
+func TestRebalanceMovesPartitions(t *testing.T) {
+	b := New(2)
+	s1 := b.Subscribe("t", "g")
+	s2 := b.Subscribe("t", "g")
+
+	if len(s1.positions) != 1 || len(s2.positions) != 1 {
+		t.Fatalf("partitions not split: %v / %v", s1.positions, s2.positions)
+	}
+	_ = s2.Close()
+	if len(s1.positions) != 2 {
+		t.Fatalf("partitions not reassigned after leave: %v", s1.positions)
+	}
+
+	// коммит по партиции, которую подписчик не читает, отклоняется
+	s3 := b.Subscribe("t", "g")
+	var foreign int
+	for p := range s3.positions {
+		foreign = p
+	}
+	err := s1.Commit(context.Background(), broker.Message{Topic: "t", Partition: foreign, Offset: 0})
+	if !errors.Is(err, ErrNotAssigned) {
+		t.Fatalf("commit foreign partition: %v, want ErrNotAssigned", err)
+	}
+}
+
+func TestFetchWaitsForPublish(t *testing.T) {
+	b := New(1)
+	s := b.Subscribe("t", "g")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = b.PublishWithHeaders(context.Background(), "t", []byte("k"), []byte("v"),
+			broker.WithRetryCount(nil, 2))
+	}()
+
+	msg := fetch(t, s)
+	if string(msg.Value) != "v" || broker.GetRetryCount(msg) != 2 {
+		t.Fatalf("got value=%s retry=%d", msg.Value, broker.GetRetryCount(msg))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Fetch(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("fetch with cancelled ctx: %v", err)
+	}
+}
@@ -1,14 +1,10 @@
-package kafka
+package broker
 
-import (
-	"strconv"
-
-	kafkago "github.com/segmentio/kafka-go"
-)
+import "strconv"
 
 const retryHeaderKey = "retry_count"
 
-func GetRetryCount(msg kafkago.Message) int {
+func GetRetryCount(msg Message) int {
 	for _, h := range msg.Headers {
 		if h.Key == retryHeaderKey {
 			if n, err := strconv.Atoi(string(h.Value)); err == nil {
@@ -19,14 +15,14 @@ func GetRetryCount(msg kafkago.Message) int {
 	return 0
 }
 
-func WithRetryCount(headers []kafkago.Header, count int) []kafkago.Header {
-	out := make([]kafkago.Header, 0, len(headers)+1)
+func WithRetryCount(headers []Header, count int) []Header {
+	out := make([]Header, 0, len(headers)+1)
 	for _, h := range headers {
 		if h.Key != retryHeaderKey {
 			out = append(out, h)
 		}
 	}
-	out = append(out, kafkago.Header{
+	out = append(out, Header{
 		Key:   retryHeaderKey,
 		Value: []byte(strconv.Itoa(count)),
 	})
@@ -0,0 +1,117 @@
+package envconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load заполняет dst (указатель на структуру с уже выставленными дефолтами):
+// сначала из YAML-файла path (если задан), затем из переменных окружения по тегу `env`.
+// Все ошибки разбора собираются и возвращаются одной через errors.Join.
+func Load(path string, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("envconfig: dst must be a pointer to struct, got %T", dst)
+	}
+
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, dst); err != nil {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	applyEnv(rv.Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func applyEnv(v reflect.Value, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		key := f.Tag.Get("env")
+		if key == "" {
+			if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+				applyEnv(fv, errs)
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(key)
+		raw = strings.TrimSpace(raw)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			*errs = append(*errs, fmt.Errorf("env %s=%q: %w", key, raw, err))
+		}
+	}
+}
+
+func setValue(fv reflect.Value, raw string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("expected duration like 5s")
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("expected integer")
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected boolean")
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", fv.Type())
+		}
+		parts := SplitList(raw)
+		fv.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// SplitList разбивает строку вида "a, b,,c" на непустые элементы.
+func SplitList(s string) []string {
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
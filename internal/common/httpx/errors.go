@@ -0,0 +1,145 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Каталог кодов ошибок API. Коды стабильны: клиенты ветвятся по ним, а не по
+// тексту message, который может меняться.
+const (
+	CodeBadRequest            = "BAD_REQUEST"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeForbidden             = "FORBIDDEN"
+	CodeNotFound              = "NOT_FOUND"
+	CodeMethodNotAllowed      = "METHOD_NOT_ALLOWED"
+	CodeAlreadyExists         = "ALREADY_EXISTS"
+	CodeConflict              = "CONFLICT"
+	CodeAccountFrozen         = "ACCOUNT_FROZEN"
+	CodeAccountClosed         = "ACCOUNT_CLOSED"
+	CodeAccountNotEmpty       = "ACCOUNT_NOT_EMPTY"
+	CodeInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	CodeCurrencyMismatch      = "CURRENCY_MISMATCH"
+	CodeInvalidTransition     = "INVALID_STATE_TRANSITION"
+	CodeRefundExceedsAmount   = "REFUND_EXCEEDS_AMOUNT"
+	CodeRateLimited           = "RATE_LIMITED"
+	CodeUnsupportedAPIVersion = "UNSUPPORTED_API_VERSION"
+	CodeInternal              = "INTERNAL"
+	CodeUnavailable           = "UNAVAILABLE"
+	CodeUpstreamError         = "UPSTREAM_ERROR"
+	CodeUpstreamTimeout       = "UPSTREAM_TIMEOUT"
+	CodeUpstreamUnavailable   = "UPSTREAM_UNAVAILABLE"
+)
+
+// APIError — ошибка, готовая к отдаче клиенту. Err — исходная причина: она
+// попадает в лог, но не в ответ.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details []ErrorDetail
+	Err     error
+}
+
+func NewError(status int, code, msg string, details ...ErrorDetail) *APIError {
+	return &APIError{Status: status, Code: code, Message: msg, Details: details}
+}
+
+// Invalid — 400 BAD_REQUEST с перечнем проблем по полям.
+func Invalid(details ...ErrorDetail) *APIError {
+	return NewError(http.StatusBadRequest, CodeBadRequest, "invalid request", details...)
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// Rule сопоставляет доменную ошибку с ответом.
+type Rule struct {
+	Err     error
+	Status  int
+	Code    string
+	Message string
+}
+
+// Map переводит err в APIError по первому правилу, для которого
+// errors.Is(err, rule.Err). APIError возвращается как есть, остальное —
+// 500 INTERNAL с сообщением fallback.
+func Map(err error, fallback string, rules ...Rule) *APIError {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	for _, rule := range rules {
+		if errors.Is(err, rule.Err) {
+			return &APIError{Status: rule.Status, Code: rule.Code, Message: rule.Message, Err: err}
+		}
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: fallback, Err: err}
+}
+
+// Fail отвечает ошибкой err (см. Map) с request ID запроса. Клиент, который
+// принимает application/problem+json, получает ответ в формате RFC 7807.
+func Fail(w http.ResponseWriter, r *http.Request, err error) {
+	ae := Map(err, "internal error")
+	if ae.Status >= http.StatusInternalServerError && ae.Err != nil {
+		log.Printf("[http] %s %s: %v", r.Method, r.URL.Path, ae.Err)
+	}
+	body := ErrorBody{Code: ae.Code, Message: ae.Message, Details: ae.Details, RequestID: RequestIDFrom(r.Context())}
+	if wantsProblem(r) {
+		writeProblem(w, r, ae.Status, body)
+		return
+	}
+	JSON(w, ae.Status, ErrorResponse{Error: body})
+}
+
+const (
+	ProblemContentType = "application/problem+json"
+	// ProblemTypePrefix + код — значение type в ответе RFC 7807.
+	ProblemTypePrefix = "urn:hw4:error:"
+)
+
+// Problem — тело application/problem+json (RFC 7807) с кодом из каталога.
+type Problem struct {
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	Status    int           `json:"status"`
+	Detail    string        `json:"detail,omitempty"`
+	Instance  string        `json:"instance,omitempty"`
+	Code      string        `json:"code"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, body ErrorBody) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Problem{
+		Type:      ProblemTypePrefix + body.Code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    body.Message,
+		Instance:  r.URL.Path,
+		Code:      body.Code,
+		Details:   body.Details,
+		RequestID: body.RequestID,
+	})
+}
+
+func wantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID — сквозной идентификатор запроса: gateway присваивает его,
+// сервисы принимают и возвращают в ответе и в телах ошибок.
+const HeaderRequestID = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestIDFrom — ID, присвоенный RequestID; без middleware — пустая строка.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID берёт X-Request-ID из запроса или выдаёт новый, кладёт его в
+// контекст, в заголовок запроса (для прокси) и в заголовок ответа.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+			r.Header.Set(HeaderRequestID, id)
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID пропускает только печатный ASCII разумной длины: ID попадает в логи.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -6,8 +6,16 @@ import (
 )
 
 type ErrorBody struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// ErrorDetail — проблема в конкретном поле запроса, например body.user_id.
+type ErrorDetail struct {
+	Field string `json:"field"`
+	Issue string `json:"issue"`
 }
 
 type ErrorResponse struct {
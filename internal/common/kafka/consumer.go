@@ -6,36 +6,64 @@ import (
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
+
+	"HW4/internal/common/broker"
 )
 
+type ConsumerConfig struct {
+	Brokers       []string
+	Topic         string
+	GroupID       string
+	MinBytes      int
+	MaxBytes      int
+	MaxWait       time.Duration
+	FetchTimeout  time.Duration
+	CommitTimeout time.Duration
+}
+
 type Consumer struct {
-	r *kafkago.Reader
+	r             *kafkago.Reader
+	fetchTimeout  time.Duration
+	commitTimeout time.Duration
 }
 
-func NewConsumer(brokers []string, topic, groupID string) *Consumer {
+func NewConsumer(cfg ConsumerConfig) *Consumer {
 	return &Consumer{
 		r: kafkago.NewReader(kafkago.ReaderConfig{
-			Brokers:        brokers,
-			Topic:          topic,
-			GroupID:        groupID,
-			MinBytes:       1e3,
-			MaxBytes:       10e6,
+			Brokers:        cfg.Brokers,
+			Topic:          cfg.Topic,
+			GroupID:        cfg.GroupID,
+			MinBytes:       cfg.MinBytes,
+			MaxBytes:       cfg.MaxBytes,
+			MaxWait:        cfg.MaxWait,
 			CommitInterval: 0,
 			StartOffset:    kafkago.FirstOffset,
 		}),
+		fetchTimeout:  cfg.FetchTimeout,
+		commitTimeout: cfg.CommitTimeout,
 	}
 }
 
-func (c *Consumer) Fetch(ctx context.Context) (kafkago.Message, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+var _ broker.Subscriber = (*Consumer)(nil)
+
+func (c *Consumer) Fetch(ctx context.Context) (broker.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.fetchTimeout)
 	defer cancel()
-	return c.r.FetchMessage(ctx)
+	msg, err := c.r.FetchMessage(ctx)
+	if err != nil {
+		return broker.Message{}, err
+	}
+	return fromKafka(msg), nil
 }
 
-func (c *Consumer) Commit(ctx context.Context, msg kafkago.Message) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+func (c *Consumer) Commit(ctx context.Context, msg broker.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, c.commitTimeout)
 	defer cancel()
-	return c.r.CommitMessages(ctx, msg)
+	return c.r.CommitMessages(ctx, kafkago.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
 }
 
 func (c *Consumer) Read(ctx context.Context) ([]byte, error) {
@@ -61,3 +89,19 @@ func SplitBrokers(s string) []string {
 	}
 	return out
 }
+
+func fromKafka(m kafkago.Message) broker.Message {
+	headers := make([]broker.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		headers = append(headers, broker.Header{Key: h.Key, Value: h.Value})
+	}
+	return broker.Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   headers,
+		Time:      m.Time,
+	}
+}
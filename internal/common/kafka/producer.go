@@ -5,38 +5,54 @@ import (
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
+
+	"HW4/internal/common/broker"
 )
 
+type ProducerConfig struct {
+	Brokers        []string
+	PublishTimeout time.Duration
+}
+
 type Producer struct {
-	w *kafkago.Writer
+	w              *kafkago.Writer
+	publishTimeout time.Duration
 }
 
-func NewProducer(brokers []string) *Producer {
+func NewProducer(cfg ProducerConfig) *Producer {
 	return &Producer{
 		w: &kafkago.Writer{
-			Addr:         kafkago.TCP(brokers...),
+			Addr:         kafkago.TCP(cfg.Brokers...),
 			Balancer:     &kafkago.Hash{},
 			RequiredAcks: kafkago.RequireAll,
 			Async:        false,
 		},
+		publishTimeout: cfg.PublishTimeout,
 	}
 }
 
+var _ broker.Publisher = (*Producer)(nil)
+
 func (p *Producer) Close() error { return p.w.Close() }
 
 func (p *Producer) Publish(ctx context.Context, topic string, key []byte, value []byte) error {
 	return p.PublishWithHeaders(ctx, topic, key, value, nil)
 }
 
-func (p *Producer) PublishWithHeaders(ctx context.Context, topic string, key []byte, value []byte, headers []kafkago.Header) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+func (p *Producer) PublishWithHeaders(ctx context.Context, topic string, key []byte, value []byte, headers []broker.Header) error {
+	ctx, cancel := context.WithTimeout(ctx, p.publishTimeout)
 	defer cancel()
 
+	kh := make([]kafkago.Header, 0, len(headers))
+	for _, h := range headers {
+		kh = append(kh, kafkago.Header{Key: h.Key, Value: h.Value})
+	}
+
 	return p.w.WriteMessages(ctx, kafkago.Message{
 		Topic:   topic,
 		Key:     key,
 		Value:   value,
 		Time:    time.Now(),
-		Headers: headers,
+		Headers: kh,
 	})
 }
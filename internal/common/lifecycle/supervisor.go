@@ -0,0 +1,114 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Worker — фоновый процесс сервиса (outbox publisher, consumer).
+// Run должен вернуться после отмены ctx, доделав текущую единицу работы.
+// Текущую единицу работы воркер ведёт в контексте InFlight(ctx): он
+// переживает отмену ctx, но отменяется, когда истекает дедлайн Wait.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+type WorkerFunc func(ctx context.Context)
+
+func (f WorkerFunc) Run(ctx context.Context) { f(ctx) }
+
+// Supervisor запускает воркеры, перезапускает упавшие с panic
+// и дожидается их остановки при shutdown.
+type Supervisor struct {
+	name         string
+	restartDelay time.Duration
+
+	wg sync.WaitGroup
+	// abort отменяет работу, начатую воркерами, когда истекает дедлайн Wait
+	abort       context.Context
+	cancelAbort context.CancelFunc
+}
+
+func NewSupervisor(name string, restartDelay time.Duration) *Supervisor {
+	if restartDelay <= 0 {
+		restartDelay = time.Second
+	}
+	abort, cancelAbort := context.WithCancel(context.Background())
+	return &Supervisor{name: name, restartDelay: restartDelay, abort: abort, cancelAbort: cancelAbort}
+}
+
+type abortKey struct{}
+
+// InFlight возвращает контекст для единицы работы, начатой воркером в ctx:
+// отмена ctx его не отменяет, дедлайн Supervisor.Wait — отменяет. Вне
+// Supervisor это просто отвязанный от ctx контекст.
+func InFlight(ctx context.Context) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	abort, ok := ctx.Value(abortKey{}).(context.Context)
+	if !ok {
+		return work, cancel
+	}
+	stop := context.AfterFunc(abort, cancel)
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Go запускает воркер в отдельной горутине. После panic воркер перезапускается
+// с задержкой, пока ctx не отменён. Обычный возврат из Run считается остановкой.
+func (s *Supervisor) Go(ctx context.Context, name string, w Worker) {
+	ctx = context.WithValue(ctx, abortKey{}, s.abort)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			err := s.runOnce(ctx, w)
+			if err == nil {
+				log.Printf("[%s] worker %s stopped", s.name, name)
+				return
+			}
+			log.Printf("[%s] worker %s crashed: %v", s.name, name, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.restartDelay):
+				log.Printf("[%s] restarting worker %s", s.name, name)
+			}
+		}
+	}()
+}
+
+func (s *Supervisor) runOnce(ctx context.Context, w Worker) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+	w.Run(ctx)
+	return nil
+}
+
+// Wait ждёт остановки всех воркеров. Если дедлайн истёк раньше, отменяет
+// начатую ими работу (см. InFlight) и возвращает ctx.Err(): воркеры в этот
+// момент ещё могут работать, и общие ресурсы закрывать нельзя.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelAbort()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestartsPanickedWorker(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	var (
+		mu     sync.Mutex
+		starts []time.Time
+	)
+	// первые два запуска падают, третий штатно завершается
+	w := WorkerFunc(func(ctx context.Context) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		n := len(starts)
+		mu.Unlock()
+		if n < 3 {
+			panic("boom")
+		}
+	})
+
+	sup := NewSupervisor("test", delay)
+	sup.Go(context.Background(), "flaky", w)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sup.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(starts) != 3 {
+		t.Fatalf("worker started %d times, want 3", len(starts))
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < delay {
+			t.Fatalf("restart %d after %v, want at least %v", i, gap, delay)
+		}
+	}
+}
+
+func TestSupervisorStopsRestartingAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu     sync.Mutex
+		starts int
+	)
+	w := WorkerFunc(func(context.Context) {
+		mu.Lock()
+		starts++
+		mu.Unlock()
+		cancel()
+		panic("boom")
+	})
+
+	sup := NewSupervisor("test", time.Hour)
+	sup.Go(ctx, "flaky", w)
+
+	// задержка перезапуска — час: Wait вернётся, только если отмена её прервала
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := sup.Wait(waitCtx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if starts != 1 {
+		t.Fatalf("worker started %d times, want 1", starts)
+	}
+}
+
+func TestSupervisorWaitHonorsDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	// воркер не смотрит на ctx и не останавливается при отмене
+	w := WorkerFunc(func(context.Context) { <-release })
+
+	runCtx, stop := context.WithCancel(context.Background())
+	sup := NewSupervisor("test", time.Millisecond)
+	sup.Go(runCtx, "stuck", w)
+	stop()
+
+	const deadline = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	start := time.Now()
+	err := sup.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > deadline+time.Second {
+		t.Fatalf("Wait returned after %v, want about %v", elapsed, deadline)
+	}
+}
+
+func TestInFlightOutlivesStopUntilDeadline(t *testing.T) {
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	// воркер начинает работу и ведёт её в InFlight-контексте
+	w := WorkerFunc(func(ctx context.Context) {
+		work, cancel := InFlight(ctx)
+		defer cancel()
+		close(started)
+		<-ctx.Done()
+		select {
+		case <-work.Done():
+			result <- errors.New("in-flight work cancelled by stop")
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		<-work.Done()
+		result <- work.Err()
+	})
+
+	runCtx, stop := context.WithCancel(context.Background())
+	sup := NewSupervisor("test", time.Millisecond)
+	sup.Go(runCtx, "busy", w)
+	<-started
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sup.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("in-flight work ended with %v, want %v after the deadline", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight work was not cancelled at the deadline")
+	}
+
+	// воркер вернулся: теперь Wait завершается сразу
+	done, cancelDone := context.WithTimeout(context.Background(), time.Second)
+	defer cancelDone()
+	if err := sup.Wait(done); err != nil {
+		t.Fatalf("Wait after abort: %v", err)
+	}
+}
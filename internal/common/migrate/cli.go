@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const Usage = "usage: migrate up | down [N] | status | version"
+
+// Commands — операции Runner, которые вызывает RunCommand.
+type Commands interface {
+	Up(ctx context.Context) (int, error)
+	Down(ctx context.Context, steps int) (int, error)
+	Status(ctx context.Context) ([]Status, error)
+	Version(ctx context.Context) (int64, bool, error)
+}
+
+// RunCommand выполняет подкоманду `migrate <args>` сервисного бинарника.
+func RunCommand(ctx context.Context, r Commands, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := r.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", n)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("bad steps %q: %s", args[1], Usage)
+			}
+			steps = n
+		}
+		n, err := r.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rolled back %d migration(s)\n", n)
+
+	case "status":
+		st, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range st {
+			mark := "pending"
+			if s.Applied {
+				mark = "applied"
+			}
+			fmt.Fprintf(out, "%03d_%s\t%s\n", s.Version, s.Name, mark)
+		}
+
+	case "version":
+		v, dirty, err := r.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			fmt.Fprintf(out, "%d (dirty)\n", v)
+		} else {
+			fmt.Fprintf(out, "%d\n", v)
+		}
+
+	default:
+		return fmt.Errorf("unknown command %q: %s", args[0], Usage)
+	}
+	return nil
+}
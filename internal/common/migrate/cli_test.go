@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeCommands struct {
+	calls   []string
+	steps   int
+	version int64
+	dirty   bool
+	err     error
+}
+
+func (f *fakeCommands) Up(context.Context) (int, error) {
+	f.calls = append(f.calls, "up")
+	return 2, f.err
+}
+
+func (f *fakeCommands) Down(_ context.Context, steps int) (int, error) {
+	f.calls = append(f.calls, "down")
+	f.steps = steps
+	return steps, f.err
+}
+
+func (f *fakeCommands) Status(context.Context) ([]Status, error) {
+	f.calls = append(f.calls, "status")
+	return []Status{
+		{Migration: Migration{Version: 1, Name: "init"}, Applied: true},
+		{Migration: Migration{Version: 2, Name: "holds"}},
+	}, f.err
+}
+
+func (f *fakeCommands) Version(context.Context) (int64, bool, error) {
+	f.calls = append(f.calls, "version")
+	return f.version, f.dirty, f.err
+}
+
+func TestRunCommand(t *testing.T) {
+	errDB := errors.New("db is down")
+
+	tests := []struct {
+		name      string
+		args      []string
+		cmds      fakeCommands
+		wantCall  string
+		wantSteps int
+		wantOut   string
+		wantErr   string
+	}{
+		{name: "up", args: []string{"up"}, wantCall: "up", wantOut: "applied 2 migration(s)\n"},
+		{name: "down default one step", args: []string{"down"}, wantCall: "down", wantSteps: 1, wantOut: "rolled back 1 migration(s)\n"},
+		{name: "down N", args: []string{"down", "3"}, wantCall: "down", wantSteps: 3, wantOut: "rolled back 3 migration(s)\n"},
+		{name: "down zero", args: []string{"down", "0"}, wantErr: `bad steps "0"`},
+		{name: "down not a number", args: []string{"down", "all"}, wantErr: `bad steps "all"`},
+		{name: "status", args: []string{"status"}, wantCall: "status", wantOut: "001_init\tapplied\n002_holds\tpending\n"},
+		{name: "version", args: []string{"version"}, cmds: fakeCommands{version: 7}, wantCall: "version", wantOut: "7\n"},
+		{name: "version dirty", args: []string{"version"}, cmds: fakeCommands{version: 7, dirty: true}, wantCall: "version", wantOut: "7 (dirty)\n"},
+		{name: "runner error", args: []string{"up"}, cmds: fakeCommands{err: errDB}, wantCall: "up", wantErr: errDB.Error()},
+		{name: "no command", args: nil, wantErr: Usage},
+		{name: "unknown command", args: []string{"redo"}, wantErr: `unknown command "redo"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmds := tt.cmds
+			err := RunCommand(context.Background(), &cmds, tt.args, &out)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCall == "" && len(cmds.calls) != 0 {
+				t.Fatalf("calls = %v, want none", cmds.calls)
+			}
+			if tt.wantCall != "" && (len(cmds.calls) != 1 || cmds.calls[0] != tt.wantCall) {
+				t.Fatalf("calls = %v, want [%s]", cmds.calls, tt.wantCall)
+			}
+			if cmds.steps != tt.wantSteps {
+				t.Fatalf("steps = %d, want %d", cmds.steps, tt.wantSteps)
+			}
+			if out.String() != tt.wantOut {
+				t.Fatalf("output = %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Таблица совместима с golang-migrate (одна строка version/dirty),
+// поэтому базы, размеченные migrate/migrate, подхватываются без изменений.
+const versionTable = "schema_migrations"
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("database is dirty: previous migration failed, fix it manually")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied bool
+}
+
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+	lockKey    int64
+}
+
+// New читает миграции из fsys. lockName определяет ключ advisory lock,
+// под которым выполняются up/down, чтобы реплики не мигрировали одновременно.
+func New(db *sql.DB, fsys fs.FS, lockName string) (*Runner, error) {
+	migs, err := parse(fsys)
+	if err != nil {
+		return nil, err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("migrate:" + lockName))
+	return &Runner{db: db, migrations: migs, lockKey: int64(h.Sum64())}, nil
+}
+
+// parse собирает пары NNN_name.up.sql / NNN_name.down.sql и сортирует их по
+// версии. Версия без одного из файлов или с двумя разными файлами одного
+// направления — ошибка: такой набор нельзя ни применить, ни откатить.
+func parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	files := map[string]string{} // "<version>.<up|down>" -> имя файла
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		v, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		key := fmt.Sprintf("%d.%s", v, m[3])
+		if prev, ok := files[key]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", v, prev, e.Name())
+		}
+		files[key] = e.Name()
+		body, err := fs.ReadFile(fsys, path.Clean(e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[v]
+		if !ok {
+			mig = &Migration{Version: v, Name: m[2]}
+			byVersion[v] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", v, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		for _, dir := range []string{"up", "down"} {
+			if _, ok := files[fmt.Sprintf("%d.%s", m.Version, dir)]; !ok {
+				return nil, fmt.Errorf("migration %d_%s has no %s file", m.Version, m.Name, dir)
+			}
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Up применяет все ещё не применённые миграции. Возвращает число применённых.
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		cur, err := r.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			if m.Version <= cur {
+				continue
+			}
+			if err := r.apply(ctx, conn, m.Up, m.Version); err != nil {
+				return fmt.Errorf("up %d_%s: %w", m.Version, m.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних применённых миграций.
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	rolled := 0
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		cur, err := r.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && rolled < steps; i-- {
+			m := r.migrations[i]
+			if m.Version > cur {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+			}
+			prev := int64(0)
+			if i > 0 {
+				prev = r.migrations[i-1].Version
+			}
+			if err := r.apply(ctx, conn, m.Down, prev); err != nil {
+				return fmt.Errorf("down %d_%s: %w", m.Version, m.Name, err)
+			}
+			rolled++
+		}
+		return nil
+	})
+	return rolled, err
+}
+
+// Version возвращает текущую версию схемы (0 — миграций не было) и флаг dirty.
+func (r *Runner) Version(ctx context.Context) (int64, bool, error) {
+	if err := r.ensureTable(ctx, r.db); err != nil {
+		return 0, false, err
+	}
+	return readVersion(ctx, r.db)
+}
+
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	cur, _, err := r.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		out = append(out, Status{Migration: m, Applied: m.Version <= cur})
+	}
+	return out, nil
+}
+
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// advisory lock сессионный, поэтому держим одно соединение на всё время работы
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, r.lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, r.lockKey)
+	}()
+
+	if err := r.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (r *Runner) ensureTable(ctx context.Context, db execQuerier) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+versionTable+` (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty   BOOLEAN NOT NULL
+		)
+	`)
+	return err
+}
+
+func (r *Runner) current(ctx context.Context, conn *sql.Conn) (int64, error) {
+	v, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w (version %d)", ErrDirty, v)
+	}
+	return v, nil
+}
+
+func readVersion(ctx context.Context, db execQuerier) (int64, bool, error) {
+	var (
+		v     int64
+		dirty bool
+	)
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM `+versionTable+` LIMIT 1`).Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return v, dirty, err
+}
+
+// apply выполняет скрипт и переставляет версию в одной транзакции.
+func (r *Runner) apply(ctx context.Context, conn *sql.Conn, script string, newVersion int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+versionTable); err != nil {
+		return err
+	}
+	if newVersion > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+versionTable+`(version, dirty) VALUES ($1, false)`, newVersion); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"HW4/migrations"
+)
+
+func TestParse(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name: "pairs sorted by version",
+			fsys: fstest.MapFS{
+				"010_limits.up.sql":   file("up10"),
+				"010_limits.down.sql": file("down10"),
+				"002_holds.up.sql":    file("up2"),
+				"002_holds.down.sql":  file("down2"),
+				"001_init.up.sql":     file("up1"),
+				"001_init.down.sql":   file("down1"),
+				"README.md":           file("not a migration"),
+				"003_draft.sql":       file("no direction"),
+				"subdir/004_x.up.sql": file("nested"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "init", Up: "up1", Down: "down1"},
+				{Version: 2, Name: "holds", Up: "up2", Down: "down2"},
+				{Version: 10, Name: "limits", Up: "up10", Down: "down10"},
+			},
+		},
+		{
+			name: "empty dir",
+			fsys: fstest.MapFS{},
+			want: []Migration{},
+		},
+		{
+			name:    "missing down",
+			fsys:    fstest.MapFS{"001_init.up.sql": file("up1")},
+			wantErr: "1_init has no down file",
+		},
+		{
+			name:    "missing up",
+			fsys:    fstest.MapFS{"001_init.down.sql": file("down1")},
+			wantErr: "1_init has no up file",
+		},
+		{
+			name: "duplicate version with different names",
+			fsys: fstest.MapFS{
+				"001_init.up.sql":    file("up1"),
+				"001_init.down.sql":  file("down1"),
+				"001_other.up.sql":   file("up1b"),
+				"001_other.down.sql": file("down1b"),
+			},
+			wantErr: "duplicate migration version 1",
+		},
+		{
+			name: "duplicate version with different padding",
+			fsys: fstest.MapFS{
+				"001_init.up.sql":   file("up1"),
+				"001_init.down.sql": file("down1"),
+				"1_init.up.sql":     file("up1b"),
+			},
+			wantErr: "duplicate migration version 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(tt.fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parse error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parse = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("migration %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestEmbeddedMigrations: наборы, встроенные в сервисы, разбираются без
+// ошибок, и версии идут подряд с единицы.
+func TestEmbeddedMigrations(t *testing.T) {
+	sets := map[string]fs.FS{
+		"orders":   migrations.Orders(),
+		"payments": migrations.Payments(),
+		"gateway":  migrations.Gateway(),
+	}
+	for name, fsys := range sets {
+		t.Run(name, func(t *testing.T) {
+			migs, err := parse(fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migs) == 0 {
+				t.Fatal("no migrations")
+			}
+			for i, m := range migs {
+				if m.Version != int64(i+1) {
+					t.Fatalf("migration %d has version %d, want %d", i, m.Version, i+1)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Package money — поддерживаемые валюты ISO 4217. Суммы во всех сервисах —
+// целые числа в минорных единицах валюты: копейках, тиынах, центах.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// DefaultCurrency — валюта заказов, счетов и команд, в которых она не указана.
+const DefaultCurrency = "RUB"
+
+// MaxMajorAmount — верхняя граница одной суммы в основных единицах валюты.
+// В минорных единицах граница зависит от их числа у валюты.
+const MaxMajorAmount = 1_000_000_000_000
+
+type Currency struct {
+	Code string
+	// MinorUnits — число знаков после запятой: 2 у RUB (копейки), 0 у валют
+	// без дробной части.
+	MinorUnits int
+}
+
+var currencies = map[string]Currency{
+	"RUB": {Code: "RUB", MinorUnits: 2},
+	"KZT": {Code: "KZT", MinorUnits: 2},
+	"USD": {Code: "USD", MinorUnits: 2},
+	"EUR": {Code: "EUR", MinorUnits: 2},
+}
+
+// Lookup возвращает валюту по коду ISO 4217; ok=false — валюта не поддерживается.
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+// Codes — коды поддерживаемых валют по алфавиту.
+func Codes() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// MaxAmount — MaxMajorAmount в минорных единицах валюты.
+func (c Currency) MaxAmount() int64 {
+	limit := int64(MaxMajorAmount)
+	for range c.MinorUnits {
+		limit *= 10
+	}
+	return limit
+}
+
+// CheckAmount проверяет сумму платежа в минорных единицах: она должна быть
+// положительной и не больше MaxAmount.
+func (c Currency) CheckAmount(amount int64) error {
+	switch {
+	case amount <= 0:
+		return errors.New("must be > 0")
+	case amount > c.MaxAmount():
+		return fmt.Errorf("must be at most %d %s minor units", c.MaxAmount(), c.Code)
+	}
+	return nil
+}
+
+// Or возвращает code или, если он пуст, DefaultCurrency.
+func Or(code string) string {
+	if code == "" {
+		return DefaultCurrency
+	}
+	return code
+}
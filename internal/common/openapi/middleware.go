@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+
+	"HW4/internal/common/httpx"
+)
+
+// Options настраивают Middleware.
+type Options struct {
+	// Responses включает проверку ответов обработчиков — для тестов и стендов:
+	// ответ буферизуется целиком.
+	Responses bool
+	// OnResponseError получает расхождение ответа со спецификацией; по умолчанию — в лог.
+	OnResponseError func(r *http.Request, err error)
+}
+
+// Middleware отклоняет запросы, не соответствующие спецификации, с 400
+// BAD_REQUEST и ошибками по полям. Пути и методы, которых нет в спецификации,
+// пропускаются как есть: на них ответит сам mux.
+func Middleware(spec *Spec, opts Options, next http.Handler) http.Handler {
+	report := opts.OnResponseError
+	if report == nil {
+		report = func(r *http.Request, err error) {
+			log.Printf("[openapi] %s %s: response does not match spec: %v", r.Method, r.URL.Path, err)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, _, params := spec.Find(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := spec.ValidateRequest(r, op, params); err != nil {
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				httpx.Fail(w, r, httpx.NewError(http.StatusBadRequest, httpx.CodeBadRequest, err.Error()))
+				return
+			}
+			httpx.Fail(w, r, httpx.Invalid(ve.Details...))
+			return
+		}
+		if !opts.Responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if err := spec.ValidateResponse(op, rec.status, w.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			report(r, err)
+		}
+	})
+}
+
+// recorder пропускает ответ клиенту и сохраняет копию тела для проверки.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,260 @@
+// Package openapi проверяет запросы и ответы по api/swagger.yaml. Поддержано
+// подмножество OpenAPI 3, которым пользуется спецификация: параметры пути и
+// query, JSON-тела, $ref на components/schemas, type/format/enum/required,
+// minimum/maximum, minLength/maxLength, nullable, items и additionalProperties.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Spec struct {
+	paths   []*pathItem
+	schemas map[string]*Schema
+}
+
+type pathItem struct {
+	template   string
+	segments   []string
+	operations map[string]*Operation
+}
+
+// Operation — метод пути из спецификации.
+type Operation struct {
+	Parameters  []Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody        `yaml:"requestBody"`
+	Responses   map[string]Response `yaml:"responses"`
+}
+
+type Parameter struct {
+	In       string  `yaml:"in"`
+	Name     string  `yaml:"name"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Content map[string]MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Items                *Schema            `yaml:"items"`
+	AdditionalProperties *Additional        `yaml:"additionalProperties"`
+	Enum                 []any              `yaml:"enum"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	Nullable             bool               `yaml:"nullable"`
+}
+
+// Additional — additionalProperties: либо true/false, либо схема значений.
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return node.Decode(&a.Schema)
+}
+
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Parse читает спецификацию и проверяет, что все $ref разрешаются.
+func Parse(raw []byte) (*Spec, error) {
+	var doc struct {
+		Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+		Components struct {
+			Schemas map[string]*Schema `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+
+	s := &Spec{schemas: doc.Components.Schemas}
+	var errs []error
+	for template, item := range doc.Paths {
+		p := &pathItem{template: template, segments: split(template), operations: map[string]*Operation{}}
+		for _, m := range methods {
+			node, ok := item[strings.ToLower(m)]
+			if !ok {
+				continue
+			}
+			var op Operation
+			if err := node.Decode(&op); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", m, template, err))
+				continue
+			}
+			if err := s.checkRefs(&op); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", m, template, err))
+			}
+			p.operations[m] = &op
+		}
+		s.paths = append(s.paths, p)
+	}
+	for name, schema := range s.schemas {
+		if err := s.checkSchemaRefs(schema, map[*Schema]bool{}); err != nil {
+			errs = append(errs, fmt.Errorf("schema %s: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	// порядок для Operations и стабильного выбора среди равных шаблонов
+	sort.Slice(s.paths, func(i, j int) bool { return s.paths[i].template < s.paths[j].template })
+	return s, nil
+}
+
+func (s *Spec) checkRefs(op *Operation) error {
+	var errs []error
+	for _, p := range op.Parameters {
+		errs = append(errs, s.checkSchemaRefs(p.Schema, map[*Schema]bool{}))
+	}
+	if op.RequestBody != nil {
+		for _, mt := range op.RequestBody.Content {
+			errs = append(errs, s.checkSchemaRefs(mt.Schema, map[*Schema]bool{}))
+		}
+	}
+	for _, resp := range op.Responses {
+		for _, mt := range resp.Content {
+			errs = append(errs, s.checkSchemaRefs(mt.Schema, map[*Schema]bool{}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Spec) checkSchemaRefs(schema *Schema, seen map[*Schema]bool) error {
+	if schema == nil || seen[schema] {
+		return nil
+	}
+	seen[schema] = true
+	if schema.Ref != "" {
+		target, err := s.resolve(schema)
+		if err != nil {
+			return err
+		}
+		return s.checkSchemaRefs(target, seen)
+	}
+	var errs []error
+	for _, prop := range schema.Properties {
+		errs = append(errs, s.checkSchemaRefs(prop, seen))
+	}
+	errs = append(errs, s.checkSchemaRefs(schema.Items, seen))
+	if schema.AdditionalProperties != nil {
+		errs = append(errs, s.checkSchemaRefs(schema.AdditionalProperties.Schema, seen))
+	}
+	return errors.Join(errs...)
+}
+
+const refPrefix = "#/components/schemas/"
+
+func (s *Spec) resolve(schema *Schema) (*Schema, error) {
+	for i := 0; schema != nil && schema.Ref != ""; i++ {
+		name, ok := strings.CutPrefix(schema.Ref, refPrefix)
+		if !ok || i > 16 {
+			return nil, fmt.Errorf("unsupported $ref %q", schema.Ref)
+		}
+		target, ok := s.schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", schema.Ref)
+		}
+		schema = target
+	}
+	return schema, nil
+}
+
+// Operations — все операции спецификации в виде "GET /orders/{order_id}".
+func (s *Spec) Operations() []string {
+	var out []string
+	for _, p := range s.paths {
+		for _, m := range methods {
+			if _, ok := p.operations[m]; ok {
+				out = append(out, m+" "+p.template)
+			}
+		}
+	}
+	return out
+}
+
+// Find ищет операцию по методу и пути. Литеральные сегменты шаблона
+// приоритетнее параметров: /accounts/topup выигрывает у /accounts/{user_id}.
+// template пустой, если путь не описан; op == nil, если описан без этого метода.
+func (s *Spec) Find(method, path string) (op *Operation, template string, params map[string]string) {
+	parts := split(path)
+	best := -1
+	var bestItem *pathItem
+	for _, p := range s.paths {
+		score, ok := match(p.segments, parts)
+		if ok && score > best {
+			best, bestItem = score, p
+		}
+	}
+	if bestItem == nil {
+		return nil, "", nil
+	}
+	params = map[string]string{}
+	for i, seg := range bestItem.segments {
+		if name, ok := paramName(seg); ok {
+			params[name] = parts[i]
+		}
+	}
+	return bestItem.operations[method], bestItem.template, params
+}
+
+func match(segments, parts []string) (literal int, ok bool) {
+	if len(segments) != len(parts) {
+		return 0, false
+	}
+	for i, seg := range segments {
+		if _, isParam := paramName(seg); isParam {
+			if parts[i] == "" {
+				return 0, false
+			}
+			continue
+		}
+		if seg != parts[i] {
+			return 0, false
+		}
+		literal++
+	}
+	return literal, true
+}
+
+func paramName(seg string) (string, bool) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
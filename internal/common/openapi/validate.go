@@ -0,0 +1,339 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/httpx"
+)
+
+// ValidationError — перечень ошибок по полям: path.order_id, query.user_id, body.amount.
+type ValidationError struct {
+	Details []httpx.ErrorDetail
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Details))
+	for i, d := range e.Details {
+		parts[i] = d.Field + ": " + d.Issue
+	}
+	return strings.Join(parts, "; ")
+}
+
+// maxBody ограничивает тело, которое валидатор читает в память.
+const maxBody = 1 << 20
+
+// ValidateRequest проверяет параметры и JSON-тело r по операции op. Тело
+// читается и подменяется копией, так что обработчик получает его целиком.
+func (s *Spec) ValidateRequest(r *http.Request, op *Operation, params map[string]string) error {
+	v := validator{spec: s}
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var (
+			raw     string
+			present bool
+		)
+		switch p.In {
+		case "path":
+			raw, present = params[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			raw = query.Get(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		field := p.In + "." + p.Name
+		if !present {
+			if p.Required {
+				v.add(field, "is required")
+			}
+			continue
+		}
+		v.param(field, raw, p.Schema)
+	}
+
+	if op.RequestBody != nil {
+		v.body(r, op.RequestBody)
+	}
+	return v.err()
+}
+
+// ValidateResponse проверяет, что статус описан в операции и JSON-тело
+// соответствует его схеме.
+func (s *Spec) ValidateResponse(op *Operation, status int, contentType string, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+	mt, ok := resp.Content["application/json"]
+	if !ok || mt.Schema == nil {
+		return nil
+	}
+	// ошибка в формате RFC 7807 — та же ошибка, что и в JSON, по запросу клиента
+	if strings.HasPrefix(contentType, httpx.ProblemContentType) && status >= http.StatusBadRequest {
+		problem, ok := s.schemas["Problem"]
+		if !ok {
+			return fmt.Errorf("status %d: %s is not documented", status, httpx.ProblemContentType)
+		}
+		mt = MediaType{Schema: problem}
+	} else if !strings.HasPrefix(contentType, "application/json") {
+		return fmt.Errorf("status %d: content type %q, want application/json", status, contentType)
+	}
+	v := validator{spec: s}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("status %d: malformed json: %w", status, err)
+	}
+	v.value("body", doc, mt.Schema)
+	if err := v.err(); err != nil {
+		return fmt.Errorf("status %d: %w", status, err)
+	}
+	return nil
+}
+
+type validator struct {
+	spec    *Spec
+	details []httpx.ErrorDetail
+}
+
+func (v *validator) add(field, msg string) {
+	v.details = append(v.details, httpx.ErrorDetail{Field: field, Issue: msg})
+}
+
+func (v *validator) err() error {
+	if len(v.details) == 0 {
+		return nil
+	}
+	return &ValidationError{Details: v.details}
+}
+
+func (v *validator) body(r *http.Request, rb *RequestBody) {
+	var raw []byte
+	if r.Body != nil {
+		var err error
+		raw, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		_ = r.Body.Close()
+		if err != nil {
+			v.add("body", "cannot read body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if rb.Required {
+			v.add("body", "is required")
+		}
+		return
+	}
+	if len(raw) > maxBody {
+		v.add("body", "is too large")
+		return
+	}
+	mt, ok := rb.Content["application/json"]
+	if !ok || mt.Schema == nil {
+		return
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct != "" && !strings.HasPrefix(ct, "application/json") {
+		v.add("body", "content type must be application/json")
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		v.add("body", "must be valid json")
+		return
+	}
+	v.value("body", doc, mt.Schema)
+}
+
+// param приводит строковое значение параметра к типу схемы и проверяет его.
+func (v *validator) param(field, raw string, schema *Schema) {
+	s, err := v.spec.resolve(schema)
+	if err != nil || s == nil {
+		return
+	}
+	var val any = raw
+	switch s.Type {
+	case "integer", "number":
+		val = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.add(field, "must be a boolean")
+			return
+		}
+		val = b
+	}
+	v.value(field, val, s)
+}
+
+func (v *validator) value(field string, val any, schema *Schema) {
+	s, err := v.spec.resolve(schema)
+	if err != nil || s == nil {
+		return
+	}
+	if val == nil {
+		if !s.Nullable && s.Type != "" {
+			v.add(field, "must not be null")
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := val.(map[string]any)
+		if !ok {
+			v.add(field, "must be an object")
+			return
+		}
+		v.object(field, obj, s)
+	case "array":
+		arr, ok := val.([]any)
+		if !ok {
+			v.add(field, "must be an array")
+			return
+		}
+		for i, item := range arr {
+			v.value(fmt.Sprintf("%s[%d]", field, i), item, s.Items)
+		}
+	case "string":
+		str, ok := val.(string)
+		if !ok {
+			v.add(field, "must be a string")
+			return
+		}
+		v.str(field, str, s)
+	case "integer", "number":
+		n, ok := val.(json.Number)
+		if !ok {
+			v.add(field, "must be a "+numberKind(s))
+			return
+		}
+		v.number(field, n, s)
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			v.add(field, "must be a boolean")
+			return
+		}
+	}
+	if len(s.Enum) > 0 && !inEnum(val, s.Enum) {
+		v.add(field, "must be one of "+enumList(s.Enum))
+	}
+}
+
+func (v *validator) object(field string, obj map[string]any, s *Schema) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.add(field+"."+name, "is required")
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok {
+			v.value(field+"."+name, obj[name], prop)
+			continue
+		}
+		if ap := s.AdditionalProperties; ap != nil {
+			if !ap.Allowed {
+				v.add(field+"."+name, "unknown field")
+			} else if ap.Schema != nil {
+				v.value(field+"."+name, obj[name], ap.Schema)
+			}
+		}
+	}
+}
+
+func (v *validator) str(field, str string, s *Schema) {
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		v.add(field, fmt.Sprintf("must be at least %d characters", *s.MinLength))
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		v.add(field, fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+	}
+	switch s.Format {
+	case "uuid":
+		if uuid.Validate(str) != nil {
+			v.add(field, "must be a uuid")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			v.add(field, "must be an RFC 3339 date-time")
+		}
+	}
+}
+
+func (v *validator) number(field string, n json.Number, s *Schema) {
+	f, err := n.Float64()
+	if err != nil || math.IsInf(f, 0) {
+		v.add(field, "must be a "+numberKind(s))
+		return
+	}
+	if s.Type == "integer" {
+		i, err := n.Int64()
+		if err != nil {
+			v.add(field, "must be an integer")
+			return
+		}
+		if s.Format == "int32" && (i < math.MinInt32 || i > math.MaxInt32) {
+			v.add(field, "must fit in int32")
+			return
+		}
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		v.add(field, "must be >= "+strconv.FormatFloat(*s.Minimum, 'f', -1, 64))
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		v.add(field, "must be <= "+strconv.FormatFloat(*s.Maximum, 'f', -1, 64))
+	}
+}
+
+func numberKind(s *Schema) string {
+	if s.Type == "integer" {
+		return "integer"
+	}
+	return "number"
+}
+
+func inEnum(val any, enum []any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(val) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		parts[i] = fmt.Sprint(e)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,216 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"HW4/internal/gateway/apikey"
+	"HW4/internal/gateway/repository/memstore"
+)
+
+const owner = "11111111-1111-1111-1111-111111111111"
+
+// clock — управляемое время для проверки TTL кэша и сроков ключей.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// countingStore считает обращения к хранилищу по хэшу.
+type countingStore struct {
+	*memstore.Store
+	mu      sync.Mutex
+	lookups int
+}
+
+func (s *countingStore) GetByHash(ctx context.Context, hash string) (apikey.Key, error) {
+	s.mu.Lock()
+	s.lookups++
+	s.mu.Unlock()
+	return s.Store.GetByHash(ctx, hash)
+}
+
+func setup(t *testing.T) (*countingStore, *apikey.Authenticator, *apikey.Manager, *clock) {
+	t.Helper()
+	clk := &clock{now: time.Now()}
+	store := &countingStore{Store: memstore.New()}
+	auth := apikey.NewAuthenticator(store, apikey.Options{CacheTTL: time.Minute, Now: clk.Now})
+	return store, auth, apikey.NewManager(store, auth), clk
+}
+
+func TestIssueValidation(t *testing.T) {
+	_, _, m, _ := setup(t)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		req     apikey.IssueRequest
+		wantErr error
+	}{
+		{name: "ok", req: apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:write", "ORDERS:WRITE"}}},
+		{name: "owner not uuid", req: apikey.IssueRequest{Owner: "acme", Scopes: []string{"orders:read"}}, wantErr: apikey.ErrBadRequest},
+		{name: "no scopes", req: apikey.IssueRequest{Owner: owner}, wantErr: apikey.ErrInvalidScope},
+		{name: "unknown scope", req: apikey.IssueRequest{Owner: owner, Scopes: []string{"admin"}}, wantErr: apikey.ErrInvalidScope},
+		{name: "expired at issue", req: apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:read"}, ExpiresAt: &past}, wantErr: apikey.ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, err := m.Issue(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if issued.Hash != apikey.Hash(issued.Plain) || issued.Hash == issued.Plain {
+				t.Fatal("stored hash does not match issued key")
+			}
+			if len(issued.Scopes) != 1 {
+				t.Fatalf("scopes = %v, want deduplicated single scope", issued.Scopes)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCachesLookups(t *testing.T) {
+	store, auth, m, clk := setup(t)
+	ctx := context.Background()
+
+	issued, err := m.Issue(ctx, apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Authenticate(ctx, issued.Plain); err != nil {
+			t.Fatalf("authenticate: %v", err)
+		}
+	}
+	if store.lookups != 1 {
+		t.Fatalf("store lookups = %d, want 1", store.lookups)
+	}
+
+	clk.Advance(2 * time.Minute)
+	if _, err := auth.Authenticate(ctx, issued.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if store.lookups != 2 {
+		t.Fatalf("store lookups after ttl = %d, want 2", store.lookups)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Authenticate(ctx, "hw4_unknown"); !errors.Is(err, apikey.ErrNotFound) {
+			t.Fatalf("unknown key err = %v", err)
+		}
+	}
+	if store.lookups != 3 {
+		t.Fatalf("unknown key should be cached negatively, lookups = %d", store.lookups)
+	}
+}
+
+func TestRevokeAndExpiry(t *testing.T) {
+	_, auth, m, clk := setup(t)
+	ctx := context.Background()
+
+	expires := clk.Now().Add(time.Hour)
+	issued, err := m.Issue(ctx, apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:read"}, ExpiresAt: &expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(ctx, issued.Plain); err != nil {
+		t.Fatal(err)
+	}
+
+	// срок проверяется и для закэшированного ключа
+	clk.Advance(2 * time.Hour)
+	if _, err := auth.Authenticate(ctx, issued.Plain); !errors.Is(err, apikey.ErrExpired) {
+		t.Fatalf("err = %v, want ErrExpired", err)
+	}
+
+	other, err := m.Issue(ctx, apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(ctx, other.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke(ctx, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	// отзыв сбрасывает кэш, ждать TTL не нужно
+	if _, err := auth.Authenticate(ctx, other.Plain); !errors.Is(err, apikey.ErrRevoked) {
+		t.Fatalf("err = %v, want ErrRevoked", err)
+	}
+	if err := m.Revoke(ctx, other.ID); !errors.Is(err, apikey.ErrRevoked) {
+		t.Fatalf("second revoke err = %v, want ErrRevoked", err)
+	}
+}
+
+func TestRotateKeepsOldKeyForGracePeriod(t *testing.T) {
+	_, auth, m, clk := setup(t)
+	ctx := context.Background()
+
+	old, err := m.Issue(ctx, apikey.IssueRequest{Owner: owner, Name: "acme", Scopes: []string{"orders:write", "accounts:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := m.Rotate(ctx, old.ID, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == old.ID || next.Plain == old.Plain {
+		t.Fatal("rotation must produce a new key")
+	}
+	if next.Owner != old.Owner || next.Name != old.Name || len(next.Scopes) != 2 {
+		t.Fatalf("rotated key lost attributes: %+v", next.Key)
+	}
+
+	if _, err := auth.Authenticate(ctx, old.Plain); err != nil {
+		t.Fatalf("old key inside grace: %v", err)
+	}
+	clk.Advance(11 * time.Minute)
+	if _, err := auth.Authenticate(ctx, old.Plain); !errors.Is(err, apikey.ErrExpired) {
+		t.Fatalf("old key after grace err = %v, want ErrExpired", err)
+	}
+	if _, err := auth.Authenticate(ctx, next.Plain); err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+}
+
+func TestFlushRecordsLastUsed(t *testing.T) {
+	store, auth, m, clk := setup(t)
+	ctx := context.Background()
+
+	issued, err := m.Issue(ctx, apikey.IssueRequest{Owner: owner, Scopes: []string{"orders:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(ctx, issued.Plain); err != nil {
+		t.Fatal(err)
+	}
+	k, _ := store.Get(ctx, issued.ID)
+	if k.LastUsedAt != nil {
+		t.Fatal("last_used_at must be written in batches, not per request")
+	}
+
+	auth.Flush(ctx)
+	k, _ = store.Get(ctx, issued.ID)
+	if k.LastUsedAt == nil || !k.LastUsedAt.Equal(clk.Now()) {
+		t.Fatalf("last_used_at = %v, want %v", k.LastUsedAt, clk.Now())
+	}
+}
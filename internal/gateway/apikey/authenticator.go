@@ -0,0 +1,174 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"HW4/internal/common/lifecycle"
+)
+
+type Options struct {
+	// CacheTTL — сколько держать найденный ключ без похода в хранилище.
+	// Отзыв на другой реплике gateway вступает в силу не позже чем через CacheTTL.
+	CacheTTL time.Duration
+	// NegativeTTL — сколько помнить несуществующий ключ (защита хранилища от перебора).
+	NegativeTTL time.Duration
+	// MaxEntries ограничивает размер кэша; при переполнении он очищается целиком.
+	MaxEntries int
+	// FlushInterval — период записи last_used_at в хранилище.
+	FlushInterval time.Duration
+	Now           func() time.Time
+}
+
+func (o *Options) setDefaults() {
+	if o.CacheTTL <= 0 {
+		o.CacheTTL = 30 * time.Second
+	}
+	if o.NegativeTTL <= 0 {
+		o.NegativeTTL = 5 * time.Second
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 10 * time.Second
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+type cacheEntry struct {
+	key     Key
+	missing bool
+	until   time.Time
+}
+
+// Authenticator проверяет ключи из X-API-Key. Результаты поиска кэшируются,
+// а время последнего использования копится в памяти и пишется пачкой в Run,
+// чтобы не превращать каждый запрос в UPDATE.
+type Authenticator struct {
+	store Store
+	opts  Options
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	used  map[string]time.Time
+}
+
+func NewAuthenticator(store Store, opts Options) *Authenticator {
+	opts.setDefaults()
+	return &Authenticator{
+		store: store,
+		opts:  opts,
+		cache: map[string]cacheEntry{},
+		used:  map[string]time.Time{},
+	}
+}
+
+// Authenticate возвращает действующий ключ по его открытому значению.
+func (a *Authenticator) Authenticate(ctx context.Context, plain string) (Key, error) {
+	if plain == "" {
+		return Key{}, ErrNotFound
+	}
+	hash := Hash(plain)
+	now := a.opts.Now()
+
+	k, err := a.lookup(ctx, hash, now)
+	if err != nil {
+		return Key{}, err
+	}
+	// срок и отзыв проверяем и для ключа из кэша: expires_at известен заранее
+	if err := k.Check(now); err != nil {
+		return Key{}, err
+	}
+
+	a.mu.Lock()
+	a.used[k.ID] = now
+	a.mu.Unlock()
+	return k, nil
+}
+
+func (a *Authenticator) lookup(ctx context.Context, hash string, now time.Time) (Key, error) {
+	a.mu.Lock()
+	e, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && now.Before(e.until) {
+		if e.missing {
+			return Key{}, ErrNotFound
+		}
+		return e.key, nil
+	}
+
+	k, err := a.store.GetByHash(ctx, hash)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		a.put(hash, cacheEntry{missing: true, until: now.Add(a.opts.NegativeTTL)})
+		return Key{}, ErrNotFound
+	case err != nil:
+		return Key{}, err
+	}
+	a.put(hash, cacheEntry{key: k, until: now.Add(a.opts.CacheTTL)})
+	return k, nil
+}
+
+func (a *Authenticator) put(hash string, e cacheEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cache) >= a.opts.MaxEntries {
+		a.cache = map[string]cacheEntry{}
+	}
+	a.cache[hash] = e
+}
+
+// Forget убирает ключ из кэша.
+func (a *Authenticator) Forget(hash string) {
+	a.mu.Lock()
+	delete(a.cache, hash)
+	a.mu.Unlock()
+}
+
+// Run периодически сбрасывает last_used_at в хранилище. После отмены ctx
+// делает последний сброс, чтобы не потерять накопленное, — не дольше
+// дедлайна shutdown.
+func (a *Authenticator) Run(ctx context.Context) {
+	t := time.NewTicker(a.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := lifecycle.InFlight(ctx)
+			a.Flush(flushCtx)
+			cancel()
+			return
+		case <-t.C:
+			a.Flush(ctx)
+		}
+	}
+}
+
+// Flush записывает накопленные отметки использования. При ошибке они
+// возвращаются в буфер и уйдут со следующей пачкой.
+func (a *Authenticator) Flush(ctx context.Context) {
+	a.mu.Lock()
+	batch := a.used
+	a.used = map[string]time.Time{}
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := a.store.TouchLastUsed(ctx, batch); err != nil {
+		log.Printf("[gateway] api key last_used flush: %v", err)
+		a.mu.Lock()
+		for id, at := range batch {
+			if cur, ok := a.used[id]; !ok || cur.Before(at) {
+				a.used[id] = at
+			}
+		}
+		a.mu.Unlock()
+	}
+}
@@ -0,0 +1,136 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IssueRequest struct {
+	Owner     string     `json:"owner"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Issued — выпущенный ключ. Plain отдаётся клиенту один раз и нигде не хранится.
+type Issued struct {
+	Key
+	Plain string `json:"key"`
+}
+
+// Manager выпускает, ротирует и отзывает ключи.
+type Manager struct {
+	store Store
+	auth  *Authenticator
+	now   func() time.Time
+}
+
+// NewManager создаёт менеджер ключей. auth (может быть nil) сбрасывает кэш
+// при отзыве и ротации, чтобы изменения на этой реплике действовали сразу.
+func NewManager(store Store, auth *Authenticator) *Manager {
+	return &Manager{store: store, auth: auth, now: time.Now}
+}
+
+func (m *Manager) Issue(ctx context.Context, req IssueRequest) (Issued, error) {
+	req.Owner = strings.TrimSpace(req.Owner)
+	if _, err := uuid.Parse(req.Owner); err != nil {
+		return Issued{}, ErrBadRequest
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return Issued{}, err
+	}
+	now := m.now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return Issued{}, ErrBadRequest
+	}
+
+	issued, err := m.newKey(req.Owner, strings.TrimSpace(req.Name), scopes, req.ExpiresAt, now)
+	if err != nil {
+		return Issued{}, err
+	}
+	if err := m.store.Create(ctx, issued.Key); err != nil {
+		return Issued{}, err
+	}
+	return issued, nil
+}
+
+// Rotate выпускает замену ключа id с теми же владельцем, именем, scope и сроком.
+// Старый ключ продолжает работать grace, чтобы клиент успел переключиться;
+// grace == 0 отключает его сразу.
+func (m *Manager) Rotate(ctx context.Context, id string, grace time.Duration) (Issued, error) {
+	if grace < 0 {
+		return Issued{}, ErrBadRequest
+	}
+	old, err := m.store.Get(ctx, id)
+	if err != nil {
+		return Issued{}, err
+	}
+	now := m.now().UTC()
+	if err := old.Check(now); err != nil {
+		return Issued{}, err
+	}
+
+	next, err := m.newKey(old.Owner, old.Name, old.Scopes, old.ExpiresAt, now)
+	if err != nil {
+		return Issued{}, err
+	}
+	until := now.Add(grace)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(until) {
+		until = *old.ExpiresAt
+	}
+	if err := m.store.Rotate(ctx, old.ID, until, next.Key); err != nil {
+		return Issued{}, err
+	}
+	m.forget(old.Hash)
+	return next, nil
+}
+
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	k, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Revoke(ctx, id, m.now().UTC()); err != nil {
+		return err
+	}
+	m.forget(k.Hash)
+	return nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Key, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Manager) List(ctx context.Context, owner string) ([]Key, error) {
+	return m.store.List(ctx, strings.TrimSpace(owner))
+}
+
+func (m *Manager) newKey(owner, name string, scopes []string, expiresAt *time.Time, now time.Time) (Issued, error) {
+	plain, prefix, err := generate()
+	if err != nil {
+		return Issued{}, err
+	}
+	return Issued{
+		Key: Key{
+			ID:        uuid.NewString(),
+			Owner:     owner,
+			Name:      name,
+			Prefix:    prefix,
+			Hash:      Hash(plain),
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		},
+		Plain: plain,
+	}, nil
+}
+
+func (m *Manager) forget(hash string) {
+	if m.auth != nil {
+		m.auth.Forget(hash)
+	}
+}
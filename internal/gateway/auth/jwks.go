@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key — ключ проверки подписи: секрет HS256 или публичный ключ RS256.
+type Key struct {
+	ID     string
+	Alg    string
+	Secret []byte
+	RSA    *rsa.PublicKey
+}
+
+type KeySet []Key
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS читает набор ключей в формате JWKS (RFC 7517).
+// Поддерживаются kty=oct (HS256) и kty=RSA (RS256).
+func LoadJWKS(path string) (KeySet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(raw)
+}
+
+func ParseJWKS(raw []byte) (KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	var (
+		set  KeySet
+		errs []error
+	)
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("jwks key #%d (kid=%q): %w", i, k.Kid, err))
+			continue
+		}
+		set = append(set, key)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if len(set) == 0 {
+		return nil, errors.New("jwks: no signing keys")
+	}
+	return set, nil
+}
+
+func parseJWK(k jwk) (Key, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != AlgHS256 {
+			return Key{}, fmt.Errorf("unsupported alg %s for oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return Key{}, errors.New("bad k")
+		}
+		return Key{ID: k.Kid, Alg: AlgHS256, Secret: secret}, nil
+
+	case "RSA":
+		if k.Alg != "" && k.Alg != AlgRS256 {
+			return Key{}, fmt.Errorf("unsupported alg %s for RSA key", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return Key{}, errors.New("bad n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 {
+			return Key{}, errors.New("bad e")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return Key{ID: k.Kid, Alg: AlgRS256, RSA: pub}, nil
+
+	default:
+		return Key{}, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+}
@@ -0,0 +1,189 @@
+// Package auth проверяет bearer JWT на gateway.
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrBadSignature = errors.New("bad signature")
+	ErrExpired      = errors.New("token expired")
+	ErrNotYetValid  = errors.New("token not valid yet")
+	ErrBadIssuer    = errors.New("unexpected issuer")
+	ErrBadAudience  = errors.New("unexpected audience")
+	ErrNoSubject    = errors.New("token has no subject")
+)
+
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// Audience принимает aud и строкой, и массивом строк.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a Audience) contains(v string) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	Now      func() time.Time
+}
+
+type Verifier struct {
+	keys KeySet
+	opts Options
+}
+
+func NewVerifier(keys KeySet, opts Options) *Verifier {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Verifier{keys: keys, opts: opts}
+}
+
+// Verify проверяет подпись, сроки действия, iss/aud и возвращает claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	key, err := v.key(header.Alg, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(key, parts[0]+"."+parts[1], sig); err != nil {
+		return Claims{}, err
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	return c, v.validate(c)
+}
+
+// key выбирает ключ по kid; без kid — единственный ключ нужного алгоритма.
+// Алгоритм из заголовка обязан совпадать с алгоритмом ключа, иначе
+// возможна подмена RS256 на HS256 с публичным ключом в роли секрета.
+func (v *Verifier) key(alg, kid string) (Key, error) {
+	if alg != AlgHS256 && alg != AlgRS256 {
+		return Key{}, fmt.Errorf("%w: alg %q", ErrUnknownKey, alg)
+	}
+
+	var found []Key
+	for _, k := range v.keys {
+		if k.Alg != alg {
+			continue
+		}
+		if kid == "" || k.ID == kid {
+			found = append(found, k)
+		}
+	}
+	if len(found) != 1 {
+		return Key{}, ErrUnknownKey
+	}
+	return found[0], nil
+}
+
+func verifySignature(k Key, signingInput string, sig []byte) error {
+	switch k.Alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrBadSignature
+		}
+	case AlgRS256:
+		sum := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(k.RSA, crypto.SHA256, sum[:], sig); err != nil {
+			return ErrBadSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+	return nil
+}
+
+func (v *Verifier) validate(c Claims) error {
+	now := v.opts.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(v.opts.Leeway)) {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(v.opts.Leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+	if v.opts.Issuer != "" && c.Issuer != v.opts.Issuer {
+		return ErrBadIssuer
+	}
+	if v.opts.Audience != "" && !c.Audience.contains(v.opts.Audience) {
+		return ErrBadAudience
+	}
+	if strings.TrimSpace(c.Subject) == "" {
+		return ErrNoSubject
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
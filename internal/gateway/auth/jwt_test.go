@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	hsSecret = []byte("super-secret-key-for-tests")
+	rsaKey   *rsa.PrivateKey
+	now      = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func init() {
+	var err error
+	if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+}
+
+func b64(v []byte) string { return base64.RawURLEncoding.EncodeToString(v) }
+
+func sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, hsSecret)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case AlgRS256:
+		sum := sha256.Sum256([]byte(input))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return input + "." + b64(sig)
+}
+
+func testJWKS(t *testing.T) KeySet {
+	t.Helper()
+	doc, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": b64(hsSecret)},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "use": "sig",
+			"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	keys, err := ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("parsed %d keys, want 2 signing keys", len(keys))
+	}
+	return keys
+}
+
+func TestVerify(t *testing.T) {
+	v := NewVerifier(testJWKS(t), Options{
+		Issuer:   "https://id.example.com",
+		Audience: "gateway",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	})
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub":   "11111111-1111-1111-1111-111111111111",
+			"iss":   "https://id.example.com",
+			"aud":   []string{"gateway", "other"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"admin"},
+		}
+	}
+	with := func(k string, v any) map[string]any {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "hs256", token: sign(t, AlgHS256, "hs", valid())},
+		{name: "rs256", token: sign(t, AlgRS256, "rs", valid())},
+		{name: "no kid picks the only key of alg", token: sign(t, AlgRS256, "", valid())},
+		{name: "aud as string", token: sign(t, AlgHS256, "hs", with("aud", "gateway"))},
+		{name: "expired within leeway", token: sign(t, AlgHS256, "hs", with("exp", now.Add(-30*time.Second).Unix()))},
+		{name: "expired", token: sign(t, AlgHS256, "hs", with("exp", now.Add(-time.Hour).Unix())), wantErr: ErrExpired},
+		{name: "no exp", token: sign(t, AlgHS256, "hs", with("exp", nil)), wantErr: ErrExpired},
+		{name: "not yet valid", token: sign(t, AlgHS256, "hs", with("nbf", now.Add(time.Hour).Unix())), wantErr: ErrNotYetValid},
+		{name: "wrong issuer", token: sign(t, AlgHS256, "hs", with("iss", "evil")), wantErr: ErrBadIssuer},
+		{name: "wrong audience", token: sign(t, AlgHS256, "hs", with("aud", "billing")), wantErr: ErrBadAudience},
+		{name: "no subject", token: sign(t, AlgHS256, "hs", with("sub", nil)), wantErr: ErrNoSubject},
+		{name: "unknown kid", token: sign(t, AlgHS256, "nope", valid()), wantErr: ErrUnknownKey},
+		{name: "alg mismatch with key", token: sign(t, AlgHS256, "rs", valid()), wantErr: ErrUnknownKey},
+		{name: "alg none", token: b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + ".", wantErr: ErrUnknownKey},
+		{name: "tampered payload", token: tamper(sign(t, AlgHS256, "hs", valid())), wantErr: ErrBadSignature},
+		{name: "garbage", token: "abc", wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (c.Subject == "" || len(c.Roles) != 1) {
+				t.Fatalf("unexpected claims %+v", c)
+			}
+		})
+	}
+}
+
+func tamper(token string) string {
+	other, _ := json.Marshal(map[string]any{"sub": "someone-else", "exp": now.Add(time.Hour).Unix()})
+	parts := strings.Split(token, ".")
+	parts[1] = b64(other)
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/apikey"
+)
+
+// Authenticator пускает на gateway по bearer JWT или по X-API-Key.
+type Authenticator struct {
+	jwt        *Verifier
+	keys       *apikey.Authenticator
+	adminToken string
+}
+
+// NewAuthenticator собирает проверку входа. jwt == nil выключает JWT: запросы
+// без учётных данных проходят анонимно. keys == nil отключает API-ключи.
+// adminToken — статический bearer для админских эндпоинтов (пустой — выключен).
+func NewAuthenticator(jwt *Verifier, keys *apikey.Authenticator, adminToken string) *Authenticator {
+	return &Authenticator{jwt: jwt, keys: keys, adminToken: adminToken}
+}
+
+// Mode — требование маршрута к аутентификации.
+type Mode string
+
+const (
+	// ModeDefault — JWT обязателен, если он настроен; API-ключ принимается всегда.
+	ModeDefault Mode = ""
+	// ModeRequired — учётные данные нужны, даже если JWT на gateway выключен.
+	ModeRequired Mode = "required"
+	// ModeNone — публичный маршрут: учётные данные не проверяются и не передаются.
+	ModeNone Mode = "none"
+)
+
+// Middleware — Protect с ModeDefault.
+func (a *Authenticator) Middleware(resource string, next http.Handler) http.Handler {
+	return a.Protect(resource, ModeDefault, next)
+}
+
+// Protect проверяет учётные данные и передаёт subject и роли в сервисы
+// доверенными заголовками. Такие же заголовки от клиента всегда удаляются.
+// resource ("orders", "accounts") определяет нужный scope API-ключа:
+// resource:read для чтения и resource:write для остальных методов.
+func (a *Authenticator) Protect(resource string, mode Mode, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authn.StripHeaders(r.Header)
+		if a == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if mode == ModeNone {
+			r.Header.Del(apikey.HeaderAPIKey)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if plain := r.Header.Get(apikey.HeaderAPIKey); plain != "" {
+			// ключ не должен уйти в upstream
+			r.Header.Del(apikey.HeaderAPIKey)
+			a.serveAPIKey(w, r, plain, resource, next)
+			return
+		}
+		if a.jwt == nil {
+			if mode == ModeRequired {
+				httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "credentials required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, ok := a.bearerIdentity(w, r)
+		if !ok {
+			return
+		}
+		authn.SetHeaders(r.Header, id)
+		next.ServeHTTP(w, withClient(r, "user:"+id.Subject))
+	})
+}
+
+// RequireAdmin пускает только администратора: JWT с ролью admin или
+// статический admin-токен. API-ключами админские эндпоинты недоступны.
+func (a *Authenticator) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authn.StripHeaders(r.Header)
+		if a == nil || (a.jwt == nil && a.adminToken == "") {
+			httpx.Error(w, http.StatusForbidden, httpx.CodeForbidden, "admin access is not configured")
+			return
+		}
+
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if ok && a.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.jwt == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "admin token required")
+			return
+		}
+
+		id, ok := a.bearerIdentity(w, r)
+		if !ok {
+			return
+		}
+		if !id.IsAdmin() {
+			httpx.Error(w, http.StatusForbidden, httpx.CodeForbidden, "admin role required")
+			return
+		}
+		authn.SetHeaders(r.Header, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) serveAPIKey(w http.ResponseWriter, r *http.Request, plain, resource string, next http.Handler) {
+	if a.keys == nil {
+		httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "api keys are not accepted")
+		return
+	}
+
+	key, err := a.keys.Authenticate(r.Context(), plain)
+	if err != nil {
+		if !errors.Is(err, apikey.ErrNotFound) && !errors.Is(err, apikey.ErrRevoked) && !errors.Is(err, apikey.ErrExpired) {
+			log.Printf("[gateway] api key lookup: %v", err)
+			httpx.Error(w, http.StatusServiceUnavailable, httpx.CodeUnavailable, "api key store unavailable")
+			return
+		}
+		log.Printf("[gateway] rejected api key: %v", err)
+		httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "invalid api key")
+		return
+	}
+
+	scope := requiredScope(resource, r.Method)
+	if !key.HasScope(scope) {
+		httpx.Error(w, http.StatusForbidden, httpx.CodeForbidden, "api key lacks scope "+scope)
+		return
+	}
+
+	authn.SetHeaders(r.Header, authn.Identity{Subject: key.Owner})
+	r = r.WithContext(context.WithValue(r.Context(), apiKeyCtx{}, key))
+	next.ServeHTTP(w, withClient(r, "key:"+key.ID))
+}
+
+type apiKeyCtx struct{}
+
+// RequireScope ставится после Protect, когда эндпоинт читает или пишет
+// несколько ресурсов: API-ключ запроса должен иметь scope и для resource.
+// Запросы по JWT и анонимные проходят как есть.
+func RequireScope(resource string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := r.Context().Value(apiKeyCtx{}).(apikey.Key)
+		if ok {
+			if scope := requiredScope(resource, r.Method); !key.HasScope(scope) {
+				httpx.Error(w, http.StatusForbidden, httpx.CodeForbidden, "api key lacks scope "+scope)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) bearerIdentity(w http.ResponseWriter, r *http.Request) (authn.Identity, bool) {
+	token, ok := bearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "bearer token required")
+		return authn.Identity{}, false
+	}
+
+	claims, err := a.jwt.Verify(token)
+	if err != nil {
+		log.Printf("[gateway] rejected token: %v", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		httpx.Error(w, http.StatusUnauthorized, httpx.CodeUnauthorized, "invalid token")
+		return authn.Identity{}, false
+	}
+	return authn.Identity{Subject: claims.Subject, Roles: claims.Roles}, true
+}
+
+type clientKey struct{}
+
+func withClient(r *http.Request, client string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientKey{}, client))
+}
+
+// ClientKey идентифицирует клиента для лимитов: "key:<id>" для API-ключа,
+// "user:<sub>" для JWT и "ip:<addr>" для анонимных запросов.
+func ClientKey(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(string); ok {
+		return c
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func requiredScope(resource, method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource + ":read"
+	default:
+		return resource + ":write"
+	}
+}
+
+func bearerToken(h string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(h), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -1,32 +1,234 @@
 package config
 
 import (
+	"fmt"
 	"log"
-	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/gateway/proxy"
+	"HW4/internal/gateway/ratelimit"
+	"HW4/internal/gateway/routes"
+	"HW4/internal/gateway/upstream"
 )
 
+// defaultRateLimits — лимиты по умолчанию: группа=запросы/окно[:burst].
+const defaultRateLimits = "orders=20/1s:40,accounts=20/1s:40,topup=5/1s:10,summary=10/1s:20"
+
 type Config struct {
-	OrdersBaseURL   *url.URL
-	PaymentsBaseURL *url.URL
+	// OrdersURLs и PaymentsURLs — экземпляры сервисов (через запятую в env).
+	OrdersURLs     []string
+	PaymentsURLs   []string
+	OrdersPolicy   string
+	PaymentsPolicy string
+	// UpstreamsFile — YAML с пулами; перечитывается по SIGHUP и имеет приоритет над env.
+	UpstreamsFile string
+	Health        upstream.HealthConfig
+	// RoutesFile — YAML/JSON с таблицей маршрутов; перечитывается по SIGHUP.
+	// Пустое значение — routes.Default().
+	RoutesFile string
+
+	// JWKSFile — набор ключей для проверки JWT. Пустое значение выключает авторизацию.
+	JWKSFile    string
+	JWTIssuer   string
+	JWTAudience string
+
+	// DBDSN — база с API-ключами. Пустое значение — ключи хранятся в памяти до рестарта.
+	DBDSN         string
+	DBAutoMigrate bool
+	// AdminToken — статический bearer для /admin/*, нужен для выпуска первых ключей.
+	AdminToken          string
+	APIKeyCacheTTL      time.Duration
+	APIKeyFlushInterval time.Duration
+
+	// LegacySunset — дата отключения путей без /v1 (общая с сервисами API_LEGACY_SUNSET).
+	LegacySunset time.Time
+
+	// RateLimits — лимиты групп маршрутов. nil — rate limiting выключен.
+	RateLimits map[string]ratelimit.Limit
+
+	// OrdersProxy и PaymentsProxy отличаются только таймаутом, остальное общее.
+	// DefaultProxy — для upstream'ов из GATEWAY_UPSTREAMS_FILE.
+	OrdersProxy   proxy.Config
+	PaymentsProxy proxy.Config
+	DefaultProxy  proxy.Config
+
+	// ShutdownTimeout и WorkerRestartDelay — те же SHUTDOWN_TIMEOUT и
+	// WORKER_RESTART_DELAY, что у Orders и Payments.
+	ShutdownTimeout    time.Duration
+	WorkerRestartDelay time.Duration
 }
 
 func MustLoad() *Config {
+	upstreamsFile := strings.TrimSpace(os.Getenv("GATEWAY_UPSTREAMS_FILE"))
+	// с файлом пулов адреса в env необязательны
+	required := upstreamsFile == ""
 	return &Config{
-		OrdersBaseURL:   mustURL("ORDERS_BASE_URL"),
-		PaymentsBaseURL: mustURL("PAYMENTS_BASE_URL"),
+		OrdersURLs:     mustURLs("ORDERS_BASE_URL", required),
+		PaymentsURLs:   mustURLs("PAYMENTS_BASE_URL", required),
+		OrdersPolicy:   strings.TrimSpace(os.Getenv("GATEWAY_ORDERS_LB_POLICY")),
+		PaymentsPolicy: strings.TrimSpace(os.Getenv("GATEWAY_PAYMENTS_LB_POLICY")),
+		UpstreamsFile:  upstreamsFile,
+		RoutesFile:     strings.TrimSpace(os.Getenv("GATEWAY_ROUTES_FILE")),
+		Health: upstream.HealthConfig{
+			Path:               strings.TrimSpace(os.Getenv("GATEWAY_HEALTH_PATH")),
+			Interval:           mustDuration("GATEWAY_HEALTH_INTERVAL", 5*time.Second),
+			Timeout:            mustDuration("GATEWAY_HEALTH_TIMEOUT", time.Second),
+			UnhealthyThreshold: mustInt("GATEWAY_HEALTH_UNHEALTHY_THRESHOLD", 2),
+			HealthyThreshold:   mustInt("GATEWAY_HEALTH_HEALTHY_THRESHOLD", 1),
+		},
+
+		JWKSFile:    strings.TrimSpace(os.Getenv("GATEWAY_JWKS_FILE")),
+		JWTIssuer:   strings.TrimSpace(os.Getenv("GATEWAY_JWT_ISSUER")),
+		JWTAudience: strings.TrimSpace(os.Getenv("GATEWAY_JWT_AUDIENCE")),
+
+		DBDSN:               strings.TrimSpace(os.Getenv("GATEWAY_DB_DSN")),
+		DBAutoMigrate:       mustBool("GATEWAY_DB_AUTO_MIGRATE", false),
+		AdminToken:          strings.TrimSpace(os.Getenv("GATEWAY_ADMIN_TOKEN")),
+		APIKeyCacheTTL:      mustDuration("GATEWAY_API_KEY_CACHE_TTL", 30*time.Second),
+		APIKeyFlushInterval: mustDuration("GATEWAY_API_KEY_FLUSH_INTERVAL", 10*time.Second),
+		LegacySunset:        mustSunset("API_LEGACY_SUNSET"),
+		RateLimits:          mustRateLimits("GATEWAY_RATE_LIMITS"),
+		OrdersProxy:         upstreamConfig("GATEWAY_ORDERS_TIMEOUT"),
+		PaymentsProxy:       upstreamConfig("GATEWAY_PAYMENTS_TIMEOUT"),
+		DefaultProxy:        upstreamConfig("GATEWAY_UPSTREAM_TIMEOUT"),
+		ShutdownTimeout:     mustDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		WorkerRestartDelay:  mustDuration("WORKER_RESTART_DELAY", time.Second),
+	}
+}
+
+// Proxies — настройки прокси по имени upstream.
+func (c *Config) Proxies() map[string]proxy.Config {
+	return map[string]proxy.Config{"orders": c.OrdersProxy, "payments": c.PaymentsProxy}
+}
+
+// Routes читает таблицу маршрутов. Вызывается при старте и по SIGHUP.
+func (c *Config) Routes() ([]routes.Spec, error) {
+	if c.RoutesFile == "" {
+		return routes.Default(), nil
+	}
+	return routes.Load(c.RoutesFile)
+}
+
+func upstreamConfig(timeoutKey string) proxy.Config {
+	return proxy.Config{
+		Timeout:             mustDuration(timeoutKey, 5*time.Second),
+		DialTimeout:         mustDuration("GATEWAY_UPSTREAM_DIAL_TIMEOUT", 2*time.Second),
+		Retries:             mustInt("GATEWAY_UPSTREAM_RETRIES", 2),
+		RetryBackoff:        mustDuration("GATEWAY_UPSTREAM_RETRY_BACKOFF", 50*time.Millisecond),
+		MaxIdleConns:        mustInt("GATEWAY_UPSTREAM_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost: mustInt("GATEWAY_UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 32),
+		MaxConnsPerHost:     mustInt("GATEWAY_UPSTREAM_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:     mustDuration("GATEWAY_UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+		Breaker: proxy.BreakerConfig{
+			Failures:       mustInt("GATEWAY_BREAKER_FAILURES", 5),
+			OpenTimeout:    mustDuration("GATEWAY_BREAKER_OPEN_TIMEOUT", 10*time.Second),
+			HalfOpenProbes: mustInt("GATEWAY_BREAKER_HALF_OPEN_PROBES", 1),
+		},
+	}
+}
+
+// Upstreams собирает пулы orders и payments: адреса из env, поверх них — файл.
+// Вызывается при старте и по SIGHUP.
+func (c *Config) Upstreams() (map[string]upstream.Spec, error) {
+	specs := map[string]upstream.Spec{}
+	if len(c.OrdersURLs) > 0 {
+		specs["orders"] = upstream.Spec{Policy: c.OrdersPolicy, URLs: c.OrdersURLs}
+	}
+	if len(c.PaymentsURLs) > 0 {
+		specs["payments"] = upstream.Spec{Policy: c.PaymentsPolicy, URLs: c.PaymentsURLs}
+	}
+	if c.UpstreamsFile != "" {
+		fromFile, err := upstream.LoadFile(c.UpstreamsFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, spec := range fromFile {
+			specs[name] = spec
+		}
+	}
+	for _, name := range []string{"orders", "payments"} {
+		if _, ok := specs[name]; !ok {
+			return nil, fmt.Errorf("no urls for upstream %s", name)
+		}
+	}
+	return specs, nil
+}
+
+func mustURLs(envKey string, required bool) []string {
+	raw := strings.TrimSpace(os.Getenv(envKey))
+	if raw == "" {
+		if required {
+			log.Fatalf("missing env %s", envKey)
+		}
+		return nil
 	}
+	list := strings.Split(raw, ",")
+	if _, err := upstream.ParseURLs(list); err != nil {
+		log.Fatalf("bad %s: %v", envKey, err)
+	}
+	return list
 }
 
-func mustURL(envKey string) *url.URL {
+func mustDuration(envKey string, def time.Duration) time.Duration {
 	raw := strings.TrimSpace(os.Getenv(envKey))
 	if raw == "" {
-		log.Fatalf("missing env %s", envKey)
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Fatalf("bad %s=%q: expected positive duration like 30s", envKey, raw)
+	}
+	return d
+}
+
+func mustInt(envKey string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(envKey))
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Fatalf("bad %s=%q: expected non-negative integer", envKey, raw)
+	}
+	return n
+}
+
+func mustBool(envKey string, def bool) bool {
+	raw := strings.TrimSpace(os.Getenv(envKey))
+	if raw == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("bad %s=%q: expected true or false", envKey, raw)
+	}
+	return b
+}
+
+func mustSunset(envKey string) time.Time {
+	t, err := apiversion.ParseSunset(os.Getenv(envKey))
+	if err != nil {
+		log.Fatalf("bad %s: %v", envKey, err)
+	}
+	return t
+}
+
+// mustRateLimits читает лимиты; "off" выключает их, пустое значение — дефолты.
+func mustRateLimits(envKey string) map[string]ratelimit.Limit {
+	raw := strings.TrimSpace(os.Getenv(envKey))
+	switch raw {
+	case "off":
+		return nil
+	case "":
+		raw = defaultRateLimits
 	}
-	u, err := url.Parse(raw)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		log.Fatalf("bad %s=%q: expected like http://host:port", envKey, raw)
+	limits, err := ratelimit.ParseLimits(raw)
+	if err != nil {
+		log.Fatalf("bad %s=%q: %v", envKey, raw, err)
 	}
-	return u
+	return limits
 }
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/apikey"
+)
+
+type rotateRequest struct {
+	// GraceSeconds — сколько секунд старый ключ ещё принимается после ротации.
+	GraceSeconds int64 `json:"grace_seconds"`
+}
+
+// APIKeysHandler — админские эндпоинты выпуска, ротации и отзыва API-ключей.
+type APIKeysHandler struct {
+	keys *apikey.Manager
+}
+
+func NewAPIKeysHandler(keys *apikey.Manager) *APIKeysHandler {
+	return &APIKeysHandler{keys: keys}
+}
+
+func (h *APIKeysHandler) Register(mux *http.ServeMux, wrap func(http.Handler) http.Handler) {
+	mux.Handle("/admin/api-keys", wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.Issue(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.List(w, r)
+			return
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})))
+	mux.Handle("/admin/api-keys/", wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/api-keys/"), "/")
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			h.Get(w, r, id)
+		case action == "" && r.Method == http.MethodDelete, action == "revoke" && r.Method == http.MethodPost:
+			h.Revoke(w, r, id)
+		case action == "rotate" && r.Method == http.MethodPost:
+			h.Rotate(w, r, id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+}
+
+func (h *APIKeysHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	var req apikey.IssueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, "invalid json body")
+		return
+	}
+
+	issued, err := h.keys.Issue(r.Context(), req)
+	if err != nil {
+		writeKeyError(w, err, "failed to issue api key")
+		return
+	}
+	httpx.JSON(w, http.StatusCreated, httpx.SuccessResponse[apikey.Issued]{Data: issued})
+}
+
+func (h *APIKeysHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keys.List(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		writeKeyError(w, err, "failed to list api keys")
+		return
+	}
+	if keys == nil {
+		keys = []apikey.Key{}
+	}
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[[]apikey.Key]{Data: keys})
+}
+
+func (h *APIKeysHandler) Get(w http.ResponseWriter, r *http.Request, id string) {
+	k, err := h.keys.Get(r.Context(), id)
+	if err != nil {
+		writeKeyError(w, err, "failed to get api key")
+		return
+	}
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[apikey.Key]{Data: k})
+}
+
+func (h *APIKeysHandler) Rotate(w http.ResponseWriter, r *http.Request, id string) {
+	var req rotateRequest
+	// тело необязательно: без него старый ключ отключается сразу
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, "invalid json body")
+			return
+		}
+	}
+
+	issued, err := h.keys.Rotate(r.Context(), id, time.Duration(req.GraceSeconds)*time.Second)
+	if err != nil {
+		writeKeyError(w, err, "failed to rotate api key")
+		return
+	}
+	httpx.JSON(w, http.StatusCreated, httpx.SuccessResponse[apikey.Issued]{Data: issued})
+}
+
+func (h *APIKeysHandler) Revoke(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.keys.Revoke(r.Context(), id); err != nil {
+		writeKeyError(w, err, "failed to revoke api key")
+		return
+	}
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[map[string]any]{Data: map[string]any{"status": "revoked"}})
+}
+
+func writeKeyError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, apikey.ErrBadRequest):
+		httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, "owner must be a UUID, expires_at in the future, grace_seconds >= 0")
+	case errors.Is(err, apikey.ErrInvalidScope):
+		httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, "scopes must be a non-empty subset of orders:read, orders:write, accounts:read, accounts:write")
+	case errors.Is(err, apikey.ErrNotFound):
+		httpx.Error(w, http.StatusNotFound, httpx.CodeNotFound, "api key not found")
+	case errors.Is(err, apikey.ErrRevoked), errors.Is(err, apikey.ErrExpired):
+		httpx.Error(w, http.StatusConflict, httpx.CodeConflict, "api key is no longer active")
+	default:
+		httpx.Error(w, http.StatusInternalServerError, httpx.CodeInternal, fallback)
+	}
+}
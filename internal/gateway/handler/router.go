@@ -1,22 +1,105 @@
 package handler
 
 import (
-	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/apikey"
+	"HW4/internal/gateway/auth"
+	"HW4/internal/gateway/proxy"
+	"HW4/internal/gateway/ratelimit"
+	"HW4/internal/gateway/routes"
+	"HW4/internal/gateway/upstream"
 )
 
+// Router проксирует запросы по таблице маршрутов. Таблицу можно заменить на
+// лету (SetRoutes); прокси и их breaker'ы живут дольше таблицы и общие для
+// всех маршрутов одного upstream.
 type Router struct {
-	ordersProxy   *httputil.ReverseProxy
-	paymentsProxy *httputil.ReverseProxy
+	upstreams  *upstream.Registry
+	auth       *auth.Authenticator
+	keys       *apikey.Manager
+	limiter    *ratelimit.Limiter
+	proxyCfg   map[string]proxy.Config
+	defProxy   proxy.Config
+	versioning apiversion.Options
+
+	mu      sync.Mutex
+	proxies map[string]*proxy.Proxy
+
+	table atomic.Pointer[routeTable]
+}
+
+type routeTable struct {
+	*routes.Table
+	handlers map[*routes.Route]http.Handler
+}
+
+// Options — необязательные части gateway.
+type Options struct {
+	// Auth == nil выключает аутентификацию.
+	Auth *auth.Authenticator
+	// Keys == nil не регистрирует админские эндпоинты API-ключей.
+	Keys *apikey.Manager
+	// Limiter == nil выключает rate limiting.
+	Limiter *ratelimit.Limiter
+	// Routes == nil — routes.Default().
+	Routes []routes.Spec
+	// Proxies — таймауты, повторы и breaker по имени upstream; для остальных Proxy.
+	Proxies map[string]proxy.Config
+	Proxy   proxy.Config
+	// Versioning — дата Sunset для путей без /v1.
+	Versioning apiversion.Options
 }
 
-func NewRouter(ordersBase, paymentsBase *url.URL) *Router {
-	return &Router{
-		ordersProxy:   newReverseProxy(ordersBase),
-		paymentsProxy: newReverseProxy(paymentsBase),
+// GroupSummary — группа лимитов встроенного эндпоинта сводки.
+const GroupSummary = "summary"
+
+// NewRouter создаёт роутер gateway поверх пулов upstreams и проверяет таблицу маршрутов.
+func NewRouter(upstreams *upstream.Registry, opts Options) (*Router, error) {
+	rt := &Router{
+		upstreams:  upstreams,
+		auth:       opts.Auth,
+		keys:       opts.Keys,
+		limiter:    opts.Limiter,
+		proxyCfg:   opts.Proxies,
+		defProxy:   opts.Proxy,
+		versioning: opts.Versioning,
+		proxies:    map[string]*proxy.Proxy{},
 	}
+	specs := opts.Routes
+	if specs == nil {
+		specs = routes.Default()
+	}
+	if err := rt.SetRoutes(specs); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// SetRoutes проверяет и атомарно применяет новую таблицу. При ошибке остаётся
+// прежняя. Upstream'ы маршрутов должны уже быть в реестре.
+func (rt *Router) SetRoutes(specs []routes.Spec) error {
+	table, err := routes.Compile(specs, func(name string) bool { return rt.upstreams.Get(name) != nil })
+	if err != nil {
+		return err
+	}
+	compiled := &routeTable{Table: table, handlers: map[*routes.Route]http.Handler{}}
+	for _, route := range table.Routes() {
+		compiled.handlers[route] = rt.routeHandler(route)
+	}
+	rt.table.Store(compiled)
+	return nil
+}
+
+// Routes — действующая таблица.
+func (rt *Router) Routes() *routes.Table {
+	return rt.table.Load().Table
 }
 
 func (rt *Router) Register(mux *http.ServeMux) {
@@ -24,29 +107,87 @@ func (rt *Router) Register(mux *http.ServeMux) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	if rt.keys != nil {
+		NewAPIKeysHandler(rt.keys).Register(mux, rt.auth.RequireAdmin)
+	}
 
-	mux.HandleFunc("/orders", rt.ordersProxy.ServeHTTP)
-	mux.HandleFunc("/orders/", rt.ordersProxy.ServeHTTP)
-	mux.HandleFunc("/accounts", rt.paymentsProxy.ServeHTTP)
-	mux.HandleFunc("/accounts/", rt.paymentsProxy.ServeHTTP)
+	var summary http.Handler
+	if rt.upstreams.Get("orders") != nil && rt.upstreams.Get("payments") != nil {
+		// сводка читает оба ресурса, поэтому ключу нужны orders:read и accounts:read
+		summary = rt.auth.Protect("orders", auth.ModeDefault, auth.RequireScope("accounts",
+			rt.limiter.Middleware(GroupSummary, authn.Middleware(false,
+				NewSummaryHandler(rt.proxy("orders").Client(), rt.proxy("payments").Client())))))
+	}
+	// публичный API версионируется: /v1/... и устаревшие пути без версии
+	// приходят сюда уже с путём без префикса
+	mux.Handle("/", apiversion.Middleware(rt.versioning, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := summaryUserID(r.URL.Path); ok && summary != nil {
+			summary.ServeHTTP(w, r)
+			return
+		}
+		rt.ServeHTTP(w, r)
+	})))
 }
 
-func newReverseProxy(target *url.URL) *httputil.ReverseProxy {
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	origDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		origDirector(req)
-		req.Host = target.Host
-		if req.Header.Get("X-Forwarded-Host") == "" {
-			req.Header.Set("X-Forwarded-Host", req.Host)
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	table := rt.table.Load()
+	route, params, allowed := table.Match(r.Method, r.URL.Path)
+	if route == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			httpx.Error(w, http.StatusMethodNotAllowed, httpx.CodeMethodNotAllowed, "method not allowed")
+			return
 		}
+		httpx.Error(w, http.StatusNotFound, httpx.CodeNotFound, "no route for "+r.URL.Path)
+		return
 	}
 
-	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("[gateway] proxy error: %v", err)
-		http.Error(w, "bad gateway", http.StatusBadGateway)
+	r = r.Clone(r.Context())
+	r.URL.Path = route.UpstreamPath(r.URL.Path, params)
+	r.URL.RawPath = ""
+	table.handlers[route].ServeHTTP(w, r)
+}
+
+// routeHandler собирает цепочку маршрута: аутентификация, затем лимит (ключом
+// должен быть клиент, а не IP), затем заголовки, таймаут и прокси.
+func (rt *Router) routeHandler(route *routes.Route) http.Handler {
+	p := rt.proxy(route.Upstream)
+	forward := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range route.Headers {
+			r.Header.Set(name, value)
+		}
+		if route.Timeout > 0 {
+			r = proxy.WithTimeout(r, route.Timeout)
+		}
+		p.ServeHTTP(w, r)
+	})
+
+	scope := route.Scope
+	if scope == "" {
+		scope = route.Upstream
+	}
+	mode := auth.ModeDefault
+	switch route.Auth {
+	case routes.AuthRequired:
+		mode = auth.ModeRequired
+	case routes.AuthNone:
+		mode = auth.ModeNone
 	}
+	return rt.auth.Protect(scope, mode, rt.limiter.Middleware(route.RateLimit, forward))
+}
 
-	return proxy
+// proxy возвращает прокси upstream'а name, создавая его при первом обращении.
+func (rt *Router) proxy(name string) *proxy.Proxy {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if p, ok := rt.proxies[name]; ok {
+		return p
+	}
+	cfg, ok := rt.proxyCfg[name]
+	if !ok {
+		cfg = rt.defProxy
+	}
+	p := proxy.New(rt.upstreams.Get(name), cfg)
+	rt.proxies[name] = p
+	return p
 }
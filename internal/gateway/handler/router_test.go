@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/authn"
+	"HW4/internal/gateway/apikey"
+	"HW4/internal/gateway/auth"
+	"HW4/internal/gateway/repository/memstore"
+	"HW4/internal/gateway/routes"
+	"HW4/internal/gateway/upstream"
+)
+
+var secret = []byte("router-test-secret")
+
+func hsToken(t *testing.T, sub string, exp time.Time) string {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "HS256"})
+	payload, _ := json.Marshal(map[string]any{"sub": sub, "exp": exp.Unix(), "roles": []string{"user"}})
+	input := enc(header) + "." + enc(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + enc(mac.Sum(nil))
+}
+
+// echoUpstreams поднимает orders и payments, которые отвечают заголовками
+// личности и путём запроса, дошедшими до них.
+func echoUpstreams(t *testing.T) *upstream.Registry {
+	t.Helper()
+	specs := map[string]upstream.Spec{}
+	for _, name := range []string{"orders", "payments"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Seen-Upstream", name)
+			w.Header().Set("X-Seen-Path", r.URL.Path)
+			w.Header().Set("X-Seen-Subject", r.Header.Get(authn.HeaderSubject))
+			w.Header().Set("X-Seen-Roles", r.Header.Get(authn.HeaderRoles))
+			w.Header().Set("X-Seen-Route", r.Header.Get("X-Route"))
+			w.Header().Set("X-Seen-Version", r.Header.Get(apiversion.Header))
+			if d, err := time.ParseDuration(r.URL.Query().Get("sleep")); err == nil {
+				time.Sleep(d)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(srv.Close)
+		specs[name] = upstream.Spec{URLs: []string{srv.URL}}
+	}
+	reg := upstream.NewRegistry(upstream.HealthConfig{})
+	if err := reg.Apply(specs); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func newMux(t *testing.T, reg *upstream.Registry, opts Options) (*http.ServeMux, *Router) {
+	t.Helper()
+	rt, err := NewRouter(reg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	rt.Register(mux)
+	return mux, rt
+}
+
+func TestRouterAuthentication(t *testing.T) {
+	verifier := auth.NewVerifier(auth.KeySet{{Alg: auth.AlgHS256, Secret: secret}}, auth.Options{})
+	const user = "11111111-1111-1111-1111-111111111111"
+
+	tests := []struct {
+		name        string
+		verifier    *auth.Verifier
+		path        string
+		authz       string
+		spoof       string
+		wantCode    int
+		wantSubject string
+	}{
+		{name: "health is public", verifier: verifier, path: "/health", wantCode: http.StatusOK},
+		{name: "missing token", verifier: verifier, path: "/orders", wantCode: http.StatusUnauthorized},
+		{name: "not bearer", verifier: verifier, path: "/orders", authz: "Basic abc", wantCode: http.StatusUnauthorized},
+		{name: "expired token", verifier: verifier, path: "/orders", authz: "Bearer " + hsToken(t, user, time.Now().Add(-time.Hour)), wantCode: http.StatusUnauthorized},
+		{name: "valid token forwards subject", verifier: verifier, path: "/accounts/" + user, authz: "Bearer " + hsToken(t, user, time.Now().Add(time.Hour)), wantCode: http.StatusOK, wantSubject: user},
+		{name: "spoofed header replaced by token subject", verifier: verifier, path: "/orders", authz: "Bearer " + hsToken(t, user, time.Now().Add(time.Hour)), spoof: "admin-user", wantCode: http.StatusOK, wantSubject: user},
+		{name: "auth disabled strips spoofed header", verifier: nil, path: "/orders", spoof: "admin-user", wantCode: http.StatusOK, wantSubject: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, _ := newMux(t, echoUpstreams(t), Options{Auth: auth.NewAuthenticator(tt.verifier, nil, "")})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authz != "" {
+				req.Header.Set("Authorization", tt.authz)
+			}
+			if tt.spoof != "" {
+				req.Header.Set(authn.HeaderSubject, tt.spoof)
+				req.Header.Set(authn.HeaderRoles, authn.RoleAdmin)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Code == http.StatusOK && tt.path != "/health" {
+				if got := rec.Header().Get("X-Seen-Subject"); got != tt.wantSubject {
+					t.Fatalf("upstream saw subject %q, want %q", got, tt.wantSubject)
+				}
+				if got := rec.Header().Get("X-Seen-Roles"); got == authn.RoleAdmin {
+					t.Fatal("spoofed admin role reached upstream")
+				}
+			}
+		})
+	}
+}
+
+func TestRouterAPIKeys(t *testing.T) {
+	const (
+		owner      = "11111111-1111-1111-1111-111111111111"
+		adminToken = "admin-secret"
+	)
+	store := memstore.New()
+	keyAuth := apikey.NewAuthenticator(store, apikey.Options{})
+	mux, _ := newMux(t, echoUpstreams(t), Options{
+		Auth: auth.NewAuthenticator(nil, keyAuth, adminToken),
+		Keys: apikey.NewManager(store, keyAuth),
+	})
+
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	admin := http.Header{"Authorization": {"Bearer " + adminToken}}
+
+	if rec := do(http.MethodPost, "/admin/api-keys", `{"owner":"`+owner+`","scopes":["orders:read"]}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("issue without admin token: status = %d, want 401", rec.Code)
+	}
+
+	rec := do(http.MethodPost, "/admin/api-keys", `{"owner":"`+owner+`","name":"acme","scopes":["orders:read"]}`, admin)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("issue: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var issued struct {
+		Data apikey.Issued `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil || issued.Data.Plain == "" {
+		t.Fatalf("issue response %s: %v", rec.Body, err)
+	}
+	key := http.Header{apikey.HeaderAPIKey: {issued.Data.Plain}}
+
+	rec = do(http.MethodGet, "/orders?user_id="+owner, "", key)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Subject") != owner {
+		t.Fatalf("read with key: status = %d, subject %q", rec.Code, rec.Header().Get("X-Seen-Subject"))
+	}
+	if rec := do(http.MethodPost, "/orders", `{}`, key); rec.Code != http.StatusForbidden {
+		t.Fatalf("write without orders:write: status = %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/accounts/"+owner, "", key); rec.Code != http.StatusForbidden {
+		t.Fatalf("accounts without accounts:read: status = %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/admin/api-keys", "", key); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("admin with api key: status = %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/orders", "", http.Header{apikey.HeaderAPIKey: {"hw4_wrong"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown key: status = %d, want 401", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/admin/api-keys/"+issued.Data.ID+"/revoke", "", admin); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/orders", "", key); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked key: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestRouterRouteTable(t *testing.T) {
+	const user = "11111111-1111-1111-1111-111111111111"
+	reg := echoUpstreams(t)
+	mux, rt := newMux(t, reg, Options{
+		Auth: auth.NewAuthenticator(nil, nil, ""),
+		Routes: []routes.Spec{
+			{Name: "legacy-balance", Pattern: "/wallets/{user_id}/balance", Methods: []string{http.MethodGet}, Upstream: "payments", Rewrite: "/accounts/{user_id}"},
+			{Name: "api-orders", Prefix: "/api/orders", Upstream: "orders", StripPrefix: "/api", Headers: map[string]string{"X-Route": "api-orders"}},
+			{Name: "slow", Prefix: "/slow", Upstream: "orders", Timeout: 20 * time.Millisecond},
+			{Name: "private", Prefix: "/private", Upstream: "orders", Auth: routes.AuthRequired},
+		},
+	})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/wallets/"+user+"/balance")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Upstream") != "payments" || rec.Header().Get("X-Seen-Path") != "/accounts/"+user {
+		t.Fatalf("pattern rewrite: status %d, upstream %q, path %q", rec.Code, rec.Header().Get("X-Seen-Upstream"), rec.Header().Get("X-Seen-Path"))
+	}
+	rec = do(http.MethodPost, "/wallets/"+user+"/balance")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodGet {
+		t.Fatalf("wrong method: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	rec = do(http.MethodGet, "/api/orders/42")
+	if rec.Header().Get("X-Seen-Path") != "/orders/42" || rec.Header().Get("X-Seen-Route") != "api-orders" {
+		t.Fatalf("strip prefix: path %q, injected header %q", rec.Header().Get("X-Seen-Path"), rec.Header().Get("X-Seen-Route"))
+	}
+	if rec := do(http.MethodGet, "/api/ordersx"); rec.Code != http.StatusNotFound {
+		t.Fatalf("prefix must match whole segments: status %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/slow?sleep=200ms"); rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("route timeout: status %d, want 504", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/private"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("auth required without credentials: status %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/orders"); rec.Code != http.StatusNotFound {
+		t.Fatalf("route outside the table: status %d, want 404", rec.Code)
+	}
+
+	// неверная таблица не применяется, старая продолжает работать
+	err := rt.SetRoutes([]routes.Spec{{Name: "bad", Prefix: "/x", Upstream: "missing"}})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("unknown upstream: err = %v", err)
+	}
+	if rec := do(http.MethodGet, "/api/orders"); rec.Code != http.StatusOK {
+		t.Fatalf("old table after failed reload: status %d", rec.Code)
+	}
+	if err := rt.SetRoutes(routes.Default()); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(http.MethodGet, "/orders"); rec.Code != http.StatusOK || rec.Header().Get("X-Seen-Upstream") != "orders" {
+		t.Fatalf("after reload: status %d", rec.Code)
+	}
+}
+
+func TestRouterVersioning(t *testing.T) {
+	sunset := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)
+	mux, _ := newMux(t, echoUpstreams(t), Options{Versioning: apiversion.Options{Sunset: sunset}})
+	do := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/v1/orders/42", nil)
+	h := rec.Header()
+	if rec.Code != http.StatusOK || h.Get("X-Seen-Path") != "/orders/42" || h.Get("X-Seen-Version") != apiversion.V1 {
+		t.Fatalf("/v1: status %d, upstream path %q, version %q", rec.Code, h.Get("X-Seen-Path"), h.Get("X-Seen-Version"))
+	}
+	if h.Get(apiversion.Header) != apiversion.V1 || h.Get("Deprecation") != "" {
+		t.Fatalf("/v1 response headers: %v", h)
+	}
+
+	rec = do("/orders/42", nil)
+	h = rec.Header()
+	if rec.Code != http.StatusOK || h.Get("X-Seen-Version") != apiversion.V1 {
+		t.Fatalf("legacy: status %d, version %q", rec.Code, h.Get("X-Seen-Version"))
+	}
+	if h.Get("Deprecation") == "" || h.Get("Sunset") != "Sun, 31 Jan 2027 00:00:00 GMT" || h.Get("Link") != `</v1/orders/42>; rel="successor-version"` {
+		t.Fatalf("legacy deprecation headers: %v", h)
+	}
+
+	// версия согласована заголовком — путь без префикса не считается устаревшим
+	if rec := do("/orders", http.Header{apiversion.Header: {"v1"}}); rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+		t.Fatalf("negotiated by header: status %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := do("/v2/orders", nil); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "UNSUPPORTED_API_VERSION") {
+		t.Fatalf("unknown version in path: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := do("/orders", http.Header{apiversion.Header: {"v9"}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown version in header: status %d", rec.Code)
+	}
+	if rec := do("/health", nil); rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+		t.Fatalf("/health must stay unversioned: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
+	"HW4/internal/common/money"
+	"HW4/internal/gateway/proxy"
+)
+
+// Состояния разделов сводки.
+const (
+	SectionOK       = "ok"
+	SectionNotFound = "not_found"
+	// SectionDegraded — сервис раздела не ответил; остальные разделы актуальны.
+	SectionDegraded = "degraded"
+)
+
+const (
+	defaultRecentOrders = 5
+	maxRecentOrders     = 50
+)
+
+// paidStatuses — статусы оплаченных заказов; total_spent складывается из их
+// сумм за вычетом возвратов, отдельно по каждой валюте.
+var paidStatuses = map[string]bool{"FINISHED": true, "PARTIALLY_REFUNDED": true, "REFUNDED": true}
+
+// SummaryResponse — сводка пользователя: счёт из payments и заказы из orders.
+type SummaryResponse struct {
+	UserID  string         `json:"user_id"`
+	Account AccountSection `json:"account"`
+	Orders  OrdersSection  `json:"orders"`
+	// Degraded перечисляет разделы, которые собрать не удалось.
+	Degraded []string `json:"degraded"`
+}
+
+// AccountSection: Balance — кошелёк основной валюты счёта Currency.
+type AccountSection struct {
+	Status   string           `json:"status"`
+	Balance  *int64           `json:"balance,omitempty"`
+	Currency string           `json:"currency,omitempty"`
+	Error    *httpx.ErrorBody `json:"error,omitempty"`
+}
+
+type OrdersSection struct {
+	Status         string           `json:"status"`
+	Recent         []SummaryOrder   `json:"recent"`
+	CountsByStatus map[string]int   `json:"counts_by_status"`
+	Total          int              `json:"total"`
+	TotalSpent     map[string]int64 `json:"total_spent"`
+	Error          *httpx.ErrorBody `json:"error,omitempty"`
+}
+
+type SummaryOrder struct {
+	OrderID        string `json:"order_id"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	RefundedAmount int64  `json:"refunded_amount"`
+	Status         string `json:"status"`
+	CreatedAt      string `json:"created_at"`
+	Description    string `json:"description"`
+}
+
+// SummaryHandler отдаёт GET /users/{user_id}/summary: опрашивает payments и
+// orders параллельно и отвечает тем, что удалось собрать.
+type SummaryHandler struct {
+	orders   *http.Client
+	payments *http.Client
+}
+
+// NewSummaryHandler принимает клиентов upstream'ов (см. proxy.Proxy.Client).
+func NewSummaryHandler(orders, payments *http.Client) *SummaryHandler {
+	return &SummaryHandler{orders: orders, payments: payments}
+}
+
+// summaryUserID достаёт user_id из пути /users/{user_id}/summary.
+func summaryUserID(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/users/")
+	if !ok {
+		return "", false
+	}
+	id, tail, _ := strings.Cut(rest, "/")
+	return id, tail == "summary"
+}
+
+func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		httpx.Error(w, http.StatusMethodNotAllowed, httpx.CodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	userID, _ := summaryUserID(r.URL.Path)
+	if uuid.Validate(userID) != nil {
+		httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, "user_id must be a uuid")
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Error(w, http.StatusForbidden, httpx.CodeForbidden, "user_id does not match authenticated user")
+		return
+	}
+	recent := defaultRecentOrders
+	if raw := r.URL.Query().Get("recent"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxRecentOrders {
+			httpx.Error(w, http.StatusBadRequest, httpx.CodeBadRequest, fmt.Sprintf("recent must be between 0 and %d", maxRecentOrders))
+			return
+		}
+		recent = n
+	}
+
+	resp := SummaryResponse{UserID: userID, Degraded: []string{}}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		resp.Account = h.account(r, userID)
+	}()
+	go func() {
+		defer wg.Done()
+		resp.Orders = h.orderStats(r, userID, recent)
+	}()
+	wg.Wait()
+
+	if resp.Account.Status == SectionDegraded {
+		resp.Degraded = append(resp.Degraded, "account")
+	}
+	if resp.Orders.Status == SectionDegraded {
+		resp.Degraded = append(resp.Degraded, "orders")
+	}
+	if len(resp.Degraded) == 2 {
+		httpx.Error(w, http.StatusServiceUnavailable, httpx.CodeUpstreamUnavailable, "orders and payments are unavailable")
+		return
+	}
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[SummaryResponse]{Data: resp})
+}
+
+func (h *SummaryHandler) account(r *http.Request, userID string) AccountSection {
+	var body httpx.SuccessResponse[struct {
+		Balance  int64  `json:"balance"`
+		Currency string `json:"currency"`
+	}]
+	status, errBody := getJSON(r, h.payments, "/accounts/"+url.PathEscape(userID), &body)
+	switch {
+	case errBody == nil:
+		return AccountSection{Status: SectionOK, Balance: &body.Data.Balance, Currency: money.Or(body.Data.Currency)}
+	case status == http.StatusNotFound:
+		return AccountSection{Status: SectionNotFound}
+	default:
+		return AccountSection{Status: SectionDegraded, Error: errBody}
+	}
+}
+
+func (h *SummaryHandler) orderStats(r *http.Request, userID string, recent int) OrdersSection {
+	var body httpx.SuccessResponse[struct {
+		Orders []SummaryOrder `json:"orders"`
+	}]
+	_, errBody := getJSON(r, h.orders, "/orders?user_id="+url.QueryEscape(userID), &body)
+	if errBody != nil {
+		return OrdersSection{
+			Status: SectionDegraded, Recent: []SummaryOrder{}, CountsByStatus: map[string]int{}, TotalSpent: map[string]int64{}, Error: errBody,
+		}
+	}
+
+	// orders отдаёт заказы от новых к старым
+	orders := body.Data.Orders
+	out := OrdersSection{
+		Status:         SectionOK,
+		Recent:         orders[:min(recent, len(orders))],
+		CountsByStatus: map[string]int{},
+		Total:          len(orders),
+		TotalSpent:     map[string]int64{},
+	}
+	if out.Recent == nil {
+		out.Recent = []SummaryOrder{}
+	}
+	for i := range orders {
+		// заказы без валюты созданы до мультивалютности
+		orders[i].Currency = money.Or(orders[i].Currency)
+		o := orders[i]
+		out.CountsByStatus[o.Status]++
+		if paidStatuses[o.Status] {
+			out.TotalSpent[o.Currency] += o.Amount - o.RefundedAmount
+		}
+	}
+	return out
+}
+
+// getJSON выполняет GET к upstream от имени пользователя запроса r.
+// Ошибка возвращается в виде тела для раздела сводки.
+func getJSON(r *http.Request, client *http.Client, path string, out any) (int, *httpx.ErrorBody) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "http://upstream"+path, nil)
+	if err != nil {
+		return 0, &httpx.ErrorBody{Code: httpx.CodeInternal, Message: err.Error()}
+	}
+	for _, name := range []string{authn.HeaderSubject, authn.HeaderRoles, apiversion.Header, httpx.HeaderRequestID} {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, upstreamError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e httpx.ErrorResponse
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e) != nil || e.Error.Code == "" {
+			e.Error = httpx.ErrorBody{Code: httpx.CodeUpstreamError, Message: "unexpected status " + strconv.Itoa(resp.StatusCode)}
+		}
+		return resp.StatusCode, &e.Error
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, &httpx.ErrorBody{Code: httpx.CodeUpstreamError, Message: "malformed upstream response"}
+	}
+	return resp.StatusCode, nil
+}
+
+func upstreamError(err error) *httpx.ErrorBody {
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()):
+		return &httpx.ErrorBody{Code: httpx.CodeUpstreamTimeout, Message: "upstream did not respond in time"}
+	case errors.Is(err, proxy.ErrBreakerOpen):
+		return &httpx.ErrorBody{Code: httpx.CodeUpstreamUnavailable, Message: "upstream is temporarily unavailable"}
+	default:
+		return &httpx.ErrorBody{Code: httpx.CodeUpstreamUnavailable, Message: "upstream is unavailable"}
+	}
+}
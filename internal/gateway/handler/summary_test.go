@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/auth"
+	"HW4/internal/gateway/proxy"
+	"HW4/internal/gateway/upstream"
+)
+
+const summaryUser = "11111111-1111-1111-1111-111111111111"
+
+// summaryUpstreams поднимает orders и payments с заданными обработчиками.
+func summaryUpstreams(t *testing.T, orders, payments http.HandlerFunc) *upstream.Registry {
+	t.Helper()
+	specs := map[string]upstream.Spec{}
+	for name, h := range map[string]http.HandlerFunc{"orders": orders, "payments": payments} {
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		specs[name] = upstream.Spec{URLs: []string{srv.URL}}
+	}
+	reg := upstream.NewRegistry(upstream.HealthConfig{})
+	if err := reg.Apply(specs); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func ordersOK(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orders" || r.URL.Query().Get("user_id") != summaryUser {
+			t.Errorf("orders called with %s", r.URL)
+		}
+		if got := r.Header.Get(authn.HeaderSubject); got != "" && got != summaryUser {
+			t.Errorf("orders saw subject %q", got)
+		}
+		orders := []SummaryOrder{
+			{OrderID: "o5", Amount: 7, Currency: "KZT", Status: "FINISHED"},
+			{OrderID: "o4", Amount: 40, Currency: "RUB", Status: "NEW"},
+			{OrderID: "o3", Amount: 30, Currency: "RUB", Status: "FINISHED"},
+			{OrderID: "o2", Amount: 20, Currency: "RUB", Status: "FAILED"},
+			{OrderID: "o1", Amount: 10, RefundedAmount: 4, Status: "PARTIALLY_REFUNDED"},
+		}
+		httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[map[string]any]{Data: map[string]any{"orders": orders}})
+	}
+}
+
+func balanceOK(w http.ResponseWriter, r *http.Request) {
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[map[string]any]{Data: map[string]any{"user_id": summaryUser, "balance": 500}})
+}
+
+func getSummary(t *testing.T, mux http.Handler, path string) (*httptest.ResponseRecorder, SummaryResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body httpx.SuccessResponse[SummaryResponse]
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+	}
+	return rec, body.Data
+}
+
+func TestSummaryAggregates(t *testing.T) {
+	mux, _ := newMux(t, summaryUpstreams(t, ordersOK(t), balanceOK), Options{})
+
+	rec, s := getSummary(t, mux, "/v1/users/"+summaryUser+"/summary?recent=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if s.Account.Status != SectionOK || s.Account.Balance == nil || *s.Account.Balance != 500 {
+		t.Fatalf("account = %+v", s.Account)
+	}
+	o := s.Orders
+	if o.Status != SectionOK || o.Total != 5 || len(o.Recent) != 2 || o.Recent[0].OrderID != "o5" {
+		t.Fatalf("orders = %+v", o)
+	}
+	// o1 без валюты — заказ до мультивалютности, он в рублях
+	if len(o.TotalSpent) != 2 || o.TotalSpent["RUB"] != 36 || o.TotalSpent["KZT"] != 7 {
+		t.Fatalf("total spent = %v, want RUB 36 and KZT 7", o.TotalSpent)
+	}
+	if o.CountsByStatus["FINISHED"] != 2 || o.CountsByStatus["PARTIALLY_REFUNDED"] != 1 || o.CountsByStatus["NEW"] != 1 || o.CountsByStatus["FAILED"] != 1 {
+		t.Fatalf("counts = %v", o.CountsByStatus)
+	}
+	if len(s.Degraded) != 0 {
+		t.Fatalf("degraded = %v", s.Degraded)
+	}
+}
+
+func TestSummaryPartialFailure(t *testing.T) {
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "db is down")
+	}
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		balanceOK(w, r)
+	}
+	missing := func(w http.ResponseWriter, r *http.Request) {
+		httpx.Error(w, http.StatusNotFound, "NOT_FOUND", "account not found")
+	}
+
+	t.Run("payments fails", func(t *testing.T) {
+		mux, _ := newMux(t, summaryUpstreams(t, ordersOK(t), failing), Options{})
+		rec, s := getSummary(t, mux, "/users/"+summaryUser+"/summary")
+		if rec.Code != http.StatusOK || s.Account.Status != SectionDegraded || s.Account.Error.Code != "INTERNAL" {
+			t.Fatalf("status %d, account %+v", rec.Code, s.Account)
+		}
+		if s.Orders.Status != SectionOK || len(s.Degraded) != 1 || s.Degraded[0] != "account" {
+			t.Fatalf("orders %s, degraded %v", s.Orders.Status, s.Degraded)
+		}
+	})
+
+	t.Run("payments times out", func(t *testing.T) {
+		reg := summaryUpstreams(t, ordersOK(t), slow)
+		mux, _ := newMux(t, reg, Options{Proxies: map[string]proxy.Config{"payments": {Timeout: 50 * time.Millisecond}}})
+		rec, s := getSummary(t, mux, "/users/"+summaryUser+"/summary")
+		if rec.Code != http.StatusOK || s.Account.Status != SectionDegraded || s.Account.Error.Code != "UPSTREAM_TIMEOUT" {
+			t.Fatalf("status %d, account %+v", rec.Code, s.Account)
+		}
+	})
+
+	t.Run("no account is not degradation", func(t *testing.T) {
+		mux, _ := newMux(t, summaryUpstreams(t, ordersOK(t), missing), Options{})
+		_, s := getSummary(t, mux, "/users/"+summaryUser+"/summary")
+		if s.Account.Status != SectionNotFound || len(s.Degraded) != 0 {
+			t.Fatalf("account %+v, degraded %v", s.Account, s.Degraded)
+		}
+	})
+
+	t.Run("both fail", func(t *testing.T) {
+		mux, _ := newMux(t, summaryUpstreams(t, failing, failing), Options{})
+		if rec, _ := getSummary(t, mux, "/users/"+summaryUser+"/summary"); rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want 503", rec.Code)
+		}
+	})
+}
+
+func TestSummaryAccess(t *testing.T) {
+	verifier := auth.NewVerifier(auth.KeySet{{Alg: auth.AlgHS256, Secret: secret}}, auth.Options{})
+	mux, _ := newMux(t, summaryUpstreams(t, ordersOK(t), balanceOK), Options{Auth: auth.NewAuthenticator(verifier, nil, "")})
+
+	do := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	own := hsToken(t, summaryUser, time.Now().Add(time.Hour))
+	other := hsToken(t, "22222222-2222-2222-2222-222222222222", time.Now().Add(time.Hour))
+
+	if code := do("/users/"+summaryUser+"/summary", ""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: status = %d, want 401", code)
+	}
+	if code := do("/users/"+summaryUser+"/summary", other); code != http.StatusForbidden {
+		t.Fatalf("other user: status = %d, want 403", code)
+	}
+	if code := do("/users/"+summaryUser+"/summary", own); code != http.StatusOK {
+		t.Fatalf("own summary: status = %d, want 200", code)
+	}
+	if code := do("/users/not-a-uuid/summary", own); code != http.StatusBadRequest {
+		t.Fatalf("bad user_id: status = %d, want 400", code)
+	}
+	if code := do("/users/"+summaryUser+"/other", own); code != http.StatusNotFound {
+		t.Fatalf("other /users path: status = %d, want 404 from the route table", code)
+	}
+}
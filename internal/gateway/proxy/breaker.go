@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen — upstream отключён circuit breaker'ом, запрос не отправлялся.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+type BreakerConfig struct {
+	// Failures — сколько ошибок подряд размыкают цепь.
+	Failures int
+	// OpenTimeout — сколько цепь остаётся разомкнутой до пробных запросов.
+	OpenTimeout time.Duration
+	// HalfOpenProbes — сколько пробных запросов одновременно пускается в half-open.
+	HalfOpenProbes int
+}
+
+func (c *BreakerConfig) setDefaults() {
+	if c.Failures <= 0 {
+		c.Failures = 5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 10 * time.Second
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = 1
+	}
+}
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker — circuit breaker одного upstream. В closed считает ошибки подряд и
+// после cfg.Failures размыкается; через OpenTimeout пускает пробные запросы
+// (half-open): успех замыкает цепь, ошибка снова размыкает.
+type Breaker struct {
+	name string
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	cfg.setDefaults()
+	return &Breaker{name: name, cfg: cfg, now: time.Now}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow решает, можно ли отправить запрос. После разрешённого запроса нужно
+// вызвать Record с его исходом или Release, если исход ничего не говорит
+// о здоровье upstream (например, клиент сам отменил запрос).
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrBreakerOpen
+		}
+		b.setState(StateHalfOpen)
+		b.probes = 0
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return ErrBreakerOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *Breaker) Record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		if ok {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.trip()
+		}
+	case StateHalfOpen:
+		if ok {
+			b.failures = 0
+			b.setState(StateClosed)
+			return
+		}
+		b.trip()
+	case StateOpen:
+		// ответ на запрос, начатый до размыкания: ничего не меняет
+	}
+}
+
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// RetryAfter — сколько осталось до пробных запросов.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	if d := b.cfg.OpenTimeout - b.now().Sub(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (b *Breaker) trip() {
+	b.openedAt = b.now()
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state != s {
+		log.Printf("[gateway] breaker %s: %s -> %s", b.name, b.state, s)
+	}
+	b.state = s
+}
@@ -0,0 +1,271 @@
+// Package proxy — reverse proxy gateway к сервисам: балансировка между
+// экземплярами, таймауты на upstream, circuit breaker, повторы для
+// идемпотентных запросов и настроенный пул соединений.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/upstream"
+)
+
+type Config struct {
+	// Timeout ограничивает весь обмен с upstream, включая повторы.
+	Timeout     time.Duration
+	DialTimeout time.Duration
+	// Retries — дополнительные попытки для идемпотентных запросов без тела.
+	Retries      int
+	RetryBackoff time.Duration
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost == 0 — без ограничения.
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+
+	Breaker BreakerConfig
+}
+
+func (c *Config) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 2 * time.Second
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 50 * time.Millisecond
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = 100
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 32
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = 90 * time.Second
+	}
+}
+
+// Proxy проксирует запросы в пул экземпляров одного сервиса.
+type Proxy struct {
+	name    string
+	timeout time.Duration
+	breaker *Breaker
+	rp      *httputil.ReverseProxy
+}
+
+// New создаёт proxy к экземплярам pool. Экземпляр выбирается на каждую
+// попытку, поэтому повтор уходит на другой, а обновление пула сразу видно.
+func New(pool *upstream.Pool, cfg Config) *Proxy {
+	cfg.setDefaults()
+	name := pool.Name()
+	p := &Proxy{
+		name:    name,
+		timeout: cfg.Timeout,
+		breaker: NewBreaker(name, cfg.Breaker),
+	}
+
+	rp := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			if req.Header.Get("X-Forwarded-Host") == "" {
+				req.Header.Set("X-Forwarded-Host", req.Host)
+			}
+			// адрес экземпляра подставляет transport
+			req.URL.Scheme = "http"
+			req.URL.Host = name
+		},
+	}
+	rp.Transport = &transport{
+		base:    newTransport(cfg),
+		pool:    pool,
+		breaker: p.breaker,
+		retries: cfg.Retries,
+		backoff: cfg.RetryBackoff,
+	}
+	rp.ErrorHandler = p.handleError
+	p.rp = rp
+	return p
+}
+
+func (p *Proxy) Breaker() *Breaker { return p.breaker }
+
+// Client — HTTP-клиент к экземплярам upstream с той же балансировкой,
+// повторами, breaker'ом и таймаутом, что у прокси. Хост в URL запроса
+// не важен: его подменяет transport.
+func (p *Proxy) Client() *http.Client {
+	return &http.Client{Transport: p.rp.Transport, Timeout: p.timeout}
+}
+
+type timeoutKey struct{}
+
+// WithTimeout задаёт таймаут обмена с upstream для одного запроса вместо
+// Config.Timeout: так маршрут может дать сервису больше или меньше времени.
+func WithTimeout(r *http.Request, d time.Duration) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), timeoutKey{}, d))
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := p.timeout
+	if d, ok := r.Context().Value(timeoutKey{}).(time.Duration); ok && d > 0 {
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	p.rp.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrBreakerOpen):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.breaker.RetryAfter().Seconds()))))
+		httpx.Error(w, http.StatusServiceUnavailable, httpx.CodeUpstreamUnavailable, p.name+" is temporarily unavailable")
+	case errors.Is(err, upstream.ErrNoHealthy):
+		log.Printf("[gateway] %s %s %s: %v", p.name, r.Method, r.URL.Path, err)
+		httpx.Error(w, http.StatusServiceUnavailable, httpx.CodeUpstreamUnavailable, p.name+" has no healthy instances")
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		log.Printf("[gateway] %s %s %s: timeout: %v", p.name, r.Method, r.URL.Path, err)
+		httpx.Error(w, http.StatusGatewayTimeout, httpx.CodeUpstreamTimeout, p.name+" did not respond in time")
+	case errors.Is(err, context.Canceled):
+		// клиент ушёл сам, отвечать некому
+	default:
+		log.Printf("[gateway] %s %s %s: %v", p.name, r.Method, r.URL.Path, err)
+		httpx.Error(w, http.StatusBadGateway, httpx.CodeUpstreamUnavailable, p.name+" is unavailable")
+	}
+}
+
+func newTransport(cfg Config) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.DialTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+}
+
+// transport выбирает экземпляр, отправляет запрос через breaker и повторяет
+// идемпотентные запросы при сетевых ошибках и ответах 502/503/504.
+type transport struct {
+	base    http.RoundTripper
+	pool    *upstream.Pool
+	breaker *Breaker
+	retries int
+	backoff time.Duration
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if retryable(req) {
+		attempts += t.retries
+	}
+
+	var prev *upstream.Instance
+	for i := 0; ; i++ {
+		in, err := t.pool.Pick(req, prev)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.breaker.Allow(); err != nil {
+			return nil, err
+		}
+		prev = in
+
+		release := in.Acquire()
+		resp, err := t.base.RoundTrip(toInstance(req, in))
+		if err != nil && req.Context().Err() != nil {
+			// таймаут всего запроса или отмена клиентом — не повод винить upstream
+			release()
+			t.breaker.Release()
+			return nil, err
+		}
+		if err != nil {
+			release()
+			// пассивная проверка: сетевые ошибки выводят экземпляр из ротации
+			// так же, как неудачные health-check'и
+			t.pool.ReportRequestFailure(in, err)
+		} else {
+			// запрос к экземпляру активен, пока проксируется тело ответа
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		}
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		t.breaker.Record(!failed)
+
+		if i+1 >= attempts || !(err != nil || retryStatus(resp.StatusCode)) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(t.backoff * time.Duration(i+1)):
+		}
+	}
+}
+
+// toInstance направляет запрос на экземпляр in, учитывая путь в его URL.
+func toInstance(req *http.Request, in *upstream.Instance) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = in.URL.Scheme
+	out.URL.Host = in.URL.Host
+	if base := strings.TrimSuffix(in.URL.Path, "/"); base != "" {
+		out.URL.Path = base + req.URL.Path
+		out.URL.RawPath = ""
+	}
+	out.Host = in.URL.Host
+	return out
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// retryable — только идемпотентные методы без тела: тело уже прочитано
+// первой попыткой и повторить его нельзя.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+func retryStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"HW4/internal/common/httpx"
+	"HW4/internal/gateway/upstream"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := NewBreaker("test", BreakerConfig{Failures: 2, OpenTimeout: time.Second, HalfOpenProbes: 1})
+	b.now = func() time.Time { return now }
+
+	expect := func(step string, wantAllow bool, wantState State) {
+		t.Helper()
+		if allowed := b.Allow() == nil; allowed != wantAllow {
+			t.Fatalf("%s: allow = %v, want %v", step, allowed, wantAllow)
+		}
+		if got := b.State(); got != wantState {
+			t.Fatalf("%s: state = %s, want %s", step, got, wantState)
+		}
+	}
+
+	expect("closed allows", true, StateClosed)
+	b.Record(false)
+	expect("one failure keeps closed", true, StateClosed)
+	b.Record(false)
+	expect("second failure opens", false, StateOpen)
+
+	now = now.Add(time.Second)
+	expect("probe after open timeout", true, StateHalfOpen)
+	expect("only one probe at a time", false, StateHalfOpen)
+	b.Record(false)
+	expect("failed probe reopens", false, StateOpen)
+
+	now = now.Add(time.Second)
+	expect("next probe", true, StateHalfOpen)
+	b.Record(true)
+	expect("successful probe closes", true, StateClosed)
+	b.Record(true)
+
+	// отменённый запрос освобождает место пробы, не меняя состояния
+	b.Record(false)
+	b.Record(false)
+	now = now.Add(time.Second)
+	expect("probe", true, StateHalfOpen)
+	b.Release()
+	expect("released probe slot", true, StateHalfOpen)
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body httpx.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not an ErrorResponse: %s", rec.Body)
+	}
+	return body.Error.Code
+}
+
+func pool(t *testing.T, name string, targets ...*url.URL) *upstream.Pool {
+	t.Helper()
+	p, err := upstream.NewPool(name, targets, upstream.PolicyRoundRobin, upstream.HealthConfig{UnhealthyThreshold: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func serve(p *Proxy, method string) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader(`{}`)
+	} else {
+		body = strings.NewReader("")
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(method, "/orders", body))
+	return rec
+}
+
+func TestRetriesOnlyIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// первые два вызова падают, дальше upstream здоров
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	cfg := Config{Retries: 2, RetryBackoff: time.Millisecond, Breaker: BreakerConfig{Failures: 100}}
+
+	if rec := serve(New(pool(t, "orders", target), cfg), http.MethodGet); rec.Code != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("GET: status %d after %d calls, want 200 after 3", rec.Code, calls.Load())
+	}
+
+	calls.Store(0)
+	if rec := serve(New(pool(t, "orders", target), cfg), http.MethodPost); rec.Code != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Fatalf("POST: status %d after %d calls, want 503 after 1", rec.Code, calls.Load())
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+	target, _ := url.Parse(upstream.URL)
+
+	rec := serve(New(pool(t, "payments", target), Config{Timeout: 50 * time.Millisecond}), http.MethodGet)
+	if rec.Code != http.StatusGatewayTimeout || errorCode(t, rec) != "UPSTREAM_TIMEOUT" {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUnavailableUpstreamOpensBreaker(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	p := New(pool(t, "orders", target), Config{Retries: 0, Breaker: BreakerConfig{Failures: 2, OpenTimeout: time.Minute}})
+	for i := 0; i < 2; i++ {
+		rec := serve(p, http.MethodGet)
+		if rec.Code != http.StatusBadGateway || errorCode(t, rec) != "UPSTREAM_UNAVAILABLE" {
+			t.Fatalf("attempt %d: status %d, body %s", i, rec.Code, rec.Body)
+		}
+	}
+
+	rec := serve(p, http.MethodGet)
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "UPSTREAM_UNAVAILABLE" {
+		t.Fatalf("open breaker: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("open breaker must set Retry-After")
+	}
+}
+
+func TestFailoverToHealthyInstance(t *testing.T) {
+	var served atomic.Int32
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer alive.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	aliveURL, _ := url.Parse(alive.URL)
+	deadURL, _ := url.Parse(dead.URL)
+
+	pl := pool(t, "orders", deadURL, aliveURL)
+	p := New(pl, Config{Retries: 1, RetryBackoff: time.Millisecond, Breaker: BreakerConfig{Failures: 100}})
+	for i := 0; i < 4; i++ {
+		if rec := serve(p, http.MethodGet); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, body %s", i, rec.Code, rec.Body)
+		}
+	}
+	if served.Load() != 4 {
+		t.Fatalf("alive instance served %d requests, want 4", served.Load())
+	}
+	for _, in := range pl.Instances() {
+		if in.URL.Host == deadURL.Host && in.Healthy() {
+			t.Fatal("dead instance must be evicted after a connection error")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full — момент, когда ведро наполнится; после него запись можно удалить.
+	full time.Time
+}
+
+// Memory — Backend в памяти процесса.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// sweepEvery — как часто удалять вёдра неактивных клиентов.
+const sweepEvery = time.Minute
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	capacity := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+
+	d := Decision{Allowed: b.tokens >= 1}
+	if d.Allowed {
+		b.tokens--
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.ResetAfter = seconds((capacity - b.tokens) / limit.Rate)
+	b.full = now.Add(d.ResetAfter)
+	return d, nil
+}
+
+// sweep удаляет полные вёдра: их состояние совпадает с состоянием нового ведра.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"HW4/internal/common/httpx"
+)
+
+// KeyFunc определяет клиента запроса: API-ключ, пользователя или IP.
+type KeyFunc func(r *http.Request) string
+
+// Limiter применяет лимиты групп маршрутов к запросам.
+type Limiter struct {
+	backend Backend
+	limits  map[string]Limit
+	key     KeyFunc
+}
+
+func New(backend Backend, limits map[string]Limit, key KeyFunc) *Limiter {
+	return &Limiter{backend: backend, limits: limits, key: key}
+}
+
+// Middleware ограничивает запросы группы group. Для группы без лимита и при
+// l == nil запросы проходят как есть. Ошибка backend не должна класть API,
+// поэтому в этом случае запрос пропускается (fail open).
+func (l *Limiter) Middleware(group string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	limit, ok := l.limits[group]
+	if !ok {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, err := l.backend.Take(r.Context(), group+"|"+l.key(r), limit)
+		if err != nil {
+			log.Printf("[gateway] rate limit backend: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(d.ResetAfter))
+		h.Set("RateLimit-Policy", limit.Policy())
+		if !d.Allowed {
+			h.Set("Retry-After", ceilSeconds(d.RetryAfter))
+			httpx.Error(w, http.StatusTooManyRequests, httpx.CodeRateLimited, "too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
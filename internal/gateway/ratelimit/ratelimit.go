@@ -0,0 +1,125 @@
+// Package ratelimit ограничивает частоту запросов на gateway алгоритмом
+// token bucket: у каждого клиента в каждой группе маршрутов своё ведро ёмкостью
+// Burst, которое наполняется со скоростью Rate токенов в секунду.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Limit struct {
+	// Rate — токенов в секунду.
+	Rate float64
+	// Burst — ёмкость ведра, т.е. сколько запросов можно сделать подряд.
+	Burst int
+	// requests и window — исходная запись лимита для заголовка RateLimit-Policy.
+	requests int
+	window   time.Duration
+}
+
+// Per задаёт лимит «requests запросов за window» с ведром на burst запросов.
+func Per(requests int, window time.Duration, burst int) Limit {
+	if burst <= 0 {
+		burst = requests
+	}
+	return Limit{
+		Rate:     float64(requests) / window.Seconds(),
+		Burst:    burst,
+		requests: requests,
+		window:   window,
+	}
+}
+
+// Policy — значение заголовка RateLimit-Policy, например `100;w=60;burst=200`.
+func (l Limit) Policy() string {
+	w := int(math.Ceil(l.window.Seconds()))
+	return fmt.Sprintf("%d;w=%d;burst=%d", l.requests, w, l.Burst)
+}
+
+// Decision — результат попытки взять токен.
+type Decision struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter — через сколько появится следующий токен (0, если запрос пропущен).
+	RetryAfter time.Duration
+	// ResetAfter — через сколько ведро наполнится целиком.
+	ResetAfter time.Duration
+}
+
+// Backend хранит состояние вёдер. Memory подходит для одного экземпляра
+// gateway; для нескольких реплик нужна общая реализация (например, Redis
+// со скриптом, выполняющим тот же расчёт атомарно).
+type Backend interface {
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// ParseLimits разбирает список вида `orders=100/1m:200,topup=10/1m`.
+// Формат записи: группа=запросы/окно[:burst]; без burst ведро равно числу запросов.
+func ParseLimits(raw string) (map[string]Limit, error) {
+	out := map[string]Limit{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		group, spec, ok := strings.Cut(part, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("rate limit %q: expected group=requests/window[:burst]", part)
+		}
+		l, err := parseLimit(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", part, err)
+		}
+		out[group] = l
+	}
+	return out, nil
+}
+
+func parseLimit(spec string) (Limit, error) {
+	spec, burstRaw, hasBurst := strings.Cut(spec, ":")
+	reqRaw, windowRaw, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("expected requests/window")
+	}
+	requests, err := strconv.Atoi(reqRaw)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("requests must be a positive integer")
+	}
+	// «10/s» читается как «10/1s»
+	if windowRaw != "" && (windowRaw[0] < '0' || windowRaw[0] > '9') {
+		windowRaw = "1" + windowRaw
+	}
+	window, err := time.ParseDuration(windowRaw)
+	if err != nil || window <= 0 {
+		return Limit{}, fmt.Errorf("window must be a positive duration like 1s or 1m")
+	}
+	burst := 0
+	if hasBurst {
+		if burst, err = strconv.Atoi(burstRaw); err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("burst must be a positive integer")
+		}
+	}
+	return Per(requests, window, burst), nil
+}
+
+// FormatLimits — обратная к ParseLimits запись, для логов.
+func FormatLimits(limits map[string]Limit) string {
+	groups := make([]string, 0, len(limits))
+	for g := range limits {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	parts := make([]string, 0, len(groups))
+	for _, g := range groups {
+		l := limits[g]
+		parts = append(parts, fmt.Sprintf("%s=%d/%s:%d", g, l.requests, l.window, l.Burst))
+	}
+	return strings.Join(parts, ",")
+}
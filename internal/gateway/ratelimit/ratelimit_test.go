@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		raw       string
+		wantErr   bool
+		group     string
+		wantRate  float64
+		wantBurst int
+	}{
+		{raw: "orders=100/1m:200", group: "orders", wantRate: 100.0 / 60, wantBurst: 200},
+		{raw: "topup=10/s", group: "topup", wantRate: 10, wantBurst: 10},
+		{raw: " orders = 5/2s , topup=1/1h", group: "orders", wantRate: 2.5, wantBurst: 5},
+		{raw: "orders", wantErr: true},
+		{raw: "orders=0/1s", wantErr: true},
+		{raw: "orders=10/zz", wantErr: true},
+		{raw: "orders=10/1s:-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			limits, err := ParseLimits(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			l := limits[tt.group]
+			if l.Rate != tt.wantRate || l.Burst != tt.wantBurst {
+				t.Fatalf("limit = %+v, want rate %v burst %d", l, tt.wantRate, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := Per(2, time.Second, 3)
+
+	for i := 0; i < 3; i++ {
+		d, _ := m.Take(ctx, "a", limit)
+		if !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("take %d: %+v", i, d)
+		}
+	}
+	d, _ := m.Take(ctx, "a", limit)
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("exhausted bucket: %+v", d)
+	}
+
+	// другой клиент не делит ведро
+	if d, _ := m.Take(ctx, "b", limit); !d.Allowed {
+		t.Fatal("separate key must have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := m.Take(ctx, "a", limit); !d.Allowed {
+		t.Fatalf("token must refill after 500ms: %+v", d)
+	}
+
+	// ведро не наполняется выше burst
+	now = now.Add(time.Hour)
+	d, _ = m.Take(ctx, "a", limit)
+	if d.Remaining != 2 {
+		t.Fatalf("remaining after long idle = %d, want 2", d.Remaining)
+	}
+}
+
+type failingBackend struct{}
+
+func (failingBackend) Take(context.Context, string, Limit) (Decision, error) {
+	return Decision{}, errors.New("backend down")
+}
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	byHeader := func(r *http.Request) string { return r.Header.Get("X-Client") }
+	limits := map[string]Limit{"topup": Per(1, time.Minute, 1)}
+
+	l := New(NewMemory(), limits, byHeader)
+	h := l.Middleware("topup", ok)
+	call := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/topup", nil)
+		req.Header.Set("X-Client", client)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call("alice")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first call status = %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "1;w=60;burst=1",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	rec = call("alice")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("second call: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := call("bob"); rec.Code != http.StatusOK {
+		t.Fatalf("other client status = %d", rec.Code)
+	}
+
+	// группа без лимита не ограничивается
+	rec = httptest.NewRecorder()
+	l.Middleware("orders", ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Fatal("group without limit must pass through")
+	}
+
+	// отказ backend не блокирует трафик
+	rec = httptest.NewRecorder()
+	New(failingBackend{}, limits, byHeader).Middleware("topup", ok).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fail-open status = %d", rec.Code)
+	}
+}
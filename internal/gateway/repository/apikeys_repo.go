@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"HW4/internal/gateway/apikey"
+)
+
+type APIKeysRepo struct {
+	db *sql.DB
+}
+
+func NewAPIKeysRepo(db *sql.DB) *APIKeysRepo { return &APIKeysRepo{db: db} }
+
+const apiKeyColumns = `id, owner, name, prefix, key_hash, scopes, created_at, expires_at, revoked_at, last_used_at`
+
+func (r *APIKeysRepo) Create(ctx context.Context, k apikey.Key) error {
+	return insertKey(ctx, r.db, k)
+}
+
+func (r *APIKeysRepo) Get(ctx context.Context, id string) (apikey.Key, error) {
+	return scanKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id=$1`, id))
+}
+
+func (r *APIKeysRepo) GetByHash(ctx context.Context, hash string) (apikey.Key, error) {
+	return scanKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash=$1`, hash))
+}
+
+func (r *APIKeysRepo) List(ctx context.Context, owner string) ([]apikey.Key, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE $1 = '' OR owner::text = $1
+		ORDER BY created_at DESC
+	`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []apikey.Key
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (r *APIKeysRepo) Revoke(ctx context.Context, id string, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id, at)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// либо ключа нет, либо он уже отозван
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		return apikey.ErrRevoked
+	}
+	return nil
+}
+
+func (r *APIKeysRepo) Rotate(ctx context.Context, oldID string, oldUntil time.Time, next apikey.Key) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE api_keys SET expires_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, oldID, oldUntil)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return apikey.ErrRevoked
+	}
+	if err := insertKey(ctx, tx, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *APIKeysRepo) TouchLastUsed(ctx context.Context, used map[string]time.Time) error {
+	ids := make([]string, 0, len(used))
+	ats := make([]time.Time, 0, len(used))
+	for id, at := range used {
+		ids = append(ids, id)
+		ats = append(ats, at)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys k SET last_used_at = u.at
+		FROM unnest($1::uuid[], $2::timestamptz[]) AS u(id, at)
+		WHERE k.id = u.id AND (k.last_used_at IS NULL OR k.last_used_at < u.at)
+	`, pq.Array(ids), pq.Array(ats))
+	return err
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertKey(ctx context.Context, db execer, k apikey.Key) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO api_keys(id, owner, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`, k.ID, k.Owner, k.Name, k.Prefix, k.Hash, pq.Array(k.Scopes), k.CreatedAt, k.ExpiresAt)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanKey(row scanner) (apikey.Key, error) {
+	var (
+		k                              apikey.Key
+		expiresAt, revokedAt, lastUsed sql.NullTime
+	)
+	err := row.Scan(&k.ID, &k.Owner, &k.Name, &k.Prefix, &k.Hash, pq.Array(&k.Scopes),
+		&k.CreatedAt, &expiresAt, &revokedAt, &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.Key{}, apikey.ErrNotFound
+	}
+	if err != nil {
+		return apikey.Key{}, err
+	}
+	k.ExpiresAt = nullTime(expiresAt)
+	k.RevokedAt = nullTime(revokedAt)
+	k.LastUsedAt = nullTime(lastUsed)
+	return k, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
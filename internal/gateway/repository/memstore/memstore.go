@@ -0,0 +1,113 @@
+// Package memstore — in-memory хранилище API-ключей gateway. Используется,
+// когда у gateway нет базы (ключи живут до рестарта), и в тестах.
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"HW4/internal/gateway/apikey"
+)
+
+type Store struct {
+	mu   sync.Mutex
+	keys map[string]apikey.Key
+}
+
+func New() *Store {
+	return &Store{keys: map[string]apikey.Key{}}
+}
+
+func (s *Store) Create(ctx context.Context, k apikey.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = clone(k)
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (apikey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return apikey.Key{}, apikey.ErrNotFound
+	}
+	return clone(k), nil
+}
+
+func (s *Store) GetByHash(ctx context.Context, hash string) (apikey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			return clone(k), nil
+		}
+	}
+	return apikey.Key{}, apikey.ErrNotFound
+}
+
+func (s *Store) List(ctx context.Context, owner string) ([]apikey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []apikey.Key
+	for _, k := range s.keys {
+		if owner == "" || k.Owner == owner {
+			out = append(out, clone(k))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return apikey.ErrNotFound
+	}
+	if k.RevokedAt != nil {
+		return apikey.ErrRevoked
+	}
+	k.RevokedAt = &at
+	s.keys[id] = k
+	return nil
+}
+
+func (s *Store) Rotate(ctx context.Context, oldID string, oldUntil time.Time, next apikey.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[oldID]
+	if !ok {
+		return apikey.ErrNotFound
+	}
+	if k.RevokedAt != nil {
+		return apikey.ErrRevoked
+	}
+	k.ExpiresAt = &oldUntil
+	s.keys[oldID] = k
+	s.keys[next.ID] = clone(next)
+	return nil
+}
+
+func (s *Store) TouchLastUsed(ctx context.Context, used map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, at := range used {
+		k, ok := s.keys[id]
+		if !ok || (k.LastUsedAt != nil && !k.LastUsedAt.Before(at)) {
+			continue
+		}
+		at := at
+		k.LastUsedAt = &at
+		s.keys[id] = k
+	}
+	return nil
+}
+
+func clone(k apikey.Key) apikey.Key {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	return k
+}
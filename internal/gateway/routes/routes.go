@@ -0,0 +1,379 @@
+// Package routes — декларативная таблица маршрутов gateway: какие пути и методы
+// в какой upstream уходят, как переписывается путь, с каким таймаутом,
+// требованием к аутентификации, группой лимитов и дополнительными заголовками.
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"HW4/internal/common/authn"
+	"HW4/internal/gateway/apikey"
+)
+
+// Значения Spec.Auth.
+const (
+	// AuthDefault — JWT обязателен, если он настроен; API-ключ принимается всегда.
+	AuthDefault = "default"
+	// AuthRequired — учётные данные нужны, даже если JWT на gateway выключен.
+	AuthRequired = "required"
+	// AuthNone — публичный маршрут, учётные данные не проверяются и не передаются.
+	AuthNone = "none"
+)
+
+// Spec — маршрут в конфигурации. Задаётся ровно один из Prefix и Pattern.
+type Spec struct {
+	Name string `yaml:"name"`
+	// Prefix совпадает с самим путём и со всем, что под ним: /orders, /orders/42.
+	Prefix string `yaml:"prefix"`
+	// Pattern сравнивается по сегментам: {name} — любой один сегмент,
+	// * последним сегментом — остаток пути (возможно, пустой).
+	Pattern string `yaml:"pattern"`
+	// Methods пустой — любые методы.
+	Methods  []string `yaml:"methods"`
+	Upstream string   `yaml:"upstream"`
+	// StripPrefix отрезается от пути перед отправкой в upstream.
+	StripPrefix string `yaml:"strip_prefix"`
+	// Rewrite для Prefix заменяет совпавший префикс, для Pattern — шаблон
+	// нового пути с {name} и {*}.
+	Rewrite string `yaml:"rewrite"`
+	// Timeout == 0 — таймаут upstream по умолчанию.
+	Timeout time.Duration `yaml:"timeout"`
+	// Auth — default (по умолчанию), required или none.
+	Auth string `yaml:"auth"`
+	// Scope — ресурс для scope API-ключей (orders, accounts). По умолчанию имя upstream.
+	Scope string `yaml:"scope"`
+	// RateLimit — группа лимитов. Пустая — маршрут не ограничивается.
+	RateLimit string `yaml:"rate_limit"`
+	// Headers добавляются к запросу в upstream.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Default — таблица, которой gateway пользуется без GATEWAY_ROUTES_FILE.
+func Default() []Spec {
+	return []Spec{
+		{Name: "orders", Prefix: "/orders", Upstream: "orders", Scope: "orders", RateLimit: "orders"},
+		{Name: "topup", Pattern: "/accounts/topup", Upstream: "payments", Scope: "accounts", RateLimit: "topup"},
+		{Name: "accounts", Prefix: "/accounts", Upstream: "payments", Scope: "accounts", RateLimit: "accounts"},
+	}
+}
+
+// Load читает таблицу из YAML (или JSON) файла вида
+//
+//	routes:
+//	  - name: orders
+//	    prefix: /orders
+//	    upstream: orders
+//	    timeout: 3s
+func Load(path string) ([]Spec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Routes []Spec `yaml:"routes"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(file.Routes) == 0 {
+		return nil, fmt.Errorf("%s: no routes", path)
+	}
+	return file.Routes, nil
+}
+
+// Route — проверенный маршрут таблицы.
+type Route struct {
+	Spec
+	prefix   string
+	segments []string
+	methods  map[string]bool
+}
+
+// Table — скомпилированная таблица. Маршруты проверяются в порядке объявления,
+// побеждает первый подходящий.
+type Table struct {
+	routes []*Route
+}
+
+// Params — значения {name} из Pattern; остаток пути для * лежит под ключом "*".
+type Params map[string]string
+
+// Compile проверяет таблицу целиком и возвращает все найденные ошибки сразу.
+// known сообщает, существует ли upstream; nil — имена не проверяются.
+func Compile(specs []Spec, known func(upstream string) bool) (*Table, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("route table is empty")
+	}
+	t := &Table{routes: make([]*Route, 0, len(specs))}
+	names := map[string]bool{}
+	var errs []error
+	for i, spec := range specs {
+		r, problems := compile(spec, known)
+		if spec.Name != "" && names[spec.Name] {
+			problems = append(problems, errors.New("duplicate name"))
+		}
+		names[spec.Name] = true
+		if len(problems) == 0 {
+			t.routes = append(t.routes, r)
+			continue
+		}
+		label := spec.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		for _, err := range problems {
+			errs = append(errs, fmt.Errorf("route %s: %w", label, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// reservedHeaders нельзя задать в Headers: ими gateway передаёт личность
+// клиента, а подмена Host сломает проксирование.
+var reservedHeaders = map[string]bool{
+	authn.HeaderSubject: true, authn.HeaderRoles: true, apikey.HeaderAPIKey: true,
+	"Host": true, "Content-Length": true, "Authorization": true,
+}
+
+func compile(spec Spec, known func(string) bool) (*Route, []error) {
+	r := &Route{Spec: spec}
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if spec.Name == "" {
+		fail("name is required")
+	}
+	switch {
+	case (spec.Prefix == "") == (spec.Pattern == ""):
+		fail("exactly one of prefix and pattern is required")
+	case spec.Prefix != "":
+		if !strings.HasPrefix(spec.Prefix, "/") {
+			fail("prefix %q must start with /", spec.Prefix)
+		}
+		r.prefix = strings.TrimSuffix(spec.Prefix, "/")
+	default:
+		segments, err := parsePattern(spec.Pattern)
+		if err != nil {
+			fail("%w", err)
+		}
+		r.segments = segments
+	}
+
+	if len(spec.Methods) > 0 {
+		r.methods = make(map[string]bool, len(spec.Methods))
+		for _, m := range spec.Methods {
+			if !knownMethods[m] {
+				fail("unknown method %q", m)
+			}
+			r.methods[m] = true
+		}
+	}
+
+	if spec.Upstream == "" {
+		fail("upstream is required")
+	} else if known != nil && !known(spec.Upstream) {
+		fail("unknown upstream %q", spec.Upstream)
+	}
+
+	switch {
+	case spec.StripPrefix != "" && spec.Rewrite != "":
+		fail("strip_prefix and rewrite are mutually exclusive")
+	case spec.StripPrefix != "":
+		if !strings.HasPrefix(spec.StripPrefix, "/") {
+			fail("strip_prefix %q must start with /", spec.StripPrefix)
+		} else if r.prefix != "" && !underPrefix(r.prefix, strings.TrimSuffix(spec.StripPrefix, "/")) {
+			fail("strip_prefix %q is not a prefix of %q", spec.StripPrefix, spec.Prefix)
+		}
+	case spec.Rewrite != "":
+		if !strings.HasPrefix(spec.Rewrite, "/") {
+			fail("rewrite %q must start with /", spec.Rewrite)
+		}
+		if r.segments != nil {
+			if err := checkTemplate(spec.Rewrite, r.segments); err != nil {
+				fail("%w", err)
+			}
+		}
+	}
+
+	if spec.Timeout < 0 {
+		fail("timeout must not be negative")
+	}
+	switch spec.Auth {
+	case "", AuthDefault, AuthRequired, AuthNone:
+	default:
+		fail("auth %q: expected default, required or none", spec.Auth)
+	}
+	for name := range spec.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			fail("bad header name %q", name)
+		} else if reservedHeaders[http.CanonicalHeaderKey(name)] {
+			fail("header %s is set by the gateway itself", name)
+		}
+	}
+
+	return r, errs
+}
+
+func parsePattern(pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	seen := map[string]bool{}
+	for i, seg := range segments {
+		switch {
+		case seg == "*":
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("pattern %q: * must be the last segment", pattern)
+			}
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			name := seg[1 : len(seg)-1]
+			if name == "" || name == "*" || seen[name] {
+				return nil, fmt.Errorf("pattern %q: bad or duplicate parameter %q", pattern, seg)
+			}
+			seen[name] = true
+		case strings.ContainsAny(seg, "{}*"):
+			return nil, fmt.Errorf("pattern %q: bad segment %q", pattern, seg)
+		}
+	}
+	return segments, nil
+}
+
+// checkTemplate проверяет, что все подстановки в rewrite есть в pattern.
+func checkTemplate(tmpl string, segments []string) error {
+	params := map[string]bool{}
+	for _, seg := range segments {
+		if seg == "*" {
+			params["*"] = true
+		} else if strings.HasPrefix(seg, "{") {
+			params[seg[1:len(seg)-1]] = true
+		}
+	}
+	rest := tmpl
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("rewrite %q: unclosed {", tmpl)
+		}
+		name := rest[start+1 : start+end]
+		if !params[name] {
+			return fmt.Errorf("rewrite %q: {%s} is not in the pattern", tmpl, name)
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// Routes — маршруты в порядке проверки.
+func (t *Table) Routes() []*Route {
+	return append([]*Route(nil), t.routes...)
+}
+
+// Match находит первый маршрут, подходящий по пути и методу. Если путь
+// подошёл только маршрутам с другими методами, route == nil, а allowed
+// перечисляет методы для ответа 405.
+func (t *Table) Match(method, path string) (route *Route, params Params, allowed []string) {
+	for _, r := range t.routes {
+		p, ok := r.matchPath(path)
+		if !ok {
+			continue
+		}
+		if r.methods == nil || r.methods[method] {
+			return r, p, nil
+		}
+		for _, m := range r.Methods {
+			if !contains(allowed, m) {
+				allowed = append(allowed, m)
+			}
+		}
+	}
+	return nil, nil, allowed
+}
+
+func (r *Route) matchPath(path string) (Params, bool) {
+	if r.segments == nil {
+		if !underPrefix(path, r.prefix) {
+			return nil, false
+		}
+		return Params{"*": path[len(r.prefix):]}, true
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	params := Params{}
+	for i, seg := range r.segments {
+		if seg == "*" {
+			params["*"] = "/" + strings.Join(parts[i:], "/")
+			if params["*"] == "/" {
+				params["*"] = ""
+			}
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(seg, "{"):
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = parts[i]
+		case seg != parts[i]:
+			return nil, false
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// UpstreamPath — путь, с которым запрос уходит в upstream.
+func (r *Route) UpstreamPath(path string, params Params) string {
+	switch {
+	case r.StripPrefix != "":
+		path = strings.TrimPrefix(path, strings.TrimSuffix(r.StripPrefix, "/"))
+	case r.Rewrite != "" && r.segments == nil:
+		path = strings.TrimSuffix(r.Rewrite, "/") + params["*"]
+	case r.Rewrite != "":
+		path = r.Rewrite
+		for name, value := range params {
+			path = strings.ReplaceAll(path, "{"+name+"}", value)
+		}
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// underPrefix — path равен prefix или лежит под ним; prefix без завершающего /.
+func underPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchAndRewrite(t *testing.T) {
+	table, err := Compile([]Spec{
+		{Name: "topup", Pattern: "/accounts/topup", Methods: []string{"POST"}, Upstream: "payments"},
+		{Name: "order-items", Pattern: "/v2/orders/{id}/*", Upstream: "orders", Rewrite: "/orders/{id}{*}"},
+		{Name: "api", Prefix: "/api/", Upstream: "orders", Rewrite: "/internal"},
+		{Name: "strip", Prefix: "/pay/accounts", Upstream: "payments", StripPrefix: "/pay"},
+		{Name: "accounts", Prefix: "/accounts", Upstream: "payments"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		wantRoute    string
+		wantPath     string
+	}{
+		{"POST", "/accounts/topup", "topup", "/accounts/topup"},
+		// метод не подошёл topup — проверяются следующие маршруты
+		{"GET", "/accounts/topup", "accounts", "/accounts/topup"},
+		{"GET", "/v2/orders/42/items/7", "order-items", "/orders/42/items/7"},
+		{"GET", "/v2/orders/42", "order-items", "/orders/42"},
+		{"GET", "/api", "api", "/internal"},
+		{"GET", "/api/orders", "api", "/internal/orders"},
+		{"GET", "/pay/accounts/u1", "strip", "/accounts/u1"},
+		{"GET", "/accountsx", "", ""},
+		{"GET", "/v2/orders", "", ""},
+	}
+	for _, tt := range tests {
+		route, params, _ := table.Match(tt.method, tt.path)
+		if route == nil {
+			if tt.wantRoute != "" {
+				t.Errorf("%s %s: no match, want %s", tt.method, tt.path, tt.wantRoute)
+			}
+			continue
+		}
+		if route.Name != tt.wantRoute {
+			t.Errorf("%s %s: matched %s, want %s", tt.method, tt.path, route.Name, tt.wantRoute)
+			continue
+		}
+		if got := route.UpstreamPath(tt.path, params); got != tt.wantPath {
+			t.Errorf("%s %s: upstream path %q, want %q", tt.method, tt.path, got, tt.wantPath)
+		}
+	}
+}
+
+func TestMatchReportsAllowedMethods(t *testing.T) {
+	table, err := Compile([]Spec{
+		{Name: "read", Pattern: "/items/{id}", Methods: []string{"GET", "HEAD"}, Upstream: "orders"},
+		{Name: "write", Pattern: "/items/{id}", Methods: []string{"PUT"}, Upstream: "orders"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, _, allowed := table.Match("DELETE", "/items/1")
+	if route != nil || strings.Join(allowed, ",") != "GET,HEAD,PUT" {
+		t.Fatalf("route %v, allowed %v", route, allowed)
+	}
+}
+
+func TestCompileReportsAllErrors(t *testing.T) {
+	known := func(name string) bool { return name == "orders" }
+	_, err := Compile([]Spec{
+		{Name: "a", Prefix: "/a", Pattern: "/a", Upstream: "orders"},
+		{Name: "b", Prefix: "/b", Upstream: "nope"},
+		{Name: "c", Pattern: "/c/*/d", Upstream: "orders"},
+		{Name: "d", Pattern: "/d/{id}", Upstream: "orders", Rewrite: "/x/{other}"},
+		{Name: "e", Prefix: "/e", Upstream: "orders", Methods: []string{"get"}, Auth: "maybe", Timeout: -time.Second},
+		{Name: "f", Prefix: "/f", Upstream: "orders", Headers: map[string]string{"x-auth-subject": "root"}},
+		{Name: "g", Prefix: "/g", Upstream: "orders", StripPrefix: "/h"},
+		{Name: "a", Prefix: "/dup", Upstream: "orders"},
+		{Prefix: "/noname", Upstream: "orders"},
+	}, known)
+	if err == nil {
+		t.Fatal("invalid table must be rejected")
+	}
+	for _, want := range []string{
+		"route a: exactly one of prefix and pattern",
+		`route b: unknown upstream "nope"`,
+		"route c: pattern",
+		"{other} is not in the pattern",
+		`unknown method "get"`,
+		`auth "maybe"`,
+		"timeout must not be negative",
+		"x-auth-subject is set by the gateway",
+		`strip_prefix "/h" is not a prefix`,
+		"route a: duplicate name",
+		"route #9: name is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadYAMLAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "routes.yaml")
+	jsonPath := filepath.Join(dir, "routes.json")
+	_ = os.WriteFile(yamlPath, []byte(`
+routes:
+  - name: orders
+    prefix: /orders
+    methods: [GET, POST]
+    upstream: orders
+    timeout: 3s
+    auth: required
+    headers:
+      X-Route: orders
+`), 0o600)
+	_ = os.WriteFile(jsonPath, []byte(`{"routes":[{"name":"orders","prefix":"/orders","methods":["GET","POST"],"upstream":"orders","timeout":"3s","auth":"required","headers":{"X-Route":"orders"}}]}`), 0o600)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		specs, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		s := specs[0]
+		if len(specs) != 1 || s.Timeout != 3*time.Second || s.Auth != AuthRequired || len(s.Methods) != 2 || s.Headers["X-Route"] != "orders" {
+			t.Fatalf("%s: loaded %+v", path, specs)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.yaml")
+	_ = os.WriteFile(empty, []byte("routes: []\n"), 0o600)
+	if _, err := Load(empty); err == nil {
+		t.Fatal("empty table must be rejected")
+	}
+}
+
+func TestDefaultTableIsValid(t *testing.T) {
+	if _, err := Compile(Default(), func(name string) bool { return name == "orders" || name == "payments" }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package upstream
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	PolicyRoundRobin     = "round_robin"
+	PolicyLeastConn      = "least_conn"
+	PolicyConsistentHash = "consistent_hash"
+)
+
+// Balancer выбирает экземпляр из непустого списка здоровых.
+type Balancer interface {
+	Pick(instances []*Instance, r *http.Request) *Instance
+}
+
+// NewBalancer создаёт балансировщик по имени политики; пустое имя — round_robin.
+func NewBalancer(policy string) (Balancer, error) {
+	switch policy {
+	case "", PolicyRoundRobin:
+		return &roundRobin{}, nil
+	case PolicyLeastConn:
+		return &leastConn{}, nil
+	case PolicyConsistentHash:
+		return &consistentHash{fallback: &roundRobin{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancing policy %q", policy)
+	}
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Pick(instances []*Instance, _ *http.Request) *Instance {
+	n := b.next.Add(1) - 1
+	return instances[n%uint64(len(instances))]
+}
+
+// leastConn выбирает экземпляр с наименьшим числом запросов в работе.
+// Обход начинается со сдвигающейся позиции, чтобы при равенстве нагрузка
+// не падала всегда на первый экземпляр.
+type leastConn struct {
+	offset atomic.Uint64
+}
+
+func (b *leastConn) Pick(instances []*Instance, _ *http.Request) *Instance {
+	start := int(b.offset.Add(1) % uint64(len(instances)))
+	best := instances[start]
+	for i := 1; i < len(instances); i++ {
+		in := instances[(start+i)%len(instances)]
+		if in.Active() < best.Active() {
+			best = in
+		}
+	}
+	return best
+}
+
+// consistentHash закрепляет пользователя за экземпляром (rendezvous hashing):
+// выбирается экземпляр с наибольшим hash(user_id, url). При выпадении
+// экземпляра переезжают только его пользователи. Запросы без user_id
+// распределяются по кругу.
+type consistentHash struct {
+	fallback Balancer
+}
+
+func (b *consistentHash) Pick(instances []*Instance, r *http.Request) *Instance {
+	key := UserKey(r)
+	if key == "" {
+		return b.fallback.Pick(instances, r)
+	}
+	var (
+		best  *Instance
+		score uint64
+	)
+	for _, in := range instances {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(in.key))
+		if s := h.Sum64(); best == nil || s > score {
+			best, score = in, s
+		}
+	}
+	return best
+}
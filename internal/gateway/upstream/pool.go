@@ -0,0 +1,204 @@
+// Package upstream — наборы экземпляров сервисов за gateway: балансировка,
+// активные health-check'и и замена списка адресов без рестарта.
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNoHealthy — в пуле нет ни одного здорового экземпляра.
+var ErrNoHealthy = errors.New("no healthy upstream instances")
+
+// Instance — один экземпляр сервиса.
+type Instance struct {
+	URL *url.URL
+	key string
+
+	healthy atomic.Bool
+	active  atomic.Int64
+
+	// счётчики подряд идущих результатов проверок; под Pool.mu
+	fails     int
+	successes int
+}
+
+func newInstance(u *url.URL) *Instance {
+	in := &Instance{URL: u, key: u.String()}
+	// новый экземпляр считается здоровым до первой проверки
+	in.healthy.Store(true)
+	return in
+}
+
+func (in *Instance) Healthy() bool { return in.healthy.Load() }
+
+// Active — число запросов к экземпляру, которые сейчас в работе.
+func (in *Instance) Active() int64 { return in.active.Load() }
+
+// Acquire отмечает начало запроса к экземпляру; вернуть функцию нужно по завершении.
+func (in *Instance) Acquire() (release func()) {
+	in.active.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { in.active.Add(-1) }) }
+}
+
+// Pool — экземпляры одного сервиса и политика выбора между ними.
+type Pool struct {
+	name string
+	hc   HealthConfig
+
+	mu        sync.RWMutex
+	instances []*Instance
+	balancer  Balancer
+	policy    string
+}
+
+// NewPool создаёт пул. hc задаёт пороги, по которым проверки (и ошибки
+// запросов, см. ReportRequestFailure) выводят экземпляр из ротации.
+func NewPool(name string, urls []*url.URL, policy string, hc HealthConfig) (*Pool, error) {
+	hc.setDefaults()
+	p := &Pool{name: name, hc: hc}
+	if err := p.Update(urls, policy); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Pool) Name() string { return p.name }
+
+// Update заменяет список адресов и политику. Экземпляры, оставшиеся в списке,
+// сохраняют состояние здоровья и счётчики активных запросов.
+func (p *Pool) Update(urls []*url.URL, policy string) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("upstream %s: at least one url is required", p.name)
+	}
+	balancer, err := NewBalancer(policy)
+	if err != nil {
+		return fmt.Errorf("upstream %s: %w", p.name, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*Instance, len(p.instances))
+	for _, in := range p.instances {
+		existing[in.key] = in
+	}
+	next := make([]*Instance, 0, len(urls))
+	seen := map[string]bool{}
+	for _, u := range urls {
+		key := u.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if in, ok := existing[key]; ok {
+			next = append(next, in)
+			continue
+		}
+		next = append(next, newInstance(u))
+	}
+	if policy == "" {
+		policy = PolicyRoundRobin
+	}
+	if p.policy != policy || p.instances == nil {
+		p.balancer, p.policy = balancer, policy
+	}
+	p.instances = next
+	return nil
+}
+
+// Instances возвращает копию текущего списка экземпляров.
+func (p *Pool) Instances() []*Instance {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]*Instance(nil), p.instances...)
+}
+
+func (p *Pool) Policy() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policy
+}
+
+// Pick выбирает здоровый экземпляр для запроса. exclude (может быть nil)
+// пропускается, если есть альтернатива, — так повтор уходит на другой экземпляр.
+func (p *Pool) Pick(r *http.Request, exclude *Instance) (*Instance, error) {
+	p.mu.RLock()
+	balancer := p.balancer
+	healthy := make([]*Instance, 0, len(p.instances))
+	for _, in := range p.instances {
+		if in.Healthy() {
+			healthy = append(healthy, in)
+		}
+	}
+	p.mu.RUnlock()
+
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthy
+	}
+	if exclude != nil && len(healthy) > 1 {
+		for i, in := range healthy {
+			if in == exclude {
+				healthy = append(healthy[:i:i], healthy[i+1:]...)
+				break
+			}
+		}
+	}
+	return balancer.Pick(healthy, r), nil
+}
+
+// ReportSuccess и ReportFailure учитывают результат проверки или запроса.
+// После hc.UnhealthyThreshold ошибок подряд экземпляр выводится из ротации,
+// после hc.HealthyThreshold успехов подряд возвращается.
+func (p *Pool) ReportSuccess(in *Instance) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	in.fails = 0
+	in.successes++
+	if !in.Healthy() && in.successes >= p.hc.HealthyThreshold {
+		in.healthy.Store(true)
+		log.Printf("[gateway] upstream %s: %s is healthy again", p.name, in.key)
+	}
+}
+
+func (p *Pool) ReportFailure(in *Instance, cause error) {
+	p.reportFailure(in, cause, false)
+}
+
+// ReportRequestFailure учитывает сетевую ошибку живого запроса. В отличие от
+// health-check'а не выводит из ротации последний здоровый экземпляр: когда
+// сервис лежит целиком, его отсекает circuit breaker прокси.
+func (p *Pool) ReportRequestFailure(in *Instance, cause error) {
+	p.reportFailure(in, cause, true)
+}
+
+func (p *Pool) reportFailure(in *Instance, cause error, keepLast bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	in.successes = 0
+	in.fails++
+	if !in.Healthy() || in.fails < p.hc.UnhealthyThreshold {
+		return
+	}
+	if keepLast && p.healthyCount() <= 1 {
+		return
+	}
+	in.healthy.Store(false)
+	log.Printf("[gateway] upstream %s: evicting %s: %v", p.name, in.key, cause)
+}
+
+func (p *Pool) healthyCount() int {
+	n := 0
+	for _, in := range p.instances {
+		if in.Healthy() {
+			n++
+		}
+	}
+	return n
+}
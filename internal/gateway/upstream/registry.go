@@ -0,0 +1,224 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type HealthConfig struct {
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// UnhealthyThreshold — ошибок подряд до вывода из ротации.
+	UnhealthyThreshold int
+	// HealthyThreshold — успешных проверок подряд до возврата в ротацию.
+	HealthyThreshold int
+}
+
+func (c *HealthConfig) setDefaults() {
+	if c.Path == "" {
+		c.Path = "/health"
+	}
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Second
+	}
+	if c.UnhealthyThreshold <= 0 {
+		c.UnhealthyThreshold = 2
+	}
+	if c.HealthyThreshold <= 0 {
+		c.HealthyThreshold = 1
+	}
+}
+
+// Spec — описание пула в конфигурации.
+type Spec struct {
+	Policy string   `yaml:"policy"`
+	URLs   []string `yaml:"urls"`
+}
+
+// Registry хранит пулы по имени сервиса и проверяет их экземпляры.
+type Registry struct {
+	hc     HealthConfig
+	client *http.Client
+
+	mu    sync.RWMutex
+	pools map[string]*Pool
+}
+
+func NewRegistry(hc HealthConfig) *Registry {
+	hc.setDefaults()
+	return &Registry{
+		hc:     hc,
+		client: &http.Client{Timeout: hc.Timeout},
+		pools:  map[string]*Pool{},
+	}
+}
+
+func (r *Registry) Get(name string) *Pool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pools[name]
+}
+
+// Names — имена пулов в алфавитном порядке.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.pools))
+	for n := range r.pools {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply применяет конфигурацию: существующие пулы обновляются на месте (прокси,
+// которые на них ссылаются, сразу видят новый список), новые создаются.
+// Сначала проверяется вся конфигурация, поэтому при ошибке ничего не меняется.
+// Пулы, отсутствующие в specs, остаются как есть.
+func (r *Registry) Apply(specs map[string]Spec) error {
+	type parsed struct {
+		urls   []*url.URL
+		policy string
+	}
+	all := make(map[string]parsed, len(specs))
+	var errs []error
+	for name, spec := range specs {
+		urls, err := ParseURLs(spec.URLs)
+		if err == nil && len(urls) == 0 {
+			err = errors.New("at least one url is required")
+		}
+		if err == nil {
+			_, err = NewBalancer(spec.Policy)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upstream %s: %w", name, err))
+			continue
+		}
+		all[name] = parsed{urls: urls, policy: spec.Policy}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, p := range all {
+		if pool, ok := r.pools[name]; ok {
+			// значения уже проверены выше
+			_ = pool.Update(p.urls, p.policy)
+			continue
+		}
+		pool, _ := NewPool(name, p.urls, p.policy, r.hc)
+		r.pools[name] = pool
+	}
+	return nil
+}
+
+// Run периодически проверяет все экземпляры всех пулов до отмены ctx.
+func (r *Registry) Run(ctx context.Context) {
+	t := time.NewTicker(r.hc.Interval)
+	defer t.Stop()
+	for {
+		r.CheckNow(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CheckNow выполняет один раунд проверок и ждёт его завершения.
+func (r *Registry) CheckNow(ctx context.Context) {
+	r.mu.RLock()
+	pools := make([]*Pool, 0, len(r.pools))
+	for _, p := range r.pools {
+		pools = append(pools, p)
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, p := range pools {
+		for _, in := range p.Instances() {
+			wg.Add(1)
+			go func(p *Pool, in *Instance) {
+				defer wg.Done()
+				err := r.probe(ctx, in)
+				if ctx.Err() != nil {
+					// остановка gateway, а не отказ экземпляра
+					return
+				}
+				if err != nil {
+					p.ReportFailure(in, err)
+					return
+				}
+				p.ReportSuccess(in)
+			}(p, in)
+		}
+	}
+	wg.Wait()
+}
+
+func (r *Registry) probe(ctx context.Context, in *Instance) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL.JoinPath(r.hc.Path).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ParseURLs разбирает адреса вида http://host:port.
+func ParseURLs(raw []string) ([]*url.URL, error) {
+	out := make([]*url.URL, 0, len(raw))
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("bad url %q: expected like http://host:port", s)
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// LoadFile читает пулы из YAML (или JSON) файла вида
+//
+//	orders:
+//	  policy: least_conn
+//	  urls: [http://orders-1:8080, http://orders-2:8080]
+func LoadFile(path string) (map[string]Spec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs map[string]Spec
+	if err := yaml.Unmarshal(raw, &specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return specs, nil
+}
@@ -0,0 +1,214 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func urls(t *testing.T, raw ...string) []*url.URL {
+	t.Helper()
+	out, err := ParseURLs(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func newPool(t *testing.T, policy string, raw ...string) *Pool {
+	t.Helper()
+	p, err := NewPool("orders", urls(t, raw...), policy, HealthConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func pick(t *testing.T, p *Pool, r *http.Request) string {
+	t.Helper()
+	in, err := p.Pick(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in.URL.Host
+}
+
+func TestRoundRobin(t *testing.T) {
+	p := newPool(t, PolicyRoundRobin, "http://a:1", "http://b:1", "http://c:1")
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+
+	got := map[string]int{}
+	for i := 0; i < 9; i++ {
+		got[pick(t, p, r)]++
+	}
+	for _, host := range []string{"a:1", "b:1", "c:1"} {
+		if got[host] != 3 {
+			t.Fatalf("distribution = %v, want 3 each", got)
+		}
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	p := newPool(t, PolicyLeastConn, "http://a:1", "http://b:1")
+	ins := p.Instances()
+	release := ins[0].Acquire()
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+
+	for i := 0; i < 4; i++ {
+		if host := pick(t, p, r); host != "b:1" {
+			t.Fatalf("pick %d = %s, want the idle instance b:1", i, host)
+		}
+	}
+	release()
+	release() // повторный вызов не уводит счётчик в минус
+	if ins[0].Active() != 0 {
+		t.Fatalf("active = %d after release", ins[0].Active())
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	p := newPool(t, PolicyConsistentHash, "http://a:1", "http://b:1", "http://c:1")
+	users := []string{
+		"11111111-1111-1111-1111-111111111111",
+		"22222222-2222-2222-2222-222222222222",
+		"33333333-3333-3333-3333-333333333333",
+		"44444444-4444-4444-4444-444444444444",
+		"55555555-5555-5555-5555-555555555555",
+		"66666666-6666-6666-6666-666666666666",
+	}
+	byQuery := func(u string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/orders?user_id="+u, nil)
+	}
+
+	before := map[string]string{}
+	for _, u := range users {
+		before[u] = pick(t, p, byQuery(u))
+		// тот же пользователь, но user_id в пути
+		if again := pick(t, p, httptest.NewRequest(http.MethodGet, "/accounts/"+u, nil)); again != before[u] {
+			t.Fatalf("user %s: query -> %s, path -> %s", u, before[u], again)
+		}
+	}
+
+	// выпадение экземпляра переносит только его пользователей
+	var evicted *Instance
+	for _, in := range p.Instances() {
+		if in.URL.Host == before[users[0]] {
+			evicted = in
+		}
+	}
+	evicted.healthy.Store(false)
+	for _, u := range users {
+		now := pick(t, p, byQuery(u))
+		if before[u] != evicted.URL.Host && now != before[u] {
+			t.Fatalf("user %s moved from %s to %s though its instance is healthy", u, before[u], now)
+		}
+		if now == evicted.URL.Host {
+			t.Fatalf("user %s routed to evicted instance", u)
+		}
+	}
+}
+
+func TestUserKeyFromBodyKeepsBody(t *testing.T) {
+	const body = `{"user_id":"11111111-1111-1111-1111-111111111111","amount":10}`
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	if got := UserKey(r); got != "11111111-1111-1111-1111-111111111111" {
+		t.Fatalf("UserKey = %q", got)
+	}
+	rest, _ := io.ReadAll(r.Body)
+	if string(rest) != body {
+		t.Fatalf("body after peek = %q", rest)
+	}
+}
+
+func TestUpdateKeepsInstanceState(t *testing.T) {
+	p := newPool(t, PolicyRoundRobin, "http://a:1", "http://b:1")
+	a := p.Instances()[0]
+	a.healthy.Store(false)
+
+	if err := p.Update(urls(t, "http://a:1", "http://c:1"), PolicyLeastConn); err != nil {
+		t.Fatal(err)
+	}
+	ins := p.Instances()
+	if len(ins) != 2 || ins[0] != a || ins[0].Healthy() || ins[1].URL.Host != "c:1" {
+		t.Fatalf("instances after update: %v", ins)
+	}
+	if p.Policy() != PolicyLeastConn {
+		t.Fatalf("policy = %s", p.Policy())
+	}
+	if err := p.Update(nil, ""); err == nil {
+		t.Fatal("empty url list must be rejected")
+	}
+}
+
+func TestHealthChecksEvictAndRestore(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry(HealthConfig{UnhealthyThreshold: 2, HealthyThreshold: 2})
+	if err := reg.Apply(map[string]Spec{"orders": {URLs: []string{srv.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	in := reg.Get("orders").Instances()[0]
+	ctx := context.Background()
+
+	healthy.Store(false)
+	reg.CheckNow(ctx)
+	if !in.Healthy() {
+		t.Fatal("one failed check must not evict")
+	}
+	reg.CheckNow(ctx)
+	if in.Healthy() {
+		t.Fatal("instance must be evicted after 2 failed checks")
+	}
+	if _, err := reg.Get("orders").Pick(httptest.NewRequest(http.MethodGet, "/", nil), nil); err != ErrNoHealthy {
+		t.Fatalf("pick from evicted pool err = %v", err)
+	}
+
+	healthy.Store(true)
+	reg.CheckNow(ctx)
+	reg.CheckNow(ctx)
+	if !in.Healthy() {
+		t.Fatal("instance must return after 2 successful checks")
+	}
+}
+
+func TestApplyIsAllOrNothing(t *testing.T) {
+	reg := NewRegistry(HealthConfig{})
+	if err := reg.Apply(map[string]Spec{"orders": {URLs: []string{"http://a:1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	orders := reg.Get("orders")
+
+	err := reg.Apply(map[string]Spec{
+		"orders":   {URLs: []string{"http://b:1"}},
+		"payments": {Policy: "random", URLs: []string{"http://p:1"}},
+	})
+	if err == nil {
+		t.Fatal("unknown policy must fail")
+	}
+	if reg.Get("payments") != nil || orders.Instances()[0].URL.Host != "a:1" {
+		t.Fatal("failed apply must not change anything")
+	}
+
+	if err := reg.Apply(map[string]Spec{"orders": {URLs: []string{"http://b:1", "http://c:1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Get("orders") != orders || len(orders.Instances()) != 2 {
+		t.Fatal("apply must update the existing pool in place")
+	}
+}
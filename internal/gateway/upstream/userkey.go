@@ -0,0 +1,60 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/authn"
+)
+
+// maxPeekBody — сколько тела читать в поисках user_id.
+const maxPeekBody = 64 << 10
+
+// UserKey достаёт user_id запроса для consistent-hash: subject из доверенного
+// заголовка gateway, параметр ?user_id=, сегмент пути /accounts/{user_id}
+// или поле user_id JSON-тела. Прочитанное тело возвращается в запрос.
+func UserKey(r *http.Request) string {
+	if sub := r.Header.Get(authn.HeaderSubject); sub != "" {
+		return sub
+	}
+	if id := r.URL.Query().Get("user_id"); id != "" {
+		return id
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/accounts/"); ok {
+		if id, _, _ := strings.Cut(rest, "/"); uuid.Validate(id) == nil {
+			return id
+		}
+	}
+	return bodyUserID(r)
+}
+
+func bodyUserID(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "json") {
+		return ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	// остаток тела (если оно больше лимита) дочитывается следом за буфером
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var body struct {
+		UserID string `json:"user_id"`
+	}
+	if json.Unmarshal(buf, &body) != nil {
+		return ""
+	}
+	return body.UserID
+}
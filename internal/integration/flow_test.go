@@ -0,0 +1,612 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/broker"
+	"HW4/internal/common/httpx"
+	"HW4/internal/payments/fx"
+	"HW4/internal/payments/payout"
+	paymentsworker "HW4/internal/payments/worker"
+)
+
+func createAccount(t *testing.T, h *harness, balance int64) string {
+	t.Helper()
+	userID := uuid.NewString()
+	if code := h.call(http.MethodPost, "/accounts", map[string]any{"user_id": userID, "balance": balance}, nil); code != http.StatusCreated {
+		t.Fatalf("create account: status %d", code)
+	}
+	return userID
+}
+
+// TestUserFlow повторяет сценарий из README: счёт, пополнение, заказ, опрос статуса.
+func TestUserFlow(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+
+		userID := createAccount(t, h, 500)
+		if code := h.call(http.MethodPost, "/accounts", map[string]any{"user_id": userID}, nil); code != http.StatusConflict {
+			t.Fatalf("second account for the same user: status %d, want 409", code)
+		}
+		if code := h.call(http.MethodPost, "/accounts/topup", map[string]any{"user_id": userID, "amount": 300}, nil); code != http.StatusOK {
+			t.Fatalf("top up: status %d", code)
+		}
+
+		paid := h.createOrder(userID, 200)
+		if st := h.awaitStatus(paid); st != "FINISHED" {
+			t.Fatalf("order %s: status %s, want FINISHED", paid, st)
+		}
+
+		tooExpensive := h.createOrder(userID, 10_000)
+		if st := h.awaitStatus(tooExpensive); st != "FAILED" {
+			t.Fatalf("order %s: status %s, want FAILED", tooExpensive, st)
+		}
+
+		noAccount := h.createOrder(uuid.NewString(), 10)
+		if st := h.awaitStatus(noAccount); st != "FAILED" {
+			t.Fatalf("order without account: status %s, want FAILED", st)
+		}
+
+		if got := h.balance(userID); got != 600 {
+			t.Fatalf("balance = %d, want 600", got)
+		}
+
+		var list struct {
+			Orders []struct {
+				OrderID string `json:"order_id"`
+			} `json:"orders"`
+		}
+		h.call(http.MethodGet, "/orders?user_id="+userID, nil, &list)
+		if len(list.Orders) != 2 || list.Orders[0].OrderID != tooExpensive {
+			t.Fatalf("orders list = %+v, want 2 orders, newest first", list.Orders)
+		}
+	})
+}
+
+func TestDuplicateDelivery(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		ctx := context.Background()
+
+		userID := createAccount(t, h, 500)
+		first := h.createOrder(userID, 200)
+		second := h.createOrder(userID, 1000)
+		h.awaitStatus(first)
+		h.awaitStatus(second)
+		h.settle()
+
+		// брокер доставляет каждое сообщение ещё раз (at-least-once)
+		for _, topic := range []string{topicRequested, topicResult} {
+			for _, m := range h.broker.Messages(topic) {
+				_ = h.broker.PublishWithHeaders(ctx, topic, m.Key, m.Value, m.Headers)
+			}
+		}
+		h.settle()
+
+		if got := h.balance(userID); got != 300 {
+			t.Fatalf("balance = %d, want 300: duplicate must not debit twice", got)
+		}
+		if st := h.orderStatus(first); st != "FINISHED" {
+			t.Fatalf("first order: %s, want FINISHED", st)
+		}
+		if st := h.orderStatus(second); st != "FAILED" {
+			t.Fatalf("second order: %s, want FAILED", st)
+		}
+		if n := len(h.broker.Messages(topicResult)); n != 4 {
+			t.Fatalf("result topic has %d messages, want 2 originals + 2 replays", n)
+		}
+	})
+}
+
+// flakyProcessor падает на первых failures вызовах, имитируя недоступность БД.
+type flakyProcessor struct {
+	paymentsworker.PaymentHandler
+	failures atomic.Int32
+}
+
+func (p *flakyProcessor) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
+	if p.failures.Add(-1) >= 0 {
+		return false, errors.New("temporary db error")
+	}
+	return p.PaymentHandler.HandlePaymentRequested(ctx, raw)
+}
+
+// flakyPublisher не может отправить первые failures сообщений.
+type flakyPublisher struct {
+	broker.Publisher
+	failures atomic.Int32
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	if p.failures.Add(-1) >= 0 {
+		return errors.New("broker unavailable")
+	}
+	return p.Publisher.Publish(ctx, topic, key, value)
+}
+
+func TestRetries(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		t.Run("processing retried via retry topic", func(t *testing.T) {
+			proc := &flakyProcessor{}
+			proc.failures.Store(2)
+			h := newHarness(t, b, options{wrapProcessor: func(p paymentsworker.PaymentHandler) paymentsworker.PaymentHandler {
+				proc.PaymentHandler = p
+				return proc
+			}})
+
+			userID := createAccount(t, h, 500)
+			orderID := h.createOrder(userID, 200)
+			if st := h.awaitStatus(orderID); st != "FINISHED" {
+				t.Fatalf("status %s, want FINISHED", st)
+			}
+			h.settle()
+
+			retried := h.broker.Messages(topicRetry)
+			if len(retried) != 2 || broker.GetRetryCount(retried[1]) != 2 {
+				t.Fatalf("retry topic: %d messages, want 2 with growing retry_count", len(retried))
+			}
+			if len(h.broker.Messages(topicDLQ)) != 0 {
+				t.Fatal("message must not reach DLQ")
+			}
+			if got := h.balance(userID); got != 300 {
+				t.Fatalf("balance = %d, want 300", got)
+			}
+		})
+
+		t.Run("exhausted retries go to dlq", func(t *testing.T) {
+			proc := &flakyProcessor{}
+			proc.failures.Store(100)
+			h := newHarness(t, b, options{wrapProcessor: func(p paymentsworker.PaymentHandler) paymentsworker.PaymentHandler {
+				proc.PaymentHandler = p
+				return proc
+			}})
+
+			userID := createAccount(t, h, 500)
+			orderID := h.createOrder(userID, 200)
+			eventually(t, func() bool { return len(h.broker.Messages(topicDLQ)) == 1 })
+
+			if st := h.orderStatus(orderID); st != "NEW" {
+				t.Fatalf("status %s, want NEW while payment is in DLQ", st)
+			}
+			if got := h.balance(userID); got != 500 {
+				t.Fatalf("balance = %d, want untouched 500", got)
+			}
+		})
+
+		t.Run("outbox retries failed publish", func(t *testing.T) {
+			pub := &flakyPublisher{}
+			pub.failures.Store(3)
+			h := newHarness(t, b, options{wrapPublisher: func(p broker.Publisher) broker.Publisher {
+				pub.Publisher = p
+				return pub
+			}})
+
+			userID := createAccount(t, h, 500)
+			orderID := h.createOrder(userID, 200)
+			if st := h.awaitStatus(orderID); st != "FINISHED" {
+				t.Fatalf("status %s, want FINISHED", st)
+			}
+		})
+	})
+}
+
+// crashingSubscriber теряет первый коммит — как если бы процесс упал
+// между обработкой сообщения и коммитом оффсета.
+type crashingSubscriber struct {
+	broker.Subscriber
+	crashed atomic.Bool
+}
+
+func (s *crashingSubscriber) Commit(ctx context.Context, msg broker.Message) error {
+	if s.crashed.CompareAndSwap(false, true) {
+		return errors.New("process killed before commit")
+	}
+	return s.Subscriber.Commit(ctx, msg)
+}
+
+func TestConsumerRestarts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		t.Run("payments redelivery after crash before commit", func(t *testing.T) {
+			h := newHarness(t, b, options{})
+			h.stop("payments-consumer")
+
+			sub := &crashingSubscriber{Subscriber: h.broker.Subscribe(topicRequested, groupPayments)}
+			h.startWorker("payments-consumer", paymentsworker.NewPaymentRequestedConsumer(sub, h.processor(), h.broker, retryCfg), sub)
+
+			userID := createAccount(t, h, 500)
+			orderID := h.createOrder(userID, 200)
+			if st := h.awaitStatus(orderID); st != "FINISHED" {
+				t.Fatalf("status %s, want FINISHED", st)
+			}
+			if lag := h.broker.Lag(topicRequested, groupPayments); lag != 1 {
+				t.Fatalf("lag = %d, want 1 uncommitted message", lag)
+			}
+
+			// рестарт: незакоммиченное сообщение приходит повторно и отсекается inbox'ом
+			h.stop("payments-consumer")
+			h.start("payments-consumer")
+			h.settle()
+
+			if got := h.balance(userID); got != 300 {
+				t.Fatalf("balance = %d, want 300", got)
+			}
+			if n := len(h.broker.Messages(topicResult)); n != 1 {
+				t.Fatalf("result topic has %d messages, want 1", n)
+			}
+		})
+
+		t.Run("orders consumer catches up after downtime", func(t *testing.T) {
+			h := newHarness(t, b, options{})
+			h.stop("orders-consumer")
+
+			userID := createAccount(t, h, 500)
+			orderID := h.createOrder(userID, 200)
+			eventually(t, func() bool { return len(h.broker.Messages(topicResult)) == 1 })
+			if st := h.orderStatus(orderID); st != "NEW" {
+				t.Fatalf("status %s while consumer is down, want NEW", st)
+			}
+
+			h.start("orders-consumer")
+			if st := h.awaitStatus(orderID); st != "FINISHED" {
+				t.Fatalf("status %s, want FINISHED", st)
+			}
+		})
+	})
+}
+
+// TestManualCapture: холд резервирует деньги, capture списывает, void возвращает.
+func TestManualCapture(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		userID := createAccount(t, h, 500)
+
+		captured := h.createManualOrder(userID, 200)
+		h.awaitStatusIs(captured, "AUTHORIZED")
+		if balance, held := h.funds(userID); balance != 500 || held != 200 {
+			t.Fatalf("after hold: balance %d, held %d; want 500, 200", balance, held)
+		}
+
+		// захолдированное недоступно для других списаний
+		overdraft := h.createOrder(userID, 400)
+		if st := h.awaitStatus(overdraft); st != "FAILED" {
+			t.Fatalf("order over available balance: status %s, want FAILED", st)
+		}
+
+		if code := h.call(http.MethodPost, "/orders/"+captured+"/capture", nil, nil); code != http.StatusAccepted {
+			t.Fatalf("capture: status %d, want 202", code)
+		}
+		h.awaitStatusIs(captured, "FINISHED")
+		if balance, held := h.funds(userID); balance != 300 || held != 0 {
+			t.Fatalf("after capture: balance %d, held %d; want 300, 0", balance, held)
+		}
+
+		voided := h.createManualOrder(userID, 100)
+		h.awaitStatusIs(voided, "AUTHORIZED")
+		if code := h.call(http.MethodPost, "/orders/"+voided+"/void", nil, nil); code != http.StatusAccepted {
+			t.Fatalf("void: status %d, want 202", code)
+		}
+		h.awaitStatusIs(voided, "VOIDED")
+		if balance, held := h.funds(userID); balance != 300 || held != 0 {
+			t.Fatalf("after void: balance %d, held %d; want 300, 0", balance, held)
+		}
+
+		if code := h.call(http.MethodPost, "/orders/"+voided+"/capture", nil, nil); code != http.StatusConflict {
+			t.Fatalf("capture voided order: status %d, want 409", code)
+		}
+	})
+}
+
+func TestRefunds(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		userID := createAccount(t, h, 500)
+
+		orderID := h.createOrder(userID, 200)
+		h.awaitStatusIs(orderID, "FINISHED")
+
+		refund := func(amount int64) (int, httpx.ErrorResponse) {
+			status, _, body := h.raw(http.MethodPost, "/v1/orders/"+orderID+"/refunds", map[string]any{"amount": amount})
+			var e httpx.ErrorResponse
+			_ = json.Unmarshal(body, &e)
+			return status, e
+		}
+
+		if code, _ := refund(50); code != http.StatusAccepted {
+			t.Fatalf("partial refund: status %d, want 202", code)
+		}
+		h.awaitStatusIs(orderID, "PARTIALLY_REFUNDED")
+		if balance, _ := h.funds(userID); balance != 350 {
+			t.Fatalf("after partial refund: balance %d, want 350", balance)
+		}
+
+		if code, e := refund(151); code != http.StatusConflict || e.Error.Code != httpx.CodeRefundExceedsAmount {
+			t.Fatalf("refund over the rest: status %d, code %s; want 409 %s", code, e.Error.Code, httpx.CodeRefundExceedsAmount)
+		}
+
+		if code, _ := refund(150); code != http.StatusAccepted {
+			t.Fatalf("full refund: status %d, want 202", code)
+		}
+		h.awaitStatusIs(orderID, "REFUNDED")
+		if balance, _ := h.funds(userID); balance != 500 {
+			t.Fatalf("after full refund: balance %d, want 500", balance)
+		}
+		var o struct {
+			RefundedAmount int64 `json:"refunded_amount"`
+		}
+		if h.call(http.MethodGet, "/orders/"+orderID, nil, &o); o.RefundedAmount != 200 {
+			t.Fatalf("refunded_amount = %d, want 200", o.RefundedAmount)
+		}
+
+		if code, e := refund(1); code != http.StatusConflict || e.Error.Code != httpx.CodeInvalidTransition {
+			t.Fatalf("refund of refunded order: status %d, code %s; want 409 %s", code, e.Error.Code, httpx.CodeInvalidTransition)
+		}
+	})
+}
+
+func TestTransfers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		alice := createAccount(t, h, 500)
+		bob := createAccount(t, h, 500)
+
+		transfer := func(id, from, to string, amount int64) (int, httpx.ErrorResponse) {
+			status, _, body := h.raw(http.MethodPost, "/v1/accounts/transfers", map[string]any{
+				"transfer_id": id, "from_user_id": from, "to_user_id": to, "amount": amount,
+			})
+			var e httpx.ErrorResponse
+			_ = json.Unmarshal(body, &e)
+			return status, e
+		}
+
+		id := uuid.NewString()
+		if code, _ := transfer(id, alice, bob, 200); code != http.StatusCreated {
+			t.Fatalf("transfer: status %d, want 201", code)
+		}
+		if code, _ := transfer(id, alice, bob, 200); code != http.StatusOK {
+			t.Fatalf("replayed transfer: status %d, want 200", code)
+		}
+		if fromBalance, toBalance := h.balance(alice), h.balance(bob); fromBalance != 300 || toBalance != 700 {
+			t.Fatalf("after transfer: balances %d, %d; want 300, 700", fromBalance, toBalance)
+		}
+
+		// захолдированное переводить нельзя
+		h.awaitStatusIs(h.createManualOrder(alice, 250), "AUTHORIZED")
+		if code, e := transfer(uuid.NewString(), alice, bob, 100); code != http.StatusConflict || e.Error.Code != httpx.CodeInsufficientFunds {
+			t.Fatalf("transfer over available: status %d, code %s; want 409 %s", code, e.Error.Code, httpx.CodeInsufficientFunds)
+		}
+
+		// встречные переводы блокируют счета в одном порядке и не виснут
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				from, to := bob, alice
+				if i%2 == 1 {
+					from, to = alice, bob
+				}
+				if code, _ := transfer(uuid.NewString(), from, to, 1); code != http.StatusCreated {
+					t.Errorf("concurrent transfer %d: status %d, want 201", i, code)
+				}
+			}()
+		}
+		wg.Wait()
+		if fromBalance, toBalance := h.balance(alice), h.balance(bob); fromBalance != 300 || toBalance != 700 {
+			t.Fatalf("after concurrent transfers: balances %d, %d; want 300, 700", fromBalance, toBalance)
+		}
+	})
+}
+
+// TestWithdrawals: вывод холдирует сумму до ответа провайдера выплат, успех
+// её списывает, отказ и таймаут возвращают в доступные.
+func TestWithdrawals(t *testing.T) {
+	tests := []struct {
+		mode        string
+		wantStatus  string
+		wantReason  string
+		wantBalance int64
+		wantHeld    int64
+	}{
+		{mode: payout.ModeSucceed, wantStatus: "SUCCEEDED", wantBalance: 300},
+		{mode: payout.ModeFail, wantStatus: "FAILED", wantReason: "payout_failed", wantBalance: 500},
+		// исход неизвестен: вывод ждёт повтора, средства остаются в холде
+		{mode: payout.ModeTimeout, wantStatus: "PENDING", wantBalance: 500, wantHeld: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, b backends) {
+				h := newHarness(t, b, options{payoutMode: tt.mode})
+				userID := createAccount(t, h, 500)
+
+				var created struct {
+					WithdrawalID string `json:"withdrawal_id"`
+					Status       string `json:"status"`
+				}
+				code := h.call(http.MethodPost, "/accounts/"+userID+"/withdrawals", map[string]any{"amount": 200}, &created)
+				if code != http.StatusAccepted || created.Status != "PENDING" {
+					t.Fatalf("withdraw: status %d, body %+v; want 202 PENDING", code, created)
+				}
+
+				var got struct {
+					Status string `json:"status"`
+					Reason string `json:"reason"`
+				}
+				eventually(t, func() bool {
+					if code := h.call(http.MethodGet, "/accounts/"+userID+"/withdrawals/"+created.WithdrawalID, nil, &got); code != http.StatusOK {
+						t.Fatalf("get withdrawal: status %d", code)
+					}
+					if tt.wantStatus == "PENDING" {
+						return len(h.broker.Messages(topicPayout)) > 0 && h.broker.Lag(topicPayout, groupPayments) == 0
+					}
+					return got.Status != "PENDING"
+				})
+				if got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+					t.Fatalf("withdrawal = %s/%s, want %s/%s", got.Status, got.Reason, tt.wantStatus, tt.wantReason)
+				}
+				if balance, held := h.funds(userID); balance != tt.wantBalance || held != tt.wantHeld {
+					t.Fatalf("balance = %d, held = %d; want %d, %d", balance, held, tt.wantBalance, tt.wantHeld)
+				}
+
+				status, _, body := h.raw(http.MethodPost, "/v1/accounts/"+userID+"/withdrawals", map[string]any{"amount": 1000})
+				var e httpx.ErrorResponse
+				_ = json.Unmarshal(body, &e)
+				if status != http.StatusConflict || e.Error.Code != httpx.CodeInsufficientFunds {
+					t.Fatalf("withdraw over available: status %d, code %s; want 409 %s", status, e.Error.Code, httpx.CodeInsufficientFunds)
+				}
+			})
+		})
+	}
+}
+
+// TestMultiCurrency: заказ оплачивается только из кошелька своей валюты;
+// без такого кошелька — отказ, остальные кошельки не трогаются.
+func TestMultiCurrency(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		userID := createAccount(t, h, 500)
+
+		noWallet := h.createOrderWith(map[string]any{"user_id": userID, "amount": 100, "currency": "KZT"})
+		if st := h.awaitStatus(noWallet); st != "FAILED" {
+			t.Fatalf("KZT order without KZT wallet: status %s, want FAILED", st)
+		}
+
+		if code := h.call(http.MethodPost, "/accounts/"+userID+"/wallets", map[string]any{"currency": "USD"}, nil); code != http.StatusCreated {
+			t.Fatalf("open USD wallet: status %d", code)
+		}
+		if code := h.call(http.MethodPost, "/accounts/topup", map[string]any{"user_id": userID, "amount": 300, "currency": "USD"}, nil); code != http.StatusOK {
+			t.Fatalf("top up USD: status %d", code)
+		}
+		paid := h.createOrderWith(map[string]any{"user_id": userID, "amount": 200, "currency": "USD"})
+		if st := h.awaitStatus(paid); st != "FINISHED" {
+			t.Fatalf("USD order: status %s, want FINISHED", st)
+		}
+
+		var account struct {
+			Currency string `json:"currency"`
+			Balance  int64  `json:"balance"`
+			Wallets  []struct {
+				Currency string `json:"currency"`
+				Balance  int64  `json:"balance"`
+			} `json:"wallets"`
+		}
+		if code := h.call(http.MethodGet, "/accounts/"+userID, nil, &account); code != http.StatusOK {
+			t.Fatalf("get account: status %d", code)
+		}
+		if account.Currency != "RUB" || account.Balance != 500 || len(account.Wallets) != 2 ||
+			account.Wallets[1].Currency != "USD" || account.Wallets[1].Balance != 100 {
+			t.Fatalf("account = %+v, want RUB 500 untouched and USD 100", account)
+		}
+
+		status, _, body := h.raw(http.MethodPost, "/v1/accounts/"+userID+"/withdrawals", map[string]any{"amount": 10, "currency": "EUR"})
+		var e httpx.ErrorResponse
+		_ = json.Unmarshal(body, &e)
+		if status != http.StatusConflict || e.Error.Code != httpx.CodeCurrencyMismatch {
+			t.Fatalf("withdraw without EUR wallet: status %d, code %s; want 409 %s", status, e.Error.Code, httpx.CodeCurrencyMismatch)
+		}
+	})
+}
+
+func TestFXPayment(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		rates, err := fx.NewTable(map[string]string{"USD/RUB": "92.5"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.payments.fx.SetFX(rates, fx.RoundHalfUp)
+		h := newHarness(t, b, options{})
+		userID := createAccount(t, h, 100000)
+
+		// кошелька в USD нет: платим из рублёвого, 10.01 USD × 92.5 = 925.925 RUB → 925.93
+		orderID := h.createOrderWith(map[string]any{"user_id": userID, "amount": 1001, "currency": "USD"})
+		h.awaitStatusIs(orderID, "FINISHED")
+		if balance, _ := h.funds(userID); balance != 100000-92593 {
+			t.Fatalf("RUB balance = %d, want %d", balance, 100000-92593)
+		}
+
+		var o struct {
+			Currency string `json:"currency"`
+			FX       struct {
+				Rate            string `json:"rate"`
+				ChargedAmount   int64  `json:"charged_amount"`
+				ChargedCurrency string `json:"charged_currency"`
+			} `json:"fx"`
+		}
+		if code := h.call(http.MethodGet, "/orders/"+orderID, nil, &o); code != http.StatusOK {
+			t.Fatalf("get order: status %d", code)
+		}
+		if o.Currency != "USD" || o.FX.Rate != "92.5" || o.FX.ChargedAmount != 92593 || o.FX.ChargedCurrency != "RUB" {
+			t.Fatalf("order = %+v, want USD charged 92593 RUB at 92.5", o)
+		}
+
+		// возврат по курсу исходного списания, в сумме — ровно списанное
+		for _, amount := range []int64{500, 501} {
+			if code := h.call(http.MethodPost, "/orders/"+orderID+"/refunds", map[string]any{"amount": amount}, nil); code != http.StatusAccepted {
+				t.Fatalf("refund %d: status %d", amount, code)
+			}
+		}
+		h.awaitStatusIs(orderID, "REFUNDED")
+		if balance, _ := h.funds(userID); balance != 100000 {
+			t.Fatalf("after refunds: RUB balance %d, want 100000", balance)
+		}
+
+		noRate := h.createOrderWith(map[string]any{"user_id": userID, "amount": 100, "currency": "EUR"})
+		if st := h.awaitStatus(noRate); st != "FAILED" {
+			t.Fatalf("EUR order without rate: status %s, want FAILED", st)
+		}
+	})
+}
+
+func TestSpendingLimits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		userID := createAccount(t, h, 1000)
+
+		limits := map[string]any{"max_order_amount": 300, "daily_amount": 500, "max_orders": 3, "orders_window_seconds": 3600}
+		if code := h.call(http.MethodPut, "/accounts/"+userID+"/limits", limits, nil); code != http.StatusOK {
+			t.Fatalf("set limits: status %d", code)
+		}
+
+		// 400 > max_order_amount; 300 + 200 = daily_amount; дальше упираемся в дневной лимит
+		for _, tc := range []struct {
+			amount int64
+			want   string
+		}{{400, "FAILED"}, {300, "FINISHED"}, {200, "FINISHED"}, {1, "FAILED"}} {
+			orderID := h.createOrder(userID, tc.amount)
+			if st := h.awaitStatus(orderID); st != tc.want {
+				t.Fatalf("order for %d: status %s, want %s", tc.amount, st, tc.want)
+			}
+		}
+		if balance, _ := h.funds(userID); balance != 500 {
+			t.Fatalf("balance = %d, want 500", balance)
+		}
+
+		// админ снимает денежные лимиты, остаётся лимит на число оплат: две
+		// уже были, третья проходит, четвёртая — нет
+		limits = map[string]any{"max_orders": 3, "orders_window_seconds": 3600}
+		if code := h.call(http.MethodPut, "/accounts/"+userID+"/limits", limits, nil); code != http.StatusOK {
+			t.Fatalf("raise limits: status %d", code)
+		}
+		for _, want := range []string{"FINISHED", "FAILED"} {
+			orderID := h.createOrder(userID, 10)
+			if st := h.awaitStatus(orderID); st != want {
+				t.Fatalf("order after raise: status %s, want %s", st, want)
+			}
+		}
+
+		var got struct {
+			MaxOrders int    `json:"max_orders"`
+			Currency  string `json:"currency"`
+		}
+		if code := h.call(http.MethodGet, "/accounts/"+userID+"/limits", nil, &got); code != http.StatusOK || got.MaxOrders != 3 || got.Currency != "RUB" {
+			t.Fatalf("get limits: status %d, %+v", code, got)
+		}
+	})
+}
@@ -0,0 +1,490 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	apidoc "HW4/api"
+	"HW4/internal/common/authn"
+	"HW4/internal/common/broker"
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/common/httpx"
+	"HW4/internal/common/migrate"
+	"HW4/internal/common/openapi"
+	gwauth "HW4/internal/gateway/auth"
+	gwhandler "HW4/internal/gateway/handler"
+	"HW4/internal/gateway/upstream"
+	ordersconfig "HW4/internal/orders/config"
+	ordershandler "HW4/internal/orders/handler"
+	ordersrepo "HW4/internal/orders/repository"
+	ordersmem "HW4/internal/orders/repository/memstore"
+	ordersservice "HW4/internal/orders/service"
+	ordersworker "HW4/internal/orders/worker"
+	paymentsconfig "HW4/internal/payments/config"
+	paymentshandler "HW4/internal/payments/handler"
+	"HW4/internal/payments/payout"
+	paymentsrepo "HW4/internal/payments/repository"
+	paymentsmem "HW4/internal/payments/repository/memstore"
+	paymentsservice "HW4/internal/payments/service"
+	paymentsworker "HW4/internal/payments/worker"
+	"HW4/migrations"
+)
+
+const (
+	topicRequested = "orders.payment.requested"
+	topicResult    = "payments.payment.result"
+	topicRetry     = "orders.payment.requested.retry"
+	topicDLQ       = "orders.payment.requested.dlq"
+	topicPayout    = "payments.payout.requested"
+
+	groupOrders   = "orders-service"
+	groupPayments = "payments-service"
+)
+
+var retryCfg = paymentsconfig.RetryConfig{MaxAttempts: 3, Topic: topicRetry, DLQTopic: topicDLQ}
+
+type ordersBackend struct {
+	repo   ordersservice.OrdersRepository
+	status ordersworker.StatusRepository
+	outbox ordersworker.OutboxStore
+}
+
+type paymentsBackend struct {
+	accounts  paymentsservice.AccountsRepository
+	processor paymentsworker.PaymentHandler
+	holds     paymentsworker.HoldStore
+	payouts   paymentsworker.WithdrawalStore
+	outbox    paymentsworker.OutboxStore
+	// fx включает оплату из кошелька в другой валюте.
+	fx interface {
+		SetFX(rates paymentsrepo.RateProvider, rounding string)
+	}
+}
+
+type backends struct {
+	orders   ordersBackend
+	payments paymentsBackend
+}
+
+// forEachBackend прогоняет тест на in-memory хранилищах и на настоящем
+// Postgres (см. postgresDSNs).
+func forEachBackend(t *testing.T, fn func(t *testing.T, b backends)) {
+	t.Run("memory", func(t *testing.T) {
+		orders := ordersmem.New(topicRequested)
+		payments := paymentsmem.New(topicResult)
+		payments.SetPayoutTopic(topicPayout)
+		fn(t, backends{
+			orders:   ordersBackend{repo: orders, status: orders, outbox: orders},
+			payments: paymentsBackend{accounts: payments, processor: payments, holds: payments, payouts: payments, outbox: payments, fx: payments},
+		})
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		ordersDSN, paymentsDSN := postgresDSNs(t)
+		ordersDB := openTestDB(t, ordersDSN, "orders", `TRUNCATE orders, outbox`)
+		paymentsDB := openTestDB(t, paymentsDSN, "payments", `TRUNCATE accounts, wallets, account_audit, account_limits, holds, refunds, transfers, transfer_entries, withdrawals, inbox, transactions, outbox`)
+		processor := paymentsrepo.NewPaymentProcessor(paymentsDB, topicResult, time.Hour)
+		accounts := paymentsrepo.NewAccountsRepo(paymentsDB, topicPayout)
+		fn(t, backends{
+			orders: ordersBackend{
+				repo:   ordersrepo.NewOrdersRepo(ordersDB, topicRequested),
+				status: ordersrepo.NewOrdersStatusRepo(ordersDB),
+				outbox: ordersrepo.NewOutboxRepo(ordersDB),
+			},
+			payments: paymentsBackend{
+				accounts:  accounts,
+				processor: processor,
+				holds:     processor,
+				payouts:   accounts,
+				outbox:    paymentsrepo.NewOutboxRepo(paymentsDB),
+				fx:        processor,
+			},
+		})
+	})
+}
+
+func openTestDB(t *testing.T, dsn, service, truncate string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	fsys := migrations.Orders()
+	if service == "payments" {
+		fsys = migrations.Payments()
+	}
+	runner, err := migrate.New(db, fsys, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate %s: %v", service, err)
+	}
+	if _, err := db.Exec(truncate); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type options struct {
+	wrapProcessor func(paymentsworker.PaymentHandler) paymentsworker.PaymentHandler
+	wrapPublisher func(broker.Publisher) broker.Publisher
+	// payoutMode — режим payout.Fake; пусто — payout.ModeSucceed.
+	payoutMode string
+}
+
+// harness поднимает Orders, Payments и Gateway в одном процессе поверх
+// in-memory брокера. Воркеры можно останавливать и запускать заново.
+type harness struct {
+	t       *testing.T
+	broker  *membroker.Broker
+	b       backends
+	opts    options
+	gateway *httptest.Server
+	// token — bearer JWT для запросов через gateway; пустой — анонимный запрос.
+	token string
+
+	mu      sync.Mutex
+	running map[string]func()
+}
+
+func newHarness(t *testing.T, b backends, opts options) *harness {
+	t.Helper()
+	h := &harness{
+		t:       t,
+		broker:  membroker.New(3),
+		b:       b,
+		opts:    opts,
+		token:   signToken(t, "integration-admin", authn.RoleAdmin),
+		running: map[string]func(){},
+	}
+
+	// сервисы проверяют и запросы, и ответы: расхождение обработчиков со
+	// спецификацией роняет любой тест, который до него дошёл
+	validation := openapi.Options{
+		Responses: true,
+		OnResponseError: func(r *http.Request, err error) {
+			t.Errorf("%s %s: response does not match api/swagger.yaml: %v", r.Method, r.URL.Path, err)
+		},
+	}
+
+	ordersMux := http.NewServeMux()
+	ordershandler.New(ordersservice.New(b.orders.repo)).Register(ordersMux)
+	ordersSrv := httptest.NewServer(httpx.RequestID(authn.Middleware(false, openapi.Middleware(mustSpec(t), validation, ordersMux))))
+	t.Cleanup(ordersSrv.Close)
+
+	paymentsMux := http.NewServeMux()
+	paymentshandler.New(paymentsservice.New(b.payments.accounts)).Register(paymentsMux)
+	paymentsSrv := httptest.NewServer(httpx.RequestID(authn.Middleware(false, openapi.Middleware(mustSpec(t), validation, paymentsMux))))
+	t.Cleanup(paymentsSrv.Close)
+
+	gwMux := http.NewServeMux()
+	rt, err := gwhandler.NewRouter(mustUpstreams(t, ordersSrv.URL, paymentsSrv.URL), gwhandler.Options{Auth: mustAuthenticator(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.Register(gwMux)
+	h.gateway = httptest.NewServer(httpx.RequestID(gwMux))
+	t.Cleanup(h.gateway.Close)
+
+	for _, name := range []string{"orders-outbox", "orders-consumer", "payments-outbox", "payments-consumer", "payments-retry-consumer", "payments-hold-expirer", "payments-payout-consumer"} {
+		h.start(name)
+	}
+	t.Cleanup(h.stopAll)
+	return h
+}
+
+func mustSpec(t *testing.T) *openapi.Spec {
+	spec, err := openapi.Parse(apidoc.Swagger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// jwtSecret — HS256-ключ gateway в тестах. Тесты проверяют сценарии, а не
+// разграничение доступа, поэтому по умолчанию harness ходит с токеном админа.
+var jwtSecret = []byte("integration-test-secret")
+
+func mustAuthenticator(t *testing.T) *gwauth.Authenticator {
+	doc, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "it", "alg": gwauth.AlgHS256, "k": base64.RawURLEncoding.EncodeToString(jwtSecret)},
+	}})
+	keys, err := gwauth.ParseJWKS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gwauth.NewAuthenticator(gwauth.NewVerifier(keys, gwauth.Options{}), nil, "")
+}
+
+func signToken(t *testing.T, subject string, roles ...string) string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": gwauth.AlgHS256, "kid": "it", "typ": "JWT"})
+	payload, err := json.Marshal(map[string]any{"sub": subject, "roles": roles, "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := b64(header) + "." + b64(payload)
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(input))
+	return input + "." + b64(mac.Sum(nil))
+}
+
+func mustUpstreams(t *testing.T, ordersURL, paymentsURL string) *upstream.Registry {
+	reg := upstream.NewRegistry(upstream.HealthConfig{})
+	err := reg.Apply(map[string]upstream.Spec{
+		"orders":   {URLs: []string{ordersURL}},
+		"payments": {URLs: []string{paymentsURL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func (h *harness) publisher() broker.Publisher {
+	if h.opts.wrapPublisher != nil {
+		return h.opts.wrapPublisher(h.broker)
+	}
+	return h.broker
+}
+
+func (h *harness) processor() paymentsworker.PaymentHandler {
+	if h.opts.wrapProcessor != nil {
+		return h.opts.wrapProcessor(h.b.payments.processor)
+	}
+	return h.b.payments.processor
+}
+
+// start запускает воркер так же, как его собирает main соответствующего сервиса.
+func (h *harness) start(name string) {
+	outboxCfg := ordersconfig.OutboxConfig{BatchSize: 10, PollInterval: 10 * time.Millisecond, LockTTL: time.Second, RetryBackoff: 10 * time.Millisecond}
+	paymentsOutboxCfg := paymentsconfig.OutboxConfig(outboxCfg)
+
+	var (
+		w   interface{ Run(context.Context) }
+		sub broker.Subscriber
+	)
+	switch name {
+	case "orders-outbox":
+		w = ordersworker.NewOutboxPublisher(h.b.orders.outbox, h.publisher(), outboxCfg)
+	case "orders-consumer":
+		sub = h.broker.Subscribe(topicResult, groupOrders)
+		w = ordersworker.NewPaymentResultConsumer(sub, h.b.orders.status)
+	case "payments-outbox":
+		w = paymentsworker.NewOutboxPublisher(h.b.payments.outbox, h.publisher(), paymentsOutboxCfg)
+	case "payments-consumer":
+		sub = h.broker.Subscribe(topicRequested, groupPayments)
+		w = paymentsworker.NewPaymentRequestedConsumer(sub, h.processor(), h.broker, retryCfg)
+	case "payments-retry-consumer":
+		sub = h.broker.Subscribe(topicRetry, groupPayments)
+		w = paymentsworker.NewPaymentRequestedConsumer(sub, h.processor(), h.broker, retryCfg)
+	case "payments-hold-expirer":
+		w = paymentsworker.NewHoldExpirer(h.b.payments.holds, paymentsconfig.HoldsConfig{ExpiryInterval: 10 * time.Millisecond, ExpiryBatchSize: 10})
+	case "payments-payout-consumer":
+		mode := h.opts.payoutMode
+		if mode == "" {
+			mode = payout.ModeSucceed
+		}
+		sub = h.broker.Subscribe(topicPayout, groupPayments)
+		w = paymentsworker.NewPayoutConsumer(sub, payout.NewFake(mode, 0), h.b.payments.payouts, paymentsconfig.PayoutConfig{Timeout: 50 * time.Millisecond})
+	default:
+		h.t.Fatalf("unknown worker %s", name)
+	}
+	h.startWorker(name, w, sub)
+}
+
+func (h *harness) startWorker(name string, w interface{ Run(context.Context) }, sub broker.Subscriber) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { w.Run(ctx); close(done) }()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running[name] = func() {
+		cancel()
+		<-done
+		if sub != nil {
+			_ = sub.Close()
+		}
+	}
+}
+
+func (h *harness) stop(name string) {
+	h.mu.Lock()
+	stop, ok := h.running[name]
+	delete(h.running, name)
+	h.mu.Unlock()
+	if ok {
+		stop()
+	}
+}
+
+func (h *harness) stopAll() {
+	h.mu.Lock()
+	names := make([]string, 0, len(h.running))
+	for name := range h.running {
+		names = append(names, name)
+	}
+	h.mu.Unlock()
+	for _, name := range names {
+		h.stop(name)
+	}
+}
+
+// call выполняет запрос через gateway и раскладывает ответ в out (поле data).
+func (h *harness) call(method, path string, body any, out any) int {
+	h.t.Helper()
+	var rd io.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		rd = bytes.NewReader(raw)
+	}
+	req, _ := http.NewRequest(method, h.gateway.URL+path, rd)
+	h.authorize(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		var env struct {
+			Data json.RawMessage `json:"data"`
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(raw, &env); err != nil {
+			h.t.Fatalf("%s %s: bad body %q", method, path, raw)
+		}
+		if err := json.Unmarshal(env.Data, out); err != nil && resp.StatusCode < 300 {
+			h.t.Fatalf("%s %s: bad data %s", method, path, env.Data)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (h *harness) authorize(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+}
+
+func (h *harness) balance(userID string) int64 {
+	h.t.Helper()
+	var b struct {
+		Balance int64 `json:"balance"`
+	}
+	if code := h.call(http.MethodGet, "/accounts/"+userID, nil, &b); code != http.StatusOK {
+		h.t.Fatalf("get balance: status %d", code)
+	}
+	return b.Balance
+}
+
+func (h *harness) createOrder(userID string, amount int64) string {
+	h.t.Helper()
+	return h.createOrderWith(map[string]any{"user_id": userID, "amount": amount, "description": "book"})
+}
+
+// createManualOrder создаёт заказ с холдом вместо немедленного списания.
+func (h *harness) createManualOrder(userID string, amount int64) string {
+	h.t.Helper()
+	return h.createOrderWith(map[string]any{"user_id": userID, "amount": amount, "capture_method": "manual"})
+}
+
+func (h *harness) createOrderWith(body map[string]any) string {
+	h.t.Helper()
+	var created struct {
+		OrderID string `json:"order_id"`
+		Status  string `json:"status"`
+	}
+	code := h.call(http.MethodPost, "/orders", body, &created)
+	if code != http.StatusCreated || created.Status != "NEW" {
+		h.t.Fatalf("create order: status %d, body %+v", code, created)
+	}
+	return created.OrderID
+}
+
+func (h *harness) orderStatus(orderID string) string {
+	h.t.Helper()
+	var o struct {
+		Status string `json:"status"`
+	}
+	if code := h.call(http.MethodGet, "/orders/"+orderID, nil, &o); code != http.StatusOK {
+		h.t.Fatalf("get order: status %d", code)
+	}
+	return o.Status
+}
+
+// awaitStatus опрашивает заказ, как это делает клиент из README.
+func (h *harness) awaitStatus(orderID string) string {
+	h.t.Helper()
+	var st string
+	eventually(h.t, func() bool {
+		st = h.orderStatus(orderID)
+		return st != "NEW"
+	})
+	return st
+}
+
+// awaitStatusIs ждёт, пока заказ перейдёт в статус want.
+func (h *harness) awaitStatusIs(orderID, want string) {
+	h.t.Helper()
+	eventually(h.t, func() bool { return h.orderStatus(orderID) == want })
+}
+
+// funds возвращает баланс счёта и сумму холдов на нём.
+func (h *harness) funds(userID string) (balance, held int64) {
+	h.t.Helper()
+	var a struct {
+		Balance int64 `json:"balance"`
+		Held    int64 `json:"held"`
+	}
+	if code := h.call(http.MethodGet, "/accounts/"+userID, nil, &a); code != http.StatusOK {
+		h.t.Fatalf("get account: status %d", code)
+	}
+	return a.Balance, a.Held
+}
+
+// settle ждёт, пока все группы дочитают свои топики и outbox'ы опустеют.
+func (h *harness) settle() {
+	h.t.Helper()
+	eventually(h.t, func() bool {
+		return h.broker.Lag(topicRequested, groupPayments) == 0 &&
+			h.broker.Lag(topicRetry, groupPayments) == 0 &&
+			h.broker.Lag(topicPayout, groupPayments) == 0 &&
+			h.broker.Lag(topicResult, groupOrders) == 0
+	})
+	// даём outbox-воркерам время выгрузить то, что могло появиться
+	time.Sleep(100 * time.Millisecond)
+	eventually(h.t, func() bool {
+		return h.broker.Lag(topicRequested, groupPayments) == 0 &&
+			h.broker.Lag(topicResult, groupOrders) == 0
+	})
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,205 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/httpx"
+)
+
+// TestSpecMatchesHandlers проходит по каждой операции api/swagger.yaml через
+// gateway и сверяет ответы со спецификацией. Падает, если операция из
+// спецификации не обслуживается, если у неё нет случая ниже или если
+// обработчик отвечает не тем статусом или не той схемой.
+func TestSpecMatchesHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backends) {
+		h := newHarness(t, b, options{})
+		spec := mustSpec(t)
+
+		userID := createAccount(t, h, 1000)
+		orderID := h.createOrder(userID, 100)
+		stranger := uuid.NewString()
+		frozenID := createAccount(t, h, 0)
+		recipientID := createAccount(t, h, 0)
+		transferID := uuid.NewString()
+		captureID := h.createManualOrder(userID, 10)
+		voidID := h.createManualOrder(userID, 10)
+		h.awaitStatusIs(captureID, "AUTHORIZED")
+		h.awaitStatusIs(voidID, "AUTHORIZED")
+		h.awaitStatusIs(orderID, "FINISHED")
+		var withdrawal struct {
+			WithdrawalID string `json:"withdrawal_id"`
+		}
+		if code := h.call(http.MethodPost, "/accounts/"+userID+"/withdrawals", map[string]any{"amount": 10}, &withdrawal); code != http.StatusAccepted {
+			t.Fatalf("withdraw: status %d", code)
+		}
+
+		cases := []struct {
+			op     string
+			method string
+			path   string
+			body   any
+			want   int
+			// field — поле, которое должно быть в error.details
+			field string
+		}{
+			{op: "GET /health", method: http.MethodGet, path: "/health", want: http.StatusOK},
+
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": userID, "amount": 10}, want: http.StatusCreated},
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": "nope", "amount": 10}, want: http.StatusBadRequest, field: "body.user_id"},
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": userID, "amount": 0}, want: http.StatusBadRequest, field: "body.amount"},
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": userID}, want: http.StatusBadRequest, field: "body.amount"},
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": userID, "amount": 10, "capture_method": "later"}, want: http.StatusBadRequest, field: "body.capture_method"},
+			{op: "POST /orders", method: http.MethodPost, path: "/v1/orders", body: map[string]any{"user_id": userID, "amount": 10, "currency": "rub"}, want: http.StatusBadRequest, field: "body.currency"},
+
+			{op: "GET /orders", method: http.MethodGet, path: "/v1/orders?user_id=" + userID, want: http.StatusOK},
+			{op: "GET /orders", method: http.MethodGet, path: "/v1/orders?user_id=nope", want: http.StatusBadRequest, field: "query.user_id"},
+			{op: "GET /orders", method: http.MethodGet, path: "/v1/orders", want: http.StatusBadRequest, field: "query.user_id"},
+
+			{op: "GET /orders/{order_id}", method: http.MethodGet, path: "/v1/orders/" + orderID, want: http.StatusOK},
+			{op: "GET /orders/{order_id}", method: http.MethodGet, path: "/v1/orders/" + uuid.NewString(), want: http.StatusNotFound},
+			{op: "GET /orders/{order_id}", method: http.MethodGet, path: "/v1/orders/nope", want: http.StatusBadRequest, field: "path.order_id"},
+
+			{op: "POST /orders/{order_id}/capture", method: http.MethodPost, path: "/v1/orders/" + captureID + "/capture", want: http.StatusAccepted},
+			{op: "POST /orders/{order_id}/capture", method: http.MethodPost, path: "/v1/orders/" + orderID + "/capture", want: http.StatusConflict},
+			{op: "POST /orders/{order_id}/capture", method: http.MethodPost, path: "/v1/orders/" + uuid.NewString() + "/capture", want: http.StatusNotFound},
+			{op: "POST /orders/{order_id}/capture", method: http.MethodPost, path: "/v1/orders/nope/capture", want: http.StatusBadRequest, field: "path.order_id"},
+			{op: "POST /orders/{order_id}/void", method: http.MethodPost, path: "/v1/orders/" + voidID + "/void", want: http.StatusAccepted},
+			{op: "POST /orders/{order_id}/void", method: http.MethodPost, path: "/v1/orders/" + orderID + "/void", want: http.StatusConflict},
+
+			{op: "POST /orders/{order_id}/refunds", method: http.MethodPost, path: "/v1/orders/" + orderID + "/refunds", body: map[string]any{"amount": 10}, want: http.StatusAccepted},
+			{op: "POST /orders/{order_id}/refunds", method: http.MethodPost, path: "/v1/orders/" + orderID + "/refunds", body: map[string]any{"amount": 1000}, want: http.StatusConflict},
+			{op: "POST /orders/{order_id}/refunds", method: http.MethodPost, path: "/v1/orders/" + voidID + "/refunds", body: map[string]any{"amount": 1}, want: http.StatusConflict},
+			{op: "POST /orders/{order_id}/refunds", method: http.MethodPost, path: "/v1/orders/" + orderID + "/refunds", body: map[string]any{"amount": 0}, want: http.StatusBadRequest, field: "body.amount"},
+			{op: "POST /orders/{order_id}/refunds", method: http.MethodPost, path: "/v1/orders/" + uuid.NewString() + "/refunds", body: map[string]any{"amount": 1}, want: http.StatusNotFound},
+
+			{op: "POST /accounts", method: http.MethodPost, path: "/v1/accounts", body: map[string]any{"user_id": uuid.NewString(), "balance": 0}, want: http.StatusCreated},
+			{op: "POST /accounts", method: http.MethodPost, path: "/v1/accounts", body: map[string]any{"user_id": userID, "balance": 0}, want: http.StatusConflict},
+			{op: "POST /accounts", method: http.MethodPost, path: "/v1/accounts", body: map[string]any{"user_id": "nope", "balance": -1}, want: http.StatusBadRequest, field: "body.balance"},
+
+			{op: "POST /accounts/topup", method: http.MethodPost, path: "/v1/accounts/topup", body: map[string]any{"user_id": userID, "amount": 5}, want: http.StatusOK},
+			{op: "POST /accounts/topup", method: http.MethodPost, path: "/v1/accounts/topup", body: map[string]any{"user_id": "nope", "amount": 5}, want: http.StatusBadRequest, field: "body.user_id"},
+			{op: "POST /accounts/topup", method: http.MethodPost, path: "/v1/accounts/topup", body: map[string]any{"user_id": stranger, "amount": 5}, want: http.StatusNotFound},
+
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": transferID, "from_user_id": userID, "to_user_id": recipientID, "amount": 5}, want: http.StatusCreated},
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": transferID, "from_user_id": userID, "to_user_id": recipientID, "amount": 5}, want: http.StatusOK},
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": transferID, "from_user_id": userID, "to_user_id": recipientID, "amount": 6}, want: http.StatusConflict},
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": uuid.NewString(), "from_user_id": userID, "to_user_id": recipientID, "amount": 1_000_000}, want: http.StatusConflict},
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": uuid.NewString(), "from_user_id": userID, "to_user_id": stranger, "amount": 1}, want: http.StatusNotFound},
+			{op: "POST /accounts/transfers", method: http.MethodPost, path: "/v1/accounts/transfers", body: map[string]any{"transfer_id": uuid.NewString(), "from_user_id": userID, "to_user_id": recipientID}, want: http.StatusBadRequest, field: "body.amount"},
+
+			{op: "GET /accounts/{user_id}", method: http.MethodGet, path: "/v1/accounts/" + userID, want: http.StatusOK},
+			{op: "GET /accounts/{user_id}", method: http.MethodGet, path: "/v1/accounts/" + stranger, want: http.StatusNotFound},
+			{op: "GET /accounts/{user_id}", method: http.MethodGet, path: "/v1/accounts/nope", want: http.StatusBadRequest, field: "path.user_id"},
+
+			{op: "POST /accounts/{user_id}/withdrawals", method: http.MethodPost, path: "/v1/accounts/" + userID + "/withdrawals", body: map[string]any{"amount": 5}, want: http.StatusAccepted},
+			{op: "POST /accounts/{user_id}/withdrawals", method: http.MethodPost, path: "/v1/accounts/" + userID + "/withdrawals", body: map[string]any{"amount": 1_000_000}, want: http.StatusConflict},
+			{op: "POST /accounts/{user_id}/withdrawals", method: http.MethodPost, path: "/v1/accounts/" + stranger + "/withdrawals", body: map[string]any{"amount": 5}, want: http.StatusNotFound},
+			{op: "POST /accounts/{user_id}/withdrawals", method: http.MethodPost, path: "/v1/accounts/" + userID + "/withdrawals", body: map[string]any{"amount": 0}, want: http.StatusBadRequest, field: "body.amount"},
+			{op: "GET /accounts/{user_id}/withdrawals/{withdrawal_id}", method: http.MethodGet, path: "/v1/accounts/" + userID + "/withdrawals/" + withdrawal.WithdrawalID, want: http.StatusOK},
+			{op: "GET /accounts/{user_id}/withdrawals/{withdrawal_id}", method: http.MethodGet, path: "/v1/accounts/" + userID + "/withdrawals/" + uuid.NewString(), want: http.StatusNotFound},
+			{op: "GET /accounts/{user_id}/withdrawals/{withdrawal_id}", method: http.MethodGet, path: "/v1/accounts/" + userID + "/withdrawals/nope", want: http.StatusBadRequest, field: "path.withdrawal_id"},
+
+			{op: "GET /accounts/{user_id}/limits", method: http.MethodGet, path: "/v1/accounts/" + recipientID + "/limits", want: http.StatusOK},
+			{op: "GET /accounts/{user_id}/limits", method: http.MethodGet, path: "/v1/accounts/" + stranger + "/limits", want: http.StatusNotFound},
+			{op: "PUT /accounts/{user_id}/limits", method: http.MethodPut, path: "/v1/accounts/" + recipientID + "/limits", body: map[string]any{"daily_amount": 1000, "max_orders": 5, "orders_window_seconds": 60}, want: http.StatusOK},
+			{op: "PUT /accounts/{user_id}/limits", method: http.MethodPut, path: "/v1/accounts/" + stranger + "/limits", body: map[string]any{}, want: http.StatusNotFound},
+			{op: "PUT /accounts/{user_id}/limits", method: http.MethodPut, path: "/v1/accounts/" + recipientID + "/limits", body: map[string]any{"max_orders": 5}, want: http.StatusBadRequest, field: "body.orders_window_seconds"},
+
+			{op: "POST /accounts/{user_id}/wallets", method: http.MethodPost, path: "/v1/accounts/" + userID + "/wallets", body: map[string]any{"currency": "USD"}, want: http.StatusCreated},
+			{op: "POST /accounts/{user_id}/wallets", method: http.MethodPost, path: "/v1/accounts/" + userID + "/wallets", body: map[string]any{"currency": "USD"}, want: http.StatusConflict},
+			{op: "POST /accounts/{user_id}/wallets", method: http.MethodPost, path: "/v1/accounts/" + stranger + "/wallets", body: map[string]any{"currency": "USD"}, want: http.StatusNotFound},
+			{op: "POST /accounts/{user_id}/wallets", method: http.MethodPost, path: "/v1/accounts/" + userID + "/wallets", body: map[string]any{"currency": "XXX"}, want: http.StatusBadRequest, field: "body.currency"},
+
+			{op: "POST /accounts/{user_id}/freeze", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/freeze", body: map[string]any{"reason": "kyc"}, want: http.StatusOK},
+			{op: "POST /accounts/{user_id}/freeze", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/freeze", body: map[string]any{"reason": "kyc"}, want: http.StatusConflict},
+			{op: "POST /accounts/{user_id}/freeze", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/freeze", body: map[string]any{}, want: http.StatusBadRequest, field: "body.reason"},
+			{op: "POST /accounts/{user_id}/unfreeze", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/unfreeze", body: map[string]any{"reason": "ok"}, want: http.StatusOK},
+			{op: "POST /accounts/{user_id}/unfreeze", method: http.MethodPost, path: "/v1/accounts/" + stranger + "/unfreeze", body: map[string]any{"reason": "ok"}, want: http.StatusNotFound},
+			{op: "POST /accounts/{user_id}/close", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/close", body: map[string]any{"reason": "bye"}, want: http.StatusOK},
+			{op: "POST /accounts/{user_id}/close", method: http.MethodPost, path: "/v1/accounts/" + frozenID + "/close", body: map[string]any{"reason": "bye"}, want: http.StatusConflict},
+			{op: "PUT /accounts/{user_id}/limits", method: http.MethodPut, path: "/v1/accounts/" + frozenID + "/limits", body: map[string]any{"daily_amount": 1}, want: http.StatusConflict},
+
+			{op: "GET /users/{user_id}/summary", method: http.MethodGet, path: "/v1/users/" + userID + "/summary", want: http.StatusOK},
+			{op: "GET /users/{user_id}/summary", method: http.MethodGet, path: "/v1/users/nope/summary", want: http.StatusBadRequest},
+		}
+
+		covered := map[string]bool{}
+		for _, tc := range cases {
+			covered[tc.op] = true
+		}
+		var missing []string
+		for _, op := range spec.Operations() {
+			if !covered[op] {
+				missing = append(missing, op)
+			}
+		}
+		sort.Strings(missing)
+		if len(missing) > 0 {
+			t.Fatalf("operations without a case: %s", strings.Join(missing, ", "))
+		}
+
+		for _, tc := range cases {
+			status, contentType, body := h.raw(tc.method, tc.path, tc.body)
+			if status != tc.want {
+				t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, status, tc.want, body)
+				continue
+			}
+
+			u, _ := url.Parse(tc.path)
+			path := strings.TrimPrefix(u.Path, "/v1")
+			op, template, _ := spec.Find(tc.method, path)
+			if op == nil || tc.method+" "+template != tc.op {
+				t.Errorf("%s %s: matched %q in spec, want %q", tc.method, tc.path, template, tc.op)
+				continue
+			}
+			if err := spec.ValidateResponse(op, status, contentType, body); err != nil {
+				t.Errorf("%s %s: %v", tc.method, tc.path, err)
+			}
+
+			if tc.field != "" {
+				var e httpx.ErrorResponse
+				_ = json.Unmarshal(body, &e)
+				if e.Error.Code != "BAD_REQUEST" || !hasDetail(e.Error.Details, tc.field) {
+					t.Errorf("%s %s: want BAD_REQUEST with %s in details, got %s", tc.method, tc.path, tc.field, body)
+				}
+			}
+		}
+	})
+}
+
+func hasDetail(details []httpx.ErrorDetail, field string) bool {
+	for _, d := range details {
+		if d.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// raw выполняет запрос через gateway и возвращает ответ как есть.
+func (h *harness) raw(method, path string, body any) (int, string, []byte) {
+	h.t.Helper()
+	var rd io.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		rd = bytes.NewReader(raw)
+	}
+	req, _ := http.NewRequest(method, h.gateway.URL+path, rd)
+	h.authorize(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Content-Type"), raw
+}
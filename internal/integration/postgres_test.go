@@ -0,0 +1,134 @@
+package integration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Postgres для подтестов "postgres" берётся по порядку:
+//  1. INTEGRATION_ORDERS_DB_DSN и INTEGRATION_PAYMENTS_DB_DSN — готовые пустые базы;
+//  2. временный кластер, который поднимается через initdb/pg_ctl из
+//     INTEGRATION_PG_BIN или PATH и останавливается после прогона;
+//  3. иначе подтесты пропускаются, а при заданной CI падают: в CI SQL-хранилища
+//     должны проверяться всегда, а не только in-memory реализации.
+var pg struct {
+	once     sync.Once
+	orders   string
+	payments string
+	stop     func()
+	err      error
+}
+
+var errNoPostgres = errors.New("set INTEGRATION_ORDERS_DB_DSN and INTEGRATION_PAYMENTS_DB_DSN, or put initdb and pg_ctl on PATH (or INTEGRATION_PG_BIN)")
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if pg.stop != nil {
+		pg.stop()
+	}
+	os.Exit(code)
+}
+
+// postgresDSNs возвращает DSN баз orders и payments, поднимая кластер при
+// первом вызове.
+func postgresDSNs(t *testing.T) (orders, payments string) {
+	t.Helper()
+	pg.once.Do(func() {
+		pg.orders, pg.payments, pg.stop, pg.err = resolvePostgres()
+	})
+	if pg.err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("postgres is required in CI: %v", pg.err)
+		}
+		t.Skipf("postgres: %v", pg.err)
+	}
+	return pg.orders, pg.payments
+}
+
+func resolvePostgres() (orders, payments string, stop func(), err error) {
+	orders, payments = os.Getenv("INTEGRATION_ORDERS_DB_DSN"), os.Getenv("INTEGRATION_PAYMENTS_DB_DSN")
+	if orders != "" && payments != "" {
+		return orders, payments, nil, nil
+	}
+	initdb, err := pgBin("initdb")
+	if err != nil {
+		return "", "", nil, errNoPostgres
+	}
+	pgctl, err := pgBin("pg_ctl")
+	if err != nil {
+		return "", "", nil, errNoPostgres
+	}
+	return spawnPostgres(initdb, pgctl)
+}
+
+func pgBin(name string) (string, error) {
+	if dir := os.Getenv("INTEGRATION_PG_BIN"); dir != "" {
+		p := filepath.Join(dir, name)
+		_, err := os.Stat(p)
+		return p, err
+	}
+	return exec.LookPath(name)
+}
+
+// spawnPostgres поднимает кластер во временном каталоге на свободном порту
+// и создаёт в нём базы orders и payments. fsync выключен: данные не
+// переживают прогон.
+func spawnPostgres(initdb, pgctl string) (orders, payments string, stop func(), err error) {
+	dir, err := os.MkdirTemp("", "integration-pg-")
+	if err != nil {
+		return "", "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", "", nil, fmt.Errorf("initdb: %w\n%s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", "", nil, err
+	}
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off -c full_page_writes=off", port, dir)
+	if out, err := exec.Command(pgctl, "start", "-w", "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", opts).CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", "", nil, fmt.Errorf("pg_ctl start: %w\n%s", err, out)
+	}
+	stop = func() {
+		_ = exec.Command(pgctl, "stop", "-m", "immediate", "-D", data).Run()
+		_ = os.RemoveAll(dir)
+	}
+
+	dsn := func(db string) string {
+		return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/%s?sslmode=disable", port, db)
+	}
+	admin, err := sql.Open("postgres", dsn("postgres"))
+	if err != nil {
+		stop()
+		return "", "", nil, err
+	}
+	defer admin.Close()
+	for _, db := range []string{"orders", "payments"} {
+		if _, err := admin.Exec(`CREATE DATABASE ` + db); err != nil {
+			stop()
+			return "", "", nil, fmt.Errorf("create database %s: %w", db, err)
+		}
+	}
+	return dsn("orders"), dsn("payments"), stop, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -1 +1,206 @@
 package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/envconfig"
+	"HW4/internal/common/kafka"
+)
+
+// Config — настройки Orders Service. Источники по возрастанию приоритета:
+// дефолты, YAML-файл из ORDERS_CONFIG_FILE, переменные окружения.
+type Config struct {
+	HTTP   HTTPConfig   `yaml:"http"`
+	DB     DBConfig     `yaml:"db"`
+	Kafka  KafkaConfig  `yaml:"kafka"`
+	Outbox OutboxConfig `yaml:"outbox"`
+	Auth   AuthConfig   `yaml:"auth"`
+
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	WorkerRestartDelay time.Duration `yaml:"worker_restart_delay" env:"WORKER_RESTART_DELAY"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" env:"ORDERS_HTTP_ADDR"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"ORDERS_HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"ORDERS_HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"ORDERS_HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"ORDERS_HTTP_IDLE_TIMEOUT"`
+	// LegacySunset — дата отключения маршрутов без /v1 (2027-06-30); пусто — apiversion.DefaultSunset.
+	LegacySunset string `yaml:"legacy_sunset" env:"API_LEGACY_SUNSET"`
+	// ValidateResponses сверяет ответы обработчиков с api/swagger.yaml и пишет расхождения в лог.
+	ValidateResponses bool `yaml:"validate_responses" env:"ORDERS_HTTP_VALIDATE_RESPONSES"`
+}
+
+// Versioning — настройки apiversion.Middleware. Дата уже проверена в Validate.
+func (c HTTPConfig) Versioning() apiversion.Options {
+	sunset, _ := apiversion.ParseSunset(c.LegacySunset)
+	return apiversion.Options{Sunset: sunset}
+}
+
+type DBConfig struct {
+	DSN             string        `yaml:"dsn" env:"ORDERS_DB_DSN"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"ORDERS_DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"ORDERS_DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"ORDERS_DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"ORDERS_DB_CONN_MAX_IDLE_TIME"`
+	// AutoMigrate применяет встроенные миграции при старте сервиса.
+	AutoMigrate bool `yaml:"auto_migrate" env:"ORDERS_DB_AUTO_MIGRATE"`
+}
+
+// AuthConfig: личность пользователя приходит от gateway в заголовках X-Auth-*.
+// При Required запросы без неё отклоняются с 401.
+type AuthConfig struct {
+	Required bool `yaml:"required" env:"ORDERS_AUTH_REQUIRED"`
+}
+
+type KafkaConfig struct {
+	Brokers               []string      `yaml:"brokers" env:"KAFKA_BROKERS"`
+	TopicPaymentRequested string        `yaml:"topic_payment_requested" env:"KAFKA_TOPIC_PAYMENT_REQUESTED"`
+	TopicPaymentResult    string        `yaml:"topic_payment_result" env:"KAFKA_TOPIC_PAYMENT_RESULT"`
+	ConsumerGroup         string        `yaml:"consumer_group" env:"ORDERS_CONSUMER_GROUP"`
+	MinBytes              int           `yaml:"min_bytes" env:"KAFKA_CONSUMER_MIN_BYTES"`
+	MaxBytes              int           `yaml:"max_bytes" env:"KAFKA_CONSUMER_MAX_BYTES"`
+	MaxWait               time.Duration `yaml:"max_wait" env:"KAFKA_CONSUMER_MAX_WAIT"`
+	FetchTimeout          time.Duration `yaml:"fetch_timeout" env:"KAFKA_FETCH_TIMEOUT"`
+	CommitTimeout         time.Duration `yaml:"commit_timeout" env:"KAFKA_COMMIT_TIMEOUT"`
+	PublishTimeout        time.Duration `yaml:"publish_timeout" env:"KAFKA_PUBLISH_TIMEOUT"`
+}
+
+func (k KafkaConfig) Consumer(topic string) kafka.ConsumerConfig {
+	return kafka.ConsumerConfig{
+		Brokers:       k.Brokers,
+		Topic:         topic,
+		GroupID:       k.ConsumerGroup,
+		MinBytes:      k.MinBytes,
+		MaxBytes:      k.MaxBytes,
+		MaxWait:       k.MaxWait,
+		FetchTimeout:  k.FetchTimeout,
+		CommitTimeout: k.CommitTimeout,
+	}
+}
+
+func (k KafkaConfig) Producer() kafka.ProducerConfig {
+	return kafka.ProducerConfig{Brokers: k.Brokers, PublishTimeout: k.PublishTimeout}
+}
+
+type OutboxConfig struct {
+	BatchSize    int           `yaml:"batch_size" env:"ORDERS_OUTBOX_BATCH_SIZE"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"ORDERS_OUTBOX_POLL_INTERVAL"`
+	LockTTL      time.Duration `yaml:"lock_ttl" env:"ORDERS_OUTBOX_LOCK_TTL"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"ORDERS_OUTBOX_RETRY_BACKOFF"`
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+		DB: DBConfig{
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Kafka: KafkaConfig{
+			MinBytes:       1e3,
+			MaxBytes:       10e6,
+			MaxWait:        time.Second,
+			FetchTimeout:   30 * time.Second,
+			CommitTimeout:  5 * time.Second,
+			PublishTimeout: 5 * time.Second,
+		},
+		Outbox: OutboxConfig{
+			BatchSize:    20,
+			PollInterval: 700 * time.Millisecond,
+			LockTTL:      10 * time.Second,
+			RetryBackoff: 2 * time.Second,
+		},
+		ShutdownTimeout:    15 * time.Second,
+		WorkerRestartDelay: time.Second,
+	}
+}
+
+// Load собирает конфиг из дефолтов, файла и env и валидирует его.
+// Ошибки разбора и валидации возвращаются все сразу.
+func Load() (Config, error) {
+	cfg, loadErr := load()
+	return cfg, errors.Join(loadErr, cfg.Validate())
+}
+
+// LoadDB загружает конфиг, но валидирует только секцию db —
+// для подкоманды migrate, которой Kafka не нужна.
+func LoadDB() (DBConfig, error) {
+	cfg, loadErr := load()
+	return cfg.DB, errors.Join(loadErr, cfg.DB.Validate())
+}
+
+func load() (Config, error) {
+	cfg := Default()
+	err := envconfig.Load(strings.TrimSpace(os.Getenv("ORDERS_CONFIG_FILE")), &cfg)
+	return cfg, err
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr (ORDERS_HTTP_ADDR) is required")
+	check(c.HTTP.ReadHeaderTimeout > 0, "http.read_header_timeout must be > 0")
+	check(c.HTTP.ReadTimeout >= 0, "http.read_timeout must be >= 0")
+	check(c.HTTP.WriteTimeout >= 0, "http.write_timeout must be >= 0")
+	check(c.HTTP.IdleTimeout >= 0, "http.idle_timeout must be >= 0")
+	_, sunsetErr := apiversion.ParseSunset(c.HTTP.LegacySunset)
+	check(sunsetErr == nil, "http.legacy_sunset (API_LEGACY_SUNSET): %v", sunsetErr)
+
+	check(len(c.Kafka.Brokers) > 0, "kafka.brokers (KAFKA_BROKERS) is required")
+	check(c.Kafka.TopicPaymentRequested != "", "kafka.topic_payment_requested (KAFKA_TOPIC_PAYMENT_REQUESTED) is required")
+	check(c.Kafka.TopicPaymentResult != "", "kafka.topic_payment_result (KAFKA_TOPIC_PAYMENT_RESULT) is required")
+	check(c.Kafka.ConsumerGroup != "", "kafka.consumer_group (ORDERS_CONSUMER_GROUP) is required")
+	check(c.Kafka.MinBytes > 0 && c.Kafka.MinBytes <= c.Kafka.MaxBytes, "kafka.min_bytes must be in [1, max_bytes]")
+	check(c.Kafka.MaxWait > 0, "kafka.max_wait must be > 0")
+	check(c.Kafka.FetchTimeout > 0, "kafka.fetch_timeout must be > 0")
+	check(c.Kafka.CommitTimeout > 0, "kafka.commit_timeout must be > 0")
+	check(c.Kafka.PublishTimeout > 0, "kafka.publish_timeout must be > 0")
+
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be > 0")
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be > 0")
+	check(c.Outbox.LockTTL > 0, "outbox.lock_ttl must be > 0")
+	check(c.Outbox.RetryBackoff > 0, "outbox.retry_backoff must be > 0")
+
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be > 0")
+	check(c.WorkerRestartDelay > 0, "worker_restart_delay must be > 0")
+
+	return errors.Join(append(errs, c.DB.Validate())...)
+}
+
+func (c DBConfig) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.DSN != "", "db.dsn (ORDERS_DB_DSN) is required")
+	check(c.MaxOpenConns > 0, "db.max_open_conns must be > 0")
+	check(c.MaxIdleConns >= 0 && c.MaxIdleConns <= c.MaxOpenConns,
+		"db.max_idle_conns must be in [0, max_open_conns]")
+	check(c.ConnMaxLifetime >= 0, "db.conn_max_lifetime must be >= 0")
+	check(c.ConnMaxIdleTime >= 0, "db.conn_max_idle_time must be >= 0")
+
+	return errors.Join(errs...)
+}
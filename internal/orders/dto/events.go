@@ -1,9 +1,28 @@
 package dto
 
+// Типы команд в топике запросов на оплату; пустой Type — EventPaymentRequested.
+const (
+	EventPaymentRequested = "payment.requested"
+	EventCaptureRequested = "payment.capture_requested"
+	EventVoidRequested    = "payment.void_requested"
+	EventRefundRequested  = "payment.refund_requested"
+)
+
+// Способ списания: automatic — сразу при создании заказа, manual — холд
+// до POST /orders/{order_id}/capture или /void.
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+)
+
 type PaymentRequested struct {
-	MessageID string `json:"message_id"`
-	OrderID   string `json:"order_id"`
-	UserID    string `json:"user_id"`
-	Amount    int64  `json:"amount"`
-	CreatedAt string `json:"created_at"`
+	MessageID     string `json:"message_id"`
+	Type          string `json:"type,omitempty"`
+	OrderID       string `json:"order_id"`
+	UserID        string `json:"user_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	CaptureMethod string `json:"capture_method,omitempty"`
+	RefundID      string `json:"refund_id,omitempty"`
+	CreatedAt     string `json:"created_at"`
 }
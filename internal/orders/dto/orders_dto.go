@@ -1,9 +1,14 @@
 package dto
 
 type CreateOrderRequest struct {
-	UserID      string `json:"user_id"`
-	Amount      int64  `json:"amount"`
+	UserID string `json:"user_id"`
+	// Amount — в минорных единицах Currency.
+	Amount int64 `json:"amount"`
+	// Currency — код ISO 4217; пусто — money.DefaultCurrency.
+	Currency    string `json:"currency,omitempty"`
 	Description string `json:"description"`
+	// CaptureMethod — CaptureAutomatic (по умолчанию) или CaptureManual.
+	CaptureMethod string `json:"capture_method,omitempty"`
 }
 
 type CreateOrderResponse struct {
@@ -12,14 +17,34 @@ type CreateOrderResponse struct {
 }
 
 type OrderResponse struct {
-	OrderID     string `json:"order_id"`
-	UserID      string `json:"user_id"`
-	Amount      int64  `json:"amount"`
-	Status      string `json:"status"`
+	OrderID       string `json:"order_id"`
+	UserID        string `json:"user_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	CaptureMethod string `json:"capture_method"`
+	// RefundedAmount — сумма подтверждённых возвратов.
+	RefundedAmount int64 `json:"refunded_amount"`
+	// FX — что фактически списано, если заказ оплачен из кошелька в другой валюте.
+	FX          *FX    `json:"fx,omitempty"`
 	CreatedAt   string `json:"created_at"`
 	Description string `json:"description"`
 }
 
+type RefundRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+// RefundResponse — принятый запрос на возврат. Итог придёт от Payments
+// асинхронно и отразится в refunded_amount и статусе заказа.
+type RefundResponse struct {
+	RefundID string `json:"refund_id"`
+	OrderID  string `json:"order_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+}
+
 type OrdersListResponse struct {
 	Orders []OrderResponse `json:"orders"`
 }
@@ -1,11 +1,36 @@
 package dto
 
+// EventRefundResult — тип результата возврата; пустой Type — результат оплаты.
+const EventRefundResult = "refund.result"
+
+// Статусы результата возврата.
+const (
+	RefundSucceeded = "SUCCEEDED"
+	RefundRejected  = "REJECTED"
+)
+
 type PaymentResult struct {
 	MessageID string `json:"message_id"`
+	Type      string `json:"type,omitempty"`
 	OrderID   string `json:"order_id"`
 	UserID    string `json:"user_id"`
 	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency,omitempty"`
 	Status    string `json:"status"`
 	Reason    string `json:"reason,omitempty"`
+	RefundID  string `json:"refund_id,omitempty"`
+	// RefundedAmount — сколько всего возвращено по заказу после этого возврата.
+	RefundedAmount int64 `json:"refunded_amount,omitempty"`
+	// FX — конвертация, если заказ оплачен из кошелька в другой валюте.
+	FX        *FX    `json:"fx,omitempty"`
 	CreatedAt string `json:"created_at"`
 }
+
+// FX — сколько и в какой валюте фактически списано за заказ: ChargedAmount
+// в минорных единицах ChargedCurrency по курсу Rate (1 единица валюты заказа
+// = Rate единиц ChargedCurrency).
+type FX struct {
+	Rate            string `json:"rate"`
+	ChargedAmount   int64  `json:"charged_amount"`
+	ChargedCurrency string `json:"charged_currency"`
+}
@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
 
+	"HW4/internal/common/authn"
 	"HW4/internal/common/httpx"
+	"HW4/internal/common/money"
 	"HW4/internal/orders/dto"
 	"HW4/internal/orders/service"
 )
@@ -18,24 +21,84 @@ func New(svc *service.OrdersService) *Handler {
 	return &Handler{svc: svc}
 }
 
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.CreateOrder(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListOrders(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		// /orders/{order_id} или /orders/{order_id}/{capture|void|refunds}
+		if _, action, sub := strings.Cut(strings.TrimPrefix(r.URL.Path, "/orders/"), "/"); sub {
+			if r.Method == http.MethodPost && action == "refunds" {
+				h.CreateRefund(w, r)
+				return
+			}
+			if r.Method == http.MethodPost {
+				h.Settle(w, r)
+				return
+			}
+		} else if r.Method == http.MethodGet {
+			h.GetOrder(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+}
+
+// orderErrors — ответы на ошибки OrdersService; остальное — 500 INTERNAL.
+var orderErrors = []httpx.Rule{
+	{Err: service.ErrBadRequest, Status: http.StatusBadRequest, Code: httpx.CodeBadRequest, Message: "invalid request"},
+	{Err: service.ErrNotFound, Status: http.StatusNotFound, Code: httpx.CodeNotFound, Message: "order not found"},
+	{Err: service.ErrInvalidTransition, Status: http.StatusConflict, Code: httpx.CodeInvalidTransition, Message: "order status does not allow this action"},
+	{Err: service.ErrRefundExceedsAmount, Status: http.StatusConflict, Code: httpx.CodeRefundExceedsAmount, Message: "refund exceeds the unrefunded order amount"},
+}
+
+var (
+	errForbidden        = httpx.NewError(http.StatusForbidden, httpx.CodeForbidden, "user_id does not match authenticated user")
+	errMethodNotAllowed = httpx.NewError(http.StatusMethodNotAllowed, httpx.CodeMethodNotAllowed, "method not allowed")
+	errRefundAdminOnly  = httpx.NewError(http.StatusForbidden, httpx.CodeForbidden, "only admins can refund orders")
+	// чужой заказ не отличаем от несуществующего
+	errOrderNotFound = httpx.NewError(http.StatusNotFound, httpx.CodeNotFound, "order not found")
+	errUnknownAction = httpx.NewError(http.StatusNotFound, httpx.CodeNotFound, "unknown order action")
+)
+
 func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "invalid json body")
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if req.UserID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.user_id", Issue: "is required"})
+	}
+	if cur, ok := money.Lookup(money.Or(req.Currency)); !ok {
+		details = append(details, httpx.ErrorDetail{Field: "body.currency", Issue: "must be one of " + strings.Join(money.Codes(), ", ")})
+	} else if err := cur.CheckAmount(req.Amount); err != nil {
+		details = append(details, httpx.ErrorDetail{Field: "body.amount", Issue: err.Error()})
+	}
+	if req.CaptureMethod != "" && !service.ValidCaptureMethod(req.CaptureMethod) {
+		details = append(details, httpx.ErrorDetail{Field: "body.capture_method", Issue: "must be automatic or manual"})
+	}
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
 		return
 	}
-	if req.UserID == "" || req.Amount <= 0 {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required and amount must be > 0")
+	if !authn.CanAccess(r.Context(), req.UserID) {
+		httpx.Fail(w, r, errForbidden)
 		return
 	}
 
 	resp, err := h.svc.CreateOrder(r.Context(), req)
 	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required and amount must be > 0")
-			return
-		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to create order")
+		httpx.Fail(w, r, httpx.Map(err, "failed to create order", orderErrors...))
 		return
 	}
 
@@ -45,17 +108,17 @@ func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "query.user_id", Issue: "is required"}))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
 		return
 	}
 
 	resp, err := h.svc.ListOrders(r.Context(), userID)
 	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
-			return
-		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to list orders")
+		httpx.Fail(w, r, httpx.Map(err, "failed to list orders", orderErrors...))
 		return
 	}
 
@@ -65,23 +128,90 @@ func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/orders/")
 	if id == "" {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "order_id is required")
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "path.order_id", Issue: "is required"}))
 		return
 	}
 
 	resp, err := h.svc.GetOrder(r.Context(), id)
 	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "order_id is required")
-			return
-		}
-		if err == service.ErrNotFound {
-			httpx.Error(w, http.StatusNotFound, "NOT_FOUND", "order not found")
-			return
-		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to get order")
+		httpx.Fail(w, r, httpx.Map(err, "failed to get order", orderErrors...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), resp.UserID) {
+		httpx.Fail(w, r, errOrderNotFound)
 		return
 	}
 
 	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.OrderResponse]{Data: resp})
 }
+
+// Settle обслуживает POST /orders/{order_id}/{capture|void} для заказов с
+// capture_method=manual. Команда уходит в Payments через outbox, поэтому
+// ответ — 202 с заказом в текущем статусе AUTHORIZED.
+func (h *Handler) Settle(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+	var settle func(context.Context, string) (dto.OrderResponse, error)
+	switch action {
+	case "capture":
+		settle = h.svc.Capture
+	case "void":
+		settle = h.svc.Void
+	default:
+		httpx.Fail(w, r, errUnknownAction)
+		return
+	}
+	if id == "" {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "path.order_id", Issue: "is required"}))
+		return
+	}
+
+	order, err := h.svc.GetOrder(r.Context(), id)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to get order", orderErrors...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), order.UserID) {
+		httpx.Fail(w, r, errOrderNotFound)
+		return
+	}
+
+	resp, err := settle(r.Context(), id)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to "+action+" order", orderErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusAccepted, httpx.SuccessResponse[dto.OrderResponse]{Data: resp})
+}
+
+// CreateRefund обслуживает POST /orders/{order_id}/refunds. Возврат проводит
+// Payments, поэтому ответ — 202 с refund_id в статусе PENDING. Оформить
+// возврат может только админ: покупатель сам себе деньги не возвращает.
+func (h *Handler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	if err := authn.RequireAdmin(r.Context(), errRefundAdminOnly); err != nil {
+		httpx.Fail(w, r, err)
+		return
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+	if id == "" {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "path.order_id", Issue: "is required"}))
+		return
+	}
+	var req dto.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	if req.Amount <= 0 {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body.amount", Issue: "must be > 0"}))
+		return
+	}
+
+	resp, err := h.svc.Refund(r.Context(), id, req)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to refund order", orderErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusAccepted, httpx.SuccessResponse[dto.RefundResponse]{Data: resp})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"HW4/internal/common/authn"
+	"HW4/internal/orders/repository"
+	"HW4/internal/orders/repository/memstore"
+	"HW4/internal/orders/service"
+)
+
+const userID = "11111111-1111-1111-1111-111111111111"
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+func do(t *testing.T, fn http.HandlerFunc, method, target, body string) (int, envelope) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	fn(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	var env envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("bad response body %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, env
+}
+
+func TestHandlers(t *testing.T) {
+	h := New(service.New(memstore.New("payment.requested")))
+
+	code, env := do(t, h.CreateOrder, http.MethodPost, "/orders", `{"user_id":"`+userID+`","amount":150,"description":"book"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	var created struct {
+		OrderID string `json:"order_id"`
+	}
+	_ = json.Unmarshal(env.Data, &created)
+
+	tests := []struct {
+		name     string
+		fn       http.HandlerFunc
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "create bad json", fn: h.CreateOrder, method: http.MethodPost, target: "/orders", body: `{`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "create without amount", fn: h.CreateOrder, method: http.MethodPost, target: "/orders", body: `{"user_id":"` + userID + `"}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "list without user", fn: h.ListOrders, method: http.MethodGet, target: "/orders", wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "list", fn: h.ListOrders, method: http.MethodGet, target: "/orders?user_id=" + userID, wantCode: http.StatusOK},
+		{name: "get existing", fn: h.GetOrder, method: http.MethodGet, target: "/orders/" + created.OrderID, wantCode: http.StatusOK},
+		{name: "get unknown", fn: h.GetOrder, method: http.MethodGet, target: "/orders/44444444-4444-4444-4444-444444444444", wantCode: http.StatusNotFound, wantErr: "NOT_FOUND"},
+		{name: "get empty id", fn: h.GetOrder, method: http.MethodGet, target: "/orders/", wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, env := do(t, tt.fn, tt.method, tt.target, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if env.Error.Code != tt.wantErr {
+				t.Fatalf("error code = %q, want %q", env.Error.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserScoping(t *testing.T) {
+	store := memstore.New("payment.requested")
+	h := New(service.New(store))
+	mux := http.NewServeMux()
+	h.Register(mux)
+	api := authn.Middleware(false, mux)
+
+	const other = "22222222-2222-2222-2222-222222222222"
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"user_id":"`+userID+`","amount":10}`)))
+	var env envelope
+	_ = json.Unmarshal(rec.Body.Bytes(), &env)
+	var created struct {
+		OrderID string `json:"order_id"`
+	}
+	_ = json.Unmarshal(env.Data, &created)
+
+	paid := created.OrderID
+	if ok, _ := store.UpdateStatus(context.Background(), paid, repository.StatusFinished, []string{repository.StatusNew}, nil); !ok {
+		t.Fatal("order was not marked FINISHED")
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		subject  string
+		roles    string
+		wantCode int
+	}{
+		{name: "anonymous cannot refund", method: http.MethodPost, target: "/orders/" + paid + "/refunds", body: `{"amount":5}`, wantCode: http.StatusUnauthorized},
+		{name: "owner cannot refund own order", method: http.MethodPost, target: "/orders/" + paid + "/refunds", body: `{"amount":5}`, subject: userID, wantCode: http.StatusForbidden},
+		{name: "stranger cannot refund", method: http.MethodPost, target: "/orders/" + paid + "/refunds", body: `{"amount":5}`, subject: other, wantCode: http.StatusForbidden},
+		{name: "admin refunds", method: http.MethodPost, target: "/orders/" + paid + "/refunds", body: `{"amount":5}`, subject: other, roles: "admin", wantCode: http.StatusAccepted},
+		{name: "own order", method: http.MethodPost, target: "/orders", body: `{"user_id":"` + userID + `","amount":10}`, subject: userID, wantCode: http.StatusCreated},
+		{name: "order for someone else", method: http.MethodPost, target: "/orders", body: `{"user_id":"` + other + `","amount":10}`, subject: userID, wantCode: http.StatusForbidden},
+		{name: "admin orders for anyone", method: http.MethodPost, target: "/orders", body: `{"user_id":"` + other + `","amount":10}`, subject: userID, roles: "user,admin", wantCode: http.StatusCreated},
+		{name: "list own", method: http.MethodGet, target: "/orders?user_id=" + userID, subject: userID, wantCode: http.StatusOK},
+		{name: "list foreign", method: http.MethodGet, target: "/orders?user_id=" + userID, subject: other, wantCode: http.StatusForbidden},
+		{name: "get foreign order looks missing", method: http.MethodGet, target: "/orders/" + created.OrderID, subject: other, wantCode: http.StatusNotFound},
+		{name: "get foreign order as admin", method: http.MethodGet, target: "/orders/" + created.OrderID, subject: other, roles: "admin", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set(authn.HeaderSubject, tt.subject)
+			req.Header.Set(authn.HeaderRoles, tt.roles)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package repository
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not_found")
+	// ErrInvalidTransition — статус заказа не допускает действие.
+	ErrInvalidTransition = errors.New("invalid_state_transition")
+	// ErrRefundExceedsAmount — возврат больше невозвращённого остатка заказа.
+	ErrRefundExceedsAmount = errors.New("refund_exceeds_amount")
+)
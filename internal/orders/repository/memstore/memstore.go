@@ -0,0 +1,250 @@
+// Package memstore — in-memory хранилище Orders Service для тестов.
+// Повторяет семантику SQL-репозиториев: заказ и outbox пишутся атомарно,
+// статус меняется только из допустимых исходных, outbox выдаётся пачками под lock.
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/orders/dto"
+	"HW4/internal/orders/repository"
+)
+
+type OutboxEntry struct {
+	repository.OutboxRecord
+	ProcessedAt time.Time
+	Attempts    int
+	NextRetryAt time.Time
+	LockedUntil time.Time
+	LastError   string
+}
+
+type Store struct {
+	mu                    sync.Mutex
+	paymentRequestedTopic string
+	orders                map[string]repository.Order
+	order                 []string
+	outbox                []*OutboxEntry
+	seq                   int64
+}
+
+func New(paymentRequestedTopic string) *Store {
+	return &Store{
+		paymentRequestedTopic: paymentRequestedTopic,
+		orders:                map[string]repository.Order{},
+	}
+}
+
+func (s *Store) CreateOrderWithOutbox(ctx context.Context, userID string, amount int64, currency, description, captureMethod string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	orderID := uuid.NewString()
+	payload, err := json.Marshal(repository.NewPaymentRequested(orderID, userID, amount, currency, captureMethod))
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders[orderID] = repository.Order{
+		ID:            orderID,
+		UserID:        userID,
+		Amount:        amount,
+		Currency:      currency,
+		Description:   description,
+		Status:        repository.StatusNew,
+		CaptureMethod: captureMethod,
+		CreatedAt:     time.Now(),
+	}
+	s.order = append(s.order, orderID)
+	s.appendOutboxLocked(s.paymentRequestedTopic, orderID, payload)
+	return orderID, nil
+}
+
+func (s *Store) ListOrdersByUser(ctx context.Context, userID string) ([]repository.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []repository.Order
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if o := s.orders[s.order[i]]; o.UserID == userID {
+			out = append(out, o)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *Store) GetOrderByID(ctx context.Context, id string) (repository.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return repository.Order{}, repository.ErrNotFound
+	}
+	return o, nil
+}
+
+func (s *Store) UpdateStatus(ctx context.Context, orderID, status string, from []string, fx *dto.FX) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || !slices.Contains(from, o.Status) {
+		return false, nil
+	}
+	o.Status = status
+	if fx != nil {
+		charged := *fx
+		o.FX = &charged
+	}
+	s.orders[orderID] = o
+	return true, nil
+}
+
+func (s *Store) RequestSettlement(ctx context.Context, id, event string) (repository.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return repository.Order{}, repository.ErrNotFound
+	}
+	if o.Status != repository.StatusAuthorized {
+		return repository.Order{}, repository.ErrInvalidTransition
+	}
+	payload, err := json.Marshal(repository.NewSettlementRequested(o, event))
+	if err != nil {
+		return repository.Order{}, err
+	}
+	s.appendOutboxLocked(s.paymentRequestedTopic, id, payload)
+	return o, nil
+}
+
+func (s *Store) RequestRefund(ctx context.Context, id string, amount int64) (string, repository.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	switch {
+	case !ok:
+		return "", repository.Order{}, repository.ErrNotFound
+	case !o.CanRefund():
+		return "", repository.Order{}, repository.ErrInvalidTransition
+	case amount > o.Refundable():
+		return "", repository.Order{}, repository.ErrRefundExceedsAmount
+	}
+	refundID := uuid.NewString()
+	payload, err := json.Marshal(repository.NewRefundRequested(o, refundID, amount))
+	if err != nil {
+		return "", repository.Order{}, err
+	}
+	s.appendOutboxLocked(s.paymentRequestedTopic, id, payload)
+	return refundID, o, nil
+}
+
+func (s *Store) ApplyRefund(ctx context.Context, orderID string, refunded int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || !o.CanRefund() || o.RefundedAmount >= refunded {
+		return false, nil
+	}
+	o.RefundedAmount = refunded
+	o.Status = repository.StatusPartiallyRefunded
+	if refunded >= o.Amount {
+		o.Status = repository.StatusRefunded
+	}
+	s.orders[orderID] = o
+	return true, nil
+}
+
+func (s *Store) LockBatch(ctx context.Context, limit int, lockTTL time.Duration) ([]repository.OutboxRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var batch []repository.OutboxRecord
+	for _, e := range s.outbox {
+		if len(batch) == limit {
+			break
+		}
+		if !e.ProcessedAt.IsZero() || e.NextRetryAt.After(now) || e.LockedUntil.After(now) {
+			continue
+		}
+		e.LockedUntil = now.Add(lockTTL)
+		batch = append(batch, e.OutboxRecord)
+	}
+	return batch, nil
+}
+
+func (s *Store) MarkSent(ctx context.Context, id int64) error {
+	return s.updateOutbox(id, func(e *OutboxEntry) {
+		e.ProcessedAt = time.Now()
+		e.LockedUntil = time.Time{}
+		e.LastError = ""
+	})
+}
+
+func (s *Store) MarkFailed(ctx context.Context, id int64, cause string, backoff time.Duration) error {
+	return s.updateOutbox(id, func(e *OutboxEntry) {
+		e.Attempts++
+		e.NextRetryAt = time.Now().Add(time.Duration(e.Attempts) * backoff)
+		e.LastError = cause
+		e.LockedUntil = time.Time{}
+	})
+}
+
+func (s *Store) Release(ctx context.Context, ids []int64) error {
+	for _, id := range ids {
+		_ = s.updateOutbox(id, func(e *OutboxEntry) {
+			if e.ProcessedAt.IsZero() {
+				e.LockedUntil = time.Time{}
+			}
+		})
+	}
+	return nil
+}
+
+// Outbox возвращает копию всех записей outbox в порядке вставки.
+func (s *Store) Outbox() []OutboxEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]OutboxEntry, 0, len(s.outbox))
+	for _, e := range s.outbox {
+		out = append(out, *e)
+	}
+	return out
+}
+
+func (s *Store) appendOutboxLocked(topic, key string, payload []byte) {
+	s.seq++
+	s.outbox = append(s.outbox, &OutboxEntry{
+		OutboxRecord: repository.OutboxRecord{ID: s.seq, Topic: topic, Key: key, Payload: payload},
+	})
+}
+
+func (s *Store) updateOutbox(id int64, fn func(e *OutboxEntry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.outbox {
+		if e.ID == id {
+			fn(e)
+			return nil
+		}
+	}
+	return nil
+}
@@ -28,18 +28,105 @@ func NewOrdersRepo(db *sql.DB, paymentRequestedTopic string) *OrdersRepo {
 	}
 }
 
+// Статусы заказа. С capture_method=automatic: NEW → FINISHED | FAILED,
+// с manual: NEW → AUTHORIZED | FAILED, затем AUTHORIZED → FINISHED | VOIDED.
+// Возвраты: FINISHED → PARTIALLY_REFUNDED → REFUNDED.
+const (
+	StatusNew               = "NEW"
+	StatusAuthorized        = "AUTHORIZED"
+	StatusFinished          = "FINISHED"
+	StatusFailed            = "FAILED"
+	StatusVoided            = "VOIDED"
+	StatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+	StatusRefunded          = "REFUNDED"
+)
+
 type Order struct {
-	ID          string
-	UserID      string
-	Amount      int64
-	Description string
-	Status      string
-	CreatedAt   time.Time
+	ID     string
+	UserID string
+	Amount int64
+	// Currency — код ISO 4217; Amount и RefundedAmount — в её минорных единицах.
+	Currency      string
+	Description   string
+	Status        string
+	CaptureMethod string
+	// RefundedAmount — сумма подтверждённых Payments возвратов.
+	RefundedAmount int64
+	// FX — что фактически списано, если заказ оплачен из кошелька в другой
+	// валюте; nil — оплачен в своей валюте или ещё не оплачен.
+	FX        *dto.FX
+	CreatedAt time.Time
+}
+
+// Refundable — сколько ещё можно вернуть по заказу.
+func (o Order) Refundable() int64 { return o.Amount - o.RefundedAmount }
+
+// CanRefund — заказ оплачен и вернули не всё.
+func (o Order) CanRefund() bool {
+	return o.Status == StatusFinished || o.Status == StatusPartiallyRefunded
+}
+
+// orderColumns — колонки заказа в порядке scanOrder.
+const orderColumns = `id, user_id, amount, currency, description, status, capture_method, refunded_amount, created_at,
+	COALESCE(charged_amount, 0), COALESCE(charged_currency, ''), COALESCE(fx_rate::text, '')`
+
+func scanOrder(row interface{ Scan(dest ...any) error }) (Order, error) {
+	var (
+		o  Order
+		fx dto.FX
+	)
+	err := row.Scan(&o.ID, &o.UserID, &o.Amount, &o.Currency, &o.Description, &o.Status, &o.CaptureMethod, &o.RefundedAmount, &o.CreatedAt,
+		&fx.ChargedAmount, &fx.ChargedCurrency, &fx.Rate)
+	if fx.ChargedCurrency != "" {
+		o.FX = &fx
+	}
+	return o, err
 }
 
-func (r *OrdersRepo) CreateOrderWithOutbox(ctx context.Context, userID string, amount int64, description string) (string, error) {
+// NewPaymentRequested формирует событие запроса на оплату с новым message_id.
+func NewPaymentRequested(orderID, userID string, amount int64, currency, captureMethod string) dto.PaymentRequested {
+	return dto.PaymentRequested{
+		MessageID:     uuid.NewString(),
+		Type:          dto.EventPaymentRequested,
+		OrderID:       orderID,
+		UserID:        userID,
+		Amount:        amount,
+		Currency:      currency,
+		CaptureMethod: captureMethod,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// NewSettlementRequested формирует команду capture или void (event) для
+// холда заказа o.
+func NewSettlementRequested(o Order, event string) dto.PaymentRequested {
+	return dto.PaymentRequested{
+		MessageID: uuid.NewString(),
+		Type:      event,
+		OrderID:   o.ID,
+		UserID:    o.UserID,
+		Amount:    o.Amount,
+		Currency:  o.Currency,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// NewRefundRequested формирует команду возврата amount по заказу o.
+func NewRefundRequested(o Order, refundID string, amount int64) dto.PaymentRequested {
+	return dto.PaymentRequested{
+		MessageID: uuid.NewString(),
+		Type:      dto.EventRefundRequested,
+		OrderID:   o.ID,
+		UserID:    o.UserID,
+		Amount:    amount,
+		Currency:  o.Currency,
+		RefundID:  refundID,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func (r *OrdersRepo) CreateOrderWithOutbox(ctx context.Context, userID string, amount int64, currency, description, captureMethod string) (string, error) {
 	orderID := uuid.NewString()
-	messageID := uuid.NewString()
 
 	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
@@ -48,21 +135,14 @@ func (r *OrdersRepo) CreateOrderWithOutbox(ctx context.Context, userID string, a
 	defer tx.Rollback()
 
 	_, err = tx.ExecContext(ctx, `
-		INSERT INTO orders(id, user_id, amount, description, status)
-		VALUES ($1,$2,$3,$4,'NEW')
-	`, orderID, userID, amount, description)
+		INSERT INTO orders(id, user_id, amount, currency, description, status, capture_method)
+		VALUES ($1,$2,$3,$4,$5,'NEW',$6)
+	`, orderID, userID, amount, currency, description, captureMethod)
 	if err != nil {
 		return "", err
 	}
 
-	ev := dto.PaymentRequested{
-		MessageID: messageID,
-		OrderID:   orderID,
-		UserID:    userID,
-		Amount:    amount,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
-	}
-	payload, _ := json.Marshal(ev)
+	payload, _ := json.Marshal(NewPaymentRequested(orderID, userID, amount, currency, captureMethod))
 
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO outbox(topic, key, payload)
@@ -80,7 +160,7 @@ func (r *OrdersRepo) CreateOrderWithOutbox(ctx context.Context, userID string, a
 
 func (r *OrdersRepo) ListOrdersByUser(ctx context.Context, userID string) ([]Order, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, amount, description, status, created_at
+		SELECT `+orderColumns+`
 		FROM orders
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -92,8 +172,8 @@ func (r *OrdersRepo) ListOrdersByUser(ctx context.Context, userID string) ([]Ord
 
 	var out []Order
 	for rows.Next() {
-		var o Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.Amount, &o.Description, &o.Status, &o.CreatedAt); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, o)
@@ -105,18 +185,95 @@ func (r *OrdersRepo) ListOrdersByUser(ctx context.Context, userID string) ([]Ord
 }
 
 func (r *OrdersRepo) GetOrderByID(ctx context.Context, id string) (Order, error) {
-	var o Order
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, amount, description, status, created_at
+	o, err := scanOrder(r.db.QueryRowContext(ctx, `
+		SELECT `+orderColumns+`
 		FROM orders
 		WHERE id = $1
-	`, id).Scan(&o.ID, &o.UserID, &o.Amount, &o.Description, &o.Status, &o.CreatedAt)
+	`, id))
 
-	if err == sql.ErrNoRows {
-		return Order{}, errors.New("not_found")
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, ErrNotFound
 	}
 	if err != nil {
 		return Order{}, err
 	}
 	return o, nil
 }
+
+// RequestSettlement пишет в outbox команду capture или void (event) для
+// заказа в статусе AUTHORIZED. Статус меняется, когда придёт результат от
+// Payments; до тех пор повторная команда безопасна — холд снимается один раз.
+func (r *OrdersRepo) RequestSettlement(ctx context.Context, id, event string) (Order, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	o, err := scanOrder(tx.QueryRowContext(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, ErrNotFound
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	if o.Status != StatusAuthorized {
+		return Order{}, ErrInvalidTransition
+	}
+
+	payload, _ := json.Marshal(NewSettlementRequested(o, event))
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox(topic, key, payload)
+		VALUES ($1,$2,$3)
+	`, r.paymentRequestedTopic, o.ID, payload)
+	if err != nil {
+		return Order{}, err
+	}
+	return o, tx.Commit()
+}
+
+// RequestRefund пишет в outbox команду возврата amount по оплаченному заказу
+// и возвращает id возврата. Остаток проверяется по уже подтверждённым
+// возвратам; окончательно сумму сверяет Payments по своей транзакции.
+func (r *OrdersRepo) RequestRefund(ctx context.Context, id string, amount int64) (string, Order, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return "", Order{}, err
+	}
+	defer tx.Rollback()
+
+	o, err := scanOrder(tx.QueryRowContext(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", Order{}, ErrNotFound
+	}
+	if err != nil {
+		return "", Order{}, err
+	}
+	if !o.CanRefund() {
+		return "", Order{}, ErrInvalidTransition
+	}
+	if amount > o.Refundable() {
+		return "", Order{}, ErrRefundExceedsAmount
+	}
+
+	refundID := uuid.NewString()
+	payload, _ := json.Marshal(NewRefundRequested(o, refundID, amount))
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox(topic, key, payload)
+		VALUES ($1,$2,$3)
+	`, r.paymentRequestedTopic, o.ID, payload)
+	if err != nil {
+		return "", Order{}, err
+	}
+	return refundID, o, tx.Commit()
+}
@@ -3,6 +3,10 @@ package repository
 import (
 	"context"
 	"database/sql"
+
+	"github.com/lib/pq"
+
+	"HW4/internal/orders/dto"
 )
 
 type OrdersStatusRepo struct {
@@ -11,13 +15,44 @@ type OrdersStatusRepo struct {
 
 func NewOrdersStatusRepo(db *sql.DB) *OrdersStatusRepo { return &OrdersStatusRepo{db: db} }
 
-func (r *OrdersStatusRepo) SetStatusIfNew(ctx context.Context, orderID, status string) (bool, error) {
+// UpdateStatus ставит заказу status, только если текущий статус входит в from.
+// fx из результата оплаты записывается вместе со статусом; nil оставляет
+// записанное раньше, например при холде.
+func (r *OrdersStatusRepo) UpdateStatus(ctx context.Context, orderID, status string, from []string, fx *dto.FX) (bool, error) {
+	var (
+		amount         *int64
+		currency, rate *string
+	)
+	if fx != nil {
+		amount, currency, rate = &fx.ChargedAmount, &fx.ChargedCurrency, &fx.Rate
+	}
 	res, err := r.db.ExecContext(ctx, `
 		UPDATE orders
 		SET status = $2,
-	    updated_at = now()
-		WHERE id = $1 AND status = 'NEW'
-	`, orderID, status)
+		    charged_amount = COALESCE($4, charged_amount),
+		    charged_currency = COALESCE($5, charged_currency),
+		    fx_rate = COALESCE($6::numeric, fx_rate),
+		    updated_at = now()
+		WHERE id = $1 AND status = ANY($3)
+	`, orderID, status, pq.Array(from), amount, currency, rate)
+	if err != nil {
+		return false, err
+	}
+	aff, _ := res.RowsAffected()
+	return aff > 0, nil
+}
+
+// ApplyRefund записывает сумму подтверждённых возвратов refunded и ставит
+// PARTIALLY_REFUNDED или REFUNDED. Меньшая или равная сумма от запоздавшего
+// результата игнорируется.
+func (r *OrdersStatusRepo) ApplyRefund(ctx context.Context, orderID string, refunded int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE orders
+		SET refunded_amount = $2,
+		    status = CASE WHEN $2 >= amount THEN 'REFUNDED' ELSE 'PARTIALLY_REFUNDED' END,
+		    updated_at = now()
+		WHERE id = $1 AND status IN ('FINISHED', 'PARTIALLY_REFUNDED') AND refunded_amount < $2
+	`, orderID, refunded)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type OutboxRecord struct {
+	ID      int64
+	Topic   string
+	Key     string
+	Payload []byte
+}
+
+type OutboxRepo struct {
+	db *sql.DB
+}
+
+func NewOutboxRepo(db *sql.DB) *OutboxRepo { return &OutboxRepo{db: db} }
+
+// LockBatch атомарно забирает до limit готовых к отправке строк и ставит им lock на lockTTL.
+func (r *OutboxRepo) LockBatch(ctx context.Context, limit int, lockTTL time.Duration) ([]OutboxRecord, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Постгрес-фокус: UPDATE + SKIP LOCKED + RETURNING
+	rows, err := tx.QueryContext(ctx, `
+		WITH picked AS (
+			SELECT id
+			FROM outbox
+			WHERE processed_at IS NULL
+			  AND next_retry_at <= now()
+			  AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT $1
+		)
+		UPDATE outbox o
+		SET locked_until = now() + $2 * interval '1 millisecond'
+		FROM picked
+		WHERE o.id = picked.id
+		RETURNING o.id, o.topic, o.key, o.payload
+	`, limit, lockTTL.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []OutboxRecord
+	for rows.Next() {
+		var rec OutboxRecord
+		if err := rows.Scan(&rec.ID, &rec.Topic, &rec.Key, &rec.Payload); err != nil {
+			return nil, err
+		}
+		batch = append(batch, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func (r *OutboxRepo) MarkSent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET processed_at = now(),
+		    locked_until = NULL,
+		    last_error = NULL
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+// MarkFailed снимает lock и откладывает следующую попытку на (attempts+1)*backoff.
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, cause string, backoff time.Duration) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+		    next_retry_at = now() + (attempts + 1) * $3 * interval '1 millisecond',
+		    last_error = $2,
+		    locked_until = NULL
+		WHERE id = $1
+	`, id, cause, backoff.Milliseconds())
+	return err
+}
+
+// Release снимает lock с неотправленных строк, чтобы их сразу мог забрать другой воркер.
+func (r *OutboxRepo) Release(ctx context.Context, ids []int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET locked_until = NULL
+		WHERE id = ANY($1) AND processed_at IS NULL
+	`, pq.Array(ids))
+	return err
+}
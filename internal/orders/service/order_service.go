@@ -5,29 +5,56 @@ import (
 	"errors"
 	"time"
 
+	"HW4/internal/common/money"
 	"HW4/internal/orders/dto"
 	"HW4/internal/orders/repository"
 )
 
 var (
-	ErrBadRequest = errors.New("bad_request")
-	ErrNotFound   = errors.New("not_found")
+	ErrBadRequest        = errors.New("bad_request")
+	ErrNotFound          = errors.New("not_found")
+	ErrInvalidTransition = errors.New("invalid_state_transition")
+	// ErrRefundExceedsAmount — возврат больше невозвращённого остатка заказа.
+	ErrRefundExceedsAmount = errors.New("refund_exceeds_amount")
 )
 
+// RefundPending — статус принятого, но ещё не обработанного возврата.
+const RefundPending = "PENDING"
+
+// OrdersRepository — хранилище заказов. CreateOrderWithOutbox обязан записать
+// заказ и событие PaymentRequested атомарно, RequestSettlement — команду
+// capture или void вместе с проверкой статуса AUTHORIZED, RequestRefund —
+// команду возврата вместе с проверкой статуса и остатка; GetOrderByID
+// возвращает repository.ErrNotFound для неизвестного id.
+type OrdersRepository interface {
+	CreateOrderWithOutbox(ctx context.Context, userID string, amount int64, currency, description, captureMethod string) (string, error)
+	ListOrdersByUser(ctx context.Context, userID string) ([]repository.Order, error)
+	GetOrderByID(ctx context.Context, id string) (repository.Order, error)
+	RequestSettlement(ctx context.Context, id, event string) (repository.Order, error)
+	RequestRefund(ctx context.Context, id string, amount int64) (string, repository.Order, error)
+}
+
 type OrdersService struct {
-	repo *repository.OrdersRepo
+	repo OrdersRepository
 }
 
-func New(repo *repository.OrdersRepo) *OrdersService {
+func New(repo OrdersRepository) *OrdersService {
 	return &OrdersService{repo: repo}
 }
 
+// CreateOrder создаёт заказ. Без currency заказ в money.DefaultCurrency;
+// amount — в минорных единицах валюты.
 func (s *OrdersService) CreateOrder(ctx context.Context, req dto.CreateOrderRequest) (dto.CreateOrderResponse, error) {
-	if req.UserID == "" || req.Amount <= 0 {
+	if req.CaptureMethod == "" {
+		req.CaptureMethod = dto.CaptureAutomatic
+	}
+	req.Currency = money.Or(req.Currency)
+	cur, ok := money.Lookup(req.Currency)
+	if req.UserID == "" || !ok || cur.CheckAmount(req.Amount) != nil || !ValidCaptureMethod(req.CaptureMethod) {
 		return dto.CreateOrderResponse{}, ErrBadRequest
 	}
 
-	orderID, err := s.repo.CreateOrderWithOutbox(ctx, req.UserID, req.Amount, req.Description)
+	orderID, err := s.repo.CreateOrderWithOutbox(ctx, req.UserID, req.Amount, req.Currency, req.Description, req.CaptureMethod)
 	if err != nil {
 		return dto.CreateOrderResponse{}, err
 	}
@@ -47,14 +74,7 @@ func (s *OrdersService) ListOrders(ctx context.Context, userID string) (dto.Orde
 
 	resp := dto.OrdersListResponse{Orders: make([]dto.OrderResponse, 0, len(orders))}
 	for _, o := range orders {
-		resp.Orders = append(resp.Orders, dto.OrderResponse{
-			OrderID:     o.ID,
-			UserID:      o.UserID,
-			Amount:      o.Amount,
-			Status:      o.Status,
-			CreatedAt:   o.CreatedAt.UTC().Format(time.RFC3339Nano),
-			Description: o.Description,
-		})
+		resp.Orders = append(resp.Orders, toOrderResponse(o))
 	}
 	return resp, nil
 }
@@ -66,18 +86,80 @@ func (s *OrdersService) GetOrder(ctx context.Context, id string) (dto.OrderRespo
 
 	o, err := s.repo.GetOrderByID(ctx, id)
 	if err != nil {
-		if err.Error() == "not_found" {
+		if errors.Is(err, repository.ErrNotFound) {
 			return dto.OrderResponse{}, ErrNotFound
 		}
 		return dto.OrderResponse{}, err
 	}
 
+	return toOrderResponse(o), nil
+}
+
+// Capture подтверждает холд заказа с capture_method=manual: Payments спишет
+// сумму, и заказ перейдёт в FINISHED.
+func (s *OrdersService) Capture(ctx context.Context, id string) (dto.OrderResponse, error) {
+	return s.requestSettlement(ctx, id, dto.EventCaptureRequested)
+}
+
+// Void отменяет холд заказа: сумма вернётся в доступный баланс, заказ
+// перейдёт в VOIDED.
+func (s *OrdersService) Void(ctx context.Context, id string) (dto.OrderResponse, error) {
+	return s.requestSettlement(ctx, id, dto.EventVoidRequested)
+}
+
+func (s *OrdersService) requestSettlement(ctx context.Context, id, event string) (dto.OrderResponse, error) {
+	if id == "" {
+		return dto.OrderResponse{}, ErrBadRequest
+	}
+	o, err := s.repo.RequestSettlement(ctx, id, event)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return dto.OrderResponse{}, ErrNotFound
+	case errors.Is(err, repository.ErrInvalidTransition):
+		return dto.OrderResponse{}, ErrInvalidTransition
+	case err != nil:
+		return dto.OrderResponse{}, err
+	}
+	return toOrderResponse(o), nil
+}
+
+// Refund запрашивает возврат части или всей суммы оплаченного заказа. Деньги
+// на счёт зачисляет Payments; заказ станет PARTIALLY_REFUNDED или REFUNDED,
+// когда придёт результат.
+func (s *OrdersService) Refund(ctx context.Context, id string, req dto.RefundRequest) (dto.RefundResponse, error) {
+	if id == "" || req.Amount <= 0 {
+		return dto.RefundResponse{}, ErrBadRequest
+	}
+	refundID, o, err := s.repo.RequestRefund(ctx, id, req.Amount)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return dto.RefundResponse{}, ErrNotFound
+	case errors.Is(err, repository.ErrInvalidTransition):
+		return dto.RefundResponse{}, ErrInvalidTransition
+	case errors.Is(err, repository.ErrRefundExceedsAmount):
+		return dto.RefundResponse{}, ErrRefundExceedsAmount
+	case err != nil:
+		return dto.RefundResponse{}, err
+	}
+	return dto.RefundResponse{RefundID: refundID, OrderID: id, Amount: req.Amount, Currency: o.Currency, Status: RefundPending}, nil
+}
+
+// ValidCaptureMethod — допустимое значение capture_method.
+func ValidCaptureMethod(m string) bool {
+	return m == dto.CaptureAutomatic || m == dto.CaptureManual
+}
+
+func toOrderResponse(o repository.Order) dto.OrderResponse {
 	return dto.OrderResponse{
-		OrderID:     o.ID,
-		UserID:      o.UserID,
-		Amount:      o.Amount,
-		Status:      o.Status,
-		CreatedAt:   o.CreatedAt.UTC().Format(time.RFC3339Nano),
-		Description: o.Description,
-	}, nil
+		OrderID:        o.ID,
+		UserID:         o.UserID,
+		Amount:         o.Amount,
+		Currency:       o.Currency,
+		Status:         o.Status,
+		CaptureMethod:  o.CaptureMethod,
+		RefundedAmount: o.RefundedAmount,
+		FX:             o.FX,
+		CreatedAt:      o.CreatedAt.UTC().Format(time.RFC3339Nano),
+		Description:    o.Description,
+	}
 }
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"HW4/internal/orders/dto"
+	"HW4/internal/orders/repository"
+	"HW4/internal/orders/repository/memstore"
+)
+
+var _ OrdersRepository = (*memstore.Store)(nil)
+
+const userID = "11111111-1111-1111-1111-111111111111"
+
+func TestCreateOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          dto.CreateOrderRequest
+		wantErr      error
+		wantCurrency string
+	}{
+		{name: "ok", req: dto.CreateOrderRequest{UserID: userID, Amount: 100, Description: "book"}, wantCurrency: "RUB"},
+		{name: "kzt", req: dto.CreateOrderRequest{UserID: userID, Amount: 100, Currency: "KZT"}, wantCurrency: "KZT"},
+		{name: "unknown currency", req: dto.CreateOrderRequest{UserID: userID, Amount: 100, Currency: "XXX"}, wantErr: ErrBadRequest},
+		{name: "amount over currency limit", req: dto.CreateOrderRequest{UserID: userID, Amount: 100_000_000_000_001, Currency: "RUB"}, wantErr: ErrBadRequest},
+		{name: "empty user", req: dto.CreateOrderRequest{Amount: 100}, wantErr: ErrBadRequest},
+		{name: "zero amount", req: dto.CreateOrderRequest{UserID: userID}, wantErr: ErrBadRequest},
+		{name: "negative amount", req: dto.CreateOrderRequest{UserID: userID, Amount: -5}, wantErr: ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memstore.New("payment.requested")
+			svc := New(store)
+
+			resp, err := svc.CreateOrder(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if n := len(store.Outbox()); n != 0 {
+					t.Fatalf("outbox has %d entries after rejected order", n)
+				}
+				return
+			}
+			if resp.Status != "NEW" || resp.OrderID == "" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			outbox := store.Outbox()
+			if len(outbox) != 1 || outbox[0].Key != resp.OrderID || outbox[0].Topic != "payment.requested" {
+				t.Fatalf("outbox = %+v, want one payment.requested event for the order", outbox)
+			}
+			var ev dto.PaymentRequested
+			_ = json.Unmarshal(outbox[0].Payload, &ev)
+			if o, _ := store.GetOrderByID(context.Background(), resp.OrderID); o.Currency != tt.wantCurrency || ev.Currency != tt.wantCurrency {
+				t.Fatalf("order currency %q, event currency %q; want %q", o.Currency, ev.Currency, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestListAndGetOrders(t *testing.T) {
+	ctx := context.Background()
+	svc := New(memstore.New("payment.requested"))
+
+	first, _ := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 10, Description: "first"})
+	second, _ := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 20, Description: "second"})
+	_, _ = svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: "22222222-2222-2222-2222-222222222222", Amount: 30})
+
+	list, err := svc.ListOrders(ctx, userID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list.Orders) != 2 || list.Orders[0].OrderID != second.OrderID || list.Orders[1].OrderID != first.OrderID {
+		t.Fatalf("list = %+v, want [second, first]", list.Orders)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{name: "found", id: first.OrderID},
+		{name: "empty id", id: "", wantErr: ErrBadRequest},
+		{name: "unknown id", id: "33333333-3333-3333-3333-333333333333", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.GetOrder(ctx, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (got.Amount != 10 || got.Description != "first" || got.Status != "NEW") {
+				t.Fatalf("unexpected order %+v", got)
+			}
+		})
+	}
+
+	if _, err := svc.ListOrders(ctx, ""); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("list without user: %v, want ErrBadRequest", err)
+	}
+}
+
+func TestCaptureAndVoid(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New("payment.requested")
+	svc := New(store)
+
+	if _, err := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 10, CaptureMethod: "later"}); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("unknown capture method: %v, want ErrBadRequest", err)
+	}
+	auto, _ := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 10})
+	manual, _ := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 20, CaptureMethod: dto.CaptureManual})
+	if got, _ := svc.GetOrder(ctx, auto.OrderID); got.CaptureMethod != dto.CaptureAutomatic {
+		t.Fatalf("default capture method = %q, want automatic", got.CaptureMethod)
+	}
+
+	// пока холд не подтверждён Payments, подтверждать нечего
+	if _, err := svc.Capture(ctx, manual.OrderID); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("capture NEW order: %v, want ErrInvalidTransition", err)
+	}
+	if _, err := svc.Void(ctx, "33333333-3333-3333-3333-333333333333"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("void unknown order: %v, want ErrNotFound", err)
+	}
+
+	_, _ = store.UpdateStatus(ctx, manual.OrderID, repository.StatusAuthorized, []string{repository.StatusNew}, nil)
+	got, err := svc.Capture(ctx, manual.OrderID)
+	if err != nil || got.Status != repository.StatusAuthorized {
+		t.Fatalf("capture = %+v, %v; want accepted with status AUTHORIZED", got, err)
+	}
+
+	outbox := store.Outbox()
+	var ev dto.PaymentRequested
+	_ = json.Unmarshal(outbox[len(outbox)-1].Payload, &ev)
+	if ev.Type != dto.EventCaptureRequested || ev.OrderID != manual.OrderID || ev.Amount != 20 {
+		t.Fatalf("last outbox event = %+v, want capture request for the order", ev)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New("payment.requested")
+	svc := New(store)
+
+	order, _ := svc.CreateOrder(ctx, dto.CreateOrderRequest{UserID: userID, Amount: 100})
+	if _, err := svc.Refund(ctx, order.OrderID, dto.RefundRequest{Amount: 10}); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("refund unpaid order: %v, want ErrInvalidTransition", err)
+	}
+	_, _ = store.UpdateStatus(ctx, order.OrderID, repository.StatusFinished, []string{repository.StatusNew}, nil)
+	_, _ = store.ApplyRefund(ctx, order.OrderID, 70)
+
+	tests := []struct {
+		name    string
+		id      string
+		amount  int64
+		wantErr error
+	}{
+		{name: "zero amount", id: order.OrderID, wantErr: ErrBadRequest},
+		{name: "unknown order", id: "33333333-3333-3333-3333-333333333333", amount: 10, wantErr: ErrNotFound},
+		{name: "over the rest", id: order.OrderID, amount: 31, wantErr: ErrRefundExceedsAmount},
+		{name: "the rest", id: order.OrderID, amount: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.Refund(ctx, tt.id, dto.RefundRequest{Amount: tt.amount})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if resp.Status != RefundPending || resp.RefundID == "" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			outbox := store.Outbox()
+			var ev dto.PaymentRequested
+			_ = json.Unmarshal(outbox[len(outbox)-1].Payload, &ev)
+			if ev.Type != dto.EventRefundRequested || ev.RefundID != resp.RefundID || ev.Amount != tt.amount {
+				t.Fatalf("last outbox event = %+v, want refund request", ev)
+			}
+		})
+	}
+}
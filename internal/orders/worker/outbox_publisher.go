@@ -2,36 +2,39 @@ package worker
 
 import (
 	"context"
-	"database/sql"
 	"log"
 	"time"
 
-	"HW4/internal/common/kafka"
+	"HW4/internal/common/broker"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/orders/config"
+	"HW4/internal/orders/repository"
 )
 
-type OutboxPublisher struct {
-	db        *sql.DB
-	producer  *kafka.Producer
-	batchSize int
+// OutboxStore — таблица outbox: выдача пачки под lock и фиксация результата отправки.
+type OutboxStore interface {
+	LockBatch(ctx context.Context, limit int, lockTTL time.Duration) ([]repository.OutboxRecord, error)
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, cause string, backoff time.Duration) error
+	Release(ctx context.Context, ids []int64) error
 }
 
-type outboxRow struct {
-	ID      int64
-	Topic   string
-	Key     string
-	Payload []byte
+type OutboxPublisher struct {
+	store    OutboxStore
+	producer broker.Publisher
+	cfg      config.OutboxConfig
 }
 
-func NewOutboxPublisher(db *sql.DB, producer *kafka.Producer) *OutboxPublisher {
+func NewOutboxPublisher(store OutboxStore, producer broker.Publisher, cfg config.OutboxConfig) *OutboxPublisher {
 	return &OutboxPublisher{
-		db:        db,
-		producer:  producer,
-		batchSize: 20,
+		store:    store,
+		producer: producer,
+		cfg:      cfg,
 	}
 }
 
 func (w *OutboxPublisher) Run(ctx context.Context) {
-	ticker := time.NewTicker(700 * time.Millisecond)
+	ticker := time.NewTicker(w.cfg.PollInterval)
 	defer ticker.Stop()
 
 	for {
@@ -47,8 +50,7 @@ func (w *OutboxPublisher) Run(ctx context.Context) {
 }
 
 func (w *OutboxPublisher) tick(ctx context.Context) error {
-	// 1) атомарно "забираем" пачку строк и ставим lock
-	batch, err := w.lockAndFetchBatch(ctx)
+	batch, err := w.store.LockBatch(ctx, w.cfg.BatchSize, w.cfg.LockTTL)
 	if err != nil {
 		return err
 	}
@@ -56,82 +58,29 @@ func (w *OutboxPublisher) tick(ctx context.Context) error {
 		return nil
 	}
 
-	// 2) публикуем каждую строку (вне транзакции)
-	for _, r := range batch {
-		err := w.producer.Publish(ctx, r.Topic, []byte(r.Key), r.Payload)
+	// Строку, которую начали публиковать, доводим до конца даже при shutdown
+	// (но не дольше его дедлайна), а оставшиеся в пачке освобождаем, чтобы
+	// их сразу забрала другая реплика.
+	workCtx, cancel := lifecycle.InFlight(ctx)
+	defer cancel()
+	for i, r := range batch {
+		if ctx.Err() != nil {
+			return w.release(workCtx, batch[i:])
+		}
+		err := w.producer.Publish(workCtx, r.Topic, []byte(r.Key), r.Payload)
 		if err != nil {
-			_ = w.fail(ctx, r.ID, err)
+			_ = w.store.MarkFailed(workCtx, r.ID, err.Error(), w.cfg.RetryBackoff)
 			continue
 		}
-		_ = w.success(ctx, r.ID)
+		_ = w.store.MarkSent(workCtx, r.ID)
 	}
 	return nil
 }
 
-func (w *OutboxPublisher) lockAndFetchBatch(ctx context.Context) ([]outboxRow, error) {
-	tx, err := w.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// Постгрес-фокус: UPDATE + SKIP LOCKED + RETURNING
-	rows, err := tx.QueryContext(ctx, `
-		WITH picked AS (
-			SELECT id
-			FROM outbox
-			WHERE processed_at IS NULL
-			  AND next_retry_at <= now()
-			  AND (locked_until IS NULL OR locked_until < now())
-			ORDER BY id
-			FOR UPDATE SKIP LOCKED
-			LIMIT $1
-		)
-		UPDATE outbox o
-		SET locked_until = now() + interval '10 seconds'
-		FROM picked
-		WHERE o.id = picked.id
-		RETURNING o.id, o.topic, o.key, o.payload
-	`, w.batchSize)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var batch []outboxRow
-	for rows.Next() {
-		var r outboxRow
-		if err := rows.Scan(&r.ID, &r.Topic, &r.Key, &r.Payload); err != nil {
-			return nil, err
-		}
-		batch = append(batch, r)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return nil, err
+func (w *OutboxPublisher) release(ctx context.Context, rows []repository.OutboxRecord) error {
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
 	}
-	return batch, nil
-}
-
-func (w *OutboxPublisher) success(ctx context.Context, id int64) error {
-	_, err := w.db.ExecContext(ctx, `
-		UPDATE outbox
-		SET processed_at = now(),
-		    locked_until = NULL,
-		    last_error = NULL
-		WHERE id = $1
-	`, id)
-	return err
-}
-
-func (w *OutboxPublisher) fail(ctx context.Context, id int64, cause error) error {
-	_, err := w.db.ExecContext(ctx, `
-		UPDATE outbox
-		SET attempts = attempts + 1,
-		    next_retry_at = now() + (attempts + 1) * interval '2 seconds',
-		    last_error = $2,
-		    locked_until = NULL
-		WHERE id = $1
-	`, id, cause.Error())
-	return err
+	return w.store.Release(ctx, ids)
 }
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"HW4/internal/common/broker"
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/orders/config"
+	"HW4/internal/orders/repository/memstore"
+)
+
+type failingPublisher struct{ broker.Publisher }
+
+func (failingPublisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	return errors.New("broker unavailable")
+}
+
+var outboxCfg = config.OutboxConfig{
+	BatchSize:    2,
+	PollInterval: 5 * time.Millisecond,
+	LockTTL:      time.Minute,
+	RetryBackoff: time.Minute,
+}
+
+func TestOutboxPublisher(t *testing.T) {
+	ctx := context.Background()
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	t.Run("publishes all rows in batches", func(t *testing.T) {
+		store := memstore.New("payment.requested")
+		for i := 0; i < 5; i++ {
+			_, _ = store.CreateOrderWithOutbox(ctx, userID, 10, "RUB", "", "automatic")
+		}
+		b := membroker.New(1)
+
+		stop := run(NewOutboxPublisher(store, b, outboxCfg))
+		waitFor(t, func() bool { return len(b.Messages("payment.requested")) == 5 })
+		stop()
+
+		for _, e := range store.Outbox() {
+			if e.ProcessedAt.IsZero() {
+				t.Fatalf("outbox row %d not marked as sent", e.ID)
+			}
+		}
+	})
+
+	t.Run("failed publish is scheduled for retry", func(t *testing.T) {
+		store := memstore.New("payment.requested")
+		_, _ = store.CreateOrderWithOutbox(ctx, userID, 10, "RUB", "", "automatic")
+
+		w := NewOutboxPublisher(store, failingPublisher{}, outboxCfg)
+		if err := w.tick(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		e := store.Outbox()[0]
+		if e.Attempts != 1 || e.LastError == "" || !e.ProcessedAt.IsZero() || !e.LockedUntil.IsZero() {
+			t.Fatalf("unexpected row after failure: %+v", e)
+		}
+		if !e.NextRetryAt.After(time.Now()) {
+			t.Fatal("next retry must be in the future")
+		}
+	})
+
+	t.Run("shutdown releases the rest of the batch", func(t *testing.T) {
+		store := memstore.New("payment.requested")
+		_, _ = store.CreateOrderWithOutbox(ctx, userID, 10, "RUB", "", "automatic")
+		_, _ = store.CreateOrderWithOutbox(ctx, userID, 20, "RUB", "", "automatic")
+
+		b := membroker.New(1)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := NewOutboxPublisher(store, b, outboxCfg).tick(cancelled); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(b.Messages("payment.requested")); n != 0 {
+			t.Fatalf("published %d messages after shutdown", n)
+		}
+		if again, _ := store.LockBatch(ctx, 2, time.Minute); len(again) != 2 {
+			t.Fatalf("released rows must be lockable again, got %d", len(again))
+		}
+	})
+}
@@ -5,17 +5,42 @@ import (
 	"encoding/json"
 	"log"
 
-	"HW4/internal/common/kafka"
+	"HW4/internal/common/broker"
+	"HW4/internal/common/lifecycle"
 	"HW4/internal/orders/dto"
 	"HW4/internal/orders/repository"
 )
 
+// StatusRepository меняет статус заказа, только если текущий входит в from,
+// поэтому повторные и запоздавшие результаты оплаты не откатывают заказ.
+// Вместе со статусом записывается конвертация из результата, если она была.
+// ApplyRefund по той же причине только увеличивает сумму возвратов.
+type StatusRepository interface {
+	UpdateStatus(ctx context.Context, orderID, status string, from []string, fx *dto.FX) (bool, error)
+	ApplyRefund(ctx context.Context, orderID string, refunded int64) (bool, error)
+}
+
+type transition struct {
+	to   string
+	from []string
+}
+
+// resultTransitions — статус заказа по статусу PaymentResult. Любой другой
+// статус события — отказ, он допустим только для NEW.
+var resultTransitions = map[string]transition{
+	"FINISHED":   {to: repository.StatusFinished, from: []string{repository.StatusNew, repository.StatusAuthorized}},
+	"AUTHORIZED": {to: repository.StatusAuthorized, from: []string{repository.StatusNew}},
+	"VOIDED":     {to: repository.StatusVoided, from: []string{repository.StatusAuthorized}},
+}
+
+var failedTransition = transition{to: repository.StatusFailed, from: []string{repository.StatusNew}}
+
 type PaymentResultConsumer struct {
-	consumer *kafka.Consumer
-	repo     *repository.OrdersStatusRepo
+	consumer broker.Subscriber
+	repo     StatusRepository
 }
 
-func NewPaymentResultConsumer(consumer *kafka.Consumer, repo *repository.OrdersStatusRepo) *PaymentResultConsumer {
+func NewPaymentResultConsumer(consumer broker.Subscriber, repo StatusRepository) *PaymentResultConsumer {
 	return &PaymentResultConsumer{consumer: consumer, repo: repo}
 }
 
@@ -30,33 +55,52 @@ func (c *PaymentResultConsumer) Run(ctx context.Context) {
 			continue
 		}
 
-		log.Printf("[orders-consumer] got msg topic=%s partition=%d offset=%d key=%s value=%s",
-			msg.Topic, msg.Partition, msg.Offset, string(msg.Key), string(msg.Value))
+		// Полученное сообщение обрабатываем и коммитим даже после сигнала
+		// остановки, но не дольше дедлайна shutdown.
+		workCtx, cancel := lifecycle.InFlight(ctx)
+		c.handle(workCtx, msg)
+		cancel()
+	}
+}
 
-		var ev dto.PaymentResult
-		if err := json.Unmarshal(msg.Value, &ev); err != nil {
-			log.Printf("[orders-consumer] bad json: %v; value=%s", err, string(msg.Value))
-			_ = c.consumer.Commit(ctx, msg) // чтобы не зациклиться
-			continue
-		}
+func (c *PaymentResultConsumer) handle(ctx context.Context, msg broker.Message) {
+	log.Printf("[orders-consumer] got msg topic=%s partition=%d offset=%d key=%s value=%s",
+		msg.Topic, msg.Partition, msg.Offset, string(msg.Key), string(msg.Value))
 
-		newStatus := "FAILED"
-		if ev.Status == "FINISHED" {
-			newStatus = "FINISHED"
-		}
+	var ev dto.PaymentResult
+	if err := json.Unmarshal(msg.Value, &ev); err != nil {
+		log.Printf("[orders-consumer] bad json: %v; value=%s", err, string(msg.Value))
+		_ = c.consumer.Commit(ctx, msg) // чтобы не зациклиться
+		return
+	}
 
-		updated, err := c.repo.SetStatusIfNew(ctx, ev.OrderID, newStatus)
-		if err != nil {
-			log.Printf("[orders-consumer] db error: %v", err)
-			continue
-		}
+	updated, err := c.apply(ctx, ev)
+	if err != nil {
+		log.Printf("[orders-consumer] db error: %v", err)
+		return
+	}
 
-		if err := c.consumer.Commit(ctx, msg); err != nil {
-			log.Printf("[orders-consumer] commit error: %v", err)
-			continue
+	if err := c.consumer.Commit(ctx, msg); err != nil {
+		log.Printf("[orders-consumer] commit error: %v", err)
+		return
+	}
+
+	log.Printf("[orders-consumer] order=%s type=%s eventStatus=%s updated=%v",
+		ev.OrderID, ev.Type, ev.Status, updated)
+}
+
+// apply переносит результат на заказ. Отклонённый возврат заказ не меняет.
+func (c *PaymentResultConsumer) apply(ctx context.Context, ev dto.PaymentResult) (bool, error) {
+	if ev.Type == dto.EventRefundResult {
+		if ev.Status != dto.RefundSucceeded {
+			return false, nil
 		}
+		return c.repo.ApplyRefund(ctx, ev.OrderID, ev.RefundedAmount)
+	}
 
-		log.Printf("[orders-consumer] order=%s eventStatus=%s -> set=%s updated=%v",
-			ev.OrderID, ev.Status, newStatus, updated)
+	t, ok := resultTransitions[ev.Status]
+	if !ok {
+		t = failedTransition
 	}
+	return c.repo.UpdateStatus(ctx, ev.OrderID, t.to, t.from, ev.FX)
 }
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/orders/dto"
+	"HW4/internal/orders/repository/memstore"
+)
+
+type failingStatusRepo struct{}
+
+func (failingStatusRepo) UpdateStatus(ctx context.Context, orderID, status string, from []string, fx *dto.FX) (bool, error) {
+	return false, errors.New("db down")
+}
+
+func (failingStatusRepo) ApplyRefund(ctx context.Context, orderID string, refunded int64) (bool, error) {
+	return false, errors.New("db down")
+}
+
+func publishResult(t *testing.T, b *membroker.Broker, orderID, status string) {
+	t.Helper()
+	raw, _ := json.Marshal(dto.PaymentResult{OrderID: orderID, Status: status})
+	if err := b.Publish(context.Background(), "payment.result", []byte(orderID), raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaymentResultConsumerSetsStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		captureMethod string
+		results       []string
+		want          string
+	}{
+		{name: "finished", results: []string{"FINISHED"}, want: "FINISHED"},
+		{name: "failed", results: []string{"FAILED"}, want: "FAILED"},
+		{name: "unknown status is failure", results: []string{"WHATEVER"}, want: "FAILED"},
+		{name: "late duplicate does not override", results: []string{"FINISHED", "FAILED"}, want: "FINISHED"},
+		{name: "authorized", captureMethod: "manual", results: []string{"AUTHORIZED"}, want: "AUTHORIZED"},
+		{name: "captured", captureMethod: "manual", results: []string{"AUTHORIZED", "FINISHED"}, want: "FINISHED"},
+		{name: "voided", captureMethod: "manual", results: []string{"AUTHORIZED", "VOIDED"}, want: "VOIDED"},
+		{name: "void needs authorization", captureMethod: "manual", results: []string{"VOIDED"}, want: "NEW"},
+		{name: "failure does not undo authorization", captureMethod: "manual", results: []string{"AUTHORIZED", "FAILED"}, want: "AUTHORIZED"},
+		{name: "late authorization does not undo capture", captureMethod: "manual", results: []string{"AUTHORIZED", "FINISHED", "AUTHORIZED"}, want: "FINISHED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.requested")
+			orderID, _ := store.CreateOrderWithOutbox(ctx, "11111111-1111-1111-1111-111111111111", 100, "RUB", "", tt.captureMethod)
+
+			b := membroker.New(1)
+			for _, st := range tt.results {
+				publishResult(t, b, orderID, st)
+			}
+
+			stop := run(NewPaymentResultConsumer(b.Subscribe("payment.result", "orders"), store))
+			waitFor(t, func() bool { return b.Lag("payment.result", "orders") == 0 })
+			stop()
+
+			o, _ := store.GetOrderByID(ctx, orderID)
+			if o.Status != tt.want {
+				t.Fatalf("status = %s, want %s", o.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentResultConsumerAppliesRefunds(t *testing.T) {
+	refund := func(status string, refunded int64) dto.PaymentResult {
+		return dto.PaymentResult{Type: dto.EventRefundResult, Status: status, RefundedAmount: refunded}
+	}
+
+	tests := []struct {
+		name         string
+		results      []dto.PaymentResult
+		wantStatus   string
+		wantRefunded int64
+	}{
+		{name: "partial", results: []dto.PaymentResult{refund(dto.RefundSucceeded, 40)}, wantStatus: "PARTIALLY_REFUNDED", wantRefunded: 40},
+		{name: "full", results: []dto.PaymentResult{refund(dto.RefundSucceeded, 40), refund(dto.RefundSucceeded, 100)}, wantStatus: "REFUNDED", wantRefunded: 100},
+		{name: "rejected is ignored", results: []dto.PaymentResult{refund(dto.RefundRejected, 0)}, wantStatus: "FINISHED"},
+		{name: "stale total does not decrease", results: []dto.PaymentResult{refund(dto.RefundSucceeded, 70), refund(dto.RefundSucceeded, 40)}, wantStatus: "PARTIALLY_REFUNDED", wantRefunded: 70},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.requested")
+			orderID, _ := store.CreateOrderWithOutbox(ctx, "11111111-1111-1111-1111-111111111111", 100, "RUB", "", "")
+
+			b := membroker.New(1)
+			publishResult(t, b, orderID, "FINISHED")
+			for _, res := range tt.results {
+				res.OrderID = orderID
+				raw, _ := json.Marshal(res)
+				_ = b.Publish(ctx, "payment.result", []byte(orderID), raw)
+			}
+
+			stop := run(NewPaymentResultConsumer(b.Subscribe("payment.result", "orders"), store))
+			waitFor(t, func() bool { return b.Lag("payment.result", "orders") == 0 })
+			stop()
+
+			o, _ := store.GetOrderByID(ctx, orderID)
+			if o.Status != tt.wantStatus || o.RefundedAmount != tt.wantRefunded {
+				t.Fatalf("order = %s refunded %d, want %s refunded %d", o.Status, o.RefundedAmount, tt.wantStatus, tt.wantRefunded)
+			}
+		})
+	}
+}
+
+func TestPaymentResultConsumerRecordsFX(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New("payment.requested")
+	orderID, _ := store.CreateOrderWithOutbox(ctx, "11111111-1111-1111-1111-111111111111", 10000, "RUB", "", "manual")
+
+	fx := &dto.FX{Rate: "0.0109", ChargedAmount: 109, ChargedCurrency: "USD"}
+	b := membroker.New(1)
+	for _, res := range []dto.PaymentResult{
+		{OrderID: orderID, Status: "AUTHORIZED", FX: fx},
+		{OrderID: orderID, Status: "FINISHED"},
+	} {
+		raw, _ := json.Marshal(res)
+		_ = b.Publish(ctx, "payment.result", []byte(orderID), raw)
+	}
+
+	stop := run(NewPaymentResultConsumer(b.Subscribe("payment.result", "orders"), store))
+	waitFor(t, func() bool { return b.Lag("payment.result", "orders") == 0 })
+	stop()
+
+	o, _ := store.GetOrderByID(ctx, orderID)
+	if o.Status != "FINISHED" || o.FX == nil || *o.FX != *fx {
+		t.Fatalf("order = %s fx %+v, want FINISHED fx %+v", o.Status, o.FX, fx)
+	}
+}
+
+func TestPaymentResultConsumerCommitPolicy(t *testing.T) {
+	t.Run("bad json is skipped", func(t *testing.T) {
+		b := membroker.New(1)
+		_ = b.Publish(context.Background(), "payment.result", nil, []byte("{not json"))
+
+		stop := run(NewPaymentResultConsumer(b.Subscribe("payment.result", "orders"), memstore.New("t")))
+		waitFor(t, func() bool { return b.Lag("payment.result", "orders") == 0 })
+		stop()
+	})
+
+	t.Run("db error leaves message uncommitted", func(t *testing.T) {
+		b := membroker.New(1)
+		publishResult(t, b, "order-1", "FINISHED")
+
+		sub := b.Subscribe("payment.result", "orders")
+		c := NewPaymentResultConsumer(sub, failingStatusRepo{})
+		msg, err := sub.Fetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.handle(context.Background(), msg)
+
+		if lag := b.Lag("payment.result", "orders"); lag != 1 {
+			t.Fatalf("lag = %d, want 1: failed message must be redelivered", lag)
+		}
+	})
+}
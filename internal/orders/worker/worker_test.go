@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"HW4/internal/orders/repository/memstore"
+)
+
+var (
+	_ StatusRepository = (*memstore.Store)(nil)
+	_ OutboxStore      = (*memstore.Store)(nil)
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// run запускает воркер и возвращает функцию, останавливающую его и ждущую выхода.
+func run(w interface{ Run(context.Context) }) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { w.Run(ctx); close(done) }()
+	return func() { cancel(); <-done }
+}
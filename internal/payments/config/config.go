@@ -1 +1,322 @@
 package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"HW4/internal/common/apiversion"
+	"HW4/internal/common/envconfig"
+	"HW4/internal/common/kafka"
+	"HW4/internal/payments/fx"
+	"HW4/internal/payments/payout"
+)
+
+// Config — настройки Payments Service. Источники по возрастанию приоритета:
+// дефолты, YAML-файл из PAYMENTS_CONFIG_FILE, переменные окружения.
+type Config struct {
+	HTTP   HTTPConfig   `yaml:"http"`
+	DB     DBConfig     `yaml:"db"`
+	Kafka  KafkaConfig  `yaml:"kafka"`
+	Outbox OutboxConfig `yaml:"outbox"`
+	Auth   AuthConfig   `yaml:"auth"`
+	Retry  RetryConfig  `yaml:"retry"`
+	Holds  HoldsConfig  `yaml:"holds"`
+	Payout PayoutConfig `yaml:"payout"`
+	FX     FXConfig     `yaml:"fx"`
+
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	WorkerRestartDelay time.Duration `yaml:"worker_restart_delay" env:"WORKER_RESTART_DELAY"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" env:"PAYMENTS_HTTP_ADDR"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"PAYMENTS_HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"PAYMENTS_HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"PAYMENTS_HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"PAYMENTS_HTTP_IDLE_TIMEOUT"`
+	// LegacySunset — дата отключения маршрутов без /v1 (2027-06-30); пусто — apiversion.DefaultSunset.
+	LegacySunset string `yaml:"legacy_sunset" env:"API_LEGACY_SUNSET"`
+	// ValidateResponses сверяет ответы обработчиков с api/swagger.yaml и пишет расхождения в лог.
+	ValidateResponses bool `yaml:"validate_responses" env:"PAYMENTS_HTTP_VALIDATE_RESPONSES"`
+}
+
+// Versioning — настройки apiversion.Middleware. Дата уже проверена в Validate.
+func (c HTTPConfig) Versioning() apiversion.Options {
+	sunset, _ := apiversion.ParseSunset(c.LegacySunset)
+	return apiversion.Options{Sunset: sunset}
+}
+
+type DBConfig struct {
+	DSN             string        `yaml:"dsn" env:"PAYMENTS_DB_DSN"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"PAYMENTS_DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"PAYMENTS_DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"PAYMENTS_DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"PAYMENTS_DB_CONN_MAX_IDLE_TIME"`
+	// AutoMigrate применяет встроенные миграции при старте сервиса.
+	AutoMigrate bool `yaml:"auto_migrate" env:"PAYMENTS_DB_AUTO_MIGRATE"`
+}
+
+// AuthConfig: личность пользователя приходит от gateway в заголовках X-Auth-*.
+// При Required запросы без неё отклоняются с 401.
+type AuthConfig struct {
+	Required bool `yaml:"required" env:"PAYMENTS_AUTH_REQUIRED"`
+}
+
+type KafkaConfig struct {
+	Brokers               []string      `yaml:"brokers" env:"KAFKA_BROKERS"`
+	TopicPaymentRequested string        `yaml:"topic_payment_requested" env:"KAFKA_TOPIC_PAYMENT_REQUESTED"`
+	TopicPaymentResult    string        `yaml:"topic_payment_result" env:"KAFKA_TOPIC_PAYMENT_RESULT"`
+	TopicPayoutRequested  string        `yaml:"topic_payout_requested" env:"KAFKA_TOPIC_PAYOUT_REQUESTED"`
+	ConsumerGroup         string        `yaml:"consumer_group" env:"PAYMENTS_CONSUMER_GROUP"`
+	MinBytes              int           `yaml:"min_bytes" env:"KAFKA_CONSUMER_MIN_BYTES"`
+	MaxBytes              int           `yaml:"max_bytes" env:"KAFKA_CONSUMER_MAX_BYTES"`
+	MaxWait               time.Duration `yaml:"max_wait" env:"KAFKA_CONSUMER_MAX_WAIT"`
+	FetchTimeout          time.Duration `yaml:"fetch_timeout" env:"KAFKA_FETCH_TIMEOUT"`
+	CommitTimeout         time.Duration `yaml:"commit_timeout" env:"KAFKA_COMMIT_TIMEOUT"`
+	PublishTimeout        time.Duration `yaml:"publish_timeout" env:"KAFKA_PUBLISH_TIMEOUT"`
+}
+
+// RetryConfig — политика повторной обработки запросов на оплату:
+// неудачный запрос уходит в Topic и обрабатывается снова не раньше чем через
+// Backoff, каждая следующая попытка — вдвое позже; после MaxAttempts неудач
+// сообщение уходит в DLQ.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env:"KAFKA_RETRY_MAX"`
+	Backoff     time.Duration `yaml:"backoff" env:"KAFKA_RETRY_BACKOFF"`
+	Topic       string        `yaml:"topic" env:"KAFKA_RETRY_TOPIC"`
+	DLQTopic    string        `yaml:"dlq_topic" env:"KAFKA_DLQ_TOPIC"`
+}
+
+func (k KafkaConfig) Consumer(topic string) kafka.ConsumerConfig {
+	return kafka.ConsumerConfig{
+		Brokers:       k.Brokers,
+		Topic:         topic,
+		GroupID:       k.ConsumerGroup,
+		MinBytes:      k.MinBytes,
+		MaxBytes:      k.MaxBytes,
+		MaxWait:       k.MaxWait,
+		FetchTimeout:  k.FetchTimeout,
+		CommitTimeout: k.CommitTimeout,
+	}
+}
+
+func (k KafkaConfig) Producer() kafka.ProducerConfig {
+	return kafka.ProducerConfig{Brokers: k.Brokers, PublishTimeout: k.PublishTimeout}
+}
+
+// HoldsConfig — холды для заказов с capture_method=manual: через TTL
+// неподтверждённый холд снимается воркером, который раз в ExpiryInterval
+// обрабатывает пачки по ExpiryBatchSize.
+type HoldsConfig struct {
+	TTL             time.Duration `yaml:"ttl" env:"PAYMENTS_HOLD_TTL"`
+	ExpiryInterval  time.Duration `yaml:"expiry_interval" env:"PAYMENTS_HOLD_EXPIRY_INTERVAL"`
+	ExpiryBatchSize int           `yaml:"expiry_batch_size" env:"PAYMENTS_HOLD_EXPIRY_BATCH_SIZE"`
+}
+
+// PayoutConfig — выплаты по выводам средств. Timeout ограничивает один вызов
+// провайдера: не ответил — исход неизвестен, вывод остаётся PENDING с
+// холдом. Такие выводы раз в RetryInterval пачками по RetryBatchSize
+// отправляются провайдеру повторно: первый раз — через RetryAfter, дальше
+// пауза удваивается до RetryMaxBackoff. После RetryMaxAttempts отправок без
+// ответа вывод становится FAILED, и холд снимается. FakeMode задаёт ответ локального провайдера (succeed, fail или timeout),
+// FakeDelay — его задержку.
+type PayoutConfig struct {
+	Timeout          time.Duration `yaml:"timeout" env:"PAYMENTS_PAYOUT_TIMEOUT"`
+	RetryAfter       time.Duration `yaml:"retry_after" env:"PAYMENTS_PAYOUT_RETRY_AFTER"`
+	RetryMaxBackoff  time.Duration `yaml:"retry_max_backoff" env:"PAYMENTS_PAYOUT_RETRY_MAX_BACKOFF"`
+	RetryMaxAttempts int           `yaml:"retry_max_attempts" env:"PAYMENTS_PAYOUT_RETRY_MAX_ATTEMPTS"`
+	RetryInterval    time.Duration `yaml:"retry_interval" env:"PAYMENTS_PAYOUT_RETRY_INTERVAL"`
+	RetryBatchSize   int           `yaml:"retry_batch_size" env:"PAYMENTS_PAYOUT_RETRY_BATCH_SIZE"`
+	FakeMode         string        `yaml:"fake_mode" env:"PAYMENTS_PAYOUT_FAKE_MODE"`
+	FakeDelay        time.Duration `yaml:"fake_delay" env:"PAYMENTS_PAYOUT_FAKE_DELAY"`
+}
+
+// FXConfig — оплата заказа из основного кошелька, если кошелька в валюте
+// заказа нет. Курсы задаются таблицей "FROM/TO": курс — в Rates или в
+// YAML-файле RatesFile, но не там и там сразу. Без курсов конвертация
+// выключена. Rounding — правило округления суммы списания: half_up, up или
+// down.
+type FXConfig struct {
+	RatesFile string            `yaml:"rates_file" env:"PAYMENTS_FX_RATES_FILE"`
+	Rates     map[string]string `yaml:"rates"`
+	Rounding  string            `yaml:"rounding" env:"PAYMENTS_FX_ROUNDING"`
+}
+
+// Table собирает таблицу курсов; nil — конвертация выключена.
+func (c FXConfig) Table() (*fx.Table, error) {
+	switch {
+	case c.RatesFile != "":
+		return fx.LoadFile(c.RatesFile)
+	case len(c.Rates) > 0:
+		return fx.NewTable(c.Rates)
+	}
+	return nil, nil
+}
+
+type OutboxConfig struct {
+	BatchSize    int           `yaml:"batch_size" env:"PAYMENTS_OUTBOX_BATCH_SIZE"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"PAYMENTS_OUTBOX_POLL_INTERVAL"`
+	LockTTL      time.Duration `yaml:"lock_ttl" env:"PAYMENTS_OUTBOX_LOCK_TTL"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"PAYMENTS_OUTBOX_RETRY_BACKOFF"`
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+		DB: DBConfig{
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Kafka: KafkaConfig{
+			MinBytes:       1e3,
+			MaxBytes:       10e6,
+			MaxWait:        time.Second,
+			FetchTimeout:   30 * time.Second,
+			CommitTimeout:  5 * time.Second,
+			PublishTimeout: 5 * time.Second,
+		},
+		Outbox: OutboxConfig{
+			BatchSize:    20,
+			PollInterval: 700 * time.Millisecond,
+			LockTTL:      10 * time.Second,
+			RetryBackoff: 2 * time.Second,
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 3,
+			Backoff:     time.Second,
+		},
+		Holds: HoldsConfig{
+			TTL:             24 * time.Hour,
+			ExpiryInterval:  30 * time.Second,
+			ExpiryBatchSize: 100,
+		},
+		Payout: PayoutConfig{
+			Timeout:          10 * time.Second,
+			RetryAfter:       time.Minute,
+			RetryMaxBackoff:  time.Hour,
+			RetryMaxAttempts: 10,
+			RetryInterval:    30 * time.Second,
+			RetryBatchSize:   100,
+			FakeMode:         payout.ModeSucceed,
+		},
+		FX: FXConfig{
+			Rounding: fx.RoundHalfUp,
+		},
+		ShutdownTimeout:    15 * time.Second,
+		WorkerRestartDelay: time.Second,
+	}
+}
+
+// Load собирает конфиг из дефолтов, файла и env и валидирует его.
+// Ошибки разбора и валидации возвращаются все сразу.
+func Load() (Config, error) {
+	cfg, loadErr := load()
+	return cfg, errors.Join(loadErr, cfg.Validate())
+}
+
+// LoadDB загружает конфиг, но валидирует только секцию db —
+// для подкоманды migrate, которой Kafka не нужна.
+func LoadDB() (DBConfig, error) {
+	cfg, loadErr := load()
+	return cfg.DB, errors.Join(loadErr, cfg.DB.Validate())
+}
+
+func load() (Config, error) {
+	cfg := Default()
+	err := envconfig.Load(strings.TrimSpace(os.Getenv("PAYMENTS_CONFIG_FILE")), &cfg)
+	return cfg, err
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr (PAYMENTS_HTTP_ADDR) is required")
+	check(c.HTTP.ReadHeaderTimeout > 0, "http.read_header_timeout must be > 0")
+	check(c.HTTP.ReadTimeout >= 0, "http.read_timeout must be >= 0")
+	check(c.HTTP.WriteTimeout >= 0, "http.write_timeout must be >= 0")
+	check(c.HTTP.IdleTimeout >= 0, "http.idle_timeout must be >= 0")
+	_, sunsetErr := apiversion.ParseSunset(c.HTTP.LegacySunset)
+	check(sunsetErr == nil, "http.legacy_sunset (API_LEGACY_SUNSET): %v", sunsetErr)
+
+	check(len(c.Kafka.Brokers) > 0, "kafka.brokers (KAFKA_BROKERS) is required")
+	check(c.Kafka.TopicPaymentRequested != "", "kafka.topic_payment_requested (KAFKA_TOPIC_PAYMENT_REQUESTED) is required")
+	check(c.Kafka.TopicPaymentResult != "", "kafka.topic_payment_result (KAFKA_TOPIC_PAYMENT_RESULT) is required")
+	check(c.Kafka.TopicPayoutRequested != "", "kafka.topic_payout_requested (KAFKA_TOPIC_PAYOUT_REQUESTED) is required")
+	check(c.Kafka.ConsumerGroup != "", "kafka.consumer_group (PAYMENTS_CONSUMER_GROUP) is required")
+	check(c.Kafka.MinBytes > 0 && c.Kafka.MinBytes <= c.Kafka.MaxBytes, "kafka.min_bytes must be in [1, max_bytes]")
+	check(c.Kafka.MaxWait > 0, "kafka.max_wait must be > 0")
+	check(c.Kafka.FetchTimeout > 0, "kafka.fetch_timeout must be > 0")
+	check(c.Kafka.CommitTimeout > 0, "kafka.commit_timeout must be > 0")
+	check(c.Kafka.PublishTimeout > 0, "kafka.publish_timeout must be > 0")
+
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be > 0")
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be > 0")
+	check(c.Outbox.LockTTL > 0, "outbox.lock_ttl must be > 0")
+	check(c.Outbox.RetryBackoff > 0, "outbox.retry_backoff must be > 0")
+
+	check(c.Retry.MaxAttempts >= 0, "retry.max_attempts (KAFKA_RETRY_MAX) must be >= 0")
+	check(c.Retry.Backoff >= 0, "retry.backoff (KAFKA_RETRY_BACKOFF) must be >= 0")
+	check(c.Retry.Topic != "", "retry.topic (KAFKA_RETRY_TOPIC) is required")
+	check(c.Retry.DLQTopic != "", "retry.dlq_topic (KAFKA_DLQ_TOPIC) is required")
+
+	check(c.Holds.TTL > 0, "holds.ttl (PAYMENTS_HOLD_TTL) must be > 0")
+	check(c.Holds.ExpiryInterval > 0, "holds.expiry_interval must be > 0")
+	check(c.Holds.ExpiryBatchSize > 0, "holds.expiry_batch_size must be > 0")
+
+	check(c.Payout.Timeout > 0, "payout.timeout (PAYMENTS_PAYOUT_TIMEOUT) must be > 0")
+	// раньше таймаута повтор застанет ещё идущий вызов
+	check(c.Payout.RetryAfter > c.Payout.Timeout, "payout.retry_after (PAYMENTS_PAYOUT_RETRY_AFTER) must be greater than payout.timeout")
+	check(c.Payout.RetryMaxBackoff >= c.Payout.RetryAfter, "payout.retry_max_backoff (PAYMENTS_PAYOUT_RETRY_MAX_BACKOFF) must be >= payout.retry_after")
+	check(c.Payout.RetryMaxAttempts > 0, "payout.retry_max_attempts (PAYMENTS_PAYOUT_RETRY_MAX_ATTEMPTS) must be > 0")
+	check(c.Payout.RetryInterval > 0, "payout.retry_interval (PAYMENTS_PAYOUT_RETRY_INTERVAL) must be > 0")
+	check(c.Payout.RetryBatchSize > 0, "payout.retry_batch_size (PAYMENTS_PAYOUT_RETRY_BATCH_SIZE) must be > 0")
+	check(slices.Contains(payout.Modes, c.Payout.FakeMode),
+		"payout.fake_mode (PAYMENTS_PAYOUT_FAKE_MODE) must be one of %s", strings.Join(payout.Modes, ", "))
+	check(c.Payout.FakeDelay >= 0, "payout.fake_delay must be >= 0")
+
+	check(c.FX.RatesFile == "" || len(c.FX.Rates) == 0, "fx.rates and fx.rates_file (PAYMENTS_FX_RATES_FILE) are mutually exclusive")
+	check(slices.Contains(fx.Roundings, c.FX.Rounding),
+		"fx.rounding (PAYMENTS_FX_ROUNDING) must be one of %s", strings.Join(fx.Roundings, ", "))
+	_, fxErr := c.FX.Table()
+	check(fxErr == nil, "fx: %v", fxErr)
+
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be > 0")
+	check(c.WorkerRestartDelay > 0, "worker_restart_delay must be > 0")
+
+	return errors.Join(append(errs, c.DB.Validate())...)
+}
+
+func (c DBConfig) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.DSN != "", "db.dsn (PAYMENTS_DB_DSN) is required")
+	check(c.MaxOpenConns > 0, "db.max_open_conns must be > 0")
+	check(c.MaxIdleConns >= 0 && c.MaxIdleConns <= c.MaxOpenConns,
+		"db.max_idle_conns must be in [0, max_open_conns]")
+	check(c.ConnMaxLifetime >= 0, "db.conn_max_lifetime must be >= 0")
+	check(c.ConnMaxIdleTime >= 0, "db.conn_max_idle_time must be >= 0")
+
+	return errors.Join(errs...)
+}
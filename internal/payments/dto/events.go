@@ -1,11 +1,83 @@
 package dto
 
-type PaymentResult struct {
-	MessageID string `json:"message_id"`
-	OrderID   string `json:"order_id"`
-	UserID    string `json:"user_id"`
-	Amount    int64  `json:"amount"`
-	Status    string `json:"status"`
-	Reason    string `json:"reason,omitempty"`
+// Типы команд в топике запросов на оплату. Все команды по заказу идут с
+// ключом order_id, поэтому списание или подтверждение холда не обгонит его
+// создание. Пустой Type — EventPaymentRequested.
+const (
+	EventPaymentRequested = "payment.requested"
+	EventCaptureRequested = "payment.capture_requested"
+	EventVoidRequested    = "payment.void_requested"
+	EventRefundRequested  = "payment.refund_requested"
+)
+
+// EventRefundResult — тип результата возврата в топике результатов; пустой
+// Type у PaymentResult — результат оплаты.
+const EventRefundResult = "refund.result"
+
+// Статусы результата возврата.
+const (
+	RefundSucceeded = "SUCCEEDED"
+	RefundRejected  = "REJECTED"
+)
+
+// Способ списания в PaymentRequested.CaptureMethod: automatic — сразу,
+// manual — холд до команды capture или void. Пустое значение — automatic.
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+)
+
+// PaymentRequested: Amount — в минорных единицах Currency (код ISO 4217);
+// пустой Currency — money.DefaultCurrency.
+type PaymentRequested struct {
+	MessageID     string `json:"message_id"`
+	Type          string `json:"type,omitempty"`
+	OrderID       string `json:"order_id"`
+	UserID        string `json:"user_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency,omitempty"`
+	CaptureMethod string `json:"capture_method,omitempty"`
+	// RefundID — идентификатор возврата для EventRefundRequested.
+	RefundID  string `json:"refund_id,omitempty"`
 	CreatedAt string `json:"created_at"`
 }
+
+// PaymentResult — результат оплаты или, с Type=EventRefundResult, возврата.
+// Для возврата RefundedAmount — сколько всего возвращено по заказу после
+// него: повторная или запоздавшая доставка не собьёт итог у получателя.
+// FX есть у AUTHORIZED и FINISHED, если заказ оплачен из кошелька в другой
+// валюте.
+type PaymentResult struct {
+	MessageID      string `json:"message_id"`
+	Type           string `json:"type,omitempty"`
+	OrderID        string `json:"order_id"`
+	UserID         string `json:"user_id"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency,omitempty"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason,omitempty"`
+	RefundID       string `json:"refund_id,omitempty"`
+	RefundedAmount int64  `json:"refunded_amount,omitempty"`
+	FX             *FX    `json:"fx,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// FX — конвертация при оплате: ChargedAmount в минорных единицах
+// ChargedCurrency списано или захолдировано по курсу Rate (1 единица валюты
+// заказа = Rate единиц ChargedCurrency).
+type FX struct {
+	Rate            string `json:"rate"`
+	ChargedAmount   int64  `json:"charged_amount"`
+	ChargedCurrency string `json:"charged_currency"`
+}
+
+// PayoutRequested — команда провайдеру выплат на вывод средств. Пишется в
+// outbox вместе с холдом суммы, ключ — withdrawal_id.
+type PayoutRequested struct {
+	MessageID    string `json:"message_id"`
+	WithdrawalID string `json:"withdrawal_id"`
+	UserID       string `json:"user_id"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	CreatedAt    string `json:"created_at"`
+}
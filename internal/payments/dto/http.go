@@ -1,16 +1,117 @@
 package dto
 
+// CreateAccountRequest: Currency — основная валюта счёта, в ней открывается
+// первый кошелёк с Balance. Пустая — money.DefaultCurrency.
 type CreateAccountRequest struct {
-	UserID  string `json:"user_id"`
-	Balance int64  `json:"balance"`
+	UserID   string `json:"user_id"`
+	Balance  int64  `json:"balance"`
+	Currency string `json:"currency,omitempty"`
 }
 
+// TopUpRequest: пополняется кошелёк в Currency, пустая — money.DefaultCurrency.
 type TopUpRequest struct {
-	UserID string `json:"user_id"`
-	Amount int64  `json:"amount"`
+	UserID   string `json:"user_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
 }
 
-type BalanceResponse struct {
-	UserID  string `json:"user_id"`
-	Balance int64  `json:"balance"`
+type TopUpResponse struct {
+	UserID   string `json:"user_id"`
+	Balance  int64  `json:"balance"`
+	Currency string `json:"currency"`
+}
+
+// AccountResponse: Balance, Held и Available — кошелёк основной валюты
+// Currency, Wallets — все кошельки счёта. Balance включает Held — сумму
+// активных холдов и выводов в обработке, Available = Balance - Held.
+type AccountResponse struct {
+	UserID    string           `json:"user_id"`
+	Currency  string           `json:"currency"`
+	Balance   int64            `json:"balance"`
+	Held      int64            `json:"held"`
+	Available int64            `json:"available"`
+	Status    string           `json:"status"`
+	Wallets   []WalletResponse `json:"wallets"`
+	CreatedAt string           `json:"created_at"`
+	UpdatedAt string           `json:"updated_at"`
+}
+
+type WalletResponse struct {
+	Currency  string `json:"currency"`
+	Balance   int64  `json:"balance"`
+	Held      int64  `json:"held"`
+	Available int64  `json:"available"`
+}
+
+// CreateWalletRequest — тело POST /accounts/{user_id}/wallets.
+type CreateWalletRequest struct {
+	Currency string `json:"currency"`
+}
+
+// StatusChangeRequest — тело POST /accounts/{user_id}/freeze|unfreeze|close.
+type StatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// TransferRequest — тело POST /accounts/transfers. TransferID задаёт клиент:
+// повтор с тем же id не проводит перевод второй раз.
+type TransferRequest struct {
+	TransferID string `json:"transfer_id"`
+	FromUserID string `json:"from_user_id"`
+	ToUserID   string `json:"to_user_id"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency,omitempty"`
+}
+
+type TransferResponse struct {
+	TransferID string `json:"transfer_id"`
+	FromUserID string `json:"from_user_id"`
+	ToUserID   string `json:"to_user_id"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// WithdrawalRequest — тело POST /accounts/{user_id}/withdrawals.
+type WithdrawalRequest struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// WithdrawalResponse: пока Status PENDING, Amount захолдирован на счёте;
+// Reason — причина для FAILED.
+type WithdrawalResponse struct {
+	WithdrawalID string `json:"withdrawal_id"`
+	UserID       string `json:"user_id"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// LimitsRequest — тело PUT /accounts/{user_id}/limits, заменяет все лимиты
+// счёта. 0 — без ограничения. Суммы — в минорных единицах Currency, пустая —
+// основная валюта счёта. MaxOrders — сколько оплат допускается за
+// OrdersWindowSeconds.
+type LimitsRequest struct {
+	Currency            string `json:"currency,omitempty"`
+	MaxOrderAmount      int64  `json:"max_order_amount"`
+	DailyAmount         int64  `json:"daily_amount"`
+	MonthlyAmount       int64  `json:"monthly_amount"`
+	MaxOrders           int    `json:"max_orders"`
+	OrdersWindowSeconds int    `json:"orders_window_seconds"`
+}
+
+// LimitsResponse: UpdatedAt пуст, если лимиты не задавались.
+type LimitsResponse struct {
+	UserID              string `json:"user_id"`
+	Currency            string `json:"currency"`
+	MaxOrderAmount      int64  `json:"max_order_amount"`
+	DailyAmount         int64  `json:"daily_amount"`
+	MonthlyAmount       int64  `json:"monthly_amount"`
+	MaxOrders           int    `json:"max_orders"`
+	OrdersWindowSeconds int    `json:"orders_window_seconds"`
+	UpdatedAt           string `json:"updated_at,omitempty"`
 }
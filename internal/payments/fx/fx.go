@@ -0,0 +1,119 @@
+// Package fx — курсы валют и конвертация сумм, чтобы заказ в одной валюте
+// можно было оплатить из кошелька в другой. Курс берётся из
+// repository.RateProvider; здесь — статическая таблица курсов из конфига или
+// файла.
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"HW4/internal/common/money"
+)
+
+// Правила округления сконвертированной суммы до минорной единицы валюты
+// кошелька.
+const (
+	// RoundHalfUp — до ближайшей минорной единицы, ровно половина — вверх.
+	RoundHalfUp = "half_up"
+	// RoundUp — всегда вверх: списывается не меньше точного эквивалента.
+	RoundUp = "up"
+	// RoundDown — всегда вниз: списывается не больше точного эквивалента.
+	RoundDown = "down"
+)
+
+// Roundings — допустимые значения fx.rounding.
+var Roundings = []string{RoundHalfUp, RoundUp, RoundDown}
+
+var (
+	// ErrNoRate — курса для пары валют нет.
+	ErrNoRate = errors.New("fx: no rate")
+	// ErrOutOfRange — сконвертированная сумма не помещается в int64.
+	ErrOutOfRange = errors.New("fx: converted amount out of range")
+)
+
+var decimal = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Rate — курс: 1 единица валюты From стоит Value единиц валюты To. Value —
+// положительная десятичная дробь в той записи, в какой курс задан в таблице;
+// она же сохраняется в списании и уходит в PaymentResult.
+type Rate struct {
+	From  string
+	To    string
+	Value string
+}
+
+// ParseRate проверяет валюты и запись курса.
+func ParseRate(from, to, value string) (Rate, error) {
+	if _, ok := money.Lookup(from); !ok {
+		return Rate{}, fmt.Errorf("unsupported currency %q", from)
+	}
+	if _, ok := money.Lookup(to); !ok {
+		return Rate{}, fmt.Errorf("unsupported currency %q", to)
+	}
+	if !decimal.MatchString(value) {
+		return Rate{}, fmt.Errorf("rate %q must be a decimal like 92.5", value)
+	}
+	if v, _ := new(big.Rat).SetString(value); v.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must be > 0", value)
+	}
+	return Rate{From: from, To: to, Value: value}, nil
+}
+
+// Convert переводит amount >= 0 из минорных единиц From в минорные единицы To
+// и округляет результат по rounding. Считается точно, без float.
+func (r Rate) Convert(amount int64, rounding string) (int64, error) {
+	v, ok := new(big.Rat).SetString(r.Value)
+	if !ok || amount < 0 {
+		return 0, fmt.Errorf("fx: convert %d at %q", amount, r.Value)
+	}
+	from, _ := money.Lookup(r.From)
+	to, _ := money.Lookup(r.To)
+
+	num := new(big.Int).Mul(big.NewInt(amount), v.Num())
+	den := new(big.Int).Set(v.Denom())
+	if d := to.MinorUnits - from.MinorUnits; d > 0 {
+		num.Mul(num, pow10(d))
+	} else if d < 0 {
+		den.Mul(den, pow10(-d))
+	}
+	return round(num, den, rounding)
+}
+
+// Prorate — доля part/whole от total с округлением RoundHalfUp. Возврат части
+// заказа, оплаченного с конвертацией, считается от исходного списания, а не
+// по текущему курсу: сумма зачислений при полном возврате равна total.
+func Prorate(part, whole, total int64) int64 {
+	if whole <= 0 {
+		return 0
+	}
+	num := new(big.Int).Mul(big.NewInt(part), big.NewInt(total))
+	n, _ := round(num, big.NewInt(whole), RoundHalfUp)
+	return n
+}
+
+// round делит неотрицательный num на положительный den по правилу rounding.
+func round(num, den *big.Int, rounding string) (int64, error) {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() != 0 {
+		switch rounding {
+		case RoundUp:
+			q.Add(q, big.NewInt(1))
+		case RoundDown:
+		default:
+			if r.Lsh(r, 1).Cmp(den) >= 0 {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	if !q.IsInt64() {
+		return 0, ErrOutOfRange
+	}
+	return q.Int64(), nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,74 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     Rate
+		amount   int64
+		rounding string
+		want     int64
+	}{
+		{name: "exact", rate: Rate{"USD", "RUB", "92.5"}, amount: 1000, rounding: RoundHalfUp, want: 92500},
+		{name: "half rounds up", rate: Rate{"USD", "RUB", "92.5"}, amount: 1001, rounding: RoundHalfUp, want: 92593},
+		{name: "below half rounds down", rate: Rate{"RUB", "USD", "0.0109"}, amount: 10004, rounding: RoundHalfUp, want: 109},
+		{name: "up", rate: Rate{"RUB", "USD", "0.0109"}, amount: 10004, rounding: RoundUp, want: 110},
+		{name: "down", rate: Rate{"USD", "RUB", "92.5"}, amount: 1001, rounding: RoundDown, want: 92592},
+		{name: "zero", rate: Rate{"USD", "RUB", "92.5"}, amount: 0, rounding: RoundUp, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rate.Convert(tt.amount, tt.rounding)
+			if err != nil || got != tt.want {
+				t.Fatalf("Convert(%d) = %d, %v; want %d", tt.amount, got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := (Rate{"USD", "RUB", "1000000000"}).Convert(1<<62, RoundHalfUp); !errors.Is(err, ErrOutOfRange) {
+		t.Fatalf("overflow err = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestProrate(t *testing.T) {
+	// частичные возвраты в сумме дают ровно исходное списание
+	const paid, charged = 1001, 92593
+	first := Prorate(500, paid, charged)
+	rest := Prorate(paid, paid, charged) - first
+	if first != 46250 || first+rest != charged {
+		t.Fatalf("prorate = %d + %d, want 46250 + %d", first, rest, charged-46250)
+	}
+}
+
+func TestTable(t *testing.T) {
+	table, err := NewTable(map[string]string{"USD/RUB": "92.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := table.Rate(context.Background(), "USD", "RUB"); err != nil || r.Value != "92.5" {
+		t.Fatalf("USD/RUB = %+v, %v", r, err)
+	}
+	// обратный курс не выводится
+	if _, err := table.Rate(context.Background(), "RUB", "USD"); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("RUB/USD err = %v, want ErrNoRate", err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"USD": "1"},
+		{"USD/USD": "1"},
+		{"USD/XXX": "1"},
+		{"USD/RUB": "0"},
+		{"USD/RUB": "-1"},
+		{"USD/RUB": "1e3"},
+		{"USD/RUB": "1/3"},
+	} {
+		if _, err := NewTable(bad); err == nil {
+			t.Fatalf("NewTable(%v) = nil error", bad)
+		}
+	}
+}
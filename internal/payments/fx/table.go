@@ -0,0 +1,67 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Table — статическая таблица курсов: ключ "FROM/TO", значение — курс
+// (1 FROM = значение TO). Обратный курс не выводится: у покупки и продажи
+// валюты свои курсы, поэтому каждое нужное направление задаётся отдельно.
+type Table struct {
+	rates map[string]Rate
+}
+
+// NewTable разбирает таблицу; ошибки по всем строкам возвращаются разом.
+func NewTable(rates map[string]string) (*Table, error) {
+	t := &Table{rates: make(map[string]Rate, len(rates))}
+	var errs []error
+	for _, pair := range slices.Sorted(maps.Keys(rates)) {
+		from, to, ok := strings.Cut(pair, "/")
+		if !ok || from == to {
+			errs = append(errs, fmt.Errorf("fx pair %q: want FROM/TO with different currencies", pair))
+			continue
+		}
+		r, err := ParseRate(from, to, strings.TrimSpace(rates[pair]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fx pair %q: %w", pair, err))
+			continue
+		}
+		t.rates[pair] = r
+	}
+	return t, errors.Join(errs...)
+}
+
+// LoadFile читает таблицу из YAML-файла вида
+//
+//	RUB/USD: "0.0109"
+//	USD/RUB: "91.5"
+func LoadFile(path string) (*Table, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fx rates: %w", err)
+	}
+	var rates map[string]string
+	if err := yaml.Unmarshal(raw, &rates); err != nil {
+		return nil, fmt.Errorf("parse fx rates %s: %w", path, err)
+	}
+	return NewTable(rates)
+}
+
+// Len — число курсов в таблице.
+func (t *Table) Len() int { return len(t.rates) }
+
+func (t *Table) Rate(ctx context.Context, from, to string) (Rate, error) {
+	r, ok := t.rates[from+"/"+to]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w %s/%s", ErrNoRate, from, to)
+	}
+	return r, nil
+}
@@ -2,10 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"HW4/internal/common/authn"
 	"HW4/internal/common/httpx"
+	"HW4/internal/common/money"
 	"HW4/internal/payments/dto"
 	"HW4/internal/payments/service"
 )
@@ -16,24 +20,139 @@ type Handler struct {
 
 func New(svc *service.PaymentsService) *Handler { return &Handler{svc: svc} }
 
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.CreateAccount(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+	mux.HandleFunc("/accounts/topup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.TopUp(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+	mux.HandleFunc("/accounts/transfers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.Transfer(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+	mux.HandleFunc("/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		// /accounts/{user_id}, /accounts/{user_id}/{freeze|unfreeze|close},
+		// /accounts/{user_id}/wallets, /accounts/{user_id}/withdrawals[/{withdrawal_id}],
+		// /accounts/{user_id}/limits
+		_, sub, nested := strings.Cut(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/")
+		switch {
+		case !nested:
+			if r.Method == http.MethodGet {
+				h.GetAccount(w, r)
+				return
+			}
+		case sub == "wallets":
+			if r.Method == http.MethodPost {
+				h.CreateWallet(w, r)
+				return
+			}
+		case sub == "withdrawals":
+			if r.Method == http.MethodPost {
+				h.Withdraw(w, r)
+				return
+			}
+		case strings.HasPrefix(sub, "withdrawals/"):
+			if r.Method == http.MethodGet {
+				h.GetWithdrawal(w, r)
+				return
+			}
+		case sub == "limits":
+			switch r.Method {
+			case http.MethodGet:
+				h.GetLimits(w, r)
+				return
+			case http.MethodPut:
+				h.SetLimits(w, r)
+				return
+			}
+		case r.Method == http.MethodPost:
+			h.ChangeStatus(w, r)
+			return
+		}
+		httpx.Fail(w, r, errMethodNotAllowed)
+	})
+}
+
+// accountErrors — ответы на ошибки PaymentsService; остальное — 500 INTERNAL.
+var accountErrors = []httpx.Rule{
+	{Err: service.ErrBadRequest, Status: http.StatusBadRequest, Code: httpx.CodeBadRequest, Message: "invalid request"},
+	{Err: service.ErrAlreadyExists, Status: http.StatusConflict, Code: httpx.CodeAlreadyExists, Message: "account already exists"},
+	{Err: service.ErrNotFound, Status: http.StatusNotFound, Code: httpx.CodeNotFound, Message: "account not found"},
+	{Err: service.ErrAccountFrozen, Status: http.StatusConflict, Code: httpx.CodeAccountFrozen, Message: "account is frozen"},
+	{Err: service.ErrAccountClosed, Status: http.StatusConflict, Code: httpx.CodeAccountClosed, Message: "account is closed"},
+	{Err: service.ErrInvalidTransition, Status: http.StatusConflict, Code: httpx.CodeInvalidTransition, Message: "account status does not allow this action"},
+	{Err: service.ErrInsufficientFunds, Status: http.StatusConflict, Code: httpx.CodeInsufficientFunds, Message: "insufficient funds"},
+	{Err: service.ErrIdempotencyConflict, Status: http.StatusConflict, Code: httpx.CodeConflict, Message: "transfer_id was already used with different parameters"},
+	{Err: service.ErrWithdrawalNotFound, Status: http.StatusNotFound, Code: httpx.CodeNotFound, Message: "withdrawal not found"},
+	{Err: service.ErrCurrencyMismatch, Status: http.StatusConflict, Code: httpx.CodeCurrencyMismatch, Message: "account has no wallet in this currency"},
+	{Err: service.ErrWalletExists, Status: http.StatusConflict, Code: httpx.CodeAlreadyExists, Message: "wallet already exists"},
+	{Err: service.ErrAccountNotEmpty, Status: http.StatusConflict, Code: httpx.CodeAccountNotEmpty, Message: "account still has funds, holds or pending withdrawals"},
+	{Err: service.ErrLimitsLoosened, Status: http.StatusForbidden, Code: httpx.CodeForbidden, Message: "only admins can raise or remove limits"},
+}
+
+var (
+	errForbidden        = httpx.NewError(http.StatusForbidden, httpx.CodeForbidden, "user_id does not match authenticated user")
+	errAdminOnly        = httpx.NewError(http.StatusForbidden, httpx.CodeForbidden, "only admins can freeze or unfreeze accounts")
+	errUnknownAction    = httpx.NewError(http.StatusNotFound, httpx.CodeNotFound, "unknown account action")
+	errMethodNotAllowed = httpx.NewError(http.StatusMethodNotAllowed, httpx.CodeMethodNotAllowed, "method not allowed")
+)
+
+// currencyDetail — ошибка валидации для неподдерживаемой валюты.
+var currencyDetail = httpx.ErrorDetail{Field: "body.currency", Issue: "must be one of " + strings.Join(money.Codes(), ", ")}
+
+// moneyDetails проверяет валюту (пустая — money.DefaultCurrency) и сумму в
+// её минорных единицах.
+func moneyDetails(currency string, amount int64) []httpx.ErrorDetail {
+	cur, ok := money.Lookup(money.Or(currency))
+	if !ok {
+		return []httpx.ErrorDetail{currencyDetail}
+	}
+	if err := cur.CheckAmount(amount); err != nil {
+		return []httpx.ErrorDetail{{Field: "body.amount", Issue: err.Error()}}
+	}
+	return nil
+}
+
 func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateAccountRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "invalid json body")
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if req.UserID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.user_id", Issue: "is required"})
+	}
+	if cur, ok := money.Lookup(money.Or(req.Currency)); !ok {
+		details = append(details, currencyDetail)
+	} else if req.Balance < 0 {
+		details = append(details, httpx.ErrorDetail{Field: "body.balance", Issue: "must be >= 0"})
+	} else if req.Balance > cur.MaxAmount() {
+		details = append(details, httpx.ErrorDetail{Field: "body.balance", Issue: fmt.Sprintf("must be at most %d %s minor units", cur.MaxAmount(), cur.Code)})
+	}
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), req.UserID) {
+		httpx.Fail(w, r, errForbidden)
 		return
 	}
 
-	err := h.svc.CreateAccount(r.Context(), req)
-	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required and balance must be >= 0")
-			return
-		}
-		if err == service.ErrAlreadyExists {
-			httpx.Error(w, http.StatusConflict, "ALREADY_EXISTS", "account already exists")
-			return
-		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to create account")
+	if err := h.svc.CreateAccount(r.Context(), req); err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to create account", accountErrors...))
 		return
 	}
 
@@ -43,39 +162,326 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) TopUp(w http.ResponseWriter, r *http.Request) {
 	var req dto.TopUpRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "invalid json body")
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if req.UserID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.user_id", Issue: "is required"})
+	}
+	details = append(details, moneyDetails(req.Currency, req.Amount)...)
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), req.UserID) {
+		httpx.Fail(w, r, errForbidden)
 		return
 	}
 
-	err := h.svc.TopUp(r.Context(), req)
+	resp, err := h.svc.TopUp(r.Context(), req)
 	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required and amount must be > 0")
-			return
-		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to top up")
+		httpx.Fail(w, r, httpx.Map(err, "failed to top up", accountErrors...))
 		return
 	}
 
-	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[map[string]any]{Data: map[string]any{"status": "ok"}})
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.TopUpResponse]{Data: resp})
 }
 
-func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
+// Transfer обслуживает POST /accounts/transfers. Переводить может только
+// владелец счёта-отправителя. Новый перевод — 201, повтор с тем же
+// transfer_id — 200 с исходным переводом.
+func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+	var req dto.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if req.TransferID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.transfer_id", Issue: "is required"})
+	}
+	if req.FromUserID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.from_user_id", Issue: "is required"})
+	}
+	if req.ToUserID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.to_user_id", Issue: "is required"})
+	} else if req.ToUserID == req.FromUserID {
+		details = append(details, httpx.ErrorDetail{Field: "body.to_user_id", Issue: "must differ from from_user_id"})
+	}
+	details = append(details, moneyDetails(req.Currency, req.Amount)...)
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), req.FromUserID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
+
+	resp, replayed, err := h.svc.Transfer(r.Context(), req)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to transfer", accountErrors...))
+		return
+	}
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	httpx.JSON(w, status, httpx.SuccessResponse[dto.TransferResponse]{Data: resp})
+}
+
+func (h *Handler) GetAccount(w http.ResponseWriter, r *http.Request) {
 	userID := strings.TrimPrefix(r.URL.Path, "/accounts/")
+	if userID == "" {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"}))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
 
-	resp, err := h.svc.GetBalance(r.Context(), userID)
+	resp, err := h.svc.GetAccount(r.Context(), userID)
 	if err != nil {
-		if err == service.ErrBadRequest {
-			httpx.Error(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
+		httpx.Fail(w, r, httpx.Map(err, "failed to get account", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.AccountResponse]{Data: resp})
+}
+
+// CreateWallet обслуживает POST /accounts/{user_id}/wallets: открывает на
+// счёте пустой кошелёк в новой валюте. Ответ 201 — счёт со всеми кошельками.
+func (h *Handler) CreateWallet(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/wallets")
+	var req dto.CreateWalletRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if userID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"})
+	}
+	if req.Currency == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.currency", Issue: "is required"})
+	} else if _, ok := money.Lookup(req.Currency); !ok {
+		details = append(details, currencyDetail)
+	}
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
+
+	resp, err := h.svc.CreateWallet(r.Context(), userID, req)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to create wallet", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusCreated, httpx.SuccessResponse[dto.AccountResponse]{Data: resp})
+}
+
+// ChangeStatus обслуживает POST /accounts/{user_id}/{freeze|unfreeze|close}.
+// Замораживает и размораживает только админ, закрыть счёт может и владелец.
+func (h *Handler) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+	userID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/")
+	switch action {
+	case service.ActionFreeze, service.ActionUnfreeze:
+		if err := authn.RequireAdmin(r.Context(), errAdminOnly); err != nil {
+			httpx.Fail(w, r, err)
 			return
 		}
-		if err == service.ErrNotFound {
-			httpx.Error(w, http.StatusNotFound, "NOT_FOUND", "account not found")
+	case service.ActionClose:
+		if !authn.CanAccess(r.Context(), userID) {
+			httpx.Fail(w, r, errForbidden)
 			return
 		}
-		httpx.Error(w, http.StatusInternalServerError, "INTERNAL", "failed to get balance")
+	default:
+		httpx.Fail(w, r, errUnknownAction)
+		return
+	}
+
+	var req dto.StatusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if userID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		details = append(details, httpx.ErrorDetail{Field: "body.reason", Issue: "is required"})
+	}
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+
+	var actor string
+	if id, ok := authn.FromContext(r.Context()); ok {
+		actor = id.Subject
+	}
+	resp, err := h.svc.ChangeStatus(r.Context(), userID, action, req, actor)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to "+action+" account", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.AccountResponse]{Data: resp})
+}
+
+// Withdraw обслуживает POST /accounts/{user_id}/withdrawals. Выводить может
+// только владелец счёта. Ответ 202: сумма захолдирована, выплата идёт
+// асинхронно, итог виден в GET /accounts/{user_id}/withdrawals/{withdrawal_id}.
+func (h *Handler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/withdrawals")
+	var req dto.WithdrawalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if userID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"})
+	}
+	details = append(details, moneyDetails(req.Currency, req.Amount)...)
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
+
+	resp, err := h.svc.Withdraw(r.Context(), userID, req)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to withdraw", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusAccepted, httpx.SuccessResponse[dto.WithdrawalResponse]{Data: resp})
+}
+
+func (h *Handler) GetWithdrawal(w http.ResponseWriter, r *http.Request) {
+	userID, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/withdrawals/")
+	var details []httpx.ErrorDetail
+	if userID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"})
+	}
+	if id == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.withdrawal_id", Issue: "is required"})
+	}
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
+
+	resp, err := h.svc.GetWithdrawal(r.Context(), userID, id)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to get withdrawal", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.WithdrawalResponse]{Data: resp})
+}
+
+func (h *Handler) GetLimits(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/limits")
+	if userID == "" {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"}))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
+		return
+	}
+
+	resp, err := h.svc.GetLimits(r.Context(), userID)
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to get limits", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.LimitsResponse]{Data: resp})
+}
+
+// SetLimits обслуживает PUT /accounts/{user_id}/limits: заменяет все лимиты
+// счёта. Владелец может только ужесточить их, поднять или снять — админ.
+func (h *Handler) SetLimits(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/limits")
+	var req dto.LimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Fail(w, r, httpx.Invalid(httpx.ErrorDetail{Field: "body", Issue: "must be valid json"}))
+		return
+	}
+	var details []httpx.ErrorDetail
+	if userID == "" {
+		details = append(details, httpx.ErrorDetail{Field: "path.user_id", Issue: "is required"})
+	}
+	details = append(details, limitsDetails(req)...)
+	if len(details) > 0 {
+		httpx.Fail(w, r, httpx.Invalid(details...))
+		return
+	}
+	if !authn.CanAccess(r.Context(), userID) {
+		httpx.Fail(w, r, errForbidden)
 		return
 	}
 
-	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.BalanceResponse]{Data: resp})
+	resp, err := h.svc.SetLimits(r.Context(), userID, req, authn.CanAdminister(r.Context()))
+	if err != nil {
+		httpx.Fail(w, r, httpx.Map(err, "failed to set limits", accountErrors...))
+		return
+	}
+
+	httpx.JSON(w, http.StatusOK, httpx.SuccessResponse[dto.LimitsResponse]{Data: resp})
+}
+
+// limitsDetails проверяет тело PUT /accounts/{user_id}/limits.
+func limitsDetails(req dto.LimitsRequest) []httpx.ErrorDetail {
+	var details []httpx.ErrorDetail
+	// без валюты в теле верхняя граница сумм не проверяется: основную валюту
+	// счёта знает только хранилище, а слишком большой лимит просто не сработает
+	cur, known := money.Lookup(req.Currency)
+	if req.Currency != "" && !known {
+		details = append(details, currencyDetail)
+	}
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"max_order_amount", req.MaxOrderAmount},
+		{"daily_amount", req.DailyAmount},
+		{"monthly_amount", req.MonthlyAmount},
+	} {
+		switch {
+		case f.value < 0:
+			details = append(details, httpx.ErrorDetail{Field: "body." + f.name, Issue: "must be >= 0"})
+		case known && f.value > cur.MaxAmount():
+			details = append(details, httpx.ErrorDetail{Field: "body." + f.name, Issue: fmt.Sprintf("must be at most %d %s minor units", cur.MaxAmount(), cur.Code)})
+		}
+	}
+	if req.MaxOrders < 0 {
+		details = append(details, httpx.ErrorDetail{Field: "body.max_orders", Issue: "must be >= 0"})
+	}
+	maxWindow := int(service.MaxOrdersWindow / time.Second)
+	switch {
+	case req.OrdersWindowSeconds < 0 || req.OrdersWindowSeconds > maxWindow:
+		details = append(details, httpx.ErrorDetail{Field: "body.orders_window_seconds", Issue: fmt.Sprintf("must be between 0 and %d", maxWindow)})
+	case req.MaxOrders > 0 && req.OrdersWindowSeconds == 0:
+		details = append(details, httpx.ErrorDetail{Field: "body.orders_window_seconds", Issue: "is required with max_orders"})
+	}
+	return details
 }
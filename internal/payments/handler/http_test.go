@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"HW4/internal/common/authn"
+	"HW4/internal/common/httpx"
+	"HW4/internal/payments/repository"
+	"HW4/internal/payments/repository/memstore"
+	"HW4/internal/payments/service"
+)
+
+const userID = "11111111-1111-1111-1111-111111111111"
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+func TestHandlers(t *testing.T) {
+	h := New(service.New(memstore.New("payment.result")))
+
+	tests := []struct {
+		name     string
+		fn       http.HandlerFunc
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantErr  string
+		wantData string
+	}{
+		{name: "create", fn: h.CreateAccount, method: http.MethodPost, target: "/accounts", body: `{"user_id":"` + userID + `","balance":500}`, wantCode: http.StatusCreated},
+		{name: "create duplicate", fn: h.CreateAccount, method: http.MethodPost, target: "/accounts", body: `{"user_id":"` + userID + `"}`, wantCode: http.StatusConflict, wantErr: "ALREADY_EXISTS"},
+		{name: "create bad json", fn: h.CreateAccount, method: http.MethodPost, target: "/accounts", body: `[`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "create negative balance", fn: h.CreateAccount, method: http.MethodPost, target: "/accounts", body: `{"user_id":"22222222-2222-2222-2222-222222222222","balance":-1}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "create unknown currency", fn: h.CreateAccount, method: http.MethodPost, target: "/accounts", body: `{"user_id":"22222222-2222-2222-2222-222222222222","currency":"XXX"}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "top up", fn: h.TopUp, method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":300}`, wantCode: http.StatusOK, wantData: `{"user_id":"` + userID + `","balance":800,"currency":"RUB"}`},
+		{name: "top up without wallet", fn: h.TopUp, method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":300,"currency":"USD"}`, wantCode: http.StatusConflict, wantErr: "CURRENCY_MISMATCH"},
+		{name: "open wallet", fn: h.CreateWallet, method: http.MethodPost, target: "/accounts/" + userID + "/wallets", body: `{"currency":"USD"}`, wantCode: http.StatusCreated},
+		{name: "open wallet twice", fn: h.CreateWallet, method: http.MethodPost, target: "/accounts/" + userID + "/wallets", body: `{"currency":"USD"}`, wantCode: http.StatusConflict, wantErr: "ALREADY_EXISTS"},
+		{name: "open wallet unknown currency", fn: h.CreateWallet, method: http.MethodPost, target: "/accounts/" + userID + "/wallets", body: `{"currency":"usd"}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "top up wallet", fn: h.TopUp, method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":300,"currency":"USD"}`, wantCode: http.StatusOK, wantData: `{"user_id":"` + userID + `","balance":300,"currency":"USD"}`},
+		{name: "top up unknown", fn: h.TopUp, method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"33333333-3333-3333-3333-333333333333","amount":300}`, wantCode: http.StatusNotFound, wantErr: "NOT_FOUND"},
+		{name: "top up zero", fn: h.TopUp, method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":0}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "account", fn: h.GetAccount, method: http.MethodGet, target: "/accounts/" + userID, wantCode: http.StatusOK},
+		{name: "balance unknown", fn: h.GetAccount, method: http.MethodGet, target: "/accounts/33333333-3333-3333-3333-333333333333", wantCode: http.StatusNotFound, wantErr: "NOT_FOUND"},
+		{name: "limits default", fn: h.GetLimits, method: http.MethodGet, target: "/accounts/" + userID + "/limits", wantCode: http.StatusOK, wantData: `{"user_id":"` + userID + `","currency":"RUB","max_order_amount":0,"daily_amount":0,"monthly_amount":0,"max_orders":0,"orders_window_seconds":0}`},
+		{name: "limits negative amount", fn: h.SetLimits, method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":-1}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "limits max orders without window", fn: h.SetLimits, method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"max_orders":5}`, wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+		{name: "limits unknown account", fn: h.SetLimits, method: http.MethodPut, target: "/accounts/33333333-3333-3333-3333-333333333333/limits", body: `{}`, wantCode: http.StatusNotFound, wantErr: "NOT_FOUND"},
+		{name: "balance empty id", fn: h.GetAccount, method: http.MethodGet, target: "/accounts/", wantCode: http.StatusBadRequest, wantErr: "BAD_REQUEST"},
+	}
+
+	// кейсы зависят друг от друга (создание → пополнение → баланс), поэтому идут по порядку
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.fn(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			var env envelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatalf("bad body %q: %v", rec.Body, err)
+			}
+			if env.Error.Code != tt.wantErr {
+				t.Fatalf("error code = %q, want %q", env.Error.Code, tt.wantErr)
+			}
+			if tt.wantData != "" && string(env.Data) != tt.wantData {
+				t.Fatalf("data = %s, want %s", env.Data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestUserScoping(t *testing.T) {
+	h := New(service.New(memstore.New("payment.result")))
+	mux := http.NewServeMux()
+	h.Register(mux)
+	api := authn.Middleware(true, mux)
+
+	const other = "22222222-2222-2222-2222-222222222222"
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		subject  string
+		roles    string
+		wantCode int
+	}{
+		{name: "no identity when required", method: http.MethodGet, target: "/accounts/" + userID, wantCode: http.StatusUnauthorized},
+		{name: "create own account", method: http.MethodPost, target: "/accounts", body: `{"user_id":"` + userID + `","balance":10}`, subject: userID, wantCode: http.StatusCreated},
+		{name: "create foreign account", method: http.MethodPost, target: "/accounts", body: `{"user_id":"` + other + `"}`, subject: userID, wantCode: http.StatusForbidden},
+		{name: "top up foreign account", method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":5}`, subject: other, wantCode: http.StatusForbidden},
+		{name: "admin tops up any account", method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":5}`, subject: other, roles: "admin", wantCode: http.StatusOK},
+		{name: "transfer from foreign account", method: http.MethodPost, target: "/accounts/transfers", body: `{"transfer_id":"t1","from_user_id":"` + userID + `","to_user_id":"` + other + `","amount":1}`, subject: other, wantCode: http.StatusForbidden},
+		{name: "transfers path is not an account id", method: http.MethodGet, target: "/accounts/transfers", subject: userID, roles: "admin", wantCode: http.StatusMethodNotAllowed},
+		{name: "own balance", method: http.MethodGet, target: "/accounts/" + userID, subject: userID, wantCode: http.StatusOK},
+		{name: "foreign balance", method: http.MethodGet, target: "/accounts/" + userID, subject: other, wantCode: http.StatusForbidden},
+		{name: "withdraw from foreign account", method: http.MethodPost, target: "/accounts/" + userID + "/withdrawals", body: `{"amount":5}`, subject: other, wantCode: http.StatusForbidden},
+		{name: "owner withdraws", method: http.MethodPost, target: "/accounts/" + userID + "/withdrawals", body: `{"amount":5}`, subject: userID, wantCode: http.StatusAccepted},
+		{name: "withdrawals are not listed", method: http.MethodGet, target: "/accounts/" + userID + "/withdrawals", subject: userID, wantCode: http.StatusMethodNotAllowed},
+		{name: "unknown withdrawal", method: http.MethodGet, target: "/accounts/" + userID + "/withdrawals/" + other, subject: userID, wantCode: http.StatusNotFound},
+		{name: "foreign limits", method: http.MethodGet, target: "/accounts/" + userID + "/limits", subject: other, wantCode: http.StatusForbidden},
+		{name: "owner sets limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":1000}`, subject: userID, wantCode: http.StatusOK},
+		{name: "owner tightens limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":500,"max_orders":10,"orders_window_seconds":60}`, subject: userID, wantCode: http.StatusOK},
+		{name: "owner cannot raise limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":5000}`, subject: userID, wantCode: http.StatusForbidden},
+		{name: "admin raises limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":5000}`, subject: other, roles: "admin", wantCode: http.StatusOK},
+		{name: "own limits", method: http.MethodGet, target: "/accounts/" + userID + "/limits", subject: userID, wantCode: http.StatusOK},
+		{name: "limits are not posted", method: http.MethodPost, target: "/accounts/" + userID + "/limits", body: `{}`, subject: userID, wantCode: http.StatusMethodNotAllowed},
+		{name: "owner cannot freeze", method: http.MethodPost, target: "/accounts/" + userID + "/freeze", body: `{"reason":"x"}`, subject: userID, wantCode: http.StatusForbidden},
+		{name: "admin freezes", method: http.MethodPost, target: "/accounts/" + userID + "/freeze", body: `{"reason":"kyc"}`, subject: other, roles: "admin", wantCode: http.StatusOK},
+		{name: "frozen account accepts top-ups", method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + userID + `","amount":5}`, subject: userID, wantCode: http.StatusOK},
+		{name: "close foreign account", method: http.MethodPost, target: "/accounts/" + userID + "/close", body: `{"reason":"x"}`, subject: other, wantCode: http.StatusForbidden},
+		{name: "account with funds is not closed", method: http.MethodPost, target: "/accounts/" + userID + "/close", body: `{"reason":"moving out"}`, subject: userID, wantCode: http.StatusConflict},
+		{name: "create empty account", method: http.MethodPost, target: "/accounts", body: `{"user_id":"` + other + `"}`, subject: other, wantCode: http.StatusCreated},
+		{name: "owner closes empty account", method: http.MethodPost, target: "/accounts/" + other + "/close", body: `{"reason":"moving out"}`, subject: other, wantCode: http.StatusOK},
+		{name: "closed account rejects top-ups", method: http.MethodPost, target: "/accounts/topup", body: `{"user_id":"` + other + `","amount":5}`, subject: other, wantCode: http.StatusConflict},
+		{name: "unknown action", method: http.MethodPost, target: "/accounts/" + userID + "/delete", body: `{"reason":"x"}`, subject: userID, roles: "admin", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.subject != "" {
+				req.Header.Set(authn.HeaderSubject, tt.subject)
+				req.Header.Set(authn.HeaderRoles, tt.roles)
+			}
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+// TestAdminRequiresIdentity: при необязательной авторизации запрос без
+// личности работает как владелец, но админские операции ему недоступны.
+func TestAdminRequiresIdentity(t *testing.T) {
+	store := memstore.New("payment.result")
+	_ = store.Create(context.Background(), userID, "RUB", 100)
+	h := New(service.New(store))
+	mux := http.NewServeMux()
+	h.Register(mux)
+	api := authn.Middleware(false, mux)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+	}{
+		{name: "freeze", method: http.MethodPost, target: "/accounts/" + userID + "/freeze", body: `{"reason":"x"}`, wantCode: http.StatusUnauthorized},
+		{name: "unfreeze", method: http.MethodPost, target: "/accounts/" + userID + "/unfreeze", body: `{"reason":"x"}`, wantCode: http.StatusUnauthorized},
+		{name: "tighten limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":1000}`, wantCode: http.StatusOK},
+		{name: "raise limits", method: http.MethodPut, target: "/accounts/" + userID + "/limits", body: `{"daily_amount":5000}`, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+	if a, _ := store.GetAccount(context.Background(), userID); a.Status != repository.AccountActive {
+		t.Fatalf("account status = %s, want %s", a.Status, repository.AccountActive)
+	}
+}
+
+func TestErrorModel(t *testing.T) {
+	h := New(service.New(memstore.New("payment.result")))
+	mux := http.NewServeMux()
+	h.Register(mux)
+	api := httpx.RequestID(mux)
+
+	t.Run("field details and request id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/topup", strings.NewReader(`{"amount":0}`))
+		req.Header.Set(httpx.HeaderRequestID, "req-42")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+
+		var body httpx.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusBadRequest {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+		}
+		e := body.Error
+		if e.Code != httpx.CodeBadRequest || e.RequestID != "req-42" || rec.Header().Get(httpx.HeaderRequestID) != "req-42" {
+			t.Fatalf("error = %+v, header %q", e, rec.Header().Get(httpx.HeaderRequestID))
+		}
+		want := []httpx.ErrorDetail{{Field: "body.user_id", Issue: "is required"}, {Field: "body.amount", Issue: "must be > 0"}}
+		if len(e.Details) != len(want) || e.Details[0] != want[0] || e.Details[1] != want[1] {
+			t.Fatalf("details = %+v, want %+v", e.Details, want)
+		}
+	})
+
+	t.Run("problem json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/accounts/"+userID, nil)
+		req.Header.Set("Accept", "application/problem+json, application/json;q=0.5")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != httpx.ProblemContentType {
+			t.Fatalf("content type = %q", ct)
+		}
+		var p httpx.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != http.StatusNotFound || p.Code != httpx.CodeNotFound || p.Type != httpx.ProblemTypePrefix+httpx.CodeNotFound ||
+			p.Instance != "/accounts/"+userID || p.RequestID == "" {
+			t.Fatalf("problem = %+v", p)
+		}
+	})
+}
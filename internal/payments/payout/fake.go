@@ -0,0 +1,90 @@
+// Package payout — провайдеры выплат для worker.PayoutConsumer. Пока
+// настоящей интеграции нет, сервис работает с Fake.
+package payout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"HW4/internal/payments/dto"
+)
+
+// Режимы Fake.
+const (
+	ModeSucceed = "succeed"
+	ModeFail    = "fail"
+	ModeTimeout = "timeout"
+)
+
+// Modes — допустимые значения payout.fake_mode.
+var Modes = []string{ModeSucceed, ModeFail, ModeTimeout}
+
+// ErrDeclined — провайдер окончательно отказал в выплате: деньги не ушли, и
+// холд можно снять. Другие ошибки провайдера такого не гарантируют.
+var ErrDeclined = errors.New("payout declined by provider")
+
+// Fake — локальная замена провайдера выплат: денег никуда не отправляет и
+// через delay отвечает по mode. В режиме timeout не отвечает вовсе, пока
+// вызывающий не отменит контекст, — как зависший провайдер. Как и настоящий
+// провайдер, Fake идемпотентен по withdrawal_id: первый ответ запоминается,
+// и повтор получает его же, не выплачивая второй раз.
+type Fake struct {
+	mode  string
+	delay time.Duration
+
+	mu       sync.Mutex
+	outcomes map[string]error
+	paid     int
+}
+
+func NewFake(mode string, delay time.Duration) *Fake {
+	return &Fake{mode: mode, delay: delay, outcomes: map[string]error{}}
+}
+
+func (f *Fake) Payout(ctx context.Context, req dto.PayoutRequested) error {
+	f.mu.Lock()
+	prev, done := f.outcomes[req.WithdrawalID]
+	f.mu.Unlock()
+	if done {
+		return prev
+	}
+	if f.mode == ModeTimeout {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(f.delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	var err error
+	if f.mode == ModeFail {
+		err = ErrDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// параллельный вызов с тем же withdrawal_id мог ответить раньше
+	if prev, ok := f.outcomes[req.WithdrawalID]; ok {
+		return prev
+	}
+	f.outcomes[req.WithdrawalID] = err
+	if err == nil {
+		f.paid++
+	}
+	return err
+}
+
+// Paid возвращает, сколько выплат Fake провёл; повторы с тем же
+// withdrawal_id не считаются.
+func (f *Fake) Paid() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paid
+}
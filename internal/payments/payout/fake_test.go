@@ -0,0 +1,66 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"HW4/internal/payments/dto"
+)
+
+func TestFakeIsIdempotentByWithdrawalID(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake(ModeSucceed, 0)
+	req := dto.PayoutRequested{MessageID: "m1", WithdrawalID: "w1", Amount: 100, Currency: "RUB"}
+
+	if err := f.Payout(ctx, req); err != nil {
+		t.Fatalf("first payout: %v", err)
+	}
+	// повтор с новым message_id, но тем же withdrawal_id
+	req.MessageID = "m2"
+	if err := f.Payout(ctx, req); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	// ответ уже известен: смена режима его не меняет
+	f.mode = ModeFail
+	if err := f.Payout(ctx, req); err != nil {
+		t.Fatalf("retry after mode change: %v", err)
+	}
+	if n := f.Paid(); n != 1 {
+		t.Fatalf("paid %d times, want 1", n)
+	}
+
+	// отказ тоже запоминается
+	declined := dto.PayoutRequested{WithdrawalID: "w2", Amount: 100, Currency: "RUB"}
+	if err := f.Payout(ctx, declined); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("payout = %v, want %v", err, ErrDeclined)
+	}
+	f.mode = ModeSucceed
+	if err := f.Payout(ctx, declined); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("retry of declined payout = %v, want %v", err, ErrDeclined)
+	}
+	if n := f.Paid(); n != 1 {
+		t.Fatalf("paid %d times, want 1", n)
+	}
+}
+
+func TestFakeTimeoutRemembersNothing(t *testing.T) {
+	f := NewFake(ModeTimeout, 0)
+	req := dto.PayoutRequested{WithdrawalID: "w1", Amount: 100, Currency: "RUB"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.Payout(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("payout = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// провайдер ожил: повтор проходит, и выплата одна
+	f.mode = ModeSucceed
+	if err := f.Payout(context.Background(), req); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if n := f.Paid(); n != 1 {
+		t.Fatalf("paid %d times, want 1", n)
+	}
+}
@@ -3,38 +3,313 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"slices"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+// Статусы счёта. Замороженный счёт принимает пополнения, закрытый — ничего.
+const (
+	AccountActive = "ACTIVE"
+	AccountFrozen = "FROZEN"
+	AccountClosed = "CLOSED"
+)
+
+// Account — счёт пользователя. Деньги лежат в кошельках Wallets, по одному
+// на валюту; Currency — основная валюта, в ней счёт создан. Balance и Held —
+// кошелёк основной валюты. Статус счёта действует на все кошельки.
+type Account struct {
+	UserID    string
+	Currency  string
+	Balance   int64
+	Held      int64
+	Status    string
+	Wallets   []Wallet
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Available — сколько можно списать или захолдировать в основной валюте.
+func (a Account) Available() int64 { return a.Balance - a.Held }
+
+// Wallet возвращает кошелёк счёта в валюте currency; ok=false — его нет.
+func (a Account) Wallet(currency string) (Wallet, bool) {
+	i := slices.IndexFunc(a.Wallets, func(w Wallet) bool { return w.Currency == currency })
+	if i < 0 {
+		return Wallet{}, false
+	}
+	return a.Wallets[i], true
+}
+
+// Wallet — кошелёк счёта в одной валюте. Суммы — в минорных единицах
+// Currency; Balance включает Held — сумму активных холдов и выводов в
+// статусе PENDING.
+type Wallet struct {
+	Currency  string
+	Balance   int64
+	Held      int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Available — сколько можно списать или захолдировать.
+func (w Wallet) Available() int64 { return w.Balance - w.Held }
+
 type AccountsRepo struct {
-	db *sql.DB
+	db          *sql.DB
+	payoutTopic string
+	payoutRetry PayoutRetry
+}
+
+// NewAccountsRepo создаёт репозиторий счетов; payoutTopic — топик команд на
+// выплату, которые CreateWithdrawal пишет в outbox.
+func NewAccountsRepo(db *sql.DB, payoutTopic string) *AccountsRepo {
+	if payoutTopic == "" {
+		panic("payoutTopic is empty")
+	}
+	return &AccountsRepo{db: db, payoutTopic: payoutTopic, payoutRetry: DefaultPayoutRetry}
+}
+
+// SetPayoutRetry задаёт расписание повторов выплат с неизвестным исходом.
+func (r *AccountsRepo) SetPayoutRetry(p PayoutRetry) {
+	r.payoutRetry = p
 }
 
-func NewAccountsRepo(db *sql.DB) *AccountsRepo { return &AccountsRepo{db: db} }
+// Create создаёт счёт с основной валютой currency и её кошельком с
+// начальным балансом balance.
+func (r *AccountsRepo) Create(ctx context.Context, userID, currency string, balance int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-func (r *AccountsRepo) Create(ctx context.Context, userID string, balance int64) error {
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO accounts(user_id, balance) VALUES ($1,$2)
-	`, userID, balance)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO accounts(user_id, currency) VALUES ($1,$2)
+	`, userID, currency)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO wallets(user_id, currency, balance) VALUES ($1,$2,$3)
+	`, userID, currency, balance)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateWallet открывает на счёте пустой кошелёк в валюте currency и
+// возвращает счёт. Кошелёк уже есть — ErrAlreadyExists, счёт закрыт —
+// ErrAccountClosed.
+func (r *AccountsRepo) CreateWallet(ctx context.Context, userID, currency string) (Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, err
+	}
+	defer tx.Rollback()
+
+	a, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return Account{}, err
+	}
+	if a.Status == AccountClosed {
+		return Account{}, ErrAccountClosed
+	}
+	if _, ok := a.Wallet(currency); ok {
+		return Account{}, ErrAlreadyExists
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO wallets(user_id, currency) VALUES ($1,$2)
+	`, userID, currency)
+	if err != nil {
+		return Account{}, err
+	}
+	if err := loadWallets(ctx, tx, &a); err != nil {
+		return Account{}, err
+	}
+	return a, tx.Commit()
+}
+
+// TopUp зачисляет amount на кошелёк в валюте currency и возвращает его новый
+// баланс. Неизвестный счёт — ErrNotFound, закрытый — ErrAccountClosed,
+// кошелька в этой валюте нет — ErrCurrencyMismatch.
+func (r *AccountsRepo) TopUp(ctx context.Context, userID, currency string, amount int64) (int64, error) {
+	var balance int64
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE wallets SET balance = balance + $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+		  AND EXISTS (SELECT 1 FROM accounts WHERE user_id = $2 AND status <> 'CLOSED' FOR SHARE)
+		RETURNING balance
+	`, amount, userID, currency).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		// строку не обновили: счёта нет, он закрыт или нет кошелька
+		a, err := r.GetAccount(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if a.Status == AccountClosed {
+			return 0, ErrAccountClosed
+		}
+		return 0, ErrCurrencyMismatch
+	}
+	return balance, err
+}
+
+func (r *AccountsRepo) GetAccount(ctx context.Context, userID string) (Account, error) {
+	a := Account{UserID: userID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT currency, status, created_at, updated_at FROM accounts WHERE user_id=$1
+	`, userID).Scan(&a.Currency, &a.Status, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, ErrNotFound
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	return a, loadWallets(ctx, r.db, &a)
+}
+
+// lockAccount читает счёт с кошельками, блокируя строку accounts до конца
+// транзакции. Кошельки блокируются тем, кто их меняет, — всегда после счёта.
+func lockAccount(ctx context.Context, tx *sql.Tx, userID string) (Account, error) {
+	a := Account{UserID: userID}
+	err := tx.QueryRowContext(ctx, `
+		SELECT currency, status, created_at, updated_at FROM accounts WHERE user_id=$1 FOR UPDATE
+	`, userID).Scan(&a.Currency, &a.Status, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, ErrNotFound
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	return a, loadWallets(ctx, tx, &a)
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// loadWallets заполняет a.Wallets по алфавиту валют, а Balance и Held —
+// кошельком основной валюты.
+func loadWallets(ctx context.Context, q querier, a *Account) error {
+	rows, err := q.QueryContext(ctx, `
+		SELECT currency, balance, held, created_at, updated_at FROM wallets
+		WHERE user_id=$1 ORDER BY currency
+	`, a.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	a.Wallets = nil
+	for rows.Next() {
+		var w Wallet
+		if err := rows.Scan(&w.Currency, &w.Balance, &w.Held, &w.CreatedAt, &w.UpdatedAt); err != nil {
 			return err
 		}
+		a.Wallets = append(a.Wallets, w)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	return err
+	w, _ := a.Wallet(a.Currency)
+	a.Balance, a.Held = w.Balance, w.Held
+	return nil
 }
 
-func (r *AccountsRepo) TopUp(ctx context.Context, userID string, amount int64) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE accounts SET balance = balance + $1, updated_at = now()
+// StatusChange — смена статуса счёта. From — статусы, из которых она допустима.
+type StatusChange struct {
+	Action string
+	From   []string
+	To     string
+	Reason string
+	Actor  string
+}
+
+// AuditEntry — запись account_audit о смене статуса.
+type AuditEntry struct {
+	UserID    string
+	Action    string
+	From      string
+	To        string
+	Reason    string
+	Actor     string
+	CreatedAt time.Time
+}
+
+// ChangeStatus меняет статус счёта и пишет запись в account_audit в одной
+// транзакции. Закрытый счёт — ErrAccountClosed, иной недопустимый исходный
+// статус — ErrInvalidTransition. Закрыть можно только пустой счёт (см.
+// ErrAccountNotEmpty): строка счёта заблокирована, поэтому параллельное
+// пополнение или списание не проскочит между проверкой и сменой статуса.
+func (r *AccountsRepo) ChangeStatus(ctx context.Context, userID string, c StatusChange) (Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM accounts WHERE user_id=$1 FOR UPDATE`, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, ErrNotFound
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	if err := CheckTransition(current, c.From); err != nil {
+		return Account{}, err
+	}
+	if c.To == AccountClosed {
+		var busy bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM wallets WHERE user_id = $1 AND (balance <> 0 OR held <> 0))
+			    OR EXISTS (SELECT 1 FROM withdrawals WHERE user_id = $1 AND status = 'PENDING')
+		`, userID).Scan(&busy)
+		if err != nil {
+			return Account{}, err
+		}
+		if busy {
+			return Account{}, ErrAccountNotEmpty
+		}
+	}
+
+	a := Account{UserID: userID, Status: c.To}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE accounts SET status = $1, updated_at = now()
 		WHERE user_id = $2
-	`, amount, userID)
-	return err
+		RETURNING currency, created_at, updated_at
+	`, c.To, userID).Scan(&a.Currency, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return Account{}, err
+	}
+	if err := loadWallets(ctx, tx, &a); err != nil {
+		return Account{}, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO account_audit(user_id, action, from_status, to_status, reason, actor)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, userID, c.Action, current, c.To, c.Reason, c.Actor)
+	if err != nil {
+		return Account{}, err
+	}
+	return a, tx.Commit()
 }
 
-func (r *AccountsRepo) GetBalance(ctx context.Context, userID string) (int64, error) {
-	var b int64
-	err := r.db.QueryRowContext(ctx, `SELECT balance FROM accounts WHERE user_id=$1`, userID).Scan(&b)
-	return b, err
+// CheckTransition проверяет, что из статуса current можно перейти, если
+// допустимы исходные статусы from.
+func CheckTransition(current string, from []string) error {
+	if slices.Contains(from, current) {
+		return nil
+	}
+	if current == AccountClosed {
+		return ErrAccountClosed
+	}
+	return ErrInvalidTransition
 }
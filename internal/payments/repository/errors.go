@@ -0,0 +1,24 @@
+package repository
+
+import "errors"
+
+var (
+	ErrAlreadyExists = errors.New("already_exists")
+	ErrNotFound      = errors.New("not_found")
+	ErrAccountFrozen = errors.New("account_frozen")
+	ErrAccountClosed = errors.New("account_closed")
+	// ErrInvalidTransition — смена статуса не допускается из текущего статуса.
+	ErrInvalidTransition = errors.New("invalid_transition")
+	// ErrInsufficientFunds — на счёте недостаточно доступных средств.
+	ErrInsufficientFunds = errors.New("insufficient_funds")
+	// ErrCurrencyMismatch — у счёта нет кошелька в валюте операции.
+	ErrCurrencyMismatch = errors.New("currency_mismatch")
+	// ErrIdempotencyConflict — id перевода уже использован с другими параметрами.
+	ErrIdempotencyConflict = errors.New("idempotency_conflict")
+	// ErrAccountNotEmpty — на счёте остались деньги, холды или выводы в
+	// обработке, поэтому закрыть его нельзя.
+	ErrAccountNotEmpty = errors.New("account_not_empty")
+	// ErrLimitsLoosened — новые лимиты слабее действующих, а ослаблять их
+	// не разрешено.
+	ErrLimitsLoosened = errors.New("limits_loosened")
+)
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Окна лимитов расхода — скользящие, отсчитываются от момента оплаты.
+const (
+	LimitDay   = 24 * time.Hour
+	LimitMonth = 30 * 24 * time.Hour
+	// MaxOrdersWindow — наибольшее окно лимита на число заказов.
+	MaxOrdersWindow = LimitMonth
+)
+
+// Причины отказа в PaymentResult.Reason из-за лимитов счёта.
+const (
+	ReasonOrderAmountLimit = "order_amount_limit_exceeded"
+	ReasonDailyLimit       = "daily_limit_exceeded"
+	ReasonMonthlyLimit     = "monthly_limit_exceeded"
+	ReasonVelocityLimit    = "velocity_limit_exceeded"
+)
+
+// Limits — лимиты расхода счёта. 0 — без ограничения. Суммы — в минорных
+// единицах Currency и действуют только на списания из кошелька этой валюты;
+// MaxOrders — сколько оплат допускается за OrdersWindow в любой валюте.
+type Limits struct {
+	Currency       string
+	MaxOrderAmount int64
+	DailyAmount    int64
+	MonthlyAmount  int64
+	MaxOrders      int
+	OrdersWindow   time.Duration
+	// UpdatedAt — когда лимиты меняли; нулевой — лимиты не задавались.
+	UpdatedAt time.Time
+}
+
+// Unlimited — ни один лимит не задан.
+func (l Limits) Unlimited() bool {
+	return !l.hasAmounts() && l.MaxOrders == 0
+}
+
+func (l Limits) hasAmounts() bool {
+	return l.MaxOrderAmount > 0 || l.DailyAmount > 0 || l.MonthlyAmount > 0
+}
+
+// Tightens — l не ослабляет cur: ни один лимит не снят и не поднят, окно
+// лимита на число заказов не сократилось. Смена валюты при заданных
+// денежных лимитах — ослабление: суммы в другой валюте несравнимы.
+func (l Limits) Tightens(cur Limits) bool {
+	tighter := func(next, prev int64) bool { return prev == 0 || (next > 0 && next <= prev) }
+	if l.Currency != cur.Currency && cur.hasAmounts() {
+		return false
+	}
+	return tighter(l.MaxOrderAmount, cur.MaxOrderAmount) &&
+		tighter(l.DailyAmount, cur.DailyAmount) &&
+		tighter(l.MonthlyAmount, cur.MonthlyAmount) &&
+		tighter(int64(l.MaxOrders), int64(cur.MaxOrders)) &&
+		(cur.MaxOrders == 0 || l.OrdersWindow >= cur.OrdersWindow)
+}
+
+// Usage — расход счёта до текущей оплаты: Day и Month — списано и
+// захолдировано в валюте лимитов за LimitDay и LimitMonth, Orders — число
+// оплат за окно лимита на заказы.
+type Usage struct {
+	Day    int64
+	Month  int64
+	Orders int
+}
+
+// Add учитывает оплату на amount в валюте currency, сделанную в момент at.
+// Оплатой считается списание или холд, кроме снятого void'ом или по TTL;
+// возвраты расход не уменьшают.
+func (u *Usage) Add(l Limits, currency string, amount int64, at, now time.Time) {
+	age := now.Sub(at)
+	if currency == l.Currency && age < LimitMonth {
+		u.Month += amount
+		if age < LimitDay {
+			u.Day += amount
+		}
+	}
+	if age < l.OrdersWindow {
+		u.Orders++
+	}
+}
+
+// Check проверяет, укладывается ли списание c в лимиты при расходе u.
+// Возвращает причину отказа или пустую строку.
+func (l Limits) Check(c Charge, u Usage) string {
+	inCurrency := c.Currency == l.Currency
+	switch {
+	case inCurrency && l.MaxOrderAmount > 0 && c.Amount > l.MaxOrderAmount:
+		return ReasonOrderAmountLimit
+	case inCurrency && l.DailyAmount > 0 && u.Day+c.Amount > l.DailyAmount:
+		return ReasonDailyLimit
+	case inCurrency && l.MonthlyAmount > 0 && u.Month+c.Amount > l.MonthlyAmount:
+		return ReasonMonthlyLimit
+	case l.MaxOrders > 0 && u.Orders >= l.MaxOrders:
+		return ReasonVelocityLimit
+	}
+	return ""
+}
+
+const limitsColumns = `currency, max_order_amount, daily_amount, monthly_amount, max_orders, orders_window_seconds, updated_at`
+
+func scanLimits(row *sql.Row) (Limits, error) {
+	var (
+		l      Limits
+		window int64
+	)
+	err := row.Scan(&l.Currency, &l.MaxOrderAmount, &l.DailyAmount, &l.MonthlyAmount, &l.MaxOrders, &window, &l.UpdatedAt)
+	l.OrdersWindow = time.Duration(window) * time.Second
+	return l, err
+}
+
+// GetLimits возвращает лимиты счёта. Если их не задавали — пустые лимиты в
+// основной валюте счёта.
+func (r *AccountsRepo) GetLimits(ctx context.Context, userID string) (Limits, error) {
+	var (
+		primary string
+		l       Limits
+	)
+	err := r.db.QueryRowContext(ctx, `SELECT currency FROM accounts WHERE user_id=$1`, userID).Scan(&primary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Limits{}, ErrNotFound
+	}
+	if err != nil {
+		return Limits{}, err
+	}
+	l, err = scanLimits(r.db.QueryRowContext(ctx, `SELECT `+limitsColumns+` FROM account_limits WHERE user_id=$1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Limits{Currency: primary}, nil
+	}
+	return l, err
+}
+
+// SetLimits заменяет лимиты счёта на l; пустая l.Currency — основная валюта
+// счёта. Без loosen лимиты можно только ужесточить (Limits.Tightens), иначе
+// ErrLimitsLoosened. Строка account_limits блокируется так же, как при
+// оплате, поэтому новые лимиты действуют с первой оплаты после коммита.
+func (r *AccountsRepo) SetLimits(ctx context.Context, userID string, l Limits, loosen bool) (Limits, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Limits{}, err
+	}
+	defer tx.Rollback()
+
+	var status, primary string
+	err = tx.QueryRowContext(ctx, `SELECT status, currency FROM accounts WHERE user_id=$1`, userID).Scan(&status, &primary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Limits{}, ErrNotFound
+	}
+	if err != nil {
+		return Limits{}, err
+	}
+	if status == AccountClosed {
+		return Limits{}, ErrAccountClosed
+	}
+	if l.Currency == "" {
+		l.Currency = primary
+	}
+
+	// пустая строка лимитов — «без ограничений»; она нужна, чтобы было что
+	// заблокировать, даже если лимиты задаются впервые
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO account_limits(user_id, currency) VALUES ($1,$2)
+		ON CONFLICT (user_id) DO NOTHING
+	`, userID, primary)
+	if err != nil {
+		return Limits{}, err
+	}
+	cur, err := scanLimits(tx.QueryRowContext(ctx, `SELECT `+limitsColumns+` FROM account_limits WHERE user_id=$1 FOR UPDATE`, userID))
+	if err != nil {
+		return Limits{}, err
+	}
+	if !loosen && !l.Tightens(cur) {
+		return Limits{}, ErrLimitsLoosened
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE account_limits
+		SET currency = $2, max_order_amount = $3, daily_amount = $4, monthly_amount = $5,
+		    max_orders = $6, orders_window_seconds = $7, updated_at = now()
+		WHERE user_id = $1
+		RETURNING updated_at
+	`, userID, l.Currency, l.MaxOrderAmount, l.DailyAmount, l.MonthlyAmount, l.MaxOrders, int64(l.OrdersWindow/time.Second)).Scan(&l.UpdatedAt)
+	if err != nil {
+		return Limits{}, err
+	}
+	return l, tx.Commit()
+}
+
+// checkLimits проверяет списание c по лимитам плательщика. Строка
+// account_limits блокируется до конца транзакции: параллельные оплаты одного
+// счёта считают расход по очереди и вместе лимит не превысят. Возвращает
+// причину отказа или пустую строку.
+func checkLimits(ctx context.Context, tx *sql.Tx, userID string, c Charge) (string, error) {
+	l, err := scanLimits(tx.QueryRowContext(ctx, `SELECT `+limitsColumns+` FROM account_limits WHERE user_id=$1 FOR UPDATE`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil || l.Unlimited() {
+		return "", err
+	}
+
+	// оплата — списание без холда или холд, кроме снятого (см. Usage.Add)
+	var u Usage
+	err = tx.QueryRowContext(ctx, `
+		WITH paid AS (
+			SELECT t.charged_amount AS amount, t.charged_currency AS currency, t.created_at
+			FROM transactions t
+			WHERE t.user_id = $1 AND t.created_at > now() - $3 * interval '1 millisecond'
+			  AND NOT EXISTS (SELECT 1 FROM holds h WHERE h.order_id = t.order_id)
+			UNION ALL
+			SELECT charged_amount, charged_currency, created_at
+			FROM holds
+			WHERE user_id = $1 AND status IN ('ACTIVE', 'CAPTURED')
+			  AND created_at > now() - $3 * interval '1 millisecond'
+		)
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE currency = $2 AND created_at > now() - $4 * interval '1 millisecond'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE currency = $2), 0),
+			COUNT(*) FILTER (WHERE created_at > now() - $5 * interval '1 millisecond')
+		FROM paid
+	`, userID, l.Currency, LimitMonth.Milliseconds(), LimitDay.Milliseconds(), l.OrdersWindow.Milliseconds()).Scan(&u.Day, &u.Month, &u.Orders)
+	if err != nil {
+		return "", err
+	}
+	return l.Check(c, u), nil
+}
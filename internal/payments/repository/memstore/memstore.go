@@ -0,0 +1,797 @@
+// Package memstore — in-memory хранилище Payments Service для тестов.
+// Повторяет семантику SQL-репозиториев: уникальный счёт на пользователя и
+// кошелёк на валюту, деньги движутся в кошельке валюты операции или, при
+// оплате с конвертацией, в основном кошельке, дедупликация по inbox, одна
+// транзакция списания или один холд на заказ, возвраты в пределах оплаты,
+// лимиты расхода счёта, идемпотентные переводы, холд суммы вывода и запись
+// результата или команды на выплату в outbox в той же «транзакции».
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/common/money"
+	"HW4/internal/payments/dto"
+	"HW4/internal/payments/fx"
+	"HW4/internal/payments/repository"
+)
+
+type OutboxEntry struct {
+	repository.OutboxRecord
+	ProcessedAt time.Time
+	Attempts    int
+	NextRetryAt time.Time
+	LockedUntil time.Time
+	LastError   string
+}
+
+// Transaction — строка таблицы transactions: Amount и Currency — в валюте
+// заказа, Charged — что списано с кошелька.
+type Transaction struct {
+	OrderID   string
+	UserID    string
+	Amount    int64
+	Currency  string
+	Charged   repository.Charge
+	CreatedAt time.Time
+}
+
+// Hold — строка таблицы holds.
+type Hold struct {
+	OrderID   string
+	UserID    string
+	Amount    int64
+	Currency  string
+	Charged   repository.Charge
+	Status    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Refund — строка таблицы refunds.
+type Refund struct {
+	ID      string
+	OrderID string
+	UserID  string
+	Amount  int64
+	Status  string
+	Reason  string
+}
+
+var errBadRefund = errors.New("refund: refund_id and positive amount are required")
+
+// DefaultHoldTTL — время жизни холда, пока не задано SetHoldTTL.
+const DefaultHoldTTL = 24 * time.Hour
+
+// DefaultPayoutTopic — топик команд на выплату, пока не задан SetPayoutTopic.
+const DefaultPayoutTopic = "payments.payout.requested"
+
+type Store struct {
+	mu           sync.Mutex
+	resultTopic  string
+	holdTTL      time.Duration
+	payoutTopic  string
+	payoutRetry  repository.PayoutRetry
+	rates        repository.RateProvider
+	rounding     string
+	accounts     map[string]*account
+	inbox        map[string]struct{}
+	transactions map[string]Transaction
+	holds        map[string]*Hold
+	refunds      map[string]Refund
+	transfers    map[string]repository.Transfer
+	entries      []repository.TransferEntry
+	withdrawals  map[string]*repository.Withdrawal
+	limits       map[string]repository.Limits
+	audit        []repository.AuditEntry
+	outbox       []*OutboxEntry
+	seq          int64
+}
+
+func New(resultTopic string) *Store {
+	return &Store{
+		resultTopic:  resultTopic,
+		holdTTL:      DefaultHoldTTL,
+		payoutTopic:  DefaultPayoutTopic,
+		payoutRetry:  repository.DefaultPayoutRetry,
+		rounding:     fx.RoundHalfUp,
+		accounts:     map[string]*account{},
+		inbox:        map[string]struct{}{},
+		transactions: map[string]Transaction{},
+		holds:        map[string]*Hold{},
+		refunds:      map[string]Refund{},
+		transfers:    map[string]repository.Transfer{},
+		withdrawals:  map[string]*repository.Withdrawal{},
+		limits:       map[string]repository.Limits{},
+	}
+}
+
+// SetHoldTTL задаёт время жизни новых холдов.
+func (s *Store) SetHoldTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holdTTL = ttl
+}
+
+// SetPayoutTopic задаёт топик команд на выплату.
+func (s *Store) SetPayoutTopic(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payoutTopic = topic
+}
+
+// SetPayoutRetry задаёт расписание повторов выплат, как
+// AccountsRepo.SetPayoutRetry.
+func (s *Store) SetPayoutRetry(p repository.PayoutRetry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payoutRetry = p
+}
+
+// SetFX включает оплату из кошелька в другой валюте, как
+// PaymentProcessor.SetFX.
+func (s *Store) SetFX(rates repository.RateProvider, rounding string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rates, s.rounding = rates, rounding
+}
+
+// account — строка accounts вместе с кошельками счёта.
+type account struct {
+	userID    string
+	currency  string
+	status    string
+	wallets   map[string]*repository.Wallet
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// snapshot собирает repository.Account так же, как AccountsRepo.GetAccount.
+func (a *account) snapshot() repository.Account {
+	out := repository.Account{
+		UserID: a.userID, Currency: a.currency, Status: a.status, CreatedAt: a.createdAt, UpdatedAt: a.updatedAt,
+	}
+	for _, code := range slices.Sorted(maps.Keys(a.wallets)) {
+		out.Wallets = append(out.Wallets, *a.wallets[code])
+	}
+	if w, ok := a.wallets[a.currency]; ok {
+		out.Balance, out.Held = w.Balance, w.Held
+	}
+	return out
+}
+
+// touch отмечает изменение кошелька w счёта a.
+func (a *account) touch(w *repository.Wallet, now time.Time) {
+	w.UpdatedAt = now
+	a.updatedAt = now
+}
+
+func (s *Store) Create(ctx context.Context, userID, currency string, balance int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[userID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	now := time.Now().UTC()
+	s.accounts[userID] = &account{
+		userID: userID, currency: currency, status: repository.AccountActive, createdAt: now, updatedAt: now,
+		wallets: map[string]*repository.Wallet{
+			currency: {Currency: currency, Balance: balance, CreatedAt: now, UpdatedAt: now},
+		},
+	}
+	return nil
+}
+
+func (s *Store) CreateWallet(ctx context.Context, userID, currency string) (repository.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	switch {
+	case !ok:
+		return repository.Account{}, repository.ErrNotFound
+	case a.status == repository.AccountClosed:
+		return repository.Account{}, repository.ErrAccountClosed
+	}
+	if _, ok := a.wallets[currency]; ok {
+		return repository.Account{}, repository.ErrAlreadyExists
+	}
+	now := time.Now().UTC()
+	a.wallets[currency] = &repository.Wallet{Currency: currency, CreatedAt: now, UpdatedAt: now}
+	return a.snapshot(), nil
+}
+
+func (s *Store) TopUp(ctx context.Context, userID, currency string, amount int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	switch {
+	case !ok:
+		return 0, repository.ErrNotFound
+	case a.status == repository.AccountClosed:
+		return 0, repository.ErrAccountClosed
+	}
+	w, ok := a.wallets[currency]
+	if !ok {
+		return 0, repository.ErrCurrencyMismatch
+	}
+	w.Balance += amount
+	a.touch(w, time.Now().UTC())
+	return w.Balance, nil
+}
+
+func (s *Store) GetAccount(ctx context.Context, userID string) (repository.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	if !ok {
+		return repository.Account{}, repository.ErrNotFound
+	}
+	return a.snapshot(), nil
+}
+
+func (s *Store) ChangeStatus(ctx context.Context, userID string, c repository.StatusChange) (repository.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	if !ok {
+		return repository.Account{}, repository.ErrNotFound
+	}
+	if err := repository.CheckTransition(a.status, c.From); err != nil {
+		return repository.Account{}, err
+	}
+	if c.To == repository.AccountClosed && !s.emptyLocked(a) {
+		return repository.Account{}, repository.ErrAccountNotEmpty
+	}
+	now := time.Now().UTC()
+	s.audit = append(s.audit, repository.AuditEntry{
+		UserID: userID, Action: c.Action, From: a.status, To: c.To, Reason: c.Reason, Actor: c.Actor, CreatedAt: now,
+	})
+	a.status = c.To
+	a.updatedAt = now
+	return a.snapshot(), nil
+}
+
+// emptyLocked — у счёта нет денег, холдов и выводов в обработке, как в
+// проверке AccountsRepo.ChangeStatus перед закрытием.
+func (s *Store) emptyLocked(a *account) bool {
+	for _, w := range a.wallets {
+		if w.Balance != 0 || w.Held != 0 {
+			return false
+		}
+	}
+	for _, w := range s.withdrawals {
+		if w.UserID == a.userID && w.Status == repository.WithdrawalPending {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) Transfer(ctx context.Context, t repository.Transfer) (repository.Transfer, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.transfers[t.ID]; ok {
+		if !prev.SameAs(t) {
+			return repository.Transfer{}, false, repository.ErrIdempotencyConflict
+		}
+		return prev, true, nil
+	}
+	from, okFrom := s.accounts[t.FromUserID]
+	to, okTo := s.accounts[t.ToUserID]
+	if !okFrom || !okTo {
+		return repository.Transfer{}, false, repository.ErrNotFound
+	}
+	if err := repository.CheckTransfer(from.snapshot(), to.snapshot(), t.Currency, t.Amount); err != nil {
+		return repository.Transfer{}, false, err
+	}
+
+	now := time.Now().UTC()
+	t.CreatedAt = now
+	fromWallet, toWallet := from.wallets[t.Currency], to.wallets[t.Currency]
+	fromWallet.Balance -= t.Amount
+	toWallet.Balance += t.Amount
+	from.touch(fromWallet, now)
+	to.touch(toWallet, now)
+	s.transfers[t.ID] = t
+	s.entries = append(s.entries,
+		repository.TransferEntry{TransferID: t.ID, UserID: t.FromUserID, Amount: -t.Amount, BalanceAfter: fromWallet.Balance, CreatedAt: now},
+		repository.TransferEntry{TransferID: t.ID, UserID: t.ToUserID, Amount: t.Amount, BalanceAfter: toWallet.Balance, CreatedAt: now},
+	)
+	return t, false, nil
+}
+
+// TransferEntries возвращает проводки transfer_entries в порядке вставки.
+func (s *Store) TransferEntries() []repository.TransferEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.entries)
+}
+
+func (s *Store) CreateWithdrawal(ctx context.Context, userID, currency string, amount int64) (repository.Withdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	if !ok {
+		return repository.Withdrawal{}, repository.ErrNotFound
+	}
+	if err := repository.CheckWithdrawal(a.snapshot(), currency, amount); err != nil {
+		return repository.Withdrawal{}, err
+	}
+
+	now := time.Now().UTC()
+	wallet := a.wallets[currency]
+	wallet.Held += amount
+	a.touch(wallet, now)
+	w := &repository.Withdrawal{
+		ID: uuid.NewString(), UserID: userID, Amount: amount, Currency: currency,
+		Status: repository.WithdrawalPending, Attempts: 1, NextAttemptAt: now.Add(s.payoutRetry.Delay(1)),
+		CreatedAt: now, UpdatedAt: now,
+	}
+	s.withdrawals[w.ID] = w
+	payload, _ := json.Marshal(repository.NewPayoutRequested(*w))
+	s.appendOutboxLocked(s.payoutTopic, w.ID, payload)
+	return *w, nil
+}
+
+func (s *Store) GetWithdrawal(ctx context.Context, id string) (repository.Withdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.withdrawals[id]
+	if !ok {
+		return repository.Withdrawal{}, repository.ErrNotFound
+	}
+	return *w, nil
+}
+
+func (s *Store) CompleteWithdrawal(ctx context.Context, id, status, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.withdrawals[id]
+	if !ok || w.Status != repository.WithdrawalPending {
+		return false, nil
+	}
+	s.completeWithdrawalLocked(w, status, reason, time.Now().UTC())
+	return true, nil
+}
+
+func (s *Store) completeWithdrawalLocked(w *repository.Withdrawal, status, reason string, now time.Time) {
+	w.Status, w.Reason, w.UpdatedAt = status, reason, now
+
+	a := s.accounts[w.UserID]
+	wallet := a.wallets[w.Currency]
+	wallet.Held -= w.Amount
+	if status == repository.WithdrawalSucceeded {
+		wallet.Balance -= w.Amount
+	}
+	a.touch(wallet, now)
+}
+
+func (s *Store) GetLimits(ctx context.Context, userID string) (repository.Limits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	if !ok {
+		return repository.Limits{}, repository.ErrNotFound
+	}
+	if l, ok := s.limits[userID]; ok {
+		return l, nil
+	}
+	return repository.Limits{Currency: a.currency}, nil
+}
+
+func (s *Store) SetLimits(ctx context.Context, userID string, l repository.Limits, loosen bool) (repository.Limits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.accounts[userID]
+	switch {
+	case !ok:
+		return repository.Limits{}, repository.ErrNotFound
+	case a.status == repository.AccountClosed:
+		return repository.Limits{}, repository.ErrAccountClosed
+	}
+	if l.Currency == "" {
+		l.Currency = a.currency
+	}
+	cur, ok := s.limits[userID]
+	if !ok {
+		cur = repository.Limits{Currency: a.currency}
+	}
+	if !loosen && !l.Tightens(cur) {
+		return repository.Limits{}, repository.ErrLimitsLoosened
+	}
+	l.UpdatedAt = time.Now().UTC()
+	s.limits[userID] = l
+	return l, nil
+}
+
+// checkLimitsLocked считает расход счёта так же, как SQL-запрос в
+// PaymentProcessor, и проверяет по нему списание c.
+func (s *Store) checkLimitsLocked(userID string, c repository.Charge) string {
+	l, ok := s.limits[userID]
+	if !ok || l.Unlimited() {
+		return ""
+	}
+	now := time.Now().UTC()
+	var u repository.Usage
+	for _, t := range s.transactions {
+		if _, held := s.holds[t.OrderID]; t.UserID == userID && !held {
+			u.Add(l, t.Charged.Currency, t.Charged.Amount, t.CreatedAt, now)
+		}
+	}
+	for _, h := range s.holds {
+		if h.UserID == userID && (h.Status == repository.HoldActive || h.Status == repository.HoldCaptured) {
+			u.Add(l, h.Charged.Currency, h.Charged.Amount, h.CreatedAt, now)
+		}
+	}
+	return l.Check(c, u)
+}
+
+func (s *Store) RetryPayouts(ctx context.Context, limit int) (resent, failed int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var due []*repository.Withdrawal
+	for _, w := range s.withdrawals {
+		if w.Status == repository.WithdrawalPending && !w.NextAttemptAt.After(now) {
+			due = append(due, w)
+		}
+	}
+	slices.SortFunc(due, func(a, b *repository.Withdrawal) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, w := range due {
+		if w.Attempts >= s.payoutRetry.MaxAttempts {
+			s.completeWithdrawalLocked(w, repository.WithdrawalFailed, repository.ReasonPayoutUnconfirmed, now)
+			failed++
+			continue
+		}
+		w.Attempts++
+		w.NextAttemptAt = now.Add(s.payoutRetry.Delay(w.Attempts))
+		w.UpdatedAt = now
+		payload, _ := json.Marshal(repository.NewPayoutRequested(*w))
+		s.appendOutboxLocked(s.payoutTopic, w.ID, payload)
+		resent++
+	}
+	return resent, failed, nil
+}
+
+// Audit возвращает записи account_audit в порядке вставки.
+func (s *Store) Audit() []repository.AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.audit)
+}
+
+func (s *Store) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
+	var req dto.PaymentRequested
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return false, err
+	}
+
+	req.Currency = money.Or(req.Currency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.inbox[req.MessageID]; ok {
+		return true, nil
+	}
+	s.inbox[req.MessageID] = struct{}{}
+
+	var (
+		res dto.PaymentResult
+		ok  bool
+		err error
+	)
+	switch req.Type {
+	case dto.EventCaptureRequested, dto.EventVoidRequested:
+		res, ok = s.settleLocked(req)
+	case dto.EventRefundRequested:
+		res, ok, err = s.refundLocked(req)
+	default:
+		_, paid := s.transactions[req.OrderID]
+		_, held := s.holds[req.OrderID]
+		if ok = !paid && !held; ok {
+			res, err = s.chargeLocked(ctx, req)
+		}
+	}
+	if err != nil {
+		// как откат транзакции: сообщение не помечено обработанным
+		delete(s.inbox, req.MessageID)
+		return false, err
+	}
+	if !ok {
+		return true, nil
+	}
+
+	if err := s.appendResultLocked(res); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// chargeLocked списывает сумму с кошелька, выбранного QuoteCharge, или, для
+// capture_method=manual, ставит на нём холд, если это позволяют лимиты счёта.
+func (s *Store) chargeLocked(ctx context.Context, req dto.PaymentRequested) (dto.PaymentResult, error) {
+	a, ok := s.accounts[req.UserID]
+	if !ok {
+		return repository.NewPaymentResult(req, "FAILED", repository.ReasonInsufficientFunds), nil
+	}
+	_, hasWallet := a.wallets[req.Currency]
+	c, reason, err := repository.QuoteCharge(ctx, s.rates, s.rounding, req, a.currency, hasWallet)
+	if err != nil {
+		return dto.PaymentResult{}, err
+	}
+	if reason != "" {
+		return repository.NewPaymentResult(req, "FAILED", reason), nil
+	}
+	if reason := s.checkLimitsLocked(req.UserID, c); reason != "" {
+		return repository.NewPaymentResult(req, "FAILED", reason), nil
+	}
+	w, hasWallet := a.wallets[c.Currency]
+	if a.status != repository.AccountActive || !hasWallet || w.Available() < c.Amount {
+		return repository.NewPaymentResult(req, "FAILED", repository.DeclineReason(a.status, hasWallet)), nil
+	}
+
+	now := time.Now().UTC()
+	a.touch(w, now)
+	var res dto.PaymentResult
+	if req.CaptureMethod == dto.CaptureManual {
+		w.Held += c.Amount
+		s.holds[req.OrderID] = &Hold{
+			OrderID: req.OrderID, UserID: req.UserID, Amount: req.Amount, Currency: req.Currency, Charged: c,
+			Status: repository.HoldActive, ExpiresAt: now.Add(s.holdTTL), CreatedAt: now,
+		}
+		res = repository.NewPaymentResult(req, "AUTHORIZED", "")
+	} else {
+		w.Balance -= c.Amount
+		s.transactions[req.OrderID] = Transaction{
+			OrderID: req.OrderID, UserID: req.UserID, Amount: req.Amount, Currency: req.Currency, Charged: c, CreatedAt: now,
+		}
+		res = repository.NewPaymentResult(req, "FINISHED", "")
+	}
+	res.FX = c.FX()
+	return res, nil
+}
+
+// settleLocked подтверждает или отменяет активный холд; ok=false — его нет.
+func (s *Store) settleLocked(req dto.PaymentRequested) (dto.PaymentResult, bool) {
+	h, ok := s.holds[req.OrderID]
+	if !ok || h.Status != repository.HoldActive {
+		return dto.PaymentResult{}, false
+	}
+	req.UserID, req.Amount, req.Currency = h.UserID, h.Amount, h.Currency
+	a := s.accounts[h.UserID]
+	w := a.wallets[h.Charged.Currency]
+	w.Held -= h.Charged.Amount
+	now := time.Now().UTC()
+	a.touch(w, now)
+
+	if req.Type == dto.EventVoidRequested {
+		h.Status = repository.HoldVoided
+		return repository.NewPaymentResult(req, "VOIDED", repository.ReasonVoidRequested), true
+	}
+	h.Status = repository.HoldCaptured
+	w.Balance -= h.Charged.Amount
+	s.transactions[req.OrderID] = Transaction{
+		OrderID: req.OrderID, UserID: h.UserID, Amount: h.Amount, Currency: h.Currency, Charged: h.Charged, CreatedAt: now,
+	}
+	res := repository.NewPaymentResult(req, "FINISHED", "")
+	res.FX = h.Charged.FX()
+	return res, true
+}
+
+// refundLocked возвращает часть оплаты заказа; ok=false — возврат с этим id
+// уже обработан.
+func (s *Store) refundLocked(req dto.PaymentRequested) (dto.PaymentResult, bool, error) {
+	if req.RefundID == "" || req.Amount <= 0 {
+		return dto.PaymentResult{}, false, errBadRefund
+	}
+	if _, ok := s.refunds[req.RefundID]; ok {
+		return dto.PaymentResult{}, false, nil
+	}
+
+	var refunded int64
+	reason := ""
+	if t, ok := s.transactions[req.OrderID]; !ok {
+		reason = repository.ReasonOrderNotPaid
+	} else {
+		req.UserID = t.UserID
+		for _, r := range s.refunds {
+			if r.OrderID == req.OrderID && r.Status == dto.RefundSucceeded {
+				refunded += r.Amount
+			}
+		}
+		a, exists := s.accounts[t.UserID]
+		switch {
+		case t.Currency != req.Currency:
+			reason = repository.ReasonCurrencyMismatch
+		case req.Amount > t.Amount-refunded:
+			reason = repository.ReasonRefundExceedsAmount
+		case !exists || a.status == repository.AccountClosed:
+			reason = repository.ReasonAccountClosed
+		default:
+			w := a.wallets[t.Charged.Currency]
+			w.Balance += fx.Prorate(refunded+req.Amount, t.Amount, t.Charged.Amount) - fx.Prorate(refunded, t.Amount, t.Charged.Amount)
+			a.touch(w, time.Now().UTC())
+			refunded += req.Amount
+		}
+	}
+
+	status := dto.RefundSucceeded
+	if reason != "" {
+		status = dto.RefundRejected
+	}
+	s.refunds[req.RefundID] = Refund{
+		ID: req.RefundID, OrderID: req.OrderID, UserID: req.UserID, Amount: req.Amount, Status: status, Reason: reason,
+	}
+	return repository.NewRefundResult(req, status, reason, refunded), true, nil
+}
+
+func (s *Store) ExpireHolds(ctx context.Context, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*Hold
+	for _, h := range s.holds {
+		if h.Status == repository.HoldActive && !h.ExpiresAt.After(now) {
+			due = append(due, h)
+		}
+	}
+	slices.SortFunc(due, func(a, b *Hold) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, h := range due {
+		h.Status = repository.HoldExpired
+		a := s.accounts[h.UserID]
+		w := a.wallets[h.Charged.Currency]
+		w.Held -= h.Charged.Amount
+		a.touch(w, now.UTC())
+		if err := s.appendResultLocked(repository.NewExpiryResult(h.OrderID, h.UserID, h.Currency, h.Amount)); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// Holds возвращает копию холдов по заказам.
+func (s *Store) Holds() map[string]Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]Hold, len(s.holds))
+	for k, v := range s.holds {
+		out[k] = *v
+	}
+	return out
+}
+
+// Refunds возвращает копию возвратов по id.
+func (s *Store) Refunds() map[string]Refund {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.refunds)
+}
+
+func (s *Store) appendResultLocked(res dto.PaymentResult) error {
+	payload, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	s.appendOutboxLocked(s.resultTopic, res.OrderID, payload)
+	return nil
+}
+
+// Transactions возвращает списания по заказам.
+func (s *Store) Transactions() map[string]Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]Transaction, len(s.transactions))
+	for k, v := range s.transactions {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Store) LockBatch(ctx context.Context, limit int, lockTTL time.Duration) ([]repository.OutboxRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var batch []repository.OutboxRecord
+	for _, e := range s.outbox {
+		if len(batch) == limit {
+			break
+		}
+		if !e.ProcessedAt.IsZero() || e.NextRetryAt.After(now) || e.LockedUntil.After(now) {
+			continue
+		}
+		e.LockedUntil = now.Add(lockTTL)
+		batch = append(batch, e.OutboxRecord)
+	}
+	return batch, nil
+}
+
+func (s *Store) MarkSent(ctx context.Context, id int64) error {
+	return s.updateOutbox(id, func(e *OutboxEntry) {
+		e.ProcessedAt = time.Now()
+		e.LockedUntil = time.Time{}
+		e.LastError = ""
+	})
+}
+
+func (s *Store) MarkFailed(ctx context.Context, id int64, cause string, backoff time.Duration) error {
+	return s.updateOutbox(id, func(e *OutboxEntry) {
+		e.Attempts++
+		e.NextRetryAt = time.Now().Add(time.Duration(e.Attempts) * backoff)
+		e.LastError = cause
+		e.LockedUntil = time.Time{}
+	})
+}
+
+func (s *Store) Release(ctx context.Context, ids []int64) error {
+	for _, id := range ids {
+		_ = s.updateOutbox(id, func(e *OutboxEntry) {
+			if e.ProcessedAt.IsZero() {
+				e.LockedUntil = time.Time{}
+			}
+		})
+	}
+	return nil
+}
+
+// Outbox возвращает копию всех записей outbox в порядке вставки.
+func (s *Store) Outbox() []OutboxEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]OutboxEntry, 0, len(s.outbox))
+	for _, e := range s.outbox {
+		out = append(out, *e)
+	}
+	return out
+}
+
+func (s *Store) appendOutboxLocked(topic, key string, payload []byte) {
+	s.seq++
+	s.outbox = append(s.outbox, &OutboxEntry{
+		OutboxRecord: repository.OutboxRecord{ID: s.seq, Topic: topic, Key: key, Payload: payload},
+	})
+}
+
+func (s *Store) updateOutbox(id int64, fn func(e *OutboxEntry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.outbox {
+		if e.ID == id {
+			fn(e)
+			return nil
+		}
+	}
+	return nil
+}
@@ -4,34 +4,183 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/google/uuid"
+
+	"HW4/internal/common/money"
 	"HW4/internal/payments/dto"
+	"HW4/internal/payments/fx"
+)
+
+// Причины отказа в PaymentResult.Reason.
+const (
+	ReasonInsufficientFunds = "insufficient_funds_or_account_missing"
+	ReasonAccountFrozen     = "account_frozen"
+	ReasonAccountClosed     = "account_closed"
+	// ReasonCurrencyMismatch — у счёта нет кошелька в валюте заказа.
+	ReasonCurrencyMismatch = "currency_mismatch"
+)
+
+// Причины в PaymentResult.Reason для статуса VOIDED.
+const (
+	ReasonVoidRequested = "void_requested"
+	ReasonHoldExpired   = "hold_expired"
+)
+
+// Причины отказа в возврате.
+const (
+	ReasonRefundExceedsAmount = "refund_exceeds_amount"
+	ReasonOrderNotPaid        = "order_not_paid"
+)
+
+// errBadRefund — команда возврата без id или с неположительной суммой; такое
+// сообщение уйдёт через retry в DLQ.
+var errBadRefund = errors.New("refund: refund_id and positive amount are required")
+
+// Статусы холда. Из ACTIVE холд уходит ровно один раз: capture списывает
+// сумму, void и истечение TTL возвращают её в доступный баланс.
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldVoided   = "VOIDED"
+	HoldExpired  = "EXPIRED"
 )
 
+// DeclineReason — причина отказа в списании со счёта в статусе status;
+// hasWallet — есть ли у счёта кошелёк в валюте списания. Пустой status —
+// счёта нет.
+func DeclineReason(status string, hasWallet bool) string {
+	switch {
+	case status == AccountFrozen:
+		return ReasonAccountFrozen
+	case status == AccountClosed:
+		return ReasonAccountClosed
+	case status != "" && !hasWallet:
+		return ReasonCurrencyMismatch
+	default:
+		return ReasonInsufficientFunds
+	}
+}
+
+// RateProvider отдаёт курс для оплаты заказа в валюте from из кошелька в
+// валюте to. fx.ErrNoRate — курса нет, заказ отклоняется как currency_mismatch;
+// другие ошибки — повод повторить обработку команды.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (fx.Rate, error)
+}
+
+// Charge — что списывается или холдируется в кошельке плательщика: сумма
+// заказа в его валюте или, при оплате из кошелька другой валюты, сумма после
+// конвертации и курс.
+type Charge struct {
+	Amount   int64
+	Currency string
+	// Rate — курс из валюты заказа в Currency; пусто — без конвертации.
+	Rate string
+}
+
+// FX — детали конвертации для PaymentResult; nil, если её не было.
+func (c Charge) FX() *dto.FX {
+	if c.Rate == "" {
+		return nil
+	}
+	return &dto.FX{Rate: c.Rate, ChargedAmount: c.Amount, ChargedCurrency: c.Currency}
+}
+
+// QuoteCharge выбирает кошелёк для оплаты req. Если у счёта есть кошелёк в
+// валюте заказа (hasWallet), платим из него. Иначе, если задан rates, — из
+// основного кошелька primary по курсу с округлением rounding. Если курса нет,
+// остаётся валюта заказа, и списание отклонится как currency_mismatch.
+// Непустой reason — отказ до списания.
+func QuoteCharge(ctx context.Context, rates RateProvider, rounding string, req dto.PaymentRequested, primary string, hasWallet bool) (Charge, string, error) {
+	c := Charge{Amount: req.Amount, Currency: req.Currency}
+	if hasWallet || rates == nil || primary == "" || primary == req.Currency {
+		return c, "", nil
+	}
+	rate, err := rates.Rate(ctx, req.Currency, primary)
+	if errors.Is(err, fx.ErrNoRate) {
+		return c, "", nil
+	}
+	if err != nil {
+		return Charge{}, "", err
+	}
+	amount, err := rate.Convert(req.Amount, rounding)
+	if errors.Is(err, fx.ErrOutOfRange) {
+		return Charge{}, ReasonInsufficientFunds, nil
+	}
+	if err != nil {
+		return Charge{}, "", err
+	}
+	return Charge{Amount: amount, Currency: primary, Rate: rate.Value}, "", nil
+}
+
 type PaymentProcessor struct {
 	db          *sql.DB
 	resultTopic string
+	holdTTL     time.Duration
+	rates       RateProvider
+	rounding    string
 }
 
-func NewPaymentProcessor(db *sql.DB, resultTopic string) *PaymentProcessor {
+// NewPaymentProcessor: holdTTL — время жизни холда для заказов с
+// capture_method=manual, после него холд снимает ExpireHolds.
+func NewPaymentProcessor(db *sql.DB, resultTopic string, holdTTL time.Duration) *PaymentProcessor {
 	if resultTopic == "" {
 		panic("resultTopic is empty")
 	}
-	return &PaymentProcessor{db: db, resultTopic: resultTopic}
+	return &PaymentProcessor{db: db, resultTopic: resultTopic, holdTTL: holdTTL, rounding: fx.RoundHalfUp}
 }
 
-func (p *PaymentProcessor) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
-	var req struct {
-		MessageID string `json:"message_id"`
-		OrderID   string `json:"order_id"`
-		UserID    string `json:"user_id"`
-		Amount    int64  `json:"amount"`
-		CreatedAt string `json:"created_at"`
+// SetFX включает оплату из кошелька в другой валюте: курсы берутся из rates,
+// суммы округляются по rounding (fx.RoundHalfUp и др.). Без вызова заказ
+// оплачивается только из кошелька своей валюты.
+func (p *PaymentProcessor) SetFX(rates RateProvider, rounding string) {
+	p.rates, p.rounding = rates, rounding
+}
+
+// NewPaymentResult формирует событие результата оплаты для запроса req.
+func NewPaymentResult(req dto.PaymentRequested, status, reason string) dto.PaymentResult {
+	return dto.PaymentResult{
+		MessageID: req.MessageID,
+		OrderID:   req.OrderID,
+		UserID:    req.UserID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Status:    status,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
 	}
+}
+
+// NewExpiryResult — результат для холда, снятого по TTL: запроса на него
+// не было, поэтому message_id новый.
+func NewExpiryResult(orderID, userID, currency string, amount int64) dto.PaymentResult {
+	req := dto.PaymentRequested{MessageID: uuid.NewString(), OrderID: orderID, UserID: userID, Amount: amount, Currency: currency}
+	return NewPaymentResult(req, "VOIDED", ReasonHoldExpired)
+}
+
+// NewRefundResult формирует результат возврата; refunded — сколько всего
+// возвращено по заказу с учётом этого возврата.
+func NewRefundResult(req dto.PaymentRequested, status, reason string, refunded int64) dto.PaymentResult {
+	res := NewPaymentResult(req, status, reason)
+	res.Type = dto.EventRefundResult
+	res.RefundID = req.RefundID
+	res.RefundedAmount = refunded
+	return res
+}
+
+// HandlePaymentRequested обрабатывает команду из топика запросов на оплату:
+// списание или холд (EventPaymentRequested), capture или void холда, возврат.
+// Деньги движутся в кошельке валюты заказа или, если его нет и включён FX, в
+// основном кошельке по курсу (см. QuoteCharge).
+func (p *PaymentProcessor) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
+	var req dto.PaymentRequested
 	if err := json.Unmarshal(raw, &req); err != nil {
 		return false, err
 	}
+	req.Currency = money.Or(req.Currency)
 
 	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
@@ -44,58 +193,364 @@ func (p *PaymentProcessor) HandlePaymentRequested(ctx context.Context, raw []byt
 		return true, tx.Commit()
 	}
 
-	var existing string
-	err = tx.QueryRowContext(ctx, `SELECT order_id FROM transactions WHERE order_id=$1`, req.OrderID).Scan(&existing)
-	if err == nil {
+	var (
+		res dto.PaymentResult
+		ok  bool
+	)
+	switch req.Type {
+	case dto.EventCaptureRequested, dto.EventVoidRequested:
+		res, ok, err = p.settle(ctx, tx, req)
+	case dto.EventRefundRequested:
+		res, ok, err = p.refund(ctx, tx, req)
+	default:
+		res, ok, err = p.pay(ctx, tx, req)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		// команда по заказу уже выполнена, результат по ней отправлен раньше
 		return true, tx.Commit()
 	}
-	if err != sql.ErrNoRows {
+
+	if err := p.writeResult(ctx, tx, res); err != nil {
 		return false, err
 	}
+	return false, tx.Commit()
+}
 
+// pay списывает сумму или ставит холд, если по заказу ещё не было ни того,
+// ни другого. Лимиты счёта проверяются в той же транзакции, до списания.
+func (p *PaymentProcessor) pay(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested) (dto.PaymentResult, bool, error) {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM transactions WHERE order_id=$1)
+		    OR EXISTS (SELECT 1 FROM holds WHERE order_id=$1)
+	`, req.OrderID).Scan(&exists)
+	if err != nil || exists {
+		return dto.PaymentResult{}, false, err
+	}
+
+	c, reason, err := p.quote(ctx, tx, req)
+	if err == nil && reason == "" {
+		reason, err = checkLimits(ctx, tx, req.UserID, c)
+	}
+	if err != nil {
+		return dto.PaymentResult{}, false, err
+	}
+	if reason != "" {
+		return NewPaymentResult(req, "FAILED", reason), true, nil
+	}
+
+	var res dto.PaymentResult
+	if req.CaptureMethod == dto.CaptureManual {
+		res, err = p.authorize(ctx, tx, req, c)
+	} else {
+		res, err = p.charge(ctx, tx, req, c)
+	}
+	return res, err == nil, err
+}
+
+// quote выбирает кошелёк и сумму списания. Без FX запрос к счёту не нужен:
+// платим в валюте заказа.
+func (p *PaymentProcessor) quote(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested) (Charge, string, error) {
+	if p.rates == nil {
+		return Charge{Amount: req.Amount, Currency: req.Currency}, "", nil
+	}
+	var (
+		primary   string
+		hasWallet bool
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT a.currency, EXISTS (SELECT 1 FROM wallets w WHERE w.user_id = a.user_id AND w.currency = $2)
+		FROM accounts a WHERE a.user_id=$1
+	`, req.UserID, req.Currency).Scan(&primary, &hasWallet)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Charge{}, "", err
+	}
+	return QuoteCharge(ctx, p.rates, p.rounding, req, primary, hasWallet)
+}
+
+// charge списывает сумму c с кошелька сразу. Строка счёта берётся FOR SHARE:
+// смена статуса дождётся конца списания.
+func (p *PaymentProcessor) charge(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested, c Charge) (dto.PaymentResult, error) {
 	res, err := tx.ExecContext(ctx, `
-		UPDATE accounts
+		UPDATE wallets
 		SET balance = balance - $1, updated_at = now()
-		WHERE user_id = $2 AND balance >= $1
-	`, req.Amount, req.UserID)
+		WHERE user_id = $2 AND currency = $3 AND balance - held >= $1
+		  AND EXISTS (SELECT 1 FROM accounts WHERE user_id = $2 AND status = 'ACTIVE' FOR SHARE)
+	`, c.Amount, req.UserID, c.Currency)
 	if err != nil {
-		return false, err
+		return dto.PaymentResult{}, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return p.decline(ctx, tx, req, c.Currency)
+	}
+
+	if err := insertTransaction(ctx, tx, req, c); err != nil {
+		return dto.PaymentResult{}, err
+	}
+	out := NewPaymentResult(req, "FINISHED", "")
+	out.FX = c.FX()
+	return out, nil
+}
+
+// authorize резервирует сумму c холдом на holdTTL.
+func (p *PaymentProcessor) authorize(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested, c Charge) (dto.PaymentResult, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE wallets
+		SET held = held + $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3 AND balance - held >= $1
+		  AND EXISTS (SELECT 1 FROM accounts WHERE user_id = $2 AND status = 'ACTIVE' FOR SHARE)
+	`, c.Amount, req.UserID, c.Currency)
+	if err != nil {
+		return dto.PaymentResult{}, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return p.decline(ctx, tx, req, c.Currency)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO holds(order_id, user_id, amount, currency, charged_amount, charged_currency, fx_rate, status, expires_at)
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,'')::numeric,'ACTIVE', now() + $8 * interval '1 millisecond')
+	`, req.OrderID, req.UserID, req.Amount, req.Currency, c.Amount, c.Currency, c.Rate, p.holdTTL.Milliseconds())
+	if err != nil {
+		return dto.PaymentResult{}, err
+	}
+	out := NewPaymentResult(req, "AUTHORIZED", "")
+	out.FX = c.FX()
+	return out, nil
+}
+
+func insertTransaction(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested, c Charge) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO transactions(order_id, user_id, amount, currency, charged_amount, charged_currency, fx_rate)
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,'')::numeric)
+	`, req.OrderID, req.UserID, req.Amount, req.Currency, c.Amount, c.Currency, c.Rate)
+	return err
+}
+
+// decline — отказ: узнаём, из-за статуса счёта, валюты или денег. currency —
+// валюта кошелька, из которого пытались списать.
+func (p *PaymentProcessor) decline(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested, currency string) (dto.PaymentResult, error) {
+	var (
+		status    string
+		hasWallet bool
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT a.status, EXISTS (SELECT 1 FROM wallets w WHERE w.user_id = a.user_id AND w.currency = $2)
+		FROM accounts a WHERE a.user_id=$1
+	`, req.UserID, currency).Scan(&status, &hasWallet)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return dto.PaymentResult{}, err
+	}
+	return NewPaymentResult(req, "FAILED", DeclineReason(status, hasWallet)), nil
+}
+
+// settle подтверждает или отменяет активный холд заказа. Сумму, валюту,
+// кошелёк и курс берёт из холда, а не из команды. ok=false — активного холда
+// нет.
+func (p *PaymentProcessor) settle(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested) (dto.PaymentResult, bool, error) {
+	capture := req.Type == dto.EventCaptureRequested
+	to := HoldVoided
+	if capture {
+		to = HoldCaptured
+	}
+
+	var c Charge
+	err := tx.QueryRowContext(ctx, `
+		UPDATE holds SET status = $2, updated_at = now()
+		WHERE order_id = $1 AND status = 'ACTIVE'
+		RETURNING user_id, amount, currency, charged_amount, charged_currency, COALESCE(fx_rate::text, '')
+	`, req.OrderID, to).Scan(&req.UserID, &req.Amount, &req.Currency, &c.Amount, &c.Currency, &c.Rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.PaymentResult{}, false, nil
+	}
+	if err != nil {
+		return dto.PaymentResult{}, false, err
 	}
-	affected, _ := res.RowsAffected()
 
-	status := "FINISHED"
+	if !capture {
+		if err := releaseHold(ctx, tx, req.UserID, c.Currency, c.Amount); err != nil {
+			return dto.PaymentResult{}, false, err
+		}
+		return NewPaymentResult(req, "VOIDED", ReasonVoidRequested), true, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE wallets
+		SET balance = balance - $1, held = held - $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+	`, c.Amount, req.UserID, c.Currency)
+	if err != nil {
+		return dto.PaymentResult{}, false, err
+	}
+	if err := insertTransaction(ctx, tx, req, c); err != nil {
+		return dto.PaymentResult{}, false, err
+	}
+	res := NewPaymentResult(req, "FINISHED", "")
+	res.FX = c.FX()
+	return res, true, nil
+}
+
+// refund возвращает на счёт плательщика часть суммы оплаченного заказа — в
+// кошелёк, с которого заказ оплачен. Возврат в другой валюте отклоняется.
+// Если оплата шла с конвертацией, зачисляется доля фактического списания
+// (fx.Prorate), а не пересчёт по текущему курсу.
+// Строка transactions блокируется, поэтому параллельные возвраты по заказу
+// проверяются по очереди и в сумме не превысят оплату. Отклонённый возврат
+// тоже записывается в refunds. ok=false — возврат с этим id уже обработан.
+func (p *PaymentProcessor) refund(ctx context.Context, tx *sql.Tx, req dto.PaymentRequested) (dto.PaymentResult, bool, error) {
+	if req.RefundID == "" || req.Amount <= 0 {
+		return dto.PaymentResult{}, false, errBadRefund
+	}
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM refunds WHERE id=$1)`, req.RefundID).Scan(&exists)
+	if err != nil || exists {
+		return dto.PaymentResult{}, false, err
+	}
+
+	var (
+		paid, refunded int64
+		paidCurrency   string
+		c              Charge
+	)
 	reason := ""
-	if affected == 0 {
-		status = "FAILED"
-		reason = "insufficient_funds_or_account_missing"
-	} else {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO transactions(order_id, user_id, amount)
-			VALUES ($1,$2,$3)
-		`, req.OrderID, req.UserID, req.Amount)
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, amount, currency, charged_amount, charged_currency
+		FROM transactions WHERE order_id=$1 FOR UPDATE
+	`, req.OrderID).Scan(&req.UserID, &paid, &paidCurrency, &c.Amount, &c.Currency)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		reason = ReasonOrderNotPaid
+	case err != nil:
+		return dto.PaymentResult{}, false, err
+	default:
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id=$1 AND status='SUCCEEDED'
+		`, req.OrderID).Scan(&refunded)
 		if err != nil {
-			return false, err
+			return dto.PaymentResult{}, false, err
+		}
+		switch {
+		case paidCurrency != req.Currency:
+			reason = ReasonCurrencyMismatch
+		case req.Amount > paid-refunded:
+			reason = ReasonRefundExceedsAmount
+		default:
+			amount := fx.Prorate(refunded+req.Amount, paid, c.Amount) - fx.Prorate(refunded, paid, c.Amount)
+			reason, err = credit(ctx, tx, req.UserID, c.Currency, amount)
+		}
+		if err != nil {
+			return dto.PaymentResult{}, false, err
+		}
+		if reason == "" {
+			refunded += req.Amount
 		}
 	}
 
-	ev := dto.PaymentResult{
-		MessageID: req.MessageID,
-		OrderID:   req.OrderID,
-		UserID:    req.UserID,
-		Amount:    req.Amount,
-		Status:    status,
-		Reason:    reason,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	status := dto.RefundSucceeded
+	if reason != "" {
+		status = dto.RefundRejected
 	}
-	payload, _ := json.Marshal(ev)
-
 	_, err = tx.ExecContext(ctx, `
-		INSERT INTO outbox(topic, key, payload)
-		VALUES ($1,$2,$3)
-	`, p.resultTopic, req.OrderID, payload)
+		INSERT INTO refunds(id, order_id, user_id, amount, status, reason)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, req.RefundID, req.OrderID, req.UserID, req.Amount, status, reason)
 	if err != nil {
-		return false, err
+		return dto.PaymentResult{}, false, err
 	}
+	return NewRefundResult(req, status, reason, refunded), true, nil
+}
 
-	return false, tx.Commit()
+// credit зачисляет возврат в кошелёк currency. Возвращает причину отказа или
+// пустую строку.
+func credit(ctx context.Context, tx *sql.Tx, userID, currency string, amount int64) (string, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE wallets SET balance = balance + $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+		  AND EXISTS (SELECT 1 FROM accounts WHERE user_id = $2 AND status <> 'CLOSED' FOR SHARE)
+	`, amount, userID, currency)
+	if err != nil {
+		return "", err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ReasonAccountClosed, nil
+	}
+	return "", nil
+}
+
+// ExpireHolds снимает до limit холдов с истёкшим TTL и пишет по каждому
+// результат VOIDED с причиной hold_expired. Возвращает число снятых холдов.
+func (p *PaymentProcessor) ExpireHolds(ctx context.Context, limit int) (int, error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH picked AS (
+			SELECT order_id
+			FROM holds
+			WHERE status = 'ACTIVE' AND expires_at <= now()
+			ORDER BY expires_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT $1
+		)
+		UPDATE holds h
+		SET status = 'EXPIRED', updated_at = now()
+		FROM picked
+		WHERE h.order_id = picked.order_id
+		RETURNING h.order_id, h.user_id, h.currency, h.amount, h.charged_currency, h.charged_amount
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		expired []dto.PaymentResult
+		charges []Charge
+	)
+	for rows.Next() {
+		var orderID, userID, currency string
+		var amount int64
+		var c Charge
+		if err := rows.Scan(&orderID, &userID, &currency, &amount, &c.Currency, &c.Amount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, NewExpiryResult(orderID, userID, currency, amount))
+		charges = append(charges, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, res := range expired {
+		if err := releaseHold(ctx, tx, res.UserID, charges[i].Currency, charges[i].Amount); err != nil {
+			return 0, err
+		}
+		if err := p.writeResult(ctx, tx, res); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), tx.Commit()
+}
+
+func releaseHold(ctx context.Context, tx *sql.Tx, userID, currency string, amount int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE wallets SET held = held - $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+	`, amount, userID, currency)
+	return err
+}
+
+func (p *PaymentProcessor) writeResult(ctx context.Context, tx *sql.Tx, res dto.PaymentResult) error {
+	payload, _ := json.Marshal(res)
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox(topic, key, payload)
+		VALUES ($1,$2,$3)
+	`, p.resultTopic, res.OrderID, payload)
+	return err
 }
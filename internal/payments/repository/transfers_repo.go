@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Transfer — перевод между кошельками двух счетов в валюте Currency. ID
+// задаёт клиент, он же ключ идемпотентности.
+type Transfer struct {
+	ID         string
+	FromUserID string
+	ToUserID   string
+	Amount     int64
+	Currency   string
+	CreatedAt  time.Time
+}
+
+// SameAs — t повторяет перевод o: те же счета, сумма и валюта.
+func (t Transfer) SameAs(o Transfer) bool {
+	return t.FromUserID == o.FromUserID && t.ToUserID == o.ToUserID && t.Amount == o.Amount && t.Currency == o.Currency
+}
+
+// TransferEntry — проводка в истории переводов: списание (Amount < 0) или
+// зачисление. BalanceAfter — баланс кошелька сразу после проводки.
+type TransferEntry struct {
+	TransferID   string
+	UserID       string
+	Amount       int64
+	BalanceAfter int64
+	CreatedAt    time.Time
+}
+
+// CheckTransfer проверяет счета перевода: from должен быть ACTIVE и иметь
+// доступными amount в валюте currency, to — не закрыт (замороженный счёт
+// принимает деньги, как и пополнения). Кошелёк в currency нужен обоим.
+func CheckTransfer(from, to Account, currency string, amount int64) error {
+	fromWallet, fromOK := from.Wallet(currency)
+	_, toOK := to.Wallet(currency)
+	switch {
+	case from.Status == AccountFrozen:
+		return ErrAccountFrozen
+	case from.Status == AccountClosed || to.Status == AccountClosed:
+		return ErrAccountClosed
+	case !fromOK || !toOK:
+		return ErrCurrencyMismatch
+	case fromWallet.Available() < amount:
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// Transfer списывает t.Amount с кошелька t.FromUserID в валюте t.Currency и
+// зачисляет на кошелёк t.ToUserID в той же валюте в одной транзакции и пишет обе проводки в transfer_entries. Счета
+// блокируются в порядке user_id, поэтому встречные переводы не
+// взаимоблокируются. Повтор с тем же id возвращает исходный перевод и
+// replayed=true, с другими счетами, суммой или валютой — ErrIdempotencyConflict.
+func (r *AccountsRepo) Transfer(ctx context.Context, t Transfer) (Transfer, bool, error) {
+	if prev, ok, err := r.findTransfer(ctx, t); ok || err != nil {
+		return prev, ok, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	defer tx.Rollback()
+
+	accounts := map[string]Account{}
+	for _, userID := range slices.Sorted(slices.Values([]string{t.FromUserID, t.ToUserID})) {
+		a, err := lockAccount(ctx, tx, userID)
+		if err != nil {
+			return Transfer{}, false, err
+		}
+		accounts[userID] = a
+	}
+	if err := CheckTransfer(accounts[t.FromUserID], accounts[t.ToUserID], t.Currency, t.Amount); err != nil {
+		return Transfer{}, false, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO transfers(id, from_user_id, to_user_id, amount, currency)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING created_at
+	`, t.ID, t.FromUserID, t.ToUserID, t.Amount, t.Currency).Scan(&t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// параллельный запрос с тем же id успел раньше
+		_ = tx.Rollback()
+		return r.findTransfer(ctx, t)
+	}
+	if err != nil {
+		return Transfer{}, false, err
+	}
+
+	// та же проверка, что у PaymentProcessor при списании
+	var fromBalance, toBalance int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE wallets SET balance = balance - $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3 AND balance - held >= $1
+		RETURNING balance
+	`, t.Amount, t.FromUserID, t.Currency).Scan(&fromBalance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transfer{}, false, ErrInsufficientFunds
+	}
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE wallets SET balance = balance + $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+		RETURNING balance
+	`, t.Amount, t.ToUserID, t.Currency).Scan(&toBalance)
+	if err != nil {
+		return Transfer{}, false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO transfer_entries(transfer_id, user_id, amount, balance_after, created_at)
+		VALUES ($1,$2,$3,$4,$6), ($1,$5,$7,$8,$6)
+	`, t.ID, t.FromUserID, -t.Amount, fromBalance, t.ToUserID, t.CreatedAt, t.Amount, toBalance)
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	return t, false, tx.Commit()
+}
+
+// findTransfer ищет уже проведённый перевод с id t.ID; ok=false — такого нет.
+func (r *AccountsRepo) findTransfer(ctx context.Context, t Transfer) (Transfer, bool, error) {
+	prev := Transfer{ID: t.ID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT from_user_id, to_user_id, amount, currency, created_at FROM transfers WHERE id=$1
+	`, t.ID).Scan(&prev.FromUserID, &prev.ToUserID, &prev.Amount, &prev.Currency, &prev.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Transfer{}, false, nil
+	case err != nil:
+		return Transfer{}, false, err
+	case !prev.SameAs(t):
+		return Transfer{}, false, ErrIdempotencyConflict
+	}
+	return prev, true, nil
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"HW4/internal/payments/dto"
+)
+
+// Статусы вывода средств.
+const (
+	WithdrawalPending   = "PENDING"
+	WithdrawalSucceeded = "SUCCEEDED"
+	WithdrawalFailed    = "FAILED"
+)
+
+// Причины в Withdrawal.Reason для статуса FAILED.
+const (
+	// ReasonPayoutFailed — провайдер отказал в выплате.
+	ReasonPayoutFailed = "payout_failed"
+	// ReasonPayoutUnconfirmed — провайдер так и не ответил за
+	// PayoutRetry.MaxAttempts отправок.
+	ReasonPayoutUnconfirmed = "payout_unconfirmed"
+)
+
+// Withdrawal — вывод средств с кошелька в валюте Currency. Пока он PENDING,
+// Amount захолдирован: в том числе когда провайдер не ответил и неизвестно,
+// ушли ли деньги. Attempts — сколько раз команда на выплату ушла провайдеру,
+// NextAttemptAt — когда отправить её снова, если ответа так и нет.
+type Withdrawal struct {
+	ID            string
+	UserID        string
+	Amount        int64
+	Currency      string
+	Status        string
+	Reason        string
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// PayoutRetry — расписание повторов выплаты, исход которой неизвестен.
+// Первый повтор — через Backoff после создания вывода, каждый следующий —
+// вдвое позже предыдущего, но не позже чем через MaxBackoff. Вывод, который
+// ушёл провайдеру MaxAttempts раз и так и остался PENDING, переводится в
+// FAILED с причиной ReasonPayoutUnconfirmed, холд снимается.
+type PayoutRetry struct {
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+// DefaultPayoutRetry — расписание повторов, пока не задано SetPayoutRetry.
+var DefaultPayoutRetry = PayoutRetry{Backoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 10}
+
+// Delay возвращает паузу после attempts-й отправки команды.
+func (p PayoutRetry) Delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// CheckWithdrawal проверяет, можно ли вывести amount в валюте currency со
+// счёта a: вывод, как и списание, требует ACTIVE и достаточно доступных
+// средств в кошельке этой валюты.
+func CheckWithdrawal(a Account, currency string, amount int64) error {
+	w, ok := a.Wallet(currency)
+	switch {
+	case a.Status == AccountFrozen:
+		return ErrAccountFrozen
+	case a.Status == AccountClosed:
+		return ErrAccountClosed
+	case !ok:
+		return ErrCurrencyMismatch
+	case w.Available() < amount:
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// NewPayoutRequested формирует команду на выплату по выводу w.
+func NewPayoutRequested(w Withdrawal) dto.PayoutRequested {
+	return dto.PayoutRequested{
+		MessageID:    uuid.NewString(),
+		WithdrawalID: w.ID,
+		UserID:       w.UserID,
+		Amount:       w.Amount,
+		Currency:     w.Currency,
+		CreatedAt:    w.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// CreateWithdrawal холдирует amount на кошельке userID в валюте currency,
+// создаёт вывод в статусе PENDING и пишет команду на выплату в outbox — всё
+// в одной транзакции.
+func (r *AccountsRepo) CreateWithdrawal(ctx context.Context, userID, currency string, amount int64) (Withdrawal, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	defer tx.Rollback()
+
+	a, err := lockAccount(ctx, tx, userID)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	if err := CheckWithdrawal(a, currency, amount); err != nil {
+		return Withdrawal{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE wallets SET held = held + $1, updated_at = now()
+		WHERE user_id = $2 AND currency = $3
+	`, amount, userID, currency)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+
+	w := Withdrawal{ID: uuid.NewString(), UserID: userID, Amount: amount, Currency: currency, Status: WithdrawalPending, Attempts: 1}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO withdrawals(id, user_id, amount, currency, status, attempts, next_attempt_at)
+		VALUES ($1,$2,$3,$4,$5,$6, now() + $7 * interval '1 millisecond')
+		RETURNING next_attempt_at, created_at, updated_at
+	`, w.ID, w.UserID, w.Amount, w.Currency, w.Status, w.Attempts, r.payoutRetry.Delay(w.Attempts).Milliseconds()).
+		Scan(&w.NextAttemptAt, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+
+	payload, _ := json.Marshal(NewPayoutRequested(w))
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox(topic, key, payload)
+		VALUES ($1,$2,$3)
+	`, r.payoutTopic, w.ID, payload)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	return w, tx.Commit()
+}
+
+func (r *AccountsRepo) GetWithdrawal(ctx context.Context, id string) (Withdrawal, error) {
+	w := Withdrawal{ID: id}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, amount, currency, status, reason, attempts, next_attempt_at, created_at, updated_at
+		FROM withdrawals WHERE id=$1
+	`, id).Scan(&w.UserID, &w.Amount, &w.Currency, &w.Status, &w.Reason, &w.Attempts, &w.NextAttemptAt, &w.CreatedAt, &w.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Withdrawal{}, ErrNotFound
+	}
+	return w, err
+}
+
+// CompleteWithdrawal переводит вывод из PENDING в status: SUCCEEDED списывает
+// захолдированную сумму с баланса кошелька, FAILED снимает холд. updated=false —
+// вывод уже завершён, счёт не трогается.
+func (r *AccountsRepo) CompleteWithdrawal(ctx context.Context, id, status, reason string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	updated, err := completeWithdrawal(ctx, tx, id, status, reason)
+	if err != nil || !updated {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func completeWithdrawal(ctx context.Context, tx *sql.Tx, id, status, reason string) (bool, error) {
+	var (
+		userID, currency string
+		amount           int64
+	)
+	err := tx.QueryRowContext(ctx, `
+		UPDATE withdrawals SET status = $2, reason = $3, updated_at = now()
+		WHERE id = $1 AND status = 'PENDING'
+		RETURNING user_id, currency, amount
+	`, id, status, reason).Scan(&userID, &currency, &amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var debit int64
+	if status == WithdrawalSucceeded {
+		debit = amount
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE wallets SET balance = balance - $1, held = held - $2, updated_at = now()
+		WHERE user_id = $3 AND currency = $4
+	`, debit, amount, userID, currency)
+	return err == nil, err
+}
+
+// RetryPayouts разбирает не более limit выводов в PENDING, у которых подошло
+// next_attempt_at: провайдер не ответил, и исход выплаты неизвестен. Пока
+// попытки не исчерпаны, команда на выплату заново пишется в outbox, а
+// следующий повтор откладывается по расписанию SetPayoutRetry. Провайдер
+// идемпотентен по withdrawal_id, поэтому повтор не выплатит дважды. Вывод с
+// исчерпанными попытками переводится в FAILED, холд снимается. Возвращает
+// число повторённых и завершённых выводов.
+func (r *AccountsRepo) RetryPayouts(ctx context.Context, limit int) (resent, failed int, err error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, amount, currency, status, attempts, created_at
+		FROM withdrawals
+		WHERE status = 'PENDING' AND next_attempt_at <= now()
+		ORDER BY next_attempt_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	var due []Withdrawal
+	for rows.Next() {
+		var w Withdrawal
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Amount, &w.Currency, &w.Status, &w.Attempts, &w.CreatedAt); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		due = append(due, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, w := range due {
+		if w.Attempts >= r.payoutRetry.MaxAttempts {
+			if _, err := completeWithdrawal(ctx, tx, w.ID, WithdrawalFailed, ReasonPayoutUnconfirmed); err != nil {
+				return 0, 0, err
+			}
+			failed++
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE withdrawals
+			SET attempts = attempts + 1, next_attempt_at = now() + $2 * interval '1 millisecond', updated_at = now()
+			WHERE id = $1
+		`, w.ID, r.payoutRetry.Delay(w.Attempts+1).Milliseconds())
+		if err != nil {
+			return 0, 0, err
+		}
+		payload, _ := json.Marshal(NewPayoutRequested(w))
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO outbox(topic, key, payload)
+			VALUES ($1,$2,$3)
+		`, r.payoutTopic, w.ID, payload)
+		if err != nil {
+			return 0, 0, err
+		}
+		resent++
+	}
+	return resent, failed, tx.Commit()
+}
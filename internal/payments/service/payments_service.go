@@ -3,7 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 
+	"HW4/internal/common/money"
 	"HW4/internal/payments/dto"
 	"HW4/internal/payments/repository"
 )
@@ -12,41 +17,361 @@ var (
 	ErrBadRequest    = errors.New("bad_request")
 	ErrAlreadyExists = errors.New("already_exists")
 	ErrNotFound      = errors.New("not_found")
+	ErrAccountFrozen = errors.New("account_frozen")
+	ErrAccountClosed = errors.New("account_closed")
+	// ErrInvalidTransition — например, разморозка незамороженного счёта.
+	ErrInvalidTransition = errors.New("invalid_transition")
+	// ErrInsufficientFunds — на счёте отправителя не хватает доступных средств.
+	ErrInsufficientFunds = errors.New("insufficient_funds")
+	// ErrIdempotencyConflict — transfer_id уже использован с другими параметрами.
+	ErrIdempotencyConflict = errors.New("idempotency_conflict")
+	// ErrWithdrawalNotFound — вывода нет или он с чужого счёта.
+	ErrWithdrawalNotFound = errors.New("withdrawal_not_found")
+	// ErrCurrencyMismatch — у счёта нет кошелька в валюте операции.
+	ErrCurrencyMismatch = errors.New("currency_mismatch")
+	// ErrWalletExists — кошелёк в этой валюте на счёте уже есть.
+	ErrWalletExists = errors.New("wallet_exists")
+	// ErrAccountNotEmpty — закрытие счёта, на котором остались деньги, холды
+	// или выводы в обработке.
+	ErrAccountNotEmpty = errors.New("account_not_empty")
+	// ErrLimitsLoosened — новые лимиты слабее действующих, а ослаблять их
+	// может только админ.
+	ErrLimitsLoosened = errors.New("limits_loosened")
 )
 
+// Действия жизненного цикла счёта.
+const (
+	ActionFreeze   = "freeze"
+	ActionUnfreeze = "unfreeze"
+	ActionClose    = "close"
+)
+
+// MaxOrdersWindow — наибольшее окно лимита на число заказов.
+const MaxOrdersWindow = repository.MaxOrdersWindow
+
+// maxReasonLen ограничивает причину смены статуса, она хранится в аудите.
+const maxReasonLen = 500
+
+// transitions — из каких статусов и в какой переводит действие.
+var transitions = map[string]struct {
+	from []string
+	to   string
+}{
+	ActionFreeze:   {from: []string{repository.AccountActive}, to: repository.AccountFrozen},
+	ActionUnfreeze: {from: []string{repository.AccountFrozen}, to: repository.AccountActive},
+	ActionClose:    {from: []string{repository.AccountActive, repository.AccountFrozen}, to: repository.AccountClosed},
+}
+
+// AccountsRepository — хранилище счетов: один счёт на пользователя
+// (повторное создание — repository.ErrAlreadyExists), отсутствующий счёт —
+// repository.ErrNotFound, операция над закрытым или замороженным счётом —
+// repository.ErrAccountClosed / repository.ErrAccountFrozen, над валютой
+// без кошелька — repository.ErrCurrencyMismatch.
+type AccountsRepository interface {
+	Create(ctx context.Context, userID, currency string, balance int64) error
+	// CreateWallet открывает пустой кошелёк; повторно —
+	// repository.ErrAlreadyExists.
+	CreateWallet(ctx context.Context, userID, currency string) (repository.Account, error)
+	TopUp(ctx context.Context, userID, currency string, amount int64) (int64, error)
+	GetAccount(ctx context.Context, userID string) (repository.Account, error)
+	// ChangeStatus меняет статус и пишет запись аудита атомарно.
+	ChangeStatus(ctx context.Context, userID string, c repository.StatusChange) (repository.Account, error)
+	// Transfer проводит перевод атомарно; replayed=true — перевод с этим id
+	// уже был, repository.ErrIdempotencyConflict — был, но с другими
+	// параметрами, repository.ErrInsufficientFunds — не хватает средств.
+	Transfer(ctx context.Context, t repository.Transfer) (repository.Transfer, bool, error)
+	// CreateWithdrawal холдирует сумму и пишет команду на выплату в outbox
+	// атомарно; проверки счёта те же, что у списания.
+	CreateWithdrawal(ctx context.Context, userID, currency string, amount int64) (repository.Withdrawal, error)
+	GetWithdrawal(ctx context.Context, id string) (repository.Withdrawal, error)
+	GetLimits(ctx context.Context, userID string) (repository.Limits, error)
+	// SetLimits заменяет лимиты; без loosen — только ужесточает, иначе
+	// repository.ErrLimitsLoosened.
+	SetLimits(ctx context.Context, userID string, l repository.Limits, loosen bool) (repository.Limits, error)
+}
+
 type PaymentsService struct {
-	repo *repository.AccountsRepo
+	repo AccountsRepository
 }
 
-func New(repo *repository.AccountsRepo) *PaymentsService {
+func New(repo AccountsRepository) *PaymentsService {
 	return &PaymentsService{repo: repo}
 }
 
+// CreateAccount создаёт счёт с кошельком основной валюты req.Currency.
 func (s *PaymentsService) CreateAccount(ctx context.Context, req dto.CreateAccountRequest) error {
-	if req.UserID == "" || req.Balance < 0 {
+	req.Currency = money.Or(req.Currency)
+	cur, ok := money.Lookup(req.Currency)
+	if req.UserID == "" || !ok || req.Balance < 0 || req.Balance > cur.MaxAmount() {
 		return ErrBadRequest
 	}
-	if err := s.repo.Create(ctx, req.UserID, req.Balance); err != nil {
-		return ErrAlreadyExists
+	if err := s.repo.Create(ctx, req.UserID, req.Currency, req.Balance); err != nil {
+		return accountError("create account", err)
 	}
 	return nil
 }
 
-func (s *PaymentsService) TopUp(ctx context.Context, req dto.TopUpRequest) error {
-	if req.UserID == "" || req.Amount <= 0 {
-		return ErrBadRequest
+// CreateWallet открывает на счёте userID пустой кошелёк в валюте req.Currency.
+func (s *PaymentsService) CreateWallet(ctx context.Context, userID string, req dto.CreateWalletRequest) (dto.AccountResponse, error) {
+	if _, ok := money.Lookup(req.Currency); userID == "" || !ok {
+		return dto.AccountResponse{}, ErrBadRequest
 	}
-	return s.repo.TopUp(ctx, req.UserID, req.Amount)
+	a, err := s.repo.CreateWallet(ctx, userID, req.Currency)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return dto.AccountResponse{}, ErrWalletExists
+	}
+	if err != nil {
+		return dto.AccountResponse{}, accountError("create wallet", err)
+	}
+	return toAccountResponse(a), nil
 }
 
-func (s *PaymentsService) GetBalance(ctx context.Context, userID string) (dto.BalanceResponse, error) {
+// TopUp зачисляет деньги на кошелёк в валюте req.Currency и возвращает его
+// новый баланс. Закрытый счёт пополнить нельзя.
+func (s *PaymentsService) TopUp(ctx context.Context, req dto.TopUpRequest) (dto.TopUpResponse, error) {
+	req.Currency = money.Or(req.Currency)
+	if req.UserID == "" || !validAmount(req.Currency, req.Amount) {
+		return dto.TopUpResponse{}, ErrBadRequest
+	}
+	balance, err := s.repo.TopUp(ctx, req.UserID, req.Currency, req.Amount)
+	if err != nil {
+		return dto.TopUpResponse{}, accountError("top up", err)
+	}
+	return dto.TopUpResponse{UserID: req.UserID, Balance: balance, Currency: req.Currency}, nil
+}
+
+func (s *PaymentsService) GetAccount(ctx context.Context, userID string) (dto.AccountResponse, error) {
 	if userID == "" {
-		return dto.BalanceResponse{}, ErrBadRequest
+		return dto.AccountResponse{}, ErrBadRequest
 	}
-	b, err := s.repo.GetBalance(ctx, userID)
+	a, err := s.repo.GetAccount(ctx, userID)
 	if err != nil {
-		// тут repo отдаёт sql.ErrNoRows наверх — handler решает. Можно оставить так:
-		return dto.BalanceResponse{}, ErrNotFound
+		return dto.AccountResponse{}, accountError("get account", err)
+	}
+	return toAccountResponse(a), nil
+}
+
+// ChangeStatus выполняет действие жизненного цикла action от имени actor.
+// Закрытие необратимо; замороженный счёт не платит, но принимает пополнения.
+func (s *PaymentsService) ChangeStatus(ctx context.Context, userID, action string, req dto.StatusChangeRequest, actor string) (dto.AccountResponse, error) {
+	t, ok := transitions[action]
+	if !ok || userID == "" || strings.TrimSpace(req.Reason) == "" || len(req.Reason) > maxReasonLen {
+		return dto.AccountResponse{}, ErrBadRequest
+	}
+	a, err := s.repo.ChangeStatus(ctx, userID, repository.StatusChange{
+		Action: action,
+		From:   t.from,
+		To:     t.to,
+		Reason: strings.TrimSpace(req.Reason),
+		Actor:  actor,
+	})
+	if err != nil {
+		return dto.AccountResponse{}, accountError(action+" account", err)
+	}
+	return toAccountResponse(a), nil
+}
+
+// Transfer переводит деньги со счёта from на счёт to. Отправитель должен быть
+// ACTIVE, получатель — не закрыт. replayed=true — перевод с этим transfer_id
+// уже проведён, ответ повторяет его.
+func (s *PaymentsService) Transfer(ctx context.Context, req dto.TransferRequest) (dto.TransferResponse, bool, error) {
+	req.Currency = money.Or(req.Currency)
+	if req.TransferID == "" || req.FromUserID == "" || req.ToUserID == "" || req.FromUserID == req.ToUserID ||
+		!validAmount(req.Currency, req.Amount) {
+		return dto.TransferResponse{}, false, ErrBadRequest
+	}
+	t, replayed, err := s.repo.Transfer(ctx, repository.Transfer{
+		ID:         req.TransferID,
+		FromUserID: req.FromUserID,
+		ToUserID:   req.ToUserID,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+	})
+	if err != nil {
+		return dto.TransferResponse{}, false, accountError("transfer", err)
+	}
+	return dto.TransferResponse{
+		TransferID: t.ID,
+		FromUserID: t.FromUserID,
+		ToUserID:   t.ToUserID,
+		Amount:     t.Amount,
+		Currency:   t.Currency,
+		CreatedAt:  t.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, replayed, nil
+}
+
+// Withdraw создаёт вывод amount с кошелька userID в валюте req.Currency.
+// Вывод завершается асинхронно: пока провайдер выплат не ответил, он
+// PENDING и сумма захолдирована.
+func (s *PaymentsService) Withdraw(ctx context.Context, userID string, req dto.WithdrawalRequest) (dto.WithdrawalResponse, error) {
+	req.Currency = money.Or(req.Currency)
+	if userID == "" || !validAmount(req.Currency, req.Amount) {
+		return dto.WithdrawalResponse{}, ErrBadRequest
+	}
+	w, err := s.repo.CreateWithdrawal(ctx, userID, req.Currency, req.Amount)
+	if err != nil {
+		return dto.WithdrawalResponse{}, accountError("withdraw", err)
+	}
+	return toWithdrawalResponse(w), nil
+}
+
+// GetWithdrawal возвращает вывод id со счёта userID.
+func (s *PaymentsService) GetWithdrawal(ctx context.Context, userID, id string) (dto.WithdrawalResponse, error) {
+	if userID == "" || id == "" {
+		return dto.WithdrawalResponse{}, ErrBadRequest
+	}
+	w, err := s.repo.GetWithdrawal(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && w.UserID != userID {
+		return dto.WithdrawalResponse{}, ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return dto.WithdrawalResponse{}, fmt.Errorf("get withdrawal: %w", err)
+	}
+	return toWithdrawalResponse(w), nil
+}
+
+// GetLimits возвращает лимиты расхода счёта userID.
+func (s *PaymentsService) GetLimits(ctx context.Context, userID string) (dto.LimitsResponse, error) {
+	if userID == "" {
+		return dto.LimitsResponse{}, ErrBadRequest
+	}
+	l, err := s.repo.GetLimits(ctx, userID)
+	if err != nil {
+		return dto.LimitsResponse{}, accountError("get limits", err)
+	}
+	return toLimitsResponse(userID, l), nil
+}
+
+// SetLimits заменяет лимиты расхода счёта userID. Ужесточить лимиты может
+// кто угодно с доступом к счёту, а поднять или снять — только при loosen,
+// иначе ErrLimitsLoosened. Без max_orders окно не хранится.
+func (s *PaymentsService) SetLimits(ctx context.Context, userID string, req dto.LimitsRequest, loosen bool) (dto.LimitsResponse, error) {
+	if userID == "" || !validLimits(req) {
+		return dto.LimitsResponse{}, ErrBadRequest
+	}
+	if req.MaxOrders == 0 {
+		req.OrdersWindowSeconds = 0
+	}
+	l, err := s.repo.SetLimits(ctx, userID, repository.Limits{
+		Currency:       req.Currency,
+		MaxOrderAmount: req.MaxOrderAmount,
+		DailyAmount:    req.DailyAmount,
+		MonthlyAmount:  req.MonthlyAmount,
+		MaxOrders:      req.MaxOrders,
+		OrdersWindow:   time.Duration(req.OrdersWindowSeconds) * time.Second,
+	}, loosen)
+	if errors.Is(err, repository.ErrLimitsLoosened) {
+		return dto.LimitsResponse{}, ErrLimitsLoosened
+	}
+	if err != nil {
+		return dto.LimitsResponse{}, accountError("set limits", err)
+	}
+	return toLimitsResponse(userID, l), nil
+}
+
+// validLimits — суммы неотрицательны и, если валюта задана, допустимы для
+// неё; окно на число заказов задано вместе с max_orders и не длиннее
+// MaxOrdersWindow.
+func validLimits(req dto.LimitsRequest) bool {
+	maxAmount := int64(math.MaxInt64)
+	if req.Currency != "" {
+		cur, ok := money.Lookup(req.Currency)
+		if !ok {
+			return false
+		}
+		maxAmount = cur.MaxAmount()
+	}
+	for _, v := range []int64{req.MaxOrderAmount, req.DailyAmount, req.MonthlyAmount} {
+		if v < 0 || v > maxAmount {
+			return false
+		}
+	}
+	window := req.OrdersWindowSeconds
+	return req.MaxOrders >= 0 && window >= 0 && window <= int(MaxOrdersWindow/time.Second) &&
+		(req.MaxOrders == 0 || window > 0)
+}
+
+func toLimitsResponse(userID string, l repository.Limits) dto.LimitsResponse {
+	resp := dto.LimitsResponse{
+		UserID:              userID,
+		Currency:            l.Currency,
+		MaxOrderAmount:      l.MaxOrderAmount,
+		DailyAmount:         l.DailyAmount,
+		MonthlyAmount:       l.MonthlyAmount,
+		MaxOrders:           l.MaxOrders,
+		OrdersWindowSeconds: int(l.OrdersWindow / time.Second),
+	}
+	if !l.UpdatedAt.IsZero() {
+		resp.UpdatedAt = l.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return resp
+}
+
+func toWithdrawalResponse(w repository.Withdrawal) dto.WithdrawalResponse {
+	return dto.WithdrawalResponse{
+		WithdrawalID: w.ID,
+		UserID:       w.UserID,
+		Amount:       w.Amount,
+		Currency:     w.Currency,
+		Status:       w.Status,
+		Reason:       w.Reason,
+		CreatedAt:    w.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UpdatedAt:    w.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func toAccountResponse(a repository.Account) dto.AccountResponse {
+	wallets := make([]dto.WalletResponse, 0, len(a.Wallets))
+	for _, w := range a.Wallets {
+		wallets = append(wallets, dto.WalletResponse{
+			Currency:  w.Currency,
+			Balance:   w.Balance,
+			Held:      w.Held,
+			Available: w.Available(),
+		})
+	}
+	return dto.AccountResponse{
+		UserID:    a.UserID,
+		Currency:  a.Currency,
+		Balance:   a.Balance,
+		Held:      a.Held,
+		Available: a.Available(),
+		Status:    a.Status,
+		Wallets:   wallets,
+		CreatedAt: a.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UpdatedAt: a.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// validAmount — currency поддерживается и amount допустим для неё.
+func validAmount(currency string, amount int64) bool {
+	cur, ok := money.Lookup(currency)
+	return ok && cur.CheckAmount(amount) == nil
+}
+
+// accountError переводит ошибки хранилища в ошибки сервиса. Неизвестные
+// ошибки оборачиваются с именем операции и уходят наверх как есть.
+func accountError(op string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return ErrAlreadyExists
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, repository.ErrAccountFrozen):
+		return ErrAccountFrozen
+	case errors.Is(err, repository.ErrAccountClosed):
+		return ErrAccountClosed
+	case errors.Is(err, repository.ErrInvalidTransition):
+		return ErrInvalidTransition
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		return ErrInsufficientFunds
+	case errors.Is(err, repository.ErrIdempotencyConflict):
+		return ErrIdempotencyConflict
+	case errors.Is(err, repository.ErrCurrencyMismatch):
+		return ErrCurrencyMismatch
+	case errors.Is(err, repository.ErrAccountNotEmpty):
+		return ErrAccountNotEmpty
+	default:
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	return dto.BalanceResponse{UserID: userID, Balance: b}, nil
 }
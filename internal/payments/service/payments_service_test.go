@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"HW4/internal/payments/dto"
+	"HW4/internal/payments/repository"
+	"HW4/internal/payments/repository/memstore"
+)
+
+var _ AccountsRepository = (*memstore.Store)(nil)
+
+const userID = "11111111-1111-1111-1111-111111111111"
+
+func TestCreateAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     dto.CreateAccountRequest
+		wantErr error
+	}{
+		{name: "ok", req: dto.CreateAccountRequest{UserID: userID, Balance: 500}},
+		{name: "zero balance is allowed", req: dto.CreateAccountRequest{UserID: "22222222-2222-2222-2222-222222222222"}},
+		{name: "duplicate", req: dto.CreateAccountRequest{UserID: userID}, wantErr: ErrAlreadyExists},
+		{name: "empty user", req: dto.CreateAccountRequest{Balance: 1}, wantErr: ErrBadRequest},
+		{name: "negative balance", req: dto.CreateAccountRequest{UserID: "33333333-3333-3333-3333-333333333333", Balance: -1}, wantErr: ErrBadRequest},
+	}
+
+	svc := New(memstore.New("payment.result"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := svc.CreateAccount(context.Background(), tt.req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTopUpAndBalance(t *testing.T) {
+	ctx := context.Background()
+	svc := New(memstore.New("payment.result"))
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: userID, Balance: 500})
+
+	tests := []struct {
+		name    string
+		req     dto.TopUpRequest
+		wantErr error
+	}{
+		{name: "ok", req: dto.TopUpRequest{UserID: userID, Amount: 300}},
+		{name: "zero amount", req: dto.TopUpRequest{UserID: userID}, wantErr: ErrBadRequest},
+		{name: "empty user", req: dto.TopUpRequest{Amount: 10}, wantErr: ErrBadRequest},
+		{name: "unknown account", req: dto.TopUpRequest{UserID: "44444444-4444-4444-4444-444444444444", Amount: 10}, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.TopUp(ctx, tt.req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	got, err := svc.GetAccount(ctx, userID)
+	if err != nil || got.Balance != 800 || got.Status != repository.AccountActive || got.CreatedAt == "" {
+		t.Fatalf("account = %+v, err = %v; want active with 800", got, err)
+	}
+	if resp, err := svc.TopUp(ctx, dto.TopUpRequest{UserID: userID, Amount: 1}); err != nil || resp.Balance != 801 {
+		t.Fatalf("top up = %+v, %v; want new balance 801", resp, err)
+	}
+	if _, err := svc.GetAccount(ctx, "44444444-4444-4444-4444-444444444444"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown account: %v, want ErrNotFound", err)
+	}
+	if _, err := svc.GetAccount(ctx, ""); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("empty user: %v, want ErrBadRequest", err)
+	}
+}
+
+// brokenRepo отвечает ошибкой хранилища на любой вызов.
+type brokenRepo struct{ err error }
+
+func (r brokenRepo) Create(context.Context, string, string, int64) error         { return r.err }
+func (r brokenRepo) TopUp(context.Context, string, string, int64) (int64, error) { return 0, r.err }
+func (r brokenRepo) CreateWallet(context.Context, string, string) (repository.Account, error) {
+	return repository.Account{}, r.err
+}
+func (r brokenRepo) GetAccount(context.Context, string) (repository.Account, error) {
+	return repository.Account{}, r.err
+}
+func (r brokenRepo) ChangeStatus(context.Context, string, repository.StatusChange) (repository.Account, error) {
+	return repository.Account{}, r.err
+}
+func (r brokenRepo) Transfer(context.Context, repository.Transfer) (repository.Transfer, bool, error) {
+	return repository.Transfer{}, false, r.err
+}
+func (r brokenRepo) CreateWithdrawal(context.Context, string, string, int64) (repository.Withdrawal, error) {
+	return repository.Withdrawal{}, r.err
+}
+func (r brokenRepo) GetWithdrawal(context.Context, string) (repository.Withdrawal, error) {
+	return repository.Withdrawal{}, r.err
+}
+func (r brokenRepo) GetLimits(context.Context, string) (repository.Limits, error) {
+	return repository.Limits{}, r.err
+}
+func (r brokenRepo) SetLimits(context.Context, string, repository.Limits, bool) (repository.Limits, error) {
+	return repository.Limits{}, r.err
+}
+
+func TestStorageErrorsAreNotMasked(t *testing.T) {
+	ctx := context.Background()
+	dbDown := errors.New("connection refused")
+	svc := New(brokenRepo{err: dbDown})
+
+	err := svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: userID})
+	if errors.Is(err, ErrAlreadyExists) || !errors.Is(err, dbDown) {
+		t.Fatalf("create: %v, want the storage error", err)
+	}
+	if _, err := svc.GetAccount(ctx, userID); errors.Is(err, ErrNotFound) || !errors.Is(err, dbDown) {
+		t.Fatalf("get account: %v, want the storage error", err)
+	}
+
+	closed := New(brokenRepo{err: repository.ErrAccountClosed})
+	if _, err := closed.TopUp(ctx, dto.TopUpRequest{UserID: userID, Amount: 1}); !errors.Is(err, ErrAccountClosed) {
+		t.Fatalf("top up closed: %v, want ErrAccountClosed", err)
+	}
+}
+
+func TestAccountLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New("payment.result")
+	svc := New(store)
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: userID})
+	reason := dto.StatusChangeRequest{Reason: "compliance check"}
+
+	steps := []struct {
+		name       string
+		action     string
+		req        dto.StatusChangeRequest
+		wantStatus string
+		wantErr    error
+	}{
+		{name: "reason is required", action: ActionFreeze, wantErr: ErrBadRequest},
+		{name: "unknown action", action: "delete", req: reason, wantErr: ErrBadRequest},
+		{name: "unfreeze active", action: ActionUnfreeze, req: reason, wantErr: ErrInvalidTransition},
+		{name: "freeze", action: ActionFreeze, req: reason, wantStatus: repository.AccountFrozen},
+		{name: "freeze twice", action: ActionFreeze, req: reason, wantErr: ErrInvalidTransition},
+		{name: "unfreeze", action: ActionUnfreeze, req: reason, wantStatus: repository.AccountActive},
+		{name: "close", action: ActionClose, req: reason, wantStatus: repository.AccountClosed},
+		{name: "closed is final", action: ActionUnfreeze, req: reason, wantErr: ErrAccountClosed},
+	}
+	for _, st := range steps {
+		got, err := svc.ChangeStatus(ctx, userID, st.action, st.req, "admin-1")
+		if !errors.Is(err, st.wantErr) || (err == nil && got.Status != st.wantStatus) {
+			t.Fatalf("%s: status %q, err %v; want %q, %v", st.name, got.Status, err, st.wantStatus, st.wantErr)
+		}
+	}
+
+	if _, err := svc.TopUp(ctx, dto.TopUpRequest{UserID: userID, Amount: 10}); !errors.Is(err, ErrAccountClosed) {
+		t.Fatalf("top up closed account: %v, want ErrAccountClosed", err)
+	}
+	audit := store.Audit()
+	if len(audit) != 3 {
+		t.Fatalf("audit has %d entries, want 3: %+v", len(audit), audit)
+	}
+	if a := audit[0]; a.Action != ActionFreeze || a.From != repository.AccountActive || a.To != repository.AccountFrozen ||
+		a.Reason != "compliance check" || a.Actor != "admin-1" {
+		t.Fatalf("audit[0] = %+v", a)
+	}
+}
+
+// TestCloseRequiresEmptyAccount: деньги закрытого счёта не вывести, поэтому
+// закрыть можно только счёт без остатка, холдов и выводов в обработке.
+func TestCloseRequiresEmptyAccount(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, store *memstore.Store)
+		wantErr error
+	}{
+		{name: "empty account", setup: func(t *testing.T, store *memstore.Store) {}},
+		{name: "funds in primary wallet", wantErr: ErrAccountNotEmpty, setup: func(t *testing.T, store *memstore.Store) {
+			_, _ = store.TopUp(ctx, userID, "RUB", 100)
+		}},
+		{name: "funds in another wallet", wantErr: ErrAccountNotEmpty, setup: func(t *testing.T, store *memstore.Store) {
+			_, _ = store.CreateWallet(ctx, userID, "USD")
+			_, _ = store.TopUp(ctx, userID, "USD", 50)
+		}},
+		{name: "active hold", wantErr: ErrAccountNotEmpty, setup: func(t *testing.T, store *memstore.Store) {
+			_, _ = store.TopUp(ctx, userID, "RUB", 100)
+			raw, _ := json.Marshal(dto.PaymentRequested{MessageID: "m1", OrderID: "o1", UserID: userID, Amount: 100, CaptureMethod: dto.CaptureManual})
+			if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "pending withdrawal", wantErr: ErrAccountNotEmpty, setup: func(t *testing.T, store *memstore.Store) {
+			_, _ = store.TopUp(ctx, userID, "RUB", 100)
+			if _, err := store.CreateWithdrawal(ctx, userID, "RUB", 100); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "settled withdrawal", setup: func(t *testing.T, store *memstore.Store) {
+			_, _ = store.TopUp(ctx, userID, "RUB", 100)
+			w, err := store.CreateWithdrawal(ctx, userID, "RUB", 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = store.CompleteWithdrawal(ctx, w.ID, repository.WithdrawalSucceeded, "")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memstore.New("payment.result")
+			_ = store.Create(ctx, userID, "RUB", 0)
+			tt.setup(t, store)
+
+			_, err := New(store).ChangeStatus(ctx, userID, ActionClose, dto.StatusChangeRequest{Reason: "moving out"}, userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("close: %v, want %v", err, tt.wantErr)
+			}
+			want := repository.AccountClosed
+			if tt.wantErr != nil {
+				want = repository.AccountActive
+			}
+			if a, _ := store.GetAccount(ctx, userID); a.Status != want {
+				t.Fatalf("status = %s, want %s", a.Status, want)
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	const (
+		alice = "11111111-1111-1111-1111-111111111111"
+		bob   = "22222222-2222-2222-2222-222222222222"
+		carol = "33333333-3333-3333-3333-333333333333"
+	)
+	store := memstore.New("payment.result")
+	svc := New(store)
+	_ = store.Create(ctx, alice, "RUB", 100)
+	_ = store.Create(ctx, bob, "RUB", 0)
+	_ = store.Create(ctx, carol, "RUB", 50)
+	_, _ = store.ChangeStatus(ctx, carol, repository.StatusChange{Action: ActionFreeze, From: []string{repository.AccountActive}, To: repository.AccountFrozen})
+
+	transfer := func(id, from, to string, amount int64) dto.TransferRequest {
+		return dto.TransferRequest{TransferID: id, FromUserID: from, ToUserID: to, Amount: amount}
+	}
+
+	tests := []struct {
+		name         string
+		req          dto.TransferRequest
+		wantErr      error
+		wantReplayed bool
+	}{
+		{name: "ok", req: transfer("t1", alice, bob, 60)},
+		{name: "replay", req: transfer("t1", alice, bob, 60), wantReplayed: true},
+		{name: "same id, other amount", req: transfer("t1", alice, bob, 61), wantErr: ErrIdempotencyConflict},
+		{name: "insufficient funds", req: transfer("t2", alice, bob, 41), wantErr: ErrInsufficientFunds},
+		{name: "unknown recipient", req: transfer("t3", alice, "44444444-4444-4444-4444-444444444444", 1), wantErr: ErrNotFound},
+		{name: "frozen sender", req: transfer("t4", carol, bob, 1), wantErr: ErrAccountFrozen},
+		{name: "frozen recipient accepts", req: transfer("t5", alice, carol, 10)},
+		{name: "to self", req: transfer("t6", alice, alice, 1), wantErr: ErrBadRequest},
+		{name: "no id", req: transfer("", alice, bob, 1), wantErr: ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, replayed, err := svc.Transfer(ctx, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (replayed != tt.wantReplayed || resp.TransferID != tt.req.TransferID) {
+				t.Fatalf("resp = %+v, replayed = %v; want replayed %v", resp, replayed, tt.wantReplayed)
+			}
+		})
+	}
+
+	for userID, want := range map[string]int64{alice: 30, bob: 60, carol: 60} {
+		if a, _ := store.GetAccount(ctx, userID); a.Balance != want {
+			t.Fatalf("balance of %s = %d, want %d", userID, a.Balance, want)
+		}
+	}
+	if entries := store.TransferEntries(); len(entries) != 4 || entries[0].Amount != -60 || entries[1].Amount != 60 || entries[1].BalanceAfter != 60 {
+		t.Fatalf("entries = %+v, want debit and credit per transfer", entries)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	ctx := context.Background()
+	const (
+		alice = "11111111-1111-1111-1111-111111111111"
+		bob   = "22222222-2222-2222-2222-222222222222"
+	)
+	store := memstore.New("payment.result")
+	svc := New(store)
+	_ = store.Create(ctx, alice, "RUB", 100)
+	_ = store.Create(ctx, bob, "RUB", 100)
+	_, _ = store.ChangeStatus(ctx, bob, repository.StatusChange{Action: ActionFreeze, From: []string{repository.AccountActive}, To: repository.AccountFrozen})
+
+	tests := []struct {
+		name    string
+		userID  string
+		amount  int64
+		wantErr error
+	}{
+		{name: "ok", userID: alice, amount: 60},
+		{name: "held amount is not available", userID: alice, amount: 41, wantErr: ErrInsufficientFunds},
+		{name: "frozen", userID: bob, amount: 1, wantErr: ErrAccountFrozen},
+		{name: "unknown account", userID: "44444444-4444-4444-4444-444444444444", amount: 1, wantErr: ErrNotFound},
+		{name: "zero amount", userID: alice, wantErr: ErrBadRequest},
+	}
+	var created dto.WithdrawalResponse
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.Withdraw(ctx, tt.userID, dto.WithdrawalRequest{Amount: tt.amount})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				created = resp
+			}
+		})
+	}
+
+	if created.Status != repository.WithdrawalPending || created.Amount != 60 {
+		t.Fatalf("withdrawal = %+v, want PENDING for 60", created)
+	}
+	if a, _ := store.GetAccount(ctx, alice); a.Balance != 100 || a.Held != 60 {
+		t.Fatalf("balance = %d, held = %d; want 100, 60", a.Balance, a.Held)
+	}
+	if got, err := svc.GetWithdrawal(ctx, alice, created.WithdrawalID); err != nil || got != created {
+		t.Fatalf("get = %+v, %v; want %+v", got, err, created)
+	}
+	if _, err := svc.GetWithdrawal(ctx, bob, created.WithdrawalID); !errors.Is(err, ErrWithdrawalNotFound) {
+		t.Fatalf("foreign withdrawal: %v, want ErrWithdrawalNotFound", err)
+	}
+}
+
+func TestWallets(t *testing.T) {
+	ctx := context.Background()
+	const (
+		alice = "11111111-1111-1111-1111-111111111111"
+		bob   = "22222222-2222-2222-2222-222222222222"
+	)
+	svc := New(memstore.New("payment.result"))
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: alice, Balance: 100})
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: bob, Currency: "KZT"})
+
+	steps := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{name: "open wallet", run: func() error {
+			_, err := svc.CreateWallet(ctx, alice, dto.CreateWalletRequest{Currency: "USD"})
+			return err
+		}},
+		{name: "open wallet twice", wantErr: ErrWalletExists, run: func() error {
+			_, err := svc.CreateWallet(ctx, alice, dto.CreateWalletRequest{Currency: "USD"})
+			return err
+		}},
+		{name: "unsupported currency", wantErr: ErrBadRequest, run: func() error {
+			_, err := svc.CreateWallet(ctx, alice, dto.CreateWalletRequest{Currency: "XXX"})
+			return err
+		}},
+		{name: "top up wallet", run: func() error {
+			_, err := svc.TopUp(ctx, dto.TopUpRequest{UserID: alice, Amount: 50, Currency: "USD"})
+			return err
+		}},
+		{name: "recipient has no wallet", wantErr: ErrCurrencyMismatch, run: func() error {
+			_, _, err := svc.Transfer(ctx, dto.TransferRequest{TransferID: "t1", FromUserID: alice, ToUserID: bob, Amount: 10, Currency: "USD"})
+			return err
+		}},
+		{name: "withdraw without wallet", wantErr: ErrCurrencyMismatch, run: func() error {
+			_, err := svc.Withdraw(ctx, alice, dto.WithdrawalRequest{Amount: 10, Currency: "EUR"})
+			return err
+		}},
+		{name: "withdraw from wallet", run: func() error {
+			_, err := svc.Withdraw(ctx, alice, dto.WithdrawalRequest{Amount: 20, Currency: "USD"})
+			return err
+		}},
+	}
+	for _, st := range steps {
+		if err := st.run(); !errors.Is(err, st.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+	}
+
+	got, err := svc.GetAccount(ctx, alice)
+	want := []dto.WalletResponse{
+		{Currency: "RUB", Balance: 100, Available: 100},
+		{Currency: "USD", Balance: 50, Held: 20, Available: 30},
+	}
+	if err != nil || got.Currency != "RUB" || got.Balance != 100 || len(got.Wallets) != 2 || got.Wallets[0] != want[0] || got.Wallets[1] != want[1] {
+		t.Fatalf("account = %+v, err = %v; want RUB primary with wallets %+v", got, err, want)
+	}
+	if b, _ := svc.GetAccount(ctx, bob); b.Currency != "KZT" || len(b.Wallets) != 1 {
+		t.Fatalf("bob = %+v, want a single KZT wallet", b)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	const (
+		alice = "11111111-1111-1111-1111-111111111111"
+		bob   = "22222222-2222-2222-2222-222222222222"
+	)
+	svc := New(memstore.New("payment.result"))
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: alice, Balance: 100})
+	_ = svc.CreateAccount(ctx, dto.CreateAccountRequest{UserID: bob})
+	_, _ = svc.ChangeStatus(ctx, bob, ActionClose, dto.StatusChangeRequest{Reason: "test"}, "")
+
+	if got, err := svc.GetLimits(ctx, alice); err != nil || got.Currency != "RUB" || got.DailyAmount != 0 || got.UpdatedAt != "" {
+		t.Fatalf("initial limits = %+v, %v; want unlimited in RUB", got, err)
+	}
+
+	set := func(req dto.LimitsRequest, loosen bool) func() error {
+		return func() error {
+			_, err := svc.SetLimits(ctx, alice, req, loosen)
+			return err
+		}
+	}
+	steps := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{name: "owner sets limits", run: set(dto.LimitsRequest{DailyAmount: 1000, MaxOrders: 5, OrdersWindowSeconds: 60}, false)},
+		{name: "owner tightens", run: set(dto.LimitsRequest{DailyAmount: 500, MaxOrders: 3, OrdersWindowSeconds: 120}, false)},
+		{name: "owner raises daily", wantErr: ErrLimitsLoosened, run: set(dto.LimitsRequest{DailyAmount: 600, MaxOrders: 3, OrdersWindowSeconds: 120}, false)},
+		{name: "owner removes velocity", wantErr: ErrLimitsLoosened, run: set(dto.LimitsRequest{DailyAmount: 500}, false)},
+		{name: "owner shortens window", wantErr: ErrLimitsLoosened, run: set(dto.LimitsRequest{DailyAmount: 500, MaxOrders: 3, OrdersWindowSeconds: 60}, false)},
+		{name: "owner switches currency", wantErr: ErrLimitsLoosened, run: set(dto.LimitsRequest{Currency: "USD", DailyAmount: 500, MaxOrders: 3, OrdersWindowSeconds: 120}, false)},
+		{name: "admin raises", run: set(dto.LimitsRequest{DailyAmount: 2000, MonthlyAmount: 10000}, true)},
+		{name: "negative amount", wantErr: ErrBadRequest, run: set(dto.LimitsRequest{DailyAmount: -1}, true)},
+		{name: "max orders without window", wantErr: ErrBadRequest, run: set(dto.LimitsRequest{MaxOrders: 1}, true)},
+		{name: "window too long", wantErr: ErrBadRequest, run: set(dto.LimitsRequest{MaxOrders: 1, OrdersWindowSeconds: 31 * 24 * 3600}, true)},
+		{name: "unsupported currency", wantErr: ErrBadRequest, run: set(dto.LimitsRequest{Currency: "XXX"}, true)},
+		{name: "unknown account", wantErr: ErrNotFound, run: func() error {
+			_, err := svc.SetLimits(ctx, "44444444-4444-4444-4444-444444444444", dto.LimitsRequest{}, true)
+			return err
+		}},
+		{name: "closed account", wantErr: ErrAccountClosed, run: func() error {
+			_, err := svc.SetLimits(ctx, bob, dto.LimitsRequest{DailyAmount: 1}, true)
+			return err
+		}},
+	}
+	for _, st := range steps {
+		if err := st.run(); !errors.Is(err, st.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+	}
+
+	got, err := svc.GetLimits(ctx, alice)
+	want := dto.LimitsResponse{UserID: alice, Currency: "RUB", DailyAmount: 2000, MonthlyAmount: 10000, UpdatedAt: got.UpdatedAt}
+	if err != nil || got != want || got.UpdatedAt == "" {
+		t.Fatalf("limits = %+v, %v; want %+v", got, err, want)
+	}
+}
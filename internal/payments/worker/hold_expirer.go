@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"HW4/internal/payments/config"
+)
+
+// HoldStore снимает холды с истёкшим TTL и пишет результаты в outbox.
+type HoldStore interface {
+	ExpireHolds(ctx context.Context, limit int) (int, error)
+}
+
+// HoldExpirer периодически снимает просроченные холды. Несколько реплик
+// могут работать одновременно: строки разбираются под SKIP LOCKED.
+type HoldExpirer struct {
+	store HoldStore
+	cfg   config.HoldsConfig
+}
+
+func NewHoldExpirer(store HoldStore, cfg config.HoldsConfig) *HoldExpirer {
+	return &HoldExpirer{store: store, cfg: cfg}
+}
+
+func (w *HoldExpirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.tick(ctx); err != nil {
+				log.Printf("[hold-expirer] tick error: %v", err)
+			}
+		}
+	}
+}
+
+// tick разбирает пачки, пока очередная не окажется неполной.
+func (w *HoldExpirer) tick(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := w.store.ExpireHolds(ctx, w.cfg.ExpiryBatchSize)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("[hold-expirer] expired %d hold(s)", n)
+		}
+		if n < w.cfg.ExpiryBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
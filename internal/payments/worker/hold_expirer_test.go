@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"HW4/internal/payments/config"
+	"HW4/internal/payments/dto"
+	"HW4/internal/payments/repository"
+	"HW4/internal/payments/repository/memstore"
+)
+
+var _ HoldStore = (*memstore.Store)(nil)
+
+func TestHoldExpirerReleasesExpiredHolds(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	ctx := context.Background()
+	store := memstore.New("payment.result")
+	_ = store.Create(ctx, userID, "RUB", 500)
+
+	authorize := func(messageID, orderID string) {
+		raw, _ := json.Marshal(dto.PaymentRequested{
+			MessageID: messageID, OrderID: orderID, UserID: userID, Amount: 100, CaptureMethod: dto.CaptureManual,
+		})
+		if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// o1 и o2 истекают сразу, o3 живёт долго
+	store.SetHoldTTL(0)
+	authorize("m1", "o1")
+	authorize("m2", "o2")
+	store.SetHoldTTL(time.Hour)
+	authorize("m3", "o3")
+
+	// пачка меньше числа просроченных: за один тик разбираются все
+	w := NewHoldExpirer(store, config.HoldsConfig{ExpiryInterval: 5 * time.Millisecond, ExpiryBatchSize: 1})
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() { w.Run(runCtx); close(done) }()
+	waitFor(t, func() bool { return len(store.Outbox()) == 5 })
+	cancel()
+	<-done
+
+	holds := store.Holds()
+	if holds["o1"].Status != repository.HoldExpired || holds["o2"].Status != repository.HoldExpired || holds["o3"].Status != repository.HoldActive {
+		t.Fatalf("holds = %+v, want o1 and o2 expired, o3 active", holds)
+	}
+	if a, _ := store.GetAccount(ctx, userID); a.Balance != 500 || a.Held != 100 {
+		t.Fatalf("balance = %d, held = %d; want 500, 100", a.Balance, a.Held)
+	}
+	for _, e := range store.Outbox()[3:] {
+		var res dto.PaymentResult
+		_ = json.Unmarshal(e.Payload, &res)
+		if res.Status != "VOIDED" || res.Reason != repository.ReasonHoldExpired || res.Amount != 100 {
+			t.Fatalf("expiry result = %+v, want VOIDED/%s for 100", res, repository.ReasonHoldExpired)
+		}
+	}
+}
@@ -0,0 +1,658 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/payments/dto"
+	"HW4/internal/payments/fx"
+	"HW4/internal/payments/repository"
+	"HW4/internal/payments/repository/memstore"
+)
+
+var (
+	_ PaymentHandler = (*memstore.Store)(nil)
+	_ OutboxStore    = (*memstore.Store)(nil)
+)
+
+func TestPaymentRequestedProcessing(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	type request struct {
+		messageID string
+		orderID   string
+		amount    int64
+	}
+	tests := []struct {
+		name        string
+		balance     int64
+		status      string
+		currency    string
+		wallet      int64 // >0 — открыть кошелёк в currency с этим балансом
+		requests    []request
+		wantBalance int64
+		wantWallet  int64
+		wantResults []string
+		wantReason  string
+	}{
+		{
+			name:        "debits once",
+			balance:     500,
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 300,
+			wantResults: []string{"FINISHED"},
+		},
+		{
+			name:        "insufficient funds",
+			balance:     100,
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 100,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonInsufficientFunds,
+		},
+		{
+			name:        "frozen account is declined",
+			balance:     500,
+			status:      repository.AccountFrozen,
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 500,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonAccountFrozen,
+		},
+		{
+			name:        "closed account is declined",
+			status:      repository.AccountClosed,
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 0,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonAccountClosed,
+		},
+		{
+			name:        "currency without wallet is declined",
+			balance:     500,
+			currency:    "USD",
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 500,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonCurrencyMismatch,
+		},
+		{
+			name:        "debits the wallet of order currency",
+			balance:     500,
+			currency:    "USD",
+			wallet:      300,
+			requests:    []request{{"m1", "o1", 200}},
+			wantBalance: 500,
+			wantWallet:  100,
+			wantResults: []string{"FINISHED"},
+		},
+		{
+			name:        "duplicate message is ignored",
+			balance:     500,
+			requests:    []request{{"m1", "o1", 200}, {"m1", "o1", 200}},
+			wantBalance: 300,
+			wantResults: []string{"FINISHED"},
+		},
+		{
+			name:        "new message for already paid order is ignored",
+			balance:     500,
+			requests:    []request{{"m1", "o1", 200}, {"m2", "o1", 200}},
+			wantBalance: 300,
+			wantResults: []string{"FINISHED"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.result")
+			_ = store.Create(ctx, userID, "RUB", tt.balance)
+			if tt.wallet > 0 {
+				_, _ = store.CreateWallet(ctx, userID, tt.currency)
+				_, _ = store.TopUp(ctx, userID, tt.currency, tt.wallet)
+			}
+			if tt.status != "" {
+				change := repository.StatusChange{From: []string{repository.AccountActive}, To: tt.status, Reason: "test"}
+				if _, err := store.ChangeStatus(ctx, userID, change); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b := membroker.New(1)
+			for _, r := range tt.requests {
+				raw, _ := json.Marshal(dto.PaymentRequested{
+					MessageID: r.messageID, OrderID: r.orderID, UserID: userID, Amount: r.amount, Currency: tt.currency,
+				})
+				_ = b.Publish(ctx, "req", []byte(r.orderID), raw)
+			}
+
+			c := NewPaymentRequestedConsumer(b.Subscribe("req", "payments"), store, b, retryCfg)
+			runCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() { c.Run(runCtx); close(done) }()
+			waitFor(t, func() bool { return b.Lag("req", "payments") == 0 })
+			cancel()
+			<-done
+
+			got, _ := store.GetAccount(ctx, userID)
+			if got.Balance != tt.wantBalance {
+				t.Fatalf("balance = %d, want %d", got.Balance, tt.wantBalance)
+			}
+			if w, _ := got.Wallet(tt.currency); tt.wallet > 0 && w.Balance != tt.wantWallet {
+				t.Fatalf("%s wallet = %d, want %d", tt.currency, w.Balance, tt.wantWallet)
+			}
+			outbox := store.Outbox()
+			if len(outbox) != len(tt.wantResults) {
+				t.Fatalf("outbox has %d results, want %d", len(outbox), len(tt.wantResults))
+			}
+			for i, e := range outbox {
+				var res dto.PaymentResult
+				_ = json.Unmarshal(e.Payload, &res)
+				if res.Status != tt.wantResults[i] || e.Topic != "payment.result" {
+					t.Fatalf("result %d = %s on %s, want %s", i, res.Status, e.Topic, tt.wantResults[i])
+				}
+				if res.Reason != tt.wantReason {
+					t.Fatalf("result %d reason = %q, want %q", i, res.Reason, tt.wantReason)
+				}
+			}
+		})
+	}
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	type command struct {
+		typ     string
+		orderID string
+		amount  int64
+	}
+	authorize := func(orderID string, amount int64) command { return command{dto.EventPaymentRequested, orderID, amount} }
+	capture := func(orderID string) command { return command{dto.EventCaptureRequested, orderID, 0} }
+	void := func(orderID string) command { return command{dto.EventVoidRequested, orderID, 0} }
+
+	tests := []struct {
+		name        string
+		commands    []command
+		wantBalance int64
+		wantHeld    int64
+		wantResults []string
+	}{
+		{
+			name:        "hold reserves funds",
+			commands:    []command{authorize("o1", 300)},
+			wantBalance: 500,
+			wantHeld:    300,
+			wantResults: []string{"AUTHORIZED"},
+		},
+		{
+			name:        "held funds are not available",
+			commands:    []command{authorize("o1", 300), authorize("o2", 300)},
+			wantBalance: 500,
+			wantHeld:    300,
+			wantResults: []string{"AUTHORIZED", "FAILED"},
+		},
+		{
+			name:        "capture debits the hold",
+			commands:    []command{authorize("o1", 300), capture("o1")},
+			wantBalance: 200,
+			wantResults: []string{"AUTHORIZED", "FINISHED"},
+		},
+		{
+			name:        "void releases the hold",
+			commands:    []command{authorize("o1", 300), void("o1")},
+			wantBalance: 500,
+			wantResults: []string{"AUTHORIZED", "VOIDED"},
+		},
+		{
+			name:        "hold is settled once",
+			commands:    []command{authorize("o1", 300), void("o1"), capture("o1"), void("o1")},
+			wantBalance: 500,
+			wantResults: []string{"AUTHORIZED", "VOIDED"},
+		},
+		{
+			name:        "capture without hold is ignored",
+			commands:    []command{capture("o1")},
+			wantBalance: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.result")
+			_ = store.Create(ctx, userID, "RUB", 500)
+
+			for i, c := range tt.commands {
+				req := dto.PaymentRequested{MessageID: fmt.Sprintf("m%d", i), Type: c.typ, OrderID: c.orderID, UserID: userID, Amount: c.amount}
+				if c.typ == dto.EventPaymentRequested {
+					req.CaptureMethod = dto.CaptureManual
+				}
+				raw, _ := json.Marshal(req)
+				if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a, _ := store.GetAccount(ctx, userID)
+			if a.Balance != tt.wantBalance || a.Held != tt.wantHeld {
+				t.Fatalf("balance = %d, held = %d; want %d, %d", a.Balance, a.Held, tt.wantBalance, tt.wantHeld)
+			}
+			outbox := store.Outbox()
+			if len(outbox) != len(tt.wantResults) {
+				t.Fatalf("outbox has %d results, want %d", len(outbox), len(tt.wantResults))
+			}
+			for i, e := range outbox {
+				var res dto.PaymentResult
+				_ = json.Unmarshal(e.Payload, &res)
+				if res.Status != tt.wantResults[i] {
+					t.Fatalf("result %d = %s, want %s", i, res.Status, tt.wantResults[i])
+				}
+				// сумма подтверждения и отмены берётся из холда, а не из команды
+				if res.Status == "FINISHED" && res.Amount != 300 {
+					t.Fatalf("captured amount = %d, want 300", res.Amount)
+				}
+			}
+		})
+	}
+}
+
+func TestRefunds(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	type refund struct {
+		id      string
+		orderID string
+		amount  int64
+	}
+
+	tests := []struct {
+		name         string
+		refunds      []refund
+		closeAccount bool
+		wantBalance  int64
+		// wantResults — статус и refunded_amount каждого результата
+		wantResults  []string
+		wantRefunded []int64
+		wantReason   string
+	}{
+		{
+			name:         "partial refunds add up",
+			refunds:      []refund{{"r1", "o1", 100}, {"r2", "o1", 50}},
+			wantBalance:  350,
+			wantResults:  []string{dto.RefundSucceeded, dto.RefundSucceeded},
+			wantRefunded: []int64{100, 150},
+		},
+		{
+			name:         "full refund",
+			refunds:      []refund{{"r1", "o1", 300}},
+			wantBalance:  500,
+			wantResults:  []string{dto.RefundSucceeded},
+			wantRefunded: []int64{300},
+		},
+		{
+			name:         "refund over the paid amount is rejected",
+			refunds:      []refund{{"r1", "o1", 200}, {"r2", "o1", 101}},
+			wantBalance:  400,
+			wantResults:  []string{dto.RefundSucceeded, dto.RefundRejected},
+			wantRefunded: []int64{200, 200},
+			wantReason:   repository.ReasonRefundExceedsAmount,
+		},
+		{
+			name:         "unpaid order is rejected",
+			refunds:      []refund{{"r1", "o2", 10}},
+			wantBalance:  200,
+			wantResults:  []string{dto.RefundRejected},
+			wantRefunded: []int64{0},
+			wantReason:   repository.ReasonOrderNotPaid,
+		},
+		{
+			name:         "duplicate refund id is applied once",
+			refunds:      []refund{{"r1", "o1", 100}, {"r1", "o1", 100}},
+			wantBalance:  300,
+			wantResults:  []string{dto.RefundSucceeded},
+			wantRefunded: []int64{100},
+		},
+		{
+			name:         "closed account is rejected",
+			refunds:      []refund{{"r1", "o1", 100}},
+			closeAccount: true,
+			wantBalance:  0,
+			wantResults:  []string{dto.RefundRejected},
+			wantRefunded: []int64{0},
+			wantReason:   repository.ReasonAccountClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.result")
+			_ = store.Create(ctx, userID, "RUB", 500)
+
+			pay, _ := json.Marshal(dto.PaymentRequested{MessageID: "pay", OrderID: "o1", UserID: userID, Amount: 300})
+			if _, err := store.HandlePaymentRequested(ctx, pay); err != nil {
+				t.Fatal(err)
+			}
+			if tt.closeAccount {
+				// закрыть можно только пустой счёт: остаток уходит на другой
+				const other = "22222222-2222-2222-2222-222222222222"
+				_ = store.Create(ctx, other, "RUB", 0)
+				if _, _, err := store.Transfer(ctx, repository.Transfer{ID: "t1", FromUserID: userID, ToUserID: other, Amount: 200, Currency: "RUB"}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := store.ChangeStatus(ctx, userID, repository.StatusChange{Action: "close", From: []string{repository.AccountActive}, To: repository.AccountClosed}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, r := range tt.refunds {
+				raw, _ := json.Marshal(dto.PaymentRequested{
+					MessageID: fmt.Sprintf("m%d", i), Type: dto.EventRefundRequested,
+					OrderID: r.orderID, UserID: userID, Amount: r.amount, RefundID: r.id,
+				})
+				if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a, _ := store.GetAccount(ctx, userID)
+			if a.Balance != tt.wantBalance {
+				t.Fatalf("balance = %d, want %d", a.Balance, tt.wantBalance)
+			}
+			outbox := store.Outbox()[1:]
+			if len(outbox) != len(tt.wantResults) {
+				t.Fatalf("outbox has %d refund results, want %d", len(outbox), len(tt.wantResults))
+			}
+			for i, e := range outbox {
+				var res dto.PaymentResult
+				_ = json.Unmarshal(e.Payload, &res)
+				if res.Type != dto.EventRefundResult || res.Status != tt.wantResults[i] || res.RefundedAmount != tt.wantRefunded[i] {
+					t.Fatalf("result %d = %s %s refunded %d, want %s refunded %d",
+						i, res.Type, res.Status, res.RefundedAmount, tt.wantResults[i], tt.wantRefunded[i])
+				}
+				if res.Status == dto.RefundRejected && res.Reason != tt.wantReason {
+					t.Fatalf("reason = %q, want %q", res.Reason, tt.wantReason)
+				}
+			}
+		})
+	}
+}
+
+func TestFXPayments(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	rates, err := fx.NewTable(map[string]string{"USD/RUB": "92.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type command struct {
+		typ      string
+		orderID  string
+		amount   int64
+		currency string
+	}
+	pay := func(orderID string, amount int64, currency string) command {
+		return command{dto.EventPaymentRequested, orderID, amount, currency}
+	}
+	refund := func(orderID string, amount int64) command {
+		return command{dto.EventRefundRequested, orderID, amount, "USD"}
+	}
+
+	tests := []struct {
+		name        string
+		rounding    string
+		manual      bool
+		commands    []command
+		wantBalance int64
+		wantHeld    int64
+		wantResults []string
+		wantFX      *dto.FX
+		wantReason  string
+	}{
+		{
+			name:        "converts and rounds half up",
+			rounding:    fx.RoundHalfUp,
+			commands:    []command{pay("o1", 1001, "USD")},
+			wantBalance: 100000 - 92593,
+			wantResults: []string{"FINISHED"},
+			wantFX:      &dto.FX{Rate: "92.5", ChargedAmount: 92593, ChargedCurrency: "RUB"},
+		},
+		{
+			name:        "rounds down",
+			rounding:    fx.RoundDown,
+			commands:    []command{pay("o1", 1001, "USD")},
+			wantBalance: 100000 - 92592,
+			wantResults: []string{"FINISHED"},
+			wantFX:      &dto.FX{Rate: "92.5", ChargedAmount: 92592, ChargedCurrency: "RUB"},
+		},
+		{
+			name:        "pair without rate is declined",
+			commands:    []command{pay("o1", 100, "KZT")},
+			wantBalance: 100000,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonCurrencyMismatch,
+		},
+		{
+			name:        "converted amount over balance is declined",
+			commands:    []command{pay("o1", 1100, "USD")},
+			wantBalance: 100000,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonInsufficientFunds,
+		},
+		{
+			name:        "hold is placed and captured in the charged wallet",
+			manual:      true,
+			commands:    []command{pay("o1", 1000, "USD"), {dto.EventCaptureRequested, "o1", 0, ""}},
+			wantBalance: 100000 - 92500,
+			wantResults: []string{"AUTHORIZED", "FINISHED"},
+			wantFX:      &dto.FX{Rate: "92.5", ChargedAmount: 92500, ChargedCurrency: "RUB"},
+		},
+		{
+			name:        "hold is released in the charged wallet",
+			manual:      true,
+			commands:    []command{pay("o1", 1000, "USD"), {dto.EventVoidRequested, "o1", 0, ""}},
+			wantBalance: 100000,
+			wantResults: []string{"AUTHORIZED", "VOIDED"},
+			wantReason:  repository.ReasonVoidRequested,
+		},
+		{
+			name:        "partial refunds return exactly what was charged",
+			commands:    []command{pay("o1", 1001, "USD"), refund("o1", 500), refund("o1", 501)},
+			wantBalance: 100000,
+			wantResults: []string{"FINISHED", dto.RefundSucceeded, dto.RefundSucceeded},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.result")
+			store.SetFX(rates, cmp.Or(tt.rounding, fx.RoundHalfUp))
+			_ = store.Create(ctx, userID, "RUB", 100000)
+
+			for i, c := range tt.commands {
+				req := dto.PaymentRequested{
+					MessageID: fmt.Sprintf("m%d", i), Type: c.typ, OrderID: c.orderID, UserID: userID,
+					Amount: c.amount, Currency: c.currency, RefundID: fmt.Sprintf("r%d", i),
+				}
+				if tt.manual {
+					req.CaptureMethod = dto.CaptureManual
+				}
+				raw, _ := json.Marshal(req)
+				if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a, _ := store.GetAccount(ctx, userID)
+			if a.Balance != tt.wantBalance || a.Held != tt.wantHeld {
+				t.Fatalf("RUB balance = %d, held = %d; want %d, %d", a.Balance, a.Held, tt.wantBalance, tt.wantHeld)
+			}
+			outbox := store.Outbox()
+			if len(outbox) != len(tt.wantResults) {
+				t.Fatalf("outbox has %d results, want %d", len(outbox), len(tt.wantResults))
+			}
+			var last dto.PaymentResult
+			for i, e := range outbox {
+				_ = json.Unmarshal(e.Payload, &last)
+				if last.Status != tt.wantResults[i] {
+					t.Fatalf("result %d = %s, want %s", i, last.Status, tt.wantResults[i])
+				}
+			}
+			if last.Reason != tt.wantReason {
+				t.Fatalf("reason = %q, want %q", last.Reason, tt.wantReason)
+			}
+			if tt.wantFX != nil && (last.FX == nil || *last.FX != *tt.wantFX) {
+				t.Fatalf("fx = %+v, want %+v", last.FX, tt.wantFX)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	rates, err := fx.NewTable(map[string]string{"USD/RUB": "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type command struct {
+		typ      string
+		orderID  string
+		amount   int64
+		currency string
+	}
+	pay := func(orderID string, amount int64) command {
+		return command{dto.EventPaymentRequested, orderID, amount, "RUB"}
+	}
+
+	tests := []struct {
+		name        string
+		limits      repository.Limits
+		manual      bool
+		commands    []command
+		wantBalance int64
+		wantHeld    int64
+		wantResults []string
+		wantReason  string
+	}{
+		{
+			name:        "order over max amount",
+			limits:      repository.Limits{Currency: "RUB", MaxOrderAmount: 500},
+			commands:    []command{pay("o1", 500), pay("o2", 501)},
+			wantBalance: 9500,
+			wantResults: []string{"FINISHED", "FAILED"},
+			wantReason:  repository.ReasonOrderAmountLimit,
+		},
+		{
+			name:        "daily spend",
+			limits:      repository.Limits{Currency: "RUB", DailyAmount: 1000, MonthlyAmount: 5000},
+			commands:    []command{pay("o1", 600), pay("o2", 400), pay("o3", 1)},
+			wantBalance: 9000,
+			wantResults: []string{"FINISHED", "FINISHED", "FAILED"},
+			wantReason:  repository.ReasonDailyLimit,
+		},
+		{
+			name:        "monthly spend",
+			limits:      repository.Limits{Currency: "RUB", MonthlyAmount: 1000},
+			commands:    []command{pay("o1", 1000), pay("o2", 1)},
+			wantBalance: 9000,
+			wantResults: []string{"FINISHED", "FAILED"},
+			wantReason:  repository.ReasonMonthlyLimit,
+		},
+		{
+			name:        "orders per window",
+			limits:      repository.Limits{Currency: "RUB", MaxOrders: 2, OrdersWindow: time.Minute},
+			commands:    []command{pay("o1", 1), pay("o2", 1), pay("o3", 1)},
+			wantBalance: 9998,
+			wantResults: []string{"FINISHED", "FINISHED", "FAILED"},
+			wantReason:  repository.ReasonVelocityLimit,
+		},
+		{
+			name:        "active holds count towards spend",
+			limits:      repository.Limits{Currency: "RUB", DailyAmount: 1000},
+			manual:      true,
+			commands:    []command{pay("o1", 800), pay("o2", 300)},
+			wantBalance: 10000,
+			wantHeld:    800,
+			wantResults: []string{"AUTHORIZED", "FAILED"},
+			wantReason:  repository.ReasonDailyLimit,
+		},
+		{
+			name:   "voided hold frees the limit",
+			limits: repository.Limits{Currency: "RUB", DailyAmount: 1000},
+			manual: true,
+			commands: []command{
+				pay("o1", 800), {dto.EventVoidRequested, "o1", 0, ""}, pay("o2", 1000), {dto.EventCaptureRequested, "o2", 0, ""},
+			},
+			wantBalance: 9000,
+			wantResults: []string{"AUTHORIZED", "VOIDED", "AUTHORIZED", "FINISHED"},
+		},
+		{
+			name:        "converted charge counts in the wallet currency",
+			limits:      repository.Limits{Currency: "RUB", MaxOrderAmount: 5000},
+			commands:    []command{{dto.EventPaymentRequested, "o1", 51, "USD"}},
+			wantBalance: 10000,
+			wantResults: []string{"FAILED"},
+			wantReason:  repository.ReasonOrderAmountLimit,
+		},
+		{
+			name:        "amount limits in another currency do not apply",
+			limits:      repository.Limits{Currency: "USD", MaxOrderAmount: 1},
+			commands:    []command{pay("o1", 100)},
+			wantBalance: 9900,
+			wantResults: []string{"FINISHED"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New("payment.result")
+			store.SetFX(rates, fx.RoundHalfUp)
+			_ = store.Create(ctx, userID, "RUB", 10000)
+			if _, err := store.SetLimits(ctx, userID, tt.limits, true); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range tt.commands {
+				req := dto.PaymentRequested{
+					MessageID: fmt.Sprintf("m%d", i), Type: c.typ, OrderID: c.orderID, UserID: userID,
+					Amount: c.amount, Currency: c.currency,
+				}
+				if tt.manual {
+					req.CaptureMethod = dto.CaptureManual
+				}
+				raw, _ := json.Marshal(req)
+				if _, err := store.HandlePaymentRequested(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a, _ := store.GetAccount(ctx, userID)
+			if a.Balance != tt.wantBalance || a.Held != tt.wantHeld {
+				t.Fatalf("balance = %d, held = %d; want %d, %d", a.Balance, a.Held, tt.wantBalance, tt.wantHeld)
+			}
+			outbox := store.Outbox()
+			if len(outbox) != len(tt.wantResults) {
+				t.Fatalf("outbox has %d results, want %d", len(outbox), len(tt.wantResults))
+			}
+			var last dto.PaymentResult
+			for i, e := range outbox {
+				last = dto.PaymentResult{}
+				_ = json.Unmarshal(e.Payload, &last)
+				if last.Status != tt.wantResults[i] {
+					t.Fatalf("result %d = %s (%s), want %s", i, last.Status, last.Reason, tt.wantResults[i])
+				}
+			}
+			if last.Reason != tt.wantReason {
+				t.Fatalf("reason = %q, want %q", last.Reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -3,36 +3,41 @@ package worker
 import (
 	"context"
 	"log"
-	"os"
-	"strconv"
+	"time"
 
-	kafkago "github.com/segmentio/kafka-go"
-
-	"HW4/internal/common/kafka"
-	"HW4/internal/payments/repository"
+	"HW4/internal/common/broker"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/payments/config"
 )
 
-type PaymentRequestedConsumer struct {
-	consumer   *kafka.Consumer
-	processor  *repository.PaymentProcessor
-	producer   *kafka.Producer
-	retryTopic string
-	dlqTopic   string
-	retryMax   int
+// PaymentHandler обрабатывает событие запроса на оплату.
+// Возвращает true, если сообщение уже было обработано ранее (дубликат).
+type PaymentHandler interface {
+	HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error)
 }
 
-func NewPaymentRequestedConsumer(consumer *kafka.Consumer, processor *repository.PaymentProcessor, producer *kafka.Producer) *PaymentRequestedConsumer {
-	retryMax := mustIntEnv("KAFKA_RETRY_MAX")
-	retryTopic := mustEnv("KAFKA_RETRY_TOPIC")
-	dlqTopic := mustEnv("KAFKA_DLQ_TOPIC")
+// PaymentRequestedConsumer читает запросы на оплату — исходные или
+// повторные из retry-топика. Повторный запрос обрабатывается не раньше, чем
+// истечёт пауза для его retry_count, отсчитанная от публикации.
+type PaymentRequestedConsumer struct {
+	consumer     broker.Subscriber
+	processor    PaymentHandler
+	producer     broker.Publisher
+	retryTopic   string
+	dlqTopic     string
+	retryMax     int
+	retryBackoff time.Duration
+}
 
+func NewPaymentRequestedConsumer(consumer broker.Subscriber, processor PaymentHandler, producer broker.Publisher, retry config.RetryConfig) *PaymentRequestedConsumer {
 	return &PaymentRequestedConsumer{
-		consumer:   consumer,
-		processor:  processor,
-		producer:   producer,
-		retryTopic: retryTopic,
-		dlqTopic:   dlqTopic,
-		retryMax:   retryMax,
+		consumer:     consumer,
+		processor:    processor,
+		producer:     producer,
+		retryTopic:   retry.Topic,
+		dlqTopic:     retry.DLQTopic,
+		retryMax:     retry.MaxAttempts,
+		retryBackoff: retry.Backoff,
 	}
 }
 
@@ -46,31 +51,64 @@ func (c *PaymentRequestedConsumer) Run(ctx context.Context) {
 			log.Printf("[payments-consumer] fetch error: %v", err)
 			continue
 		}
-
-		already, err := c.processor.HandlePaymentRequested(ctx, msg.Value)
-		if err != nil {
-			c.handleFailure(ctx, msg, err)
-			continue
+		// при остановке повтор остаётся незакоммиченным и придёт снова
+		if !c.waitRetry(ctx, msg) {
+			return
 		}
 
-		if err := c.consumer.Commit(ctx, msg); err != nil {
-			log.Printf("[payments-consumer] commit error: %v", err)
-			continue
-		}
+		// Полученное сообщение обрабатываем и коммитим даже после сигнала
+		// остановки, но не дольше дедлайна shutdown.
+		workCtx, cancel := lifecycle.InFlight(ctx)
+		c.handle(workCtx, msg)
+		cancel()
+	}
+}
 
-		if already {
-			log.Printf("[payments-consumer] duplicate ignored")
-		} else {
-			log.Printf("[payments-consumer] processed order=%s", string(msg.Key))
-		}
+func (c *PaymentRequestedConsumer) handle(ctx context.Context, msg broker.Message) {
+	already, err := c.processor.HandlePaymentRequested(ctx, msg.Value)
+	if err != nil {
+		c.handleFailure(ctx, msg, err)
+		return
+	}
+
+	if err := c.consumer.Commit(ctx, msg); err != nil {
+		log.Printf("[payments-consumer] commit error: %v", err)
+		return
+	}
+
+	if already {
+		log.Printf("[payments-consumer] duplicate ignored")
+	} else {
+		log.Printf("[payments-consumer] processed order=%s", string(msg.Key))
+	}
+}
+
+// waitRetry ждёт, пока повторному запросу msg не подойдёт время: пауза
+// retryBackoff удваивается с каждой попыткой. false — ctx отменён раньше.
+func (c *PaymentRequestedConsumer) waitRetry(ctx context.Context, msg broker.Message) bool {
+	n := broker.GetRetryCount(msg)
+	if n == 0 {
+		return true
+	}
+	d := time.Until(msg.Time.Add(c.retryBackoff << (n - 1)))
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
 	}
 }
 
-func (c *PaymentRequestedConsumer) handleFailure(ctx context.Context, msg kafkago.Message, cause error) {
-	retryCount := kafka.GetRetryCount(msg)
+func (c *PaymentRequestedConsumer) handleFailure(ctx context.Context, msg broker.Message, cause error) {
+	retryCount := broker.GetRetryCount(msg)
 
 	if retryCount < c.retryMax {
-		newHeaders := kafka.WithRetryCount(msg.Headers, retryCount+1)
+		newHeaders := broker.WithRetryCount(msg.Headers, retryCount+1)
 		pubErr := c.producer.PublishWithHeaders(ctx, c.retryTopic, msg.Key, msg.Value, newHeaders)
 		if pubErr != nil {
 			log.Printf("[payments-consumer] retry publish failed: %v (orig err=%v)", pubErr, cause)
@@ -86,7 +124,7 @@ func (c *PaymentRequestedConsumer) handleFailure(ctx context.Context, msg kafkag
 		return
 	}
 
-	newHeaders := kafka.WithRetryCount(msg.Headers, retryCount)
+	newHeaders := broker.WithRetryCount(msg.Headers, retryCount)
 	pubErr := c.producer.PublishWithHeaders(ctx, c.dlqTopic, msg.Key, msg.Value, newHeaders)
 	if pubErr != nil {
 		log.Printf("[payments-consumer] dlq publish failed: %v (orig err=%v)", pubErr, cause)
@@ -100,20 +138,3 @@ func (c *PaymentRequestedConsumer) handleFailure(ctx context.Context, msg kafkag
 
 	log.Printf("[payments-consumer] moved to DLQ topic=%s retry_count=%d cause=%v", c.dlqTopic, retryCount, cause)
 }
-
-func mustEnv(k string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		panic("missing env " + k)
-	}
-	return v
-}
-
-func mustIntEnv(k string) int {
-	raw := mustEnv(k)
-	n, err := strconv.Atoi(raw)
-	if err != nil || n < 0 {
-		panic("bad int env " + k + "=" + raw)
-	}
-	return n
-}
@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"HW4/internal/common/broker"
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/payments/config"
+)
+
+type stubHandler struct {
+	err   error
+	calls int
+}
+
+func (h *stubHandler) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
+	h.calls++
+	return false, h.err
+}
+
+// scriptedHandler отвечает ошибками из errs по очереди, дальше — успехом, и
+// запоминает время вызовов.
+type scriptedHandler struct {
+	mu    sync.Mutex
+	errs  []error
+	calls []time.Time
+}
+
+func (h *scriptedHandler) HandlePaymentRequested(ctx context.Context, raw []byte) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, time.Now())
+	var err error
+	if len(h.errs) > 0 {
+		err, h.errs = h.errs[0], h.errs[1:]
+	}
+	return false, err
+}
+
+func (h *scriptedHandler) Calls() []time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]time.Time(nil), h.calls...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var retryCfg = config.RetryConfig{MaxAttempts: 2, Topic: "req.retry", DLQTopic: "req.dlq"}
+
+func TestPaymentRequestedConsumerRouting(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		handlerErr   error
+		retryCount   int
+		wantTopic    string
+		wantRetryHdr int
+	}{
+		{name: "success is committed", handlerErr: nil},
+		{name: "first failure goes to retry", handlerErr: errors.New("db down"), retryCount: 0, wantTopic: "req.retry", wantRetryHdr: 1},
+		{name: "next failure bumps counter", handlerErr: errors.New("db down"), retryCount: 1, wantTopic: "req.retry", wantRetryHdr: 2},
+		{name: "exhausted retries go to dlq", handlerErr: errors.New("db down"), retryCount: 2, wantTopic: "req.dlq", wantRetryHdr: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := membroker.New(1)
+			_ = b.PublishWithHeaders(context.Background(), "req", []byte("order-1"), []byte(`{}`),
+				broker.WithRetryCount(nil, tt.retryCount))
+
+			h := &stubHandler{err: tt.handlerErr}
+			c := NewPaymentRequestedConsumer(b.Subscribe("req", "payments"), h, b, retryCfg)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() { c.Run(ctx); close(done) }()
+
+			waitFor(t, func() bool { return b.Lag("req", "payments") == 0 })
+			cancel()
+			<-done
+
+			if h.calls != 1 {
+				t.Fatalf("handler called %d times, want 1", h.calls)
+			}
+			for _, topic := range []string{"req.retry", "req.dlq"} {
+				msgs := b.Messages(topic)
+				if topic != tt.wantTopic {
+					if len(msgs) != 0 {
+						t.Fatalf("unexpected %d message(s) in %s", len(msgs), topic)
+					}
+					continue
+				}
+				if len(msgs) != 1 {
+					t.Fatalf("%s has %d messages, want 1", topic, len(msgs))
+				}
+				if got := broker.GetRetryCount(msgs[0]); got != tt.wantRetryHdr {
+					t.Fatalf("retry_count = %d, want %d", got, tt.wantRetryHdr)
+				}
+				if string(msgs[0].Key) != "order-1" {
+					t.Fatalf("key = %s, want order-1", msgs[0].Key)
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentRetryWaitsForBackoff(t *testing.T) {
+	const backoff = 40 * time.Millisecond
+	cfg := retryCfg
+	cfg.Backoff = backoff
+
+	tests := []struct {
+		name       string
+		retryCount int
+		wantDelay  time.Duration
+	}{
+		{name: "first retry", retryCount: 1, wantDelay: backoff},
+		{name: "second retry doubles", retryCount: 2, wantDelay: 2 * backoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := membroker.New(1)
+			published := time.Now()
+			_ = b.PublishWithHeaders(context.Background(), "req.retry", []byte("order-1"), []byte(`{}`),
+				broker.WithRetryCount(nil, tt.retryCount))
+
+			h := &scriptedHandler{}
+			c := NewPaymentRequestedConsumer(b.Subscribe("req.retry", "payments"), h, b, cfg)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() { c.Run(ctx); close(done) }()
+			waitFor(t, func() bool { return b.Lag("req.retry", "payments") == 0 })
+			cancel()
+			<-done
+
+			calls := h.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("handler called %d times, want 1", len(calls))
+			}
+			if d := calls[0].Sub(published); d < tt.wantDelay {
+				t.Fatalf("retry handled after %v, want at least %v", d, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestPaymentRetryStopsWhileWaiting(t *testing.T) {
+	cfg := retryCfg
+	cfg.Backoff = time.Hour
+
+	b := membroker.New(1)
+	_ = b.PublishWithHeaders(context.Background(), "req.retry", []byte("order-1"), []byte(`{}`),
+		broker.WithRetryCount(nil, 1))
+
+	h := &scriptedHandler{}
+	c := NewPaymentRequestedConsumer(b.Subscribe("req.retry", "payments"), h, b, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { c.Run(ctx); close(done) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not stop while waiting for backoff")
+	}
+
+	if n := len(h.Calls()); n != 0 {
+		t.Fatalf("handler called %d times, want 0", n)
+	}
+	if lag := b.Lag("req.retry", "payments"); lag != 1 {
+		t.Fatalf("lag = %d, want 1: the retry must be redelivered", lag)
+	}
+}
+
+// TestPaymentRetryConsumer: запрос, упавший в основном consumer'е, проходит
+// через retry-топик и обрабатывается вторым consumer'ом после паузы.
+func TestPaymentRetryConsumer(t *testing.T) {
+	const backoff = 30 * time.Millisecond
+	cfg := retryCfg
+	cfg.Backoff = backoff
+
+	b := membroker.New(1)
+	_ = b.Publish(context.Background(), "req", []byte("order-1"), []byte(`{}`))
+
+	h := &scriptedHandler{errs: []error{errors.New("db down")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, topic := range []string{"req", "req.retry"} {
+		c := NewPaymentRequestedConsumer(b.Subscribe(topic, "payments"), h, b, cfg)
+		wg.Add(1)
+		go func() { defer wg.Done(); c.Run(ctx) }()
+	}
+	waitFor(t, func() bool { return len(h.Calls()) == 2 && b.Lag("req.retry", "payments") == 0 })
+	cancel()
+	wg.Wait()
+
+	calls := h.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("handler called %d times, want 2", len(calls))
+	}
+	if d := calls[1].Sub(calls[0]); d < backoff {
+		t.Fatalf("retry handled %v after the failure, want at least %v", d, backoff)
+	}
+	if n := len(b.Messages("req.retry")); n != 1 {
+		t.Fatalf("retry topic has %d messages, want 1", n)
+	}
+	if n := len(b.Messages("req.dlq")); n != 0 {
+		t.Fatalf("dlq has %d messages, want 0", n)
+	}
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"HW4/internal/common/broker"
+	"HW4/internal/common/lifecycle"
+	"HW4/internal/payments/config"
+	"HW4/internal/payments/dto"
+	"HW4/internal/payments/payout"
+	"HW4/internal/payments/repository"
+)
+
+// PayoutProvider отправляет выплату во внешнюю систему. Вызов должен быть
+// идемпотентным по withdrawal_id: если завершить вывод не удалось или исход
+// неизвестен, команда придёт повторно. Окончательный отказ — ошибка,
+// оборачивающая payout.ErrDeclined; любая другая ошибка, включая таймаут,
+// значит, что выплата могла пройти.
+type PayoutProvider interface {
+	Payout(ctx context.Context, req dto.PayoutRequested) error
+}
+
+// WithdrawalStore завершает вывод только из PENDING, поэтому повторная
+// доставка команды не спишет деньги дважды.
+type WithdrawalStore interface {
+	GetWithdrawal(ctx context.Context, id string) (repository.Withdrawal, error)
+	CompleteWithdrawal(ctx context.Context, id, status, reason string) (bool, error)
+}
+
+// PayoutConsumer читает команды на выплату, вызывает провайдера и по его
+// ответу списывает захолдированную сумму или снимает холд. Без ответа вывод
+// остаётся PENDING, повтор отправляет PayoutRetrier.
+type PayoutConsumer struct {
+	consumer broker.Subscriber
+	provider PayoutProvider
+	store    WithdrawalStore
+	timeout  time.Duration
+}
+
+func NewPayoutConsumer(consumer broker.Subscriber, provider PayoutProvider, store WithdrawalStore, cfg config.PayoutConfig) *PayoutConsumer {
+	return &PayoutConsumer{consumer: consumer, provider: provider, store: store, timeout: cfg.Timeout}
+}
+
+func (c *PayoutConsumer) Run(ctx context.Context) {
+	for {
+		msg, err := c.consumer.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[payout-consumer] fetch error: %v", err)
+			continue
+		}
+
+		// Полученное сообщение обрабатываем и коммитим даже после сигнала
+		// остановки, но не дольше дедлайна shutdown.
+		workCtx, cancel := lifecycle.InFlight(ctx)
+		c.handle(workCtx, msg)
+		cancel()
+	}
+}
+
+func (c *PayoutConsumer) handle(ctx context.Context, msg broker.Message) {
+	var req dto.PayoutRequested
+	if err := json.Unmarshal(msg.Value, &req); err != nil {
+		log.Printf("[payout-consumer] bad json: %v; value=%s", err, string(msg.Value))
+		_ = c.consumer.Commit(ctx, msg) // чтобы не зациклиться
+		return
+	}
+
+	status, reason, err := c.process(ctx, req)
+	if err != nil {
+		log.Printf("[payout-consumer] db error: %v", err)
+		return
+	}
+
+	if err := c.consumer.Commit(ctx, msg); err != nil {
+		log.Printf("[payout-consumer] commit error: %v", err)
+		return
+	}
+
+	log.Printf("[payout-consumer] withdrawal=%s status=%s reason=%s", req.WithdrawalID, status, reason)
+}
+
+// process вызывает провайдера, если вывод ещё PENDING, и возвращает итоговый
+// статус вывода. Холд снимается только при окончательном отказе провайдера:
+// после таймаута деньги могли уйти, и вывод ждёт повтора в PENDING.
+func (c *PayoutConsumer) process(ctx context.Context, req dto.PayoutRequested) (string, string, error) {
+	w, err := c.store.GetWithdrawal(ctx, req.WithdrawalID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", "unknown_withdrawal", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if w.Status != repository.WithdrawalPending {
+		return w.Status, w.Reason, nil
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	err = c.provider.Payout(callCtx, req)
+	cancel()
+
+	status, reason := repository.WithdrawalSucceeded, ""
+	switch {
+	case errors.Is(err, payout.ErrDeclined):
+		status, reason = repository.WithdrawalFailed, repository.ReasonPayoutFailed
+	case err != nil:
+		log.Printf("[payout-consumer] withdrawal=%s outcome unknown, will retry: %v", req.WithdrawalID, err)
+		return repository.WithdrawalPending, "", nil
+	}
+
+	if _, err := c.store.CompleteWithdrawal(ctx, req.WithdrawalID, status, reason); err != nil {
+		return "", "", err
+	}
+	return status, reason, nil
+}
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"HW4/internal/common/broker/membroker"
+	"HW4/internal/payments/config"
+	"HW4/internal/payments/payout"
+	"HW4/internal/payments/repository"
+	"HW4/internal/payments/repository/memstore"
+)
+
+var _ WithdrawalStore = (*memstore.Store)(nil)
+
+type failingWithdrawalStore struct{ *memstore.Store }
+
+func (failingWithdrawalStore) CompleteWithdrawal(ctx context.Context, id, status, reason string) (bool, error) {
+	return false, errors.New("db down")
+}
+
+// withdraw создаёт вывод 100 со счёта с балансом 500 и переносит команду на
+// выплату из outbox в брокер. Повторы выплаты идут по расписанию retry.
+func withdraw(t *testing.T, b *membroker.Broker, retry repository.PayoutRetry) (*memstore.Store, repository.Withdrawal) {
+	t.Helper()
+	ctx := context.Background()
+	store := memstore.New("payment.result")
+	store.SetPayoutTopic("payout")
+	store.SetPayoutRetry(retry)
+	_ = store.Create(ctx, "11111111-1111-1111-1111-111111111111", "RUB", 500)
+	w, err := store.CreateWithdrawal(ctx, "11111111-1111-1111-1111-111111111111", "RUB", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range store.Outbox() {
+		_ = b.Publish(ctx, e.Topic, []byte(e.Key), e.Payload)
+	}
+	return store, w
+}
+
+func TestPayoutConsumerCompletesWithdrawal(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		wantStatus  string
+		wantReason  string
+		wantBalance int64
+		wantHeld    int64
+	}{
+		{name: "succeed", mode: payout.ModeSucceed, wantStatus: repository.WithdrawalSucceeded, wantBalance: 400},
+		{name: "fail", mode: payout.ModeFail, wantStatus: repository.WithdrawalFailed, wantReason: repository.ReasonPayoutFailed, wantBalance: 500},
+		// выплата могла пройти: холд остаётся до ответа провайдера
+		{name: "timeout", mode: payout.ModeTimeout, wantStatus: repository.WithdrawalPending, wantBalance: 500, wantHeld: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := membroker.New(1)
+			store, w := withdraw(t, b, repository.DefaultPayoutRetry)
+			// повторная доставка команды не должна списать деньги второй раз
+			msgs := b.Messages("payout")
+			_ = b.Publish(context.Background(), "payout", msgs[0].Key, msgs[0].Value)
+
+			c := NewPayoutConsumer(b.Subscribe("payout", "payments"), payout.NewFake(tt.mode, 0), store,
+				config.PayoutConfig{Timeout: 20 * time.Millisecond})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() { c.Run(ctx); close(done) }()
+			waitFor(t, func() bool { return b.Lag("payout", "payments") == 0 })
+			cancel()
+			<-done
+
+			got, _ := store.GetWithdrawal(context.Background(), w.ID)
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+				t.Fatalf("withdrawal = %s/%s, want %s/%s", got.Status, got.Reason, tt.wantStatus, tt.wantReason)
+			}
+			if a, _ := store.GetAccount(context.Background(), w.UserID); a.Balance != tt.wantBalance || a.Held != tt.wantHeld {
+				t.Fatalf("balance = %d, held = %d; want %d, %d", a.Balance, a.Held, tt.wantBalance, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestPayoutConsumerDBErrorLeavesMessageUncommitted(t *testing.T) {
+	b := membroker.New(1)
+	store, _ := withdraw(t, b, repository.DefaultPayoutRetry)
+
+	sub := b.Subscribe("payout", "payments")
+	c := NewPayoutConsumer(sub, payout.NewFake(payout.ModeSucceed, 0), failingWithdrawalStore{store},
+		config.PayoutConfig{Timeout: time.Second})
+	msg, err := sub.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handle(context.Background(), msg)
+
+	if lag := b.Lag("payout", "payments"); lag != 1 {
+		t.Fatalf("lag = %d, want 1: failed message must be redelivered", lag)
+	}
+}
+
+func TestPayoutRetryAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+	b := membroker.New(1)
+	const backoff = 100 * time.Millisecond
+	store, w := withdraw(t, b, repository.PayoutRetry{Backoff: backoff, MaxBackoff: time.Hour, MaxAttempts: 5})
+	cfg := config.PayoutConfig{Timeout: 20 * time.Millisecond, RetryBatchSize: 10}
+
+	sub := b.Subscribe("payout", "payments")
+	consume := func(mode string) {
+		t.Helper()
+		msg, err := sub.Fetch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewPayoutConsumer(sub, payout.NewFake(mode, 0), store, cfg).handle(ctx, msg)
+	}
+
+	consume(payout.ModeTimeout)
+	if got, _ := store.GetWithdrawal(ctx, w.ID); got.Status != repository.WithdrawalPending {
+		t.Fatalf("after timeout: status %s, want PENDING", got.Status)
+	}
+
+	// свежий вывод не повторяем: ответ ещё может прийти
+	retrier := NewPayoutRetrier(store, cfg)
+	if err := retrier.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.Outbox()); n != 1 {
+		t.Fatalf("outbox has %d commands, want 1", n)
+	}
+
+	time.Sleep(backoff)
+	if err := retrier.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	outbox := store.Outbox()
+	if len(outbox) != 2 || outbox[1].Key != w.ID {
+		t.Fatalf("outbox = %+v, want a second command for %s", outbox, w.ID)
+	}
+	got, _ := store.GetWithdrawal(ctx, w.ID)
+	if got.Attempts != 2 || got.NextAttemptAt.Sub(got.UpdatedAt) != 2*backoff {
+		t.Fatalf("attempts = %d, next attempt in %v; want 2, %v", got.Attempts, got.NextAttemptAt.Sub(got.UpdatedAt), 2*backoff)
+	}
+
+	// следующий повтор — только после удвоенной паузы
+	if err := retrier.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.Outbox()); n != 2 {
+		t.Fatalf("outbox has %d commands, want 2", n)
+	}
+	_ = b.Publish(ctx, outbox[1].Topic, []byte(outbox[1].Key), outbox[1].Payload)
+
+	// провайдер ответил на повтор с тем же withdrawal_id
+	consume(payout.ModeSucceed)
+	got, _ = store.GetWithdrawal(ctx, w.ID)
+	if got.Status != repository.WithdrawalSucceeded {
+		t.Fatalf("after retry: status %s, want SUCCEEDED", got.Status)
+	}
+	if a, _ := store.GetAccount(ctx, w.UserID); a.Balance != 400 || a.Held != 0 {
+		t.Fatalf("balance = %d, held = %d; want 400, 0", a.Balance, a.Held)
+	}
+}
+
+func TestPayoutRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	b := membroker.New(1)
+	store, w := withdraw(t, b, repository.PayoutRetry{MaxAttempts: 3})
+	cfg := config.PayoutConfig{Timeout: 10 * time.Millisecond, RetryBatchSize: 10, RetryMaxAttempts: 3}
+
+	// провайдер не отвечает ни на одну попытку
+	sub := b.Subscribe("payout", "payments")
+	c := NewPayoutConsumer(sub, payout.NewFake(payout.ModeTimeout, 0), store, cfg)
+	retrier := NewPayoutRetrier(store, cfg)
+	for attempt := 1; attempt <= 3; attempt++ {
+		msg, err := sub.Fetch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.handle(ctx, msg)
+		if got, _ := store.GetWithdrawal(ctx, w.ID); got.Status != repository.WithdrawalPending || got.Attempts != attempt {
+			t.Fatalf("attempt %d: withdrawal %s after %d attempt(s), want PENDING", attempt, got.Status, got.Attempts)
+		}
+		if err := retrier.tick(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range store.Outbox()[attempt:] {
+			_ = b.Publish(ctx, e.Topic, []byte(e.Key), e.Payload)
+		}
+	}
+
+	if n := len(store.Outbox()); n != 3 {
+		t.Fatalf("outbox has %d commands, want 3", n)
+	}
+	got, _ := store.GetWithdrawal(ctx, w.ID)
+	if got.Status != repository.WithdrawalFailed || got.Reason != repository.ReasonPayoutUnconfirmed {
+		t.Fatalf("withdrawal = %s/%s, want %s/%s", got.Status, got.Reason, repository.WithdrawalFailed, repository.ReasonPayoutUnconfirmed)
+	}
+	if a, _ := store.GetAccount(ctx, w.UserID); a.Balance != 500 || a.Held != 0 {
+		t.Fatalf("balance = %d, held = %d; want 500, 0", a.Balance, a.Held)
+	}
+}
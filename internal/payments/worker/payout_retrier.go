@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"HW4/internal/payments/config"
+)
+
+// PayoutRetryStore заново ставит в outbox команды на выплату для выводов,
+// которые слишком долго остаются PENDING, а выводы с исчерпанными попытками
+// завершает как FAILED.
+type PayoutRetryStore interface {
+	RetryPayouts(ctx context.Context, limit int) (resent, failed int, err error)
+}
+
+// PayoutRetrier периодически повторяет выплаты, исход которых неизвестен:
+// провайдер не ответил, а холд снимать нельзя, пока он не откажет или не
+// кончатся попытки. Несколько реплик могут работать одновременно: строки
+// разбираются под SKIP LOCKED.
+type PayoutRetrier struct {
+	store PayoutRetryStore
+	cfg   config.PayoutConfig
+}
+
+func NewPayoutRetrier(store PayoutRetryStore, cfg config.PayoutConfig) *PayoutRetrier {
+	return &PayoutRetrier{store: store, cfg: cfg}
+}
+
+func (w *PayoutRetrier) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.tick(ctx); err != nil {
+				log.Printf("[payout-retrier] tick error: %v", err)
+			}
+		}
+	}
+}
+
+// tick разбирает пачки, пока очередная не окажется неполной.
+func (w *PayoutRetrier) tick(ctx context.Context) error {
+	for ctx.Err() == nil {
+		resent, failed, err := w.store.RetryPayouts(ctx, w.cfg.RetryBatchSize)
+		if err != nil {
+			return err
+		}
+		if resent > 0 {
+			log.Printf("[payout-retrier] re-sent %d payout(s)", resent)
+		}
+		if failed > 0 {
+			log.Printf("[payout-retrier] gave up on %d unconfirmed payout(s), holds released", failed)
+		}
+		if resent+failed < w.cfg.RetryBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
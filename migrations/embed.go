@@ -0,0 +1,28 @@
+// Package migrations встраивает SQL-миграции сервисов в бинарники.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed orders/*.sql
+var orders embed.FS
+
+//go:embed payments/*.sql
+var payments embed.FS
+
+//go:embed gateway/*.sql
+var gateway embed.FS
+
+func Orders() fs.FS   { return mustSub(orders, "orders") }
+func Payments() fs.FS { return mustSub(payments, "payments") }
+func Gateway() fs.FS  { return mustSub(gateway, "gateway") }
+
+func mustSub(fsys embed.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           UUID PRIMARY KEY,
+    owner        UUID NOT NULL,
+    name         TEXT NOT NULL DEFAULT '',
+    prefix       TEXT NOT NULL,
+    key_hash     TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NULL,
+    revoked_at   TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_owner ON api_keys(owner);
@@ -0,0 +1,8 @@
+-- старая схема не знает AUTHORIZED и VOIDED: такие заказы считаем неоплаченными
+UPDATE orders SET status = 'FAILED' WHERE status IN ('AUTHORIZED', 'VOIDED');
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('NEW', 'FINISHED', 'FAILED'));
+
+ALTER TABLE orders DROP COLUMN IF EXISTS capture_method;
@@ -0,0 +1,9 @@
+-- capture_method=manual: оплата сначала холдируется (AUTHORIZED), потом
+-- подтверждается (FINISHED) или отменяется (VOIDED).
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS capture_method TEXT NOT NULL DEFAULT 'automatic'
+        CHECK (capture_method IN ('automatic', 'manual'));
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('NEW', 'AUTHORIZED', 'FINISHED', 'FAILED', 'VOIDED'));
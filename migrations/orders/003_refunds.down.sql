@@ -0,0 +1,9 @@
+-- старая схема не знает статусов возврата: заказ остаётся оплаченным
+UPDATE orders SET status = 'FINISHED' WHERE status IN ('PARTIALLY_REFUNDED', 'REFUNDED');
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('NEW', 'AUTHORIZED', 'FINISHED', 'FAILED', 'VOIDED'));
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_refunded_amount_check;
+ALTER TABLE orders DROP COLUMN IF EXISTS refunded_amount;
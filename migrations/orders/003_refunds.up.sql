@@ -0,0 +1,13 @@
+-- Возвраты: refunded_amount — сколько всего вернули по подтверждённым
+-- возвратам. Частично возвращённый заказ — PARTIALLY_REFUNDED, полностью —
+-- REFUNDED.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_refunded_amount_check;
+ALTER TABLE orders ADD CONSTRAINT orders_refunded_amount_check
+    CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('NEW', 'AUTHORIZED', 'FINISHED', 'FAILED', 'VOIDED', 'PARTIALLY_REFUNDED', 'REFUNDED'));
@@ -0,0 +1,4 @@
+-- Валюта заказа, код ISO 4217. Суммы заказа — в её минорных единицах.
+-- Существующие заказы были в рублях; дальше валюту всегда передаёт сервис.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS fx_rate;
+ALTER TABLE orders DROP COLUMN IF EXISTS charged_currency;
+ALTER TABLE orders DROP COLUMN IF EXISTS charged_amount;
@@ -0,0 +1,6 @@
+-- Что фактически списано за заказ, если он оплачен из кошелька в другой
+-- валюте: сумма в минорных единицах charged_currency и курс конвертации.
+-- NULL — оплачено в валюте заказа.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS charged_amount BIGINT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS charged_currency CHAR(3);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fx_rate NUMERIC;
@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ACTIVE'
+        CHECK (status IN ('ACTIVE', 'FROZEN', 'CLOSED'));
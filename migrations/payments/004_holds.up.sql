@@ -0,0 +1,15 @@
+-- held — сумма активных холдов; доступно к списанию balance - held.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS held BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD CONSTRAINT accounts_held_check CHECK (held >= 0 AND held <= balance);
+
+CREATE TABLE IF NOT EXISTS holds (
+    order_id   UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES accounts(user_id),
+    amount     BIGINT NOT NULL CHECK (amount > 0),
+    status     TEXT NOT NULL CHECK (status IN ('ACTIVE', 'CAPTURED', 'VOIDED', 'EXPIRED')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_holds_expiry ON holds(expires_at) WHERE status = 'ACTIVE';
@@ -0,0 +1,15 @@
+-- Возвраты по оплаченным заказам. Пишутся и отклонённые: по таблице видно,
+-- что просили и почему отказали. Сумма SUCCEEDED по заказу не превышает
+-- amount из transactions — это проверяет PaymentProcessor под блокировкой
+-- строки transactions.
+CREATE TABLE IF NOT EXISTS refunds (
+    id         UUID PRIMARY KEY,
+    order_id   UUID NOT NULL,
+    user_id    UUID NOT NULL,
+    amount     BIGINT NOT NULL CHECK (amount > 0),
+    status     TEXT NOT NULL CHECK (status IN ('SUCCEEDED', 'REJECTED')),
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds(order_id);
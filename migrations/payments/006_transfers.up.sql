@@ -0,0 +1,22 @@
+-- Переводы между счетами. id задаёт клиент, он же ключ идемпотентности.
+CREATE TABLE IF NOT EXISTS transfers (
+    id           UUID PRIMARY KEY,
+    from_user_id UUID NOT NULL REFERENCES accounts(user_id),
+    to_user_id   UUID NOT NULL REFERENCES accounts(user_id),
+    amount       BIGINT NOT NULL CHECK (amount > 0),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (from_user_id <> to_user_id)
+);
+
+-- История переводов по счёту: списание с отрицательной суммой и зачисление
+-- с положительной, balance_after — баланс счёта сразу после проводки.
+CREATE TABLE IF NOT EXISTS transfer_entries (
+    transfer_id   UUID NOT NULL REFERENCES transfers(id),
+    user_id       UUID NOT NULL REFERENCES accounts(user_id),
+    amount        BIGINT NOT NULL CHECK (amount <> 0),
+    balance_after BIGINT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (transfer_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_entries_user_id ON transfer_entries(user_id, created_at);
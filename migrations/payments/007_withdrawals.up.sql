@@ -0,0 +1,13 @@
+-- Выводы средств. Пока вывод PENDING, сумма захолдирована на счёте:
+-- SUCCEEDED списывает её с баланса, FAILED возвращает в доступные.
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES accounts(user_id),
+    amount     BIGINT NOT NULL CHECK (amount > 0),
+    status     TEXT NOT NULL CHECK (status IN ('PENDING', 'SUCCEEDED', 'FAILED')),
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user_id ON withdrawals(user_id, created_at);
@@ -0,0 +1,15 @@
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS currency;
+ALTER TABLE transfers DROP COLUMN IF EXISTS currency;
+ALTER TABLE holds DROP COLUMN IF EXISTS currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+
+-- старая схема знает один баланс на счёт: остаётся кошелёк основной валюты,
+-- остальные теряются
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS balance BIGINT NOT NULL DEFAULT 0 CHECK (balance >= 0);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS held BIGINT NOT NULL DEFAULT 0;
+UPDATE accounts a SET balance = w.balance, held = w.held
+FROM wallets w WHERE w.user_id = a.user_id AND w.currency = a.currency;
+ALTER TABLE accounts ADD CONSTRAINT accounts_held_check CHECK (held >= 0 AND held <= balance);
+
+DROP TABLE IF EXISTS wallets;
+ALTER TABLE accounts DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,35 @@
+-- Мультивалютные счета. Деньги лежат в кошельках: по одному на пару
+-- (пользователь, валюта ISO 4217), суммы — в минорных единицах валюты.
+-- Статус остаётся у счёта и действует на все его кошельки; accounts.currency
+-- — основная валюта, в ней счёт создан.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE accounts ALTER COLUMN currency DROP DEFAULT;
+
+CREATE TABLE IF NOT EXISTS wallets (
+    user_id    UUID NOT NULL REFERENCES accounts(user_id),
+    currency   CHAR(3) NOT NULL,
+    balance    BIGINT NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    held       BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, currency),
+    CHECK (held >= 0 AND held <= balance)
+);
+
+INSERT INTO wallets(user_id, currency, balance, held, created_at, updated_at)
+SELECT user_id, currency, balance, held, created_at, updated_at FROM accounts
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_held_check;
+ALTER TABLE accounts DROP COLUMN IF EXISTS balance;
+ALTER TABLE accounts DROP COLUMN IF EXISTS held;
+
+-- Валюта денежных операций. Всё, что было до кошельков, — в рублях.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE transactions ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE holds ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE transfers ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE transfers ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE withdrawals ALTER COLUMN currency DROP DEFAULT;
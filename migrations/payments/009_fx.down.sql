@@ -0,0 +1,6 @@
+ALTER TABLE holds DROP COLUMN IF EXISTS fx_rate;
+ALTER TABLE holds DROP COLUMN IF EXISTS charged_currency;
+ALTER TABLE holds DROP COLUMN IF EXISTS charged_amount;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fx_rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS charged_currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS charged_amount;
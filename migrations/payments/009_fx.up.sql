@@ -0,0 +1,18 @@
+-- Оплата из кошелька в другой валюте. amount и currency у списаний и холдов
+-- остаются в валюте заказа, а charged_amount и charged_currency — то, что
+-- фактически списано или захолдировано в кошельке. fx_rate — курс
+-- конвертации (1 единица валюты заказа = fx_rate единиц charged_currency),
+-- NULL — оплачено в валюте заказа.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS charged_amount BIGINT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS charged_currency CHAR(3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC CHECK (fx_rate > 0);
+UPDATE transactions SET charged_amount = amount, charged_currency = currency WHERE charged_amount IS NULL;
+ALTER TABLE transactions ALTER COLUMN charged_amount SET NOT NULL;
+ALTER TABLE transactions ALTER COLUMN charged_currency SET NOT NULL;
+
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS charged_amount BIGINT;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS charged_currency CHAR(3);
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS fx_rate NUMERIC CHECK (fx_rate > 0);
+UPDATE holds SET charged_amount = amount, charged_currency = currency WHERE charged_amount IS NULL;
+ALTER TABLE holds ALTER COLUMN charged_amount SET NOT NULL;
+ALTER TABLE holds ALTER COLUMN charged_currency SET NOT NULL;
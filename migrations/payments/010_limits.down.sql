@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_holds_user_created;
+DROP INDEX IF EXISTS idx_transactions_user_created;
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id);
+DROP TABLE IF EXISTS account_limits;
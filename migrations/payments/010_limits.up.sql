@@ -0,0 +1,19 @@
+-- Лимиты расхода счёта. 0 — без ограничения. Суммы — в минорных единицах
+-- currency и действуют на списания из кошелька этой валюты; max_orders —
+-- сколько оплат допускается за orders_window_seconds. Строку блокирует
+-- каждая оплата счёта, поэтому расход считается по очереди.
+CREATE TABLE IF NOT EXISTS account_limits (
+    user_id               UUID PRIMARY KEY REFERENCES accounts(user_id),
+    currency              CHAR(3) NOT NULL,
+    max_order_amount      BIGINT NOT NULL DEFAULT 0 CHECK (max_order_amount >= 0),
+    daily_amount          BIGINT NOT NULL DEFAULT 0 CHECK (daily_amount >= 0),
+    monthly_amount        BIGINT NOT NULL DEFAULT 0 CHECK (monthly_amount >= 0),
+    max_orders            INT NOT NULL DEFAULT 0 CHECK (max_orders >= 0),
+    orders_window_seconds INT NOT NULL DEFAULT 0 CHECK (orders_window_seconds >= 0),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- расход за окно считается по списаниям и холдам счёта
+DROP INDEX IF EXISTS idx_transactions_user_id;
+CREATE INDEX IF NOT EXISTS idx_transactions_user_created ON transactions(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_holds_user_created ON holds(user_id, created_at);
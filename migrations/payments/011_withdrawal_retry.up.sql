@@ -0,0 +1,3 @@
+-- Выводы, по которым провайдер не ответил, остаются PENDING и периодически
+-- отправляются провайдеру повторно — самые давние первыми.
+CREATE INDEX IF NOT EXISTS idx_withdrawals_pending ON withdrawals(updated_at) WHERE status = 'PENDING';
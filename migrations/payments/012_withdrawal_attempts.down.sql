@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_withdrawals_next_attempt;
+CREATE INDEX IF NOT EXISTS idx_withdrawals_pending ON withdrawals(updated_at) WHERE status = 'PENDING';
+
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,8 @@
+-- Повторы выплат с неизвестным исходом: attempts — сколько раз команда ушла
+-- провайдеру, next_attempt_at — когда отправить её снова. Повторы идут с
+-- растущей паузой, после последней попытки вывод переводится в FAILED.
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 1;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+DROP INDEX IF EXISTS idx_withdrawals_pending;
+CREATE INDEX IF NOT EXISTS idx_withdrawals_next_attempt ON withdrawals(next_attempt_at) WHERE status = 'PENDING';